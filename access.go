@@ -0,0 +1,428 @@
+package cftoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AccessJWTHeader is the header Cloudflare Access adds to requests it lets
+// through to the origin.
+const AccessJWTHeader = "Cf-Access-Jwt-Assertion"
+
+// AccessConfig lets a vending endpoint sit behind Cloudflare Access and
+// decide what each Access identity may request.
+type AccessConfig struct {
+	// TeamDomain is the Zero Trust team domain, e.g.
+	// "example.cloudflareaccess.com".
+	TeamDomain string `yaml:"team_domain"`
+	// Audience is the Access application's AUD tag.
+	Audience string `yaml:"audience"`
+	// Grants list what matching identities may request. A request is
+	// allowed if any one grant covers all of it.
+	Grants []AccessGrant `yaml:"grants"`
+}
+
+// AccessGrant allows the identities it matches to request Services (bundles
+// expand; "*" for any) on Scopes ("*" or empty for any) at Levels (empty for
+// any). It matches an Access group by name, a user by email, or a service
+// token by its client ID.
+type AccessGrant struct {
+	Group       string   `yaml:"group,omitempty"`
+	Email       string   `yaml:"email,omitempty"`
+	ServiceAuth string   `yaml:"service_token,omitempty"`
+	Services    []string `yaml:"services"`
+	Scopes      []string `yaml:"scopes,omitempty"`
+	Levels      []string `yaml:"levels,omitempty"`
+}
+
+// AccessIdentity is the caller as established by a verified Access JWT.
+type AccessIdentity struct {
+	// Email is set for users, CommonName for service tokens.
+	Email      string
+	CommonName string
+	// Groups are the user's Access groups, looked up only when a grant
+	// matches on group.
+	Groups []string
+}
+
+// Name is the email, or the service token's client ID.
+func (id *AccessIdentity) Name() string {
+	if id.Email != "" {
+		return id.Email
+	}
+	return id.CommonName
+}
+
+// AccessDeniedError is returned when no grant covers a request.
+type AccessDeniedError struct {
+	Identity string
+	Reason   string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("%s is not allowed to request %s", e.Identity, e.Reason)
+}
+
+// LoadAccessConfig reads and validates an AccessConfig from a YAML file.
+func LoadAccessConfig(path string) (*AccessConfig, error) {
+	c, err := ReadAccessConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// ReadAccessConfig reads an AccessConfig from a YAML file without
+// validating it, for callers that fill in fields such as the team domain
+// and audience from elsewhere. Call Validate once it is complete.
+func ReadAccessConfig(path string) (*AccessConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c AccessConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Validate checks that the team domain, audience, and at least one grant
+// are set and that every grant is well formed.
+func (c *AccessConfig) Validate() error {
+	c.TeamDomain = strings.TrimSuffix(strings.TrimPrefix(c.TeamDomain, "https://"), "/")
+	if c.TeamDomain == "" || c.Audience == "" {
+		return fmt.Errorf("team_domain and audience are required")
+	}
+	if len(c.Grants) == 0 {
+		return fmt.Errorf("at least one grant is required")
+	}
+	for i, g := range c.Grants {
+		set := 0
+		for _, s := range []string{g.Group, g.Email, g.ServiceAuth} {
+			if s != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			return fmt.Errorf("grants[%d]: set exactly one of group, email, or service_token", i)
+		}
+		if len(g.Services) == 0 {
+			return fmt.Errorf("grants[%d]: services is required", i)
+		}
+		for _, name := range ExpandServices(g.Services) {
+			if _, ok := Services[name]; !ok && name != "*" {
+				return fmt.Errorf("grants[%d]: unknown service %q", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+// needsGroups reports whether any grant matches on group.
+func (c *AccessConfig) needsGroups() bool {
+	return slices.ContainsFunc(c.Grants, func(g AccessGrant) bool { return g.Group != "" })
+}
+
+// Authorize returns an *AccessDeniedError unless a grant matching id covers
+// the request.
+func (c *AccessConfig) Authorize(id *AccessIdentity, services []string, scope, level string) error {
+	services = ExpandServices(services)
+	for _, g := range c.Grants {
+		if g.matches(id) && g.covers(services, scope, level) {
+			return nil
+		}
+	}
+	return &AccessDeniedError{
+		Identity: id.Name(),
+		Reason:   fmt.Sprintf("%s on %s at %s", strings.Join(services, ", "), scope, level),
+	}
+}
+
+func (g AccessGrant) matches(id *AccessIdentity) bool {
+	switch {
+	case g.Email != "":
+		return strings.EqualFold(g.Email, id.Email)
+	case g.ServiceAuth != "":
+		return g.ServiceAuth == id.CommonName
+	}
+	return slices.Contains(id.Groups, g.Group)
+}
+
+func (g AccessGrant) covers(services []string, scope, level string) bool {
+	allowed := ExpandServices(g.Services)
+	if !slices.Contains(allowed, "*") {
+		for _, s := range services {
+			if !slices.Contains(allowed, s) {
+				return false
+			}
+		}
+	}
+	if len(g.Scopes) > 0 && !slices.Contains(g.Scopes, "*") && !slices.Contains(g.Scopes, scope) {
+		return false
+	}
+	return len(g.Levels) == 0 || slices.Contains(g.Levels, level)
+}
+
+// accessVerifier validates Access JWTs against the team's signing keys,
+// which it fetches on first use and again when a token names a new key.
+type accessVerifier struct {
+	cfg    *AccessConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+	// fetching is closed when the key fetch in progress, if any, ends;
+	// fetchErr is how the last one failed.
+	fetching chan struct{}
+	fetchErr error
+	groups   map[string]accessGroups
+}
+
+type accessGroups struct {
+	names   []string
+	expires time.Time
+}
+
+func newAccessVerifier(cfg *AccessConfig, client *http.Client) *accessVerifier {
+	return &accessVerifier{cfg: cfg, client: client, groups: make(map[string]accessGroups)}
+}
+
+type accessClaims struct {
+	Issuer        string          `json:"iss"`
+	Audience      json.RawMessage `json:"aud"`
+	Expires       int64           `json:"exp"`
+	NotBefore     int64           `json:"nbf"`
+	Email         string          `json:"email"`
+	CommonName    string          `json:"common_name"`
+	Subject       string          `json:"sub"`
+	IdentityNonce string          `json:"identity_nonce"`
+}
+
+// verify checks the Access JWT on r and returns the caller's identity.
+func (v *accessVerifier) verify(ctx context.Context, r *http.Request) (*AccessIdentity, error) {
+	jwt := r.Header.Get(AccessJWTHeader)
+	if jwt == "" {
+		return nil, fmt.Errorf("missing %s header; is the endpoint behind Cloudflare Access?", AccessJWTHeader)
+	}
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed Access JWT")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return nil, fmt.Errorf("malformed Access JWT header")
+	}
+	key, err := v.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed Access JWT signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("invalid Access JWT signature")
+	}
+
+	var claims accessClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed Access JWT claims")
+	}
+	now := time.Now()
+	if claims.Issuer != "https://"+v.cfg.TeamDomain {
+		return nil, fmt.Errorf("Access JWT was issued by %q, not %s", claims.Issuer, v.cfg.TeamDomain)
+	}
+	if !audienceContains(claims.Audience, v.cfg.Audience) {
+		return nil, fmt.Errorf("Access JWT is for a different application")
+	}
+	if now.Unix() >= claims.Expires || (claims.NotBefore != 0 && now.Unix() < claims.NotBefore) {
+		return nil, fmt.Errorf("Access JWT has expired or is not yet valid")
+	}
+	id := &AccessIdentity{Email: claims.Email, CommonName: claims.CommonName}
+	if id.Email == "" && id.CommonName == "" {
+		return nil, fmt.Errorf("Access JWT has neither an email nor a service token")
+	}
+	if id.Email != "" && v.cfg.needsGroups() {
+		if id.Groups, err = v.identityGroups(ctx, jwt, claims); err != nil {
+			return nil, err
+		}
+	}
+	return id, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// audienceContains reports whether a JWT aud claim, a string or a list of
+// strings, includes aud.
+func audienceContains(raw json.RawMessage, aud string) bool {
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		var single string
+		if json.Unmarshal(raw, &single) != nil {
+			return false
+		}
+		list = []string{single}
+	}
+	return slices.Contains(list, aud)
+}
+
+// key returns the signing key with the given ID, refetching the team's keys
+// at most once a minute when it isn't known. The fetch runs without holding
+// v.mu, so requests signed with known keys aren't held up by it, and
+// requests that need it wait for the one fetch in progress.
+func (v *accessVerifier) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	for {
+		v.mu.Lock()
+		if key, ok := v.keys[kid]; ok {
+			v.mu.Unlock()
+			return key, nil
+		}
+		if wait := v.fetching; wait != nil {
+			v.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if time.Since(v.fetchedAt) < time.Minute {
+			err := v.fetchErr
+			v.mu.Unlock()
+			if err != nil {
+				return nil, fmt.Errorf("fetching Access signing keys: %w", err)
+			}
+			return nil, fmt.Errorf("Access JWT is signed with an unknown key")
+		}
+		done := make(chan struct{})
+		v.fetching, v.fetchedAt = done, time.Now()
+		v.mu.Unlock()
+
+		// Other requests wait on this fetch, so it isn't tied to this
+		// request's context.
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		keys, err := v.fetchKeys(fetchCtx)
+		cancel()
+		v.mu.Lock()
+		if err == nil {
+			v.keys = keys
+		}
+		v.fetchErr, v.fetching = err, nil
+		close(done)
+		v.mu.Unlock()
+	}
+}
+
+func (v *accessVerifier) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := v.getJSON(ctx, "/cdn-cgi/access/certs", "", &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no RSA keys found")
+	}
+	return keys, nil
+}
+
+// identityGroups returns the user's Access group names from the team's
+// identity endpoint, cached until the JWT expires.
+func (v *accessVerifier) identityGroups(ctx context.Context, jwt string, claims accessClaims) ([]string, error) {
+	cacheKey := claims.Subject + "\n" + claims.IdentityNonce
+	v.mu.Lock()
+	now := time.Now()
+	for k, g := range v.groups {
+		if now.After(g.expires) {
+			delete(v.groups, k)
+		}
+	}
+	cached, ok := v.groups[cacheKey]
+	v.mu.Unlock()
+	if ok {
+		return cached.names, nil
+	}
+
+	var identity struct {
+		Groups []struct {
+			Name string `json:"name"`
+		} `json:"groups"`
+	}
+	if err := v.getJSON(ctx, "/cdn-cgi/access/get-identity", jwt, &identity); err != nil {
+		return nil, fmt.Errorf("looking up Access groups: %w", err)
+	}
+	var names []string
+	for _, g := range identity.Groups {
+		names = append(names, g.Name)
+	}
+	v.mu.Lock()
+	v.groups[cacheKey] = accessGroups{names: names, expires: time.Unix(claims.Expires, 0)}
+	v.mu.Unlock()
+	return names, nil
+}
+
+func (v *accessVerifier) getJSON(ctx context.Context, path, jwt string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+v.cfg.TeamDomain+path, nil)
+	if err != nil {
+		return err
+	}
+	if jwt != "" {
+		req.AddCookie(&http.Cookie{Name: "CF_Authorization", Value: jwt})
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL, resp.Status)
+	}
+	return json.NewDecoder(http.MaxBytesReader(nil, resp.Body, 1<<20)).Decode(out)
+}
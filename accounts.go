@@ -0,0 +1,69 @@
+package cftoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// AccountInfo is an account the parent credential can access.
+type AccountInfo struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Type is "standard" or "enterprise".
+	Type string `json:"type"`
+	// Roles are the roles the parent credential's user holds in the
+	// account, e.g. "Administrator"; nil if the memberships couldn't be
+	// read.
+	Roles []string `json:"roles"`
+}
+
+// ListAccounts lists the accounts the parent credential can access with the
+// roles its user holds in each. Roles come from the user's memberships,
+// which an API token can only read with the Memberships Read permission;
+// without it, the accounts are returned without roles.
+func (g *Generator) ListAccounts(ctx context.Context) ([]AccountInfo, error) {
+	accounts, err := g.DiscoverAccounts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing accounts: %w", err)
+	}
+	roles, _ := g.membershipRoles(ctx)
+	infos := make([]AccountInfo, len(accounts))
+	for i, a := range accounts {
+		infos[i] = AccountInfo{ID: a.ID, Name: a.Name, Type: a.Type}
+		if roles != nil {
+			infos[i].Roles = roles[a.ID]
+			if infos[i].Roles == nil {
+				infos[i].Roles = []string{}
+			}
+		}
+	}
+	return infos, nil
+}
+
+// membershipRoles returns the user's roles keyed by account ID.
+func (g *Generator) membershipRoles(ctx context.Context) (map[string][]string, error) {
+	roles := make(map[string][]string)
+	for page := 1; ; page++ {
+		resp, err := g.api.Raw(ctx, http.MethodGet, fmt.Sprintf("/memberships?page=%d&per_page=50", page), nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing memberships: %w", err)
+		}
+		var memberships []struct {
+			Account struct {
+				ID string `json:"id"`
+			} `json:"account"`
+			Roles []string `json:"roles"`
+		}
+		if err := json.Unmarshal(resp.Result, &memberships); err != nil {
+			return nil, fmt.Errorf("decoding memberships: %w", err)
+		}
+		for _, m := range memberships {
+			roles[m.Account.ID] = append(roles[m.Account.ID], m.Roles...)
+		}
+		if len(memberships) == 0 || resp.ResultInfo == nil || page >= resp.ResultInfo.TotalPages {
+			return roles, nil
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package cftoken
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ResponseError is an error response from the Cloudflare API. Every Backend
+// returns API errors as one, whatever client it's built on, so callers check
+// StatusCode and Codes with errors.As instead of a client's error types.
+type ResponseError struct {
+	StatusCode int
+	// Codes and Messages are the errors listed in the response body.
+	Codes    []int
+	Messages []string
+	RayID    string
+	// Err is the client's own error, if it had one.
+	Err error
+}
+
+func (e *ResponseError) Error() string {
+	var parts []string
+	for i, msg := range e.Messages {
+		if i < len(e.Codes) && e.Codes[i] != 0 {
+			msg += fmt.Sprintf(" (%d)", e.Codes[i])
+		}
+		parts = append(parts, msg)
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("HTTP %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ErrorCodes returns Codes, like cloudflare-go's errors, for callers that
+// check for that method.
+func (e *ResponseError) ErrorCodes() []int { return e.Codes }
+
+func (e *ResponseError) Unwrap() error { return e.Err }
+
+// responseStatus returns the HTTP status of the API error in err's chain, or
+// 0 if there is none.
+func responseStatus(err error) int {
+	var resp *ResponseError
+	if errors.As(err, &resp) {
+		return resp.StatusCode
+	}
+	return 0
+}
+
+// APIError is a Cloudflare API error explained in plain language, with a
+// remediation hint. It wraps the original *ResponseError.
+type APIError struct {
+	// Op is what was being done, e.g. "creating token".
+	Op string
+	// Code is the Cloudflare error code the explanation is for, or 0 for a
+	// rate limit reported only by HTTP status.
+	Code    int
+	Message string
+	Hint    string
+	Err     error
+}
+
+func (e *APIError) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s: %s (Cloudflare error %d: %v)", e.Op, e.Message, e.Code, e.Err)
+	}
+	return fmt.Sprintf("%s: %s (%v)", e.Op, e.Message, e.Err)
+}
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// apiErrorHelp explains the common Cloudflare error codes on token requests.
+var apiErrorHelp = map[int]struct{ message, hint string }{
+	1000: {
+		"the parent credential was rejected",
+		"Check api_token in the config (run init to replace it) and that the token is active and has the API Tokens Write permission.",
+	},
+	10000: {
+		"the parent credential was rejected",
+		"Check api_token in the config (run init to replace it) and that the token is active and has the API Tokens Write permission.",
+	},
+	9109: {
+		"a permission group in the request is invalid or not available to this account",
+		"The permission catalog may be out of date: run self-update for a newer catalog, or check that the account's plan includes the service.",
+	},
+	6003: {
+		"Cloudflare rejected the request as invalid",
+		"Check that zone and account IDs are 32-character hex IDs that the parent token can see, and that TTLs, dates, and IP ranges are valid.",
+	},
+	971: {
+		"Cloudflare is rate limiting requests",
+		"Wait a minute and retry. For batches, lower --concurrency.",
+	},
+}
+
+// explainAPIError wraps err as an *APIError when it carries a known
+// Cloudflare error code or is a rate limit, and otherwise prefixes it with op.
+func explainAPIError(op string, err error) error {
+	var resp *ResponseError
+	if errors.As(err, &resp) {
+		for _, code := range resp.Codes {
+			if help, ok := apiErrorHelp[code]; ok {
+				return &APIError{Op: op, Code: code, Message: help.message, Hint: help.hint, Err: err}
+			}
+		}
+	}
+	if responseStatus(err) == http.StatusTooManyRequests {
+		help := apiErrorHelp[971]
+		return &APIError{Op: op, Message: help.message, Hint: help.hint, Err: err}
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
@@ -0,0 +1,165 @@
+package cftoken
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// The types below are what a Backend takes and returns. They marshal to and
+// from the Cloudflare API's JSON, and hold the fields the Generator reads,
+// so a Backend over any client converts to them at its edge.
+
+// APIToken is a Cloudflare API token as the token endpoints read and write
+// it. Value is only set when a token is created or rolled.
+type APIToken struct {
+	ID         string          `json:"id,omitempty"`
+	Name       string          `json:"name,omitempty"`
+	Status     string          `json:"status,omitempty"`
+	IssuedOn   *time.Time      `json:"issued_on,omitempty"`
+	ModifiedOn *time.Time      `json:"modified_on,omitempty"`
+	NotBefore  *time.Time      `json:"not_before,omitempty"`
+	ExpiresOn  *time.Time      `json:"expires_on,omitempty"`
+	Policies   []policy.Policy `json:"policies,omitempty"`
+	Condition  *TokenCondition `json:"condition,omitempty"`
+	Value      string          `json:"value,omitempty"`
+}
+
+// TokenCondition restricts where a token can be used from.
+type TokenCondition struct {
+	RequestIP *RequestIPCondition `json:"request.ip,omitempty"`
+}
+
+// RequestIPCondition lists the client IP ranges a token is accepted or
+// refused from.
+type RequestIPCondition struct {
+	In    []string `json:"in,omitempty"`
+	NotIn []string `json:"not_in,omitempty"`
+}
+
+// TokenStatus is what the verify endpoint reports about the token making
+// the request.
+type TokenStatus struct {
+	ID        string    `json:"id"`
+	Status    string    `json:"status"`
+	NotBefore time.Time `json:"not_before"`
+	ExpiresOn time.Time `json:"expires_on"`
+}
+
+// Zone is a Cloudflare zone.
+type Zone struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Status      string      `json:"status"`
+	Paused      bool        `json:"paused"`
+	Type        string      `json:"type"`
+	NameServers []string    `json:"name_servers"`
+	OriginalNS  []string    `json:"original_name_servers"`
+	Plan        ZonePlan    `json:"plan"`
+	Account     ZoneAccount `json:"account"`
+	CreatedOn   time.Time   `json:"created_on"`
+	ModifiedOn  time.Time   `json:"modified_on"`
+}
+
+// ZonePlan is the plan a zone is on. LegacyID is "free", "pro",
+// "business", or "enterprise" for the standard plans.
+type ZonePlan struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	LegacyID string `json:"legacy_id"`
+}
+
+// ZoneAccount is the account a zone belongs to.
+type ZoneAccount struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Account is a Cloudflare account.
+type Account struct {
+	ID        string           `json:"id,omitempty"`
+	Name      string           `json:"name,omitempty"`
+	Type      string           `json:"type,omitempty"`
+	CreatedOn time.Time        `json:"created_on,omitempty"`
+	Settings  *AccountSettings `json:"settings,omitempty"`
+}
+
+// AccountSettings are an account's settings.
+type AccountSettings struct {
+	EnforceTwoFactor bool `json:"enforce_twofactor"`
+}
+
+// AccountMember is a user's membership of an account, with the roles or
+// member policies that grant their access.
+type AccountMember struct {
+	ID     string            `json:"id"`
+	User   AccountMemberUser `json:"user"`
+	Status string            `json:"status"`
+	Roles  []AccountRole     `json:"roles,omitempty"`
+	// Policies are the member policies, kept as JSON since only their
+	// presence matters here.
+	Policies []json.RawMessage `json:"policies,omitempty"`
+}
+
+// AccountMemberUser is the user behind an AccountMember.
+type AccountMemberUser struct {
+	ID        string `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Email     string `json:"email"`
+	TwoFA     bool   `json:"two_factor_authentication_enabled"`
+}
+
+// AccountRole is an account role and the permissions it grants, keyed by
+// area, e.g. "dns_records".
+type AccountRole struct {
+	ID          string                    `json:"id"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Permissions map[string]RolePermission `json:"permissions"`
+}
+
+// RolePermission is the access an AccountRole grants to one area.
+type RolePermission struct {
+	Read bool `json:"read"`
+	Edit bool `json:"edit"`
+}
+
+// User is the user a credential belongs to.
+type User struct {
+	ID        string `json:"id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TwoFA     bool   `json:"two_factor_authentication_enabled,omitempty"`
+}
+
+// PageOptions selects a page of a list endpoint. Zero values leave the
+// choice to Cloudflare.
+type PageOptions struct {
+	Page    int `json:"page,omitempty"`
+	PerPage int `json:"per_page,omitempty"`
+}
+
+// AccountsParams filters the accounts list.
+type AccountsParams struct {
+	Name string `json:"name,omitempty"`
+	PageOptions
+}
+
+// ResultInfo is the paging information of a list response.
+type ResultInfo struct {
+	Page       int `json:"page"`
+	PerPage    int `json:"per_page"`
+	TotalPages int `json:"total_pages"`
+	Count      int `json:"count"`
+	Total      int `json:"total_count"`
+}
+
+// RawResponse is a response from Backend.Raw, with its result left as JSON.
+type RawResponse struct {
+	Result     json.RawMessage `json:"result"`
+	ResultInfo *ResultInfo     `json:"result_info,omitempty"`
+}
@@ -0,0 +1,180 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Audit rule identifiers, used in Violation.Rule.
+const (
+	RuleMaxTTL              = "max-ttl"
+	RuleForbiddenPermission = "forbidden-permission"
+	RuleMaxPermissionGroups = "max-permission-groups"
+	RuleIPCondition         = "ip-condition"
+	RuleNaming              = "naming"
+)
+
+// AuditRules are organization rules every token in the account should meet.
+// Unset rules aren't checked.
+type AuditRules struct {
+	// MaxTTL is the longest allowed lifetime, e.g. "90d". Tokens without an
+	// expiry violate it.
+	MaxTTL string `yaml:"max_ttl,omitempty"`
+	// ForbiddenPermissions lists permission group names or IDs no token may
+	// hold, e.g. "API Tokens Write".
+	ForbiddenPermissions []string `yaml:"forbidden_permissions,omitempty"`
+	// MaxPermissionGroups caps the number of distinct permission groups per
+	// token, catching godmode-style tokens.
+	MaxPermissionGroups int `yaml:"max_permission_groups,omitempty"`
+	// RequireIPCondition requires a request.ip allow list.
+	RequireIPCondition bool `yaml:"require_ip_condition,omitempty"`
+	// NamePattern is a regular expression token names must match.
+	NamePattern string `yaml:"name_pattern,omitempty"`
+	// RequireTaggedName requires the cftg:<team>:<purpose>:<hash> convention.
+	RequireTaggedName bool `yaml:"require_tagged_name,omitempty"`
+	// Exempt lists token IDs or names the rules don't apply to.
+	Exempt []string `yaml:"exempt,omitempty"`
+
+	path        string
+	maxTTL      time.Duration
+	namePattern *regexp.Regexp
+}
+
+// Violation is one rule a token breaks.
+type Violation struct {
+	TokenID   string
+	TokenName string
+	Rule      string
+	Message   string
+}
+
+// AuditReport is the result of auditing an account's tokens.
+type AuditReport struct {
+	// Tokens is the number of tokens checked, excluding exempt ones.
+	Tokens     int
+	Violations []Violation
+	// RulesFile is the rules file the report was checked against, if any.
+	RulesFile string
+}
+
+// LoadAuditRules reads and validates a YAML rules file.
+func LoadAuditRules(path string) (*AuditRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := AuditRules{path: path}
+	if err := yaml.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := r.compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+func (r *AuditRules) compile() error {
+	if r.MaxTTL != "" {
+		d, err := ParseTTL(r.MaxTTL)
+		if err != nil {
+			return fmt.Errorf("max_ttl: %w", err)
+		}
+		r.maxTTL = d
+	}
+	if r.NamePattern != "" {
+		re, err := regexp.Compile(r.NamePattern)
+		if err != nil {
+			return fmt.Errorf("name_pattern: %w", err)
+		}
+		r.namePattern = re
+	}
+	return nil
+}
+
+// Check returns the rules t violates. It makes no API calls.
+func (r *AuditRules) Check(t APIToken) []Violation {
+	// Rules built in code rather than by LoadAuditRules are compiled here.
+	if (r.maxTTL == 0 && r.MaxTTL != "") || (r.namePattern == nil && r.NamePattern != "") {
+		if err := r.compile(); err != nil {
+			return []Violation{{TokenID: t.ID, TokenName: t.Name, Rule: "rules", Message: err.Error()}}
+		}
+	}
+
+	var v []Violation
+	add := func(rule, format string, args ...interface{}) {
+		v = append(v, Violation{TokenID: t.ID, TokenName: t.Name, Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if r.maxTTL > 0 {
+		switch {
+		case t.ExpiresOn == nil:
+			add(RuleMaxTTL, "never expires (max %s)", r.MaxTTL)
+		case t.IssuedOn != nil && t.ExpiresOn.Sub(*t.IssuedOn) > r.maxTTL:
+			add(RuleMaxTTL, "lifetime %s exceeds %s", t.ExpiresOn.Sub(*t.IssuedOn).Round(time.Hour), r.MaxTTL)
+		}
+	}
+
+	groups := make(map[string]bool)
+	for _, pol := range t.Policies {
+		if pol.Effect != "allow" {
+			continue
+		}
+		for _, pg := range pol.PermissionGroups {
+			groups[pg.ID] = true
+			for _, f := range r.ForbiddenPermissions {
+				if f == pg.ID || strings.EqualFold(f, permissionName(pg)) {
+					add(RuleForbiddenPermission, "holds forbidden permission %q", permissionName(pg))
+				}
+			}
+		}
+	}
+	if r.MaxPermissionGroups > 0 && len(groups) > r.MaxPermissionGroups {
+		add(RuleMaxPermissionGroups, "holds %d permission groups (max %d)", len(groups), r.MaxPermissionGroups)
+	}
+
+	if r.RequireIPCondition && (t.Condition == nil || t.Condition.RequestIP == nil || len(t.Condition.RequestIP.In) == 0) {
+		add(RuleIPCondition, "has no IP allow list")
+	}
+
+	if r.namePattern != nil && !r.namePattern.MatchString(t.Name) {
+		add(RuleNaming, "name does not match %s", r.NamePattern)
+	}
+	if r.RequireTaggedName {
+		if _, ok := ParseTaggedName(t.Name); !ok {
+			add(RuleNaming, "name does not follow cftg:<team>:<purpose>:<hash>")
+		}
+	}
+	return v
+}
+
+func (r *AuditRules) exempt(t APIToken) bool {
+	for _, e := range r.Exempt {
+		if e == t.ID || e == t.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit checks every token visible to the parent token against rules.
+func (g *Generator) Audit(ctx context.Context, rules *AuditRules) (*AuditReport, error) {
+	tokens, err := g.api.APITokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tokens: %w", err)
+	}
+	report := &AuditReport{RulesFile: rules.path}
+	for _, t := range tokens {
+		if rules.exempt(t) {
+			continue
+		}
+		report.Tokens++
+		report.Violations = append(report.Violations, rules.Check(t)...)
+	}
+	return report, nil
+}
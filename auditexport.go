@@ -0,0 +1,392 @@
+package cftoken
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Audit event actions.
+const (
+	AuditTokenCreated       = "token-created"
+	AuditTokenRolled        = "token-rolled"
+	AuditTokenRevoked       = "token-revoked"
+	AuditTokenExpiryChanged = "token-expiry-changed"
+)
+
+// AuditEvent is a token lifecycle event exported to a SIEM.
+type AuditEvent struct {
+	Time      time.Time
+	Action    string
+	Requester string
+	TokenID   string
+	TokenName string
+	Services  []string
+	Scope     string
+	Level     string
+	ExpiresOn *time.Time
+	// BreakGlass is set when the token overrode a guardrail.
+	BreakGlass *BreakGlassEvent
+	Provenance *Provenance
+}
+
+// AuditExportConfig sends token events to a SIEM.
+type AuditExportConfig struct {
+	// Format is "ecs" (Elastic Common Schema JSON, the default) or "cef"
+	// (ArcSight Common Event Format).
+	Format string `yaml:"format,omitempty"`
+	// Target is where events are sent: "syslog+tcp://host:port" or
+	// "syslog+tls://host:port" for RFC 5424 syslog, or an https:// URL each
+	// event is POSTed to.
+	Target string `yaml:"target"`
+	// Headers are added to HTTPS requests, e.g. an Authorization header.
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// AuditFormatter encodes an event for a SIEM.
+type AuditFormatter interface {
+	Format(e AuditEvent) ([]byte, error)
+	ContentType() string
+}
+
+// AuditTransport delivers formatted events.
+type AuditTransport interface {
+	Send(ctx context.Context, contentType string, data []byte) error
+	String() string
+}
+
+type auditExporter struct {
+	formatter AuditFormatter
+	transport AuditTransport
+}
+
+// ParseAuditFormat returns the formatter for "ecs" or "cef".
+func ParseAuditFormat(name string) (AuditFormatter, error) {
+	switch name {
+	case "", "ecs":
+		return ecsFormatter{}, nil
+	case "cef":
+		return cefFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown audit format %q (use ecs or cef)", name)
+}
+
+// ParseAuditTransport parses an audit export target. HTTPS requests are sent
+// with client and carry headers.
+func ParseAuditTransport(target string, headers map[string]string, client *http.Client) (AuditTransport, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("audit target %q: %w", target, err)
+	}
+	switch u.Scheme {
+	case "syslog+tcp", "syslog+tls":
+		if u.Port() == "" {
+			return nil, fmt.Errorf("audit target %q: missing port", target)
+		}
+		return syslogTransport{addr: u.Host, tls: u.Scheme == "syslog+tls"}, nil
+	case "https":
+		if u.Host == "" {
+			return nil, fmt.Errorf("audit target %q: missing host", target)
+		}
+		return httpsTransport{url: target, headers: headers, client: client}, nil
+	}
+	return nil, fmt.Errorf("audit target %q: use syslog+tcp://, syslog+tls://, or https://", target)
+}
+
+// AddAuditExporter sends token events to transport, encoded by formatter, in
+// addition to the exporters in the config's audit_export section.
+func (g *Generator) AddAuditExporter(formatter AuditFormatter, transport AuditTransport) {
+	g.auditExporters = append(g.auditExporters, auditExporter{formatter, transport})
+}
+
+// auditExporters builds the exporters configured in audit_export, in name
+// order.
+func auditExporters(exports map[string]AuditExportConfig, client *http.Client) ([]auditExporter, error) {
+	names := make([]string, 0, len(exports))
+	for name := range exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var result []auditExporter
+	for _, name := range names {
+		c := exports[name]
+		f, err := ParseAuditFormat(c.Format)
+		if err != nil {
+			return nil, fmt.Errorf("audit_export.%s: %w", name, err)
+		}
+		t, err := ParseAuditTransport(c.Target, c.Headers, client)
+		if err != nil {
+			return nil, fmt.Errorf("audit_export.%s: %w", name, err)
+		}
+		result = append(result, auditExporter{f, t})
+	}
+	return result, nil
+}
+
+// exportAudit sends e to every exporter, returning the first failure.
+func (g *Generator) exportAudit(ctx context.Context, e AuditEvent) error {
+	if len(g.auditExporters) == 0 {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Requester == "" {
+		e.Requester = Requester()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	for _, x := range g.auditExporters {
+		data, err := x.formatter.Format(e)
+		if err != nil {
+			return fmt.Errorf("formatting audit event: %w", err)
+		}
+		if err := x.transport.Send(ctx, x.formatter.ContentType(), data); err != nil {
+			return fmt.Errorf("exporting audit event to %s: %w", x.transport, err)
+		}
+	}
+	return nil
+}
+
+// recordIssued exports the creation or roll of t. As with break-glass, a
+// token must not exist without its audit event, so t is revoked if the
+// export fails.
+func (g *Generator) recordIssued(ctx context.Context, t *Token, o tokenOptions, violation *GuardrailError) error {
+	if t.Existing || len(g.auditExporters) == 0 {
+		return nil
+	}
+	e := AuditEvent{
+		Action:     AuditTokenCreated,
+		Requester:  o.requester,
+		TokenID:    t.ID,
+		TokenName:  t.Name,
+		Services:   t.Services,
+		Scope:      t.Scope,
+		Level:      t.Level,
+		ExpiresOn:  t.ExpiresOn,
+		Provenance: t.Provenance,
+	}
+	if t.Rolled {
+		e.Action = AuditTokenRolled
+	}
+	if violation != nil {
+		e.BreakGlass = &BreakGlassEvent{Reason: o.breakGlassReason, Guardrail: violation.Group, Violation: violation.Reason}
+	}
+	err := g.exportAudit(ctx, e)
+	if err == nil {
+		return nil
+	}
+	if rerr := g.api.DeleteAPIToken(ctx, t.ID); rerr != nil {
+		return fmt.Errorf("%w; token %s could not be revoked: %v", err, t.ID, rerr)
+	}
+	return fmt.Errorf("%w; token %s was revoked", err, t.ID)
+}
+
+// ecsFormatter encodes events as Elastic Common Schema documents. Fields
+// without an ECS equivalent go under "cftoken".
+type ecsFormatter struct{}
+
+func (ecsFormatter) ContentType() string { return "application/json" }
+
+func (ecsFormatter) Format(e AuditEvent) ([]byte, error) {
+	eventType := "creation"
+	switch e.Action {
+	case AuditTokenRolled, AuditTokenExpiryChanged:
+		eventType = "change"
+	case AuditTokenRevoked:
+		eventType = "deletion"
+	}
+	token := map[string]any{
+		"id":       e.TokenID,
+		"name":     e.TokenName,
+		"services": e.Services,
+		"scope":    e.Scope,
+		"level":    e.Level,
+	}
+	if e.ExpiresOn != nil {
+		token["expires_on"] = e.ExpiresOn.UTC().Format(time.RFC3339)
+	}
+	if e.BreakGlass != nil {
+		token["break_glass"] = map[string]string{
+			"reason":    e.BreakGlass.Reason,
+			"guardrail": e.BreakGlass.Guardrail,
+			"violation": e.BreakGlass.Violation,
+		}
+	}
+	if e.Provenance != nil {
+		token["provenance"] = e.Provenance
+	}
+	user, host, _ := strings.Cut(e.Requester, "@")
+	doc := map[string]any{
+		"@timestamp": e.Time.UTC().Format(time.RFC3339Nano),
+		"ecs":        map[string]string{"version": "8.11.0"},
+		"event": map[string]any{
+			"kind":     "event",
+			"category": []string{"iam"},
+			"type":     []string{eventType},
+			"action":   e.Action,
+			"outcome":  "success",
+			"provider": "cloudflare-token-generator",
+		},
+		"user":    map[string]string{"name": user},
+		"host":    map[string]string{"hostname": host},
+		"cftoken": token,
+		"message": auditMessage(e),
+	}
+	return json.Marshal(doc)
+}
+
+// cefFormatter encodes events as CEF lines.
+type cefFormatter struct{}
+
+func (cefFormatter) ContentType() string { return "text/plain" }
+
+func (cefFormatter) Format(e AuditEvent) ([]byte, error) {
+	severity := 3
+	if e.BreakGlass != nil {
+		severity = 8
+	}
+	ext := []string{
+		"rt=" + strconv.FormatInt(e.Time.UnixMilli(), 10),
+		"suser=" + cefValue(e.Requester),
+		"duid=" + cefValue(e.TokenID),
+		"duser=" + cefValue(e.TokenName),
+		"cs1Label=services", "cs1=" + cefValue(strings.Join(e.Services, ",")),
+		"cs2Label=scope", "cs2=" + cefValue(e.Scope),
+		"cs3Label=level", "cs3=" + cefValue(e.Level),
+	}
+	if e.ExpiresOn != nil {
+		ext = append(ext, "end="+strconv.FormatInt(e.ExpiresOn.UnixMilli(), 10))
+	}
+	if e.BreakGlass != nil {
+		ext = append(ext, "cs4Label=breakGlassReason", "cs4="+cefValue(e.BreakGlass.Reason),
+			"cs5Label=guardrail", "cs5="+cefValue(e.BreakGlass.Guardrail))
+	}
+	if e.Provenance != nil {
+		ext = append(ext, "cs6Label=provenance", "cs6="+cefValue(e.Provenance.String()))
+	}
+	ext = append(ext, "msg="+cefValue(auditMessage(e)))
+	line := strings.Join([]string{
+		"CEF:0", "Cloudflare", "cloudflare-token-generator", "1",
+		cefHeader(e.Action), cefHeader(auditMessage(e)), strconv.Itoa(severity),
+		strings.Join(ext, " "),
+	}, "|")
+	return []byte(line), nil
+}
+
+func cefHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+func cefValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// auditMessage is a one-line summary of e.
+func auditMessage(e AuditEvent) string {
+	var msg string
+	switch e.Action {
+	case AuditTokenRolled:
+		msg = fmt.Sprintf("%s rolled token %q", e.Requester, e.TokenName)
+	case AuditTokenRevoked:
+		msg = fmt.Sprintf("%s revoked token %s", e.Requester, e.TokenID)
+	case AuditTokenExpiryChanged:
+		msg = fmt.Sprintf("%s set token %q to expire %s", e.Requester, e.TokenName, e.ExpiresOn.UTC().Format(time.RFC3339))
+	default:
+		msg = fmt.Sprintf("%s created token %q", e.Requester, e.TokenName)
+	}
+	if e.BreakGlass != nil {
+		msg += fmt.Sprintf(" overriding guardrail %q", e.BreakGlass.Guardrail)
+	}
+	return msg
+}
+
+// syslogTransport sends each event as an RFC 5424 message with octet-counted
+// framing (RFC 6587) on a new connection.
+type syslogTransport struct {
+	addr string
+	tls  bool
+}
+
+func (t syslogTransport) String() string {
+	if t.tls {
+		return "syslog+tls://" + t.addr
+	}
+	return "syslog+tcp://" + t.addr
+}
+
+func (t syslogTransport) Send(ctx context.Context, _ string, data []byte) error {
+	var conn net.Conn
+	var err error
+	if t.tls {
+		d := tls.Dialer{}
+		conn, err = d.DialContext(ctx, "tcp", t.addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(ctx, "tcp", t.addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "-"
+	}
+	// Facility authpriv (10), severity notice (5).
+	msg := fmt.Sprintf("<85>1 %s %s cloudflare-token-generator %d - - %s",
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"), host, os.Getpid(), data)
+	_, err = fmt.Fprintf(conn, "%d %s", len(msg), msg)
+	return err
+}
+
+// httpsTransport POSTs each event to a collector.
+type httpsTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (t httpsTransport) String() string {
+	if u, err := url.Parse(t.url); err == nil {
+		return "https://" + u.Host
+	}
+	return "https collector"
+}
+
+func (t httpsTransport) Send(ctx context.Context, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	client := t.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cftoken
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Backend is the subset of the Cloudflare API the Generator calls with its
+// parent credentials: the token, permission group, zone, account, and user
+// endpoints. It's written in this package's own types, so an adapter over
+// any client can be plugged in with NewWithBackend without importing the
+// cloudflare-go v0 SDK the default backend uses. CloudflareGoBackend adapts
+// a v0 *cloudflare.API, and the cloudflarev4 package a v4 client.
+type Backend interface {
+	APITokens(ctx context.Context) ([]APIToken, error)
+	GetAPIToken(ctx context.Context, tokenID string) (APIToken, error)
+	CreateAPIToken(ctx context.Context, token APIToken) (APIToken, error)
+	UpdateAPIToken(ctx context.Context, tokenID string, token APIToken) (APIToken, error)
+	RollAPIToken(ctx context.Context, tokenID string) (string, error)
+	DeleteAPIToken(ctx context.Context, tokenID string) error
+	VerifyAPIToken(ctx context.Context) (TokenStatus, error)
+	ListAPITokensPermissionGroups(ctx context.Context) ([]policy.PermissionGroup, error)
+
+	// ListZones lists every zone, or just the zones with the given names.
+	ListZones(ctx context.Context, z ...string) ([]Zone, error)
+	Accounts(ctx context.Context, params AccountsParams) ([]Account, ResultInfo, error)
+	Account(ctx context.Context, accountID string) (Account, ResultInfo, error)
+	AccountMembers(ctx context.Context, accountID string, pageOpts PageOptions) ([]AccountMember, ResultInfo, error)
+	UserDetails(ctx context.Context) (User, error)
+
+	// Raw makes a request to any endpoint, for fields the typed methods
+	// don't expose.
+	Raw(ctx context.Context, method, endpoint string, data interface{}, headers http.Header) (RawResponse, error)
+}
+
+// BackendFactory opens a Backend that authenticates with cfg's credentials:
+// api_token, or api_key and email when auth_type is api_key. It's called
+// once for the parent credential and once for each additional parent, with
+// the parent's token as api_token. client carries the proxy, CA, and
+// tracing settings, and should be used for every request.
+type BackendFactory func(cfg Config, client *http.Client) (Backend, error)
+
+// NewWithBackend is New with the Cloudflare client opened by newBackend
+// instead of cloudflare-go.
+func NewWithBackend(cfg Config, newBackend BackendFactory) (*Generator, error) {
+	return newGenerator(cfg, newBackend)
+}
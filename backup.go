@@ -0,0 +1,283 @@
+package cftoken
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupMagic starts every backup archive, followed by the PBKDF2 iteration
+// count, the salt, the GCM nonce, and the sealed tar.gz.
+const backupMagic = "CFTGBAK1"
+
+const (
+	backupIterations = 600000
+	backupSaltSize   = 16
+	// MinBackupPassphrase is the shortest passphrase Backup accepts.
+	MinBackupPassphrase = 12
+	// maxBackupFile is the largest file Backup includes and Restore reads.
+	maxBackupFile = 64 << 20
+)
+
+// BackupFile is one file in a backup: the per-user config under "config/",
+// or a file from the state directory under "state/".
+type BackupFile struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Backup writes an encrypted archive of the per-user config and everything
+// in the state directory (the inventory, receipt key, break-glass log,
+// include cache, and watch-zones state) to w. The archive is sealed with
+// AES-256-GCM under a key derived from passphrase, so it can be stored
+// anywhere. It returns the files included.
+func Backup(w io.Writer, passphrase string) ([]BackupFile, error) {
+	if len(passphrase) < MinBackupPassphrase {
+		return nil, fmt.Errorf("the backup passphrase must be at least %d characters", MinBackupPassphrase)
+	}
+	configPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	stateDir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	var archive bytes.Buffer
+	zw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(zw)
+	var files []BackupFile
+	add := func(name, path string, info fs.FileInfo) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if len(data) > maxBackupFile {
+			return fmt.Errorf("%s is larger than the %d MiB a backup can hold", path, maxBackupFile>>20)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: info.ModTime()}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return err
+		}
+		files = append(files, BackupFile{Name: name, Size: int64(len(data)), ModTime: info.ModTime()})
+		return nil
+	}
+
+	if info, err := os.Stat(configPath); err == nil {
+		if err := add("config/"+filepath.Base(configPath), configPath, info); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	err = filepath.WalkDir(stateDir, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == stateDir {
+			return fs.SkipAll
+		}
+		// Lock files are recreated as needed and would only block a restore.
+		if err != nil || d.IsDir() || p == configPath || filepath.Ext(p) == ".lock" {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(stateDir, p)
+		if err != nil {
+			return err
+		}
+		return add("state/"+filepath.ToSlash(rel), p, info)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("nothing to back up: neither %s nor %s exists", configPath, stateDir)
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(backupMagic)+4+backupSaltSize)
+	header = append(header, backupMagic...)
+	header = binary.BigEndian.AppendUint32(header, backupIterations)
+	salt := make([]byte, backupSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	header = append(header, salt...)
+	aead, err := backupCipher(passphrase, salt, backupIterations)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(append(header, nonce...), aead.Seal(nil, nonce, archive.Bytes(), header)...)
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Restore decrypts a backup from r and writes its files back: the config
+// next to ConfigPath, and state files into StateDir, which may differ from
+// where they were backed up. Unless overwrite is set, it refuses to replace
+// any existing file and writes nothing. It returns the paths written.
+func Restore(r io.Reader, passphrase string, overwrite bool) ([]string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := len(backupMagic) + 4 + backupSaltSize
+	if len(data) < headerSize || string(data[:len(backupMagic)]) != backupMagic {
+		return nil, fmt.Errorf("not a cloudflare-token-generator backup")
+	}
+	header := data[:headerSize]
+	iterations := int(binary.BigEndian.Uint32(header[len(backupMagic):]))
+	if iterations < 1 || iterations > 10*backupIterations {
+		return nil, fmt.Errorf("backup header is corrupt")
+	}
+	aead, err := backupCipher(passphrase, header[len(backupMagic)+4:], iterations)
+	if err != nil {
+		return nil, err
+	}
+	rest := data[headerSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("backup is truncated")
+	}
+	archive, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted backup")
+	}
+
+	configPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	stateDir, err := StateDir()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		path    string
+		data    []byte
+		modTime time.Time
+	}
+	var files []file
+	tr := tar.NewReader(zr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(h.Name)
+		var dest string
+		switch dir, rest, _ := strings.Cut(name, "/"); {
+		case h.Typeflag != tar.TypeReg || path.IsAbs(name) || strings.HasPrefix(name, "../") || rest == "":
+			return nil, fmt.Errorf("backup contains an invalid entry %q", h.Name)
+		case dir == "config":
+			if !strings.HasPrefix(rest, "config.") || strings.Contains(rest, "/") {
+				return nil, fmt.Errorf("backup contains an invalid entry %q", h.Name)
+			}
+			dest = filepath.Join(filepath.Dir(configPath), rest)
+		case dir == "state":
+			dest = filepath.Join(stateDir, filepath.FromSlash(rest))
+		default:
+			return nil, fmt.Errorf("backup contains an invalid entry %q", h.Name)
+		}
+		body, err := io.ReadAll(io.LimitReader(tr, maxBackupFile+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > maxBackupFile {
+			return nil, fmt.Errorf("backup entry %q is larger than %d MiB", h.Name, maxBackupFile>>20)
+		}
+		files = append(files, file{path: dest, data: body, modTime: h.ModTime})
+	}
+
+	if !overwrite {
+		var existing []string
+		for _, f := range files {
+			if _, err := os.Stat(f.path); err == nil {
+				existing = append(existing, f.path)
+			}
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("restore would overwrite %s", strings.Join(existing, ", "))
+		}
+	}
+	var written []string
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+			return written, err
+		}
+		if err := os.WriteFile(f.path, f.data, 0600); err != nil {
+			return written, err
+		}
+		os.Chtimes(f.path, f.modTime, f.modTime)
+		written = append(written, f.path)
+	}
+	return written, nil
+}
+
+func backupCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(passphrase), salt, iterations, 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a key as in RFC 8018 with HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,134 @@
+package cftoken
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		// The first is from RFC 7914, section 11; the rest are the widely
+		// used vectors extending RFC 6070 to SHA-256.
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"password", "salt", 2, 32, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, 40, "348c89dbcbd32b2f32d814b8116e84cf2b17347ebc1800181c4e2a1fb8dd53e1c635518c7dac47e9"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.keyLen, got, tt.want)
+		}
+	}
+}
+
+// setupBackupDirs points the config and state directories at a fresh
+// temporary directory and returns the state directory.
+func setupBackupDirs(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("APPDATA", home)
+	state := filepath.Join(home, "state")
+	t.Setenv("CFTG_STATE_DIR", state)
+	return state
+}
+
+func TestBackupRestore(t *testing.T) {
+	const passphrase = "correct horse battery"
+	state := setupBackupDirs(t)
+	files := map[string]string{
+		"inventory.json":     `{"tokens":[]}`,
+		"watch-zones/a.json": `{"zones":["example.com"]}`,
+	}
+	for name, data := range files {
+		path := filepath.Join(state, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var archive bytes.Buffer
+	if _, err := Backup(&archive, passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), "wrong passphrase", false); err == nil {
+		t.Error("Restore with the wrong passphrase succeeded")
+	}
+	tampered := bytes.Clone(archive.Bytes())
+	tampered[len(tampered)-1] ^= 1
+	if _, err := Restore(bytes.NewReader(tampered), passphrase, false); err == nil {
+		t.Error("Restore of a tampered backup succeeded")
+	}
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), passphrase, false); err == nil {
+		t.Error("Restore over existing files succeeded without overwrite")
+	}
+
+	state = setupBackupDirs(t)
+	written, err := Restore(bytes.NewReader(archive.Bytes()), passphrase, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(written) != len(files) {
+		t.Errorf("Restore wrote %d files, want %d", len(written), len(files))
+	}
+	for name, want := range files {
+		got, err := os.ReadFile(filepath.Join(state, filepath.FromSlash(name)))
+		if err != nil {
+			t.Error(err)
+		} else if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// TestRestoreOversized checks that an entry over maxBackupFile is refused
+// rather than restored truncated.
+func TestRestoreOversized(t *testing.T) {
+	const passphrase = "correct horse battery"
+	setupBackupDirs(t)
+
+	var archive bytes.Buffer
+	zw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "state/inventory.json", Mode: 0600, Size: maxBackupFile + 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(make([]byte, maxBackupFile+1)); err != nil {
+		t.Fatal(err)
+	}
+	tw.Close()
+	zw.Close()
+
+	// Seal it as Backup does, with one iteration to keep the test fast.
+	salt := make([]byte, backupSaltSize)
+	rand.Read(salt)
+	header := binary.BigEndian.AppendUint32([]byte(backupMagic), 1)
+	header = append(header, salt...)
+	aead, err := backupCipher(passphrase, salt, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	sealed := append(append(header, nonce...), aead.Seal(nil, nonce, archive.Bytes(), header)...)
+
+	_, err = Restore(bytes.NewReader(sealed), passphrase, false)
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Restore = %v, want an error for the oversized entry", err)
+	}
+}
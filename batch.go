@@ -0,0 +1,217 @@
+package cftoken
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BatchStatus is the outcome of one manifest entry.
+type BatchStatus string
+
+const (
+	BatchCreated BatchStatus = "created"
+	BatchFailed  BatchStatus = "failed"
+	BatchSkipped BatchStatus = "skipped"
+)
+
+// BatchResult reports what happened to one manifest entry.
+type BatchResult struct {
+	Entry    ManifestToken
+	Status   BatchStatus
+	Token    *Token
+	Attempts int
+	// Delivered is set when the secret was written to the entry's sink. If
+	// delivery fails, Err is a *DeliveryError and the token was revoked or
+	// rolled.
+	Delivered bool
+	Err       error
+}
+
+// BatchOptions controls RunBatch.
+type BatchOptions struct {
+	// Concurrency is the number of tokens created in parallel (default 4).
+	Concurrency int
+	// Retries is how many times a failed creation is retried (default 2;
+	// negative disables retries). Only failures that can't have created the
+	// token are retried; see retrySafe.
+	Retries int
+	// IfExists applies to entries that don't set their own if_exists.
+	IfExists IfExists
+	// Options are applied to every entry, e.g. WithRequestPolicy.
+	Options []Option
+	// Progress, if set, is called after each entry finishes. Calls are
+	// serialized.
+	Progress func(done, total int, r BatchResult)
+}
+
+// RunBatch creates the manifest's tokens with a bounded worker pool. All
+// workers share the Generator's client, so its built-in rate limiter applies
+// across the whole batch. Zones, existing tokens, and parent policies are
+// looked up once for the whole batch, leaving about one request per token.
+// Rate limiting and connection failures are retried with backoff. Entries
+// created under IfExistsCreate get a random idempotency key unless Options
+// set one, so a create that fails after it may have reached Cloudflare is
+// checked for and retried as WithIdempotencyKey describes.
+// Results are returned in manifest order. Entries not started before ctx is
+// cancelled are reported as skipped with ctx.Err(), as are existing tokens
+// kept under IfExistsSkip; entries already started finish, including
+// delivery to their sink. Tokens replaced under IfExistsReplace are revoked
+// once the new secret is delivered to its sink; for entries without a sink,
+// the caller calls RevokeReplaced after storing the secret.
+func (g *Generator) RunBatch(ctx context.Context, entries []ManifestToken, opts BatchOptions) []BatchResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = 2
+	}
+
+	ctx = withBatchCache(ctx)
+	results := make([]BatchResult, len(entries))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+	finish := func(i int, r BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = r
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, len(entries), r)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				finish(i, g.runBatchEntry(ctx, entries[i], opts))
+			}
+		}()
+	}
+
+	for i, e := range entries {
+		if e.Skip {
+			finish(i, BatchResult{Entry: e, Status: BatchSkipped})
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			finish(i, BatchResult{Entry: e, Status: BatchSkipped, Err: ctx.Err()})
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func (g *Generator) runBatchEntry(ctx context.Context, e ManifestToken, opts BatchOptions) BatchResult {
+	r := BatchResult{Entry: e}
+	level := e.Level
+	if level == "" {
+		level = "edit"
+	}
+	ifExists := e.IfExists
+	if ifExists == IfExistsCreate {
+		ifExists = opts.IfExists
+	}
+	if ifExists == "create" {
+		ifExists = IfExistsCreate
+	}
+	entryOpts := append([]Option(nil), opts.Options...)
+	entryOpts = append(entryOpts, e.options()...)
+	entryOpts = append(entryOpts, WithIfExists(ifExists))
+	if ifExists == IfExistsCreate && applyOptions(entryOpts).idempotencyKey == "" {
+		// A create that fails without a definite answer is then looked for
+		// by name instead of being given up on. The other modes find
+		// tokens by their exact name, so they keep it.
+		entryOpts = append(entryOpts, WithIdempotencyKey(""))
+	}
+
+	// Check the sink before creating a token that couldn't be delivered.
+	var sink Sink
+	if e.Sink != "" {
+		var err error
+		if sink, err = ParseSink(e.Sink); err != nil {
+			r.Status = BatchFailed
+			r.Err = err
+			return r
+		}
+	}
+
+	// An entry that has started finishes even if the batch is cancelled.
+	tokenCtx := context.WithoutCancel(ctx)
+	backoff := time.Second
+	for {
+		r.Attempts++
+		opCtx, op := g.startOp(tokenCtx, "GenerateToken")
+		r.Token, r.Err = g.generateToken(opCtx, e.Services, e.Scope, level, entryOpts...)
+		op.end(r.Token, r.Err)
+		if r.Err == nil || !retrySafe(r.Err) || r.Attempts > opts.Retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			r.Err = ctx.Err()
+			r.Status = BatchFailed
+			return r
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if r.Err != nil {
+		r.Status = BatchFailed
+		return r
+	}
+	if r.Token.Existing {
+		r.Status = BatchSkipped
+		return r
+	}
+	r.Status = BatchCreated
+
+	if sink != nil {
+		// The token exists now, so deliver it even if the batch is being
+		// cancelled rather than leave its secret nowhere.
+		ctx := context.WithoutCancel(ctx)
+		if err := g.Deliver(ctx, r.Token, sink, opts.Retries); err != nil {
+			r.Status = BatchFailed
+			r.Err = err
+			return r
+		}
+		r.Delivered = true
+		// The new secret is in place, so the tokens it replaces can go.
+		if err := g.RevokeReplaced(ctx, r.Token); err != nil {
+			r.Status = BatchFailed
+			r.Err = err
+		}
+	}
+	return r
+}
+
+// IsRetryable reports whether err is a transient API or network failure
+// (rate limiting, a 5xx response, or a network error) worth retrying.
+func IsRetryable(err error) bool {
+	var netErr net.Error
+	status := responseStatus(err)
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError || errors.As(err, &netErr)
+}
+
+// retrySafe reports whether a failed entry can be retried without risking a
+// second token: Cloudflare refused the request for rate limiting, or the
+// connection failed before anything was sent. A server error or a dropped
+// connection may come after the token was created.
+func retrySafe(err error) bool {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	return responseStatus(err) == http.StatusTooManyRequests || errors.As(err, &dnsErr) ||
+		(errors.As(err, &opErr) && opErr.Op == "dial")
+}
@@ -0,0 +1,111 @@
+package cftoken
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// batchCache shares lookups across the entries of one batch, so a batch
+// costs about one API request per token instead of repeating the zone list,
+// the token list for if_exists, and the parent's policies for every entry.
+// Each lookup runs once while workers needing it wait, and different
+// lookups run in parallel. Failed lookups aren't cached, so retries fetch
+// again.
+type batchCache struct {
+	// mu guards lookups and their results. It's never held while fetching.
+	mu      sync.Mutex
+	lookups map[string]interface{}
+}
+
+// lookup is one shared lookup. done is closed once val and err are set.
+type lookup[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+type batchCacheKey struct{}
+
+func withBatchCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, batchCacheKey{}, &batchCache{lookups: make(map[string]interface{})})
+}
+
+// batchCacheFrom returns the batch's cache, or nil outside a batch.
+func batchCacheFrom(ctx context.Context) *batchCache {
+	c, _ := ctx.Value(batchCacheKey{}).(*batchCache)
+	return c
+}
+
+// load returns the result of the lookup named key, calling fetch if no
+// other worker has fetched it or is fetching it.
+func load[T any](ctx context.Context, c *batchCache, key string, fetch func() (T, error)) (T, error) {
+	c.mu.Lock()
+	l, ok := c.lookups[key].(*lookup[T])
+	if !ok {
+		l = &lookup[T]{done: make(chan struct{})}
+		c.lookups[key] = l
+		c.mu.Unlock()
+		defer close(l.done)
+		val, err := fetch()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if err != nil {
+			delete(c.lookups, key)
+		}
+		l.val, l.err = val, err
+		return val, err
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-l.done:
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return l.val, l.err
+}
+
+// listZones returns the zones from the first successful list call.
+func (c *batchCache) listZones(ctx context.Context, list func(context.Context, ...string) ([]Zone, error)) ([]Zone, error) {
+	return load(ctx, c, "zones", func() ([]Zone, error) { return list(ctx) })
+}
+
+// listTokens returns the tokens of the named parent ("" for api_token),
+// including those created since they were listed.
+func (c *batchCache) listTokens(ctx context.Context, name string, list func(context.Context) ([]APIToken, error)) ([]APIToken, error) {
+	return load(ctx, c, "tokens:"+name, func() ([]APIToken, error) { return list(ctx) })
+}
+
+// created adds a token created during the batch by the named parent to its
+// cached token list, and to api_token's, which if_exists searches by name.
+func (c *batchCache) created(name string, t *Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := []string{"tokens:"}
+	if name != "" {
+		keys = append(keys, "tokens:"+name)
+	}
+	for _, key := range keys {
+		l, ok := c.lookups[key].(*lookup[[]APIToken])
+		if !ok {
+			continue
+		}
+		select {
+		case <-l.done:
+			l.val = append(l.val, APIToken{ID: t.ID, Name: t.Name})
+		default:
+			// Still being listed, which may or may not include the token.
+		}
+	}
+}
+
+// parentPolicies returns the cached policies of the named parent ("" for
+// api_token), fetching them with fetch the first time.
+func (c *batchCache) parentPolicies(ctx context.Context, name string, fetch func() ([]policy.Policy, error)) ([]policy.Policy, error) {
+	return load(ctx, c, "parent:"+name, fetch)
+}
@@ -0,0 +1,172 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// fakeBackend answers every call after latency, like a Cloudflare API a
+// few milliseconds away, and counts the calls.
+type fakeBackend struct {
+	latency time.Duration
+	calls   atomic.Int64
+	created atomic.Int64
+}
+
+func (f *fakeBackend) call() {
+	f.calls.Add(1)
+	time.Sleep(f.latency)
+}
+
+func (f *fakeBackend) APITokens(ctx context.Context) ([]APIToken, error) {
+	f.call()
+	tokens := make([]APIToken, 10)
+	for i := range tokens {
+		tokens[i] = APIToken{ID: fmt.Sprintf("existing-%d", i), Name: fmt.Sprintf("existing-%d", i)}
+	}
+	return tokens, nil
+}
+
+// GetAPIToken returns the parent token, which grants every DNS permission
+// on every zone.
+func (f *fakeBackend) GetAPIToken(ctx context.Context, tokenID string) (APIToken, error) {
+	f.call()
+	var groups []policy.PermissionGroup
+	for _, p := range Services["dns"].Permissions {
+		groups = append(groups, policy.PermissionGroup{ID: p.ID, Name: p.Name})
+	}
+	return APIToken{ID: tokenID, Status: "active", Policies: []policy.Policy{{
+		Effect:           "allow",
+		Resources:        map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"},
+		PermissionGroups: groups,
+	}}}, nil
+}
+
+func (f *fakeBackend) CreateAPIToken(ctx context.Context, token APIToken) (APIToken, error) {
+	f.call()
+	token.ID = fmt.Sprintf("token-%d", f.created.Add(1))
+	token.Value = "secret"
+	return token, nil
+}
+
+func (f *fakeBackend) UpdateAPIToken(ctx context.Context, tokenID string, token APIToken) (APIToken, error) {
+	f.call()
+	return token, nil
+}
+
+func (f *fakeBackend) RollAPIToken(ctx context.Context, tokenID string) (string, error) {
+	f.call()
+	return "secret", nil
+}
+
+func (f *fakeBackend) DeleteAPIToken(ctx context.Context, tokenID string) error {
+	f.call()
+	return nil
+}
+
+func (f *fakeBackend) VerifyAPIToken(ctx context.Context) (TokenStatus, error) {
+	f.call()
+	return TokenStatus{ID: "parent", Status: "active"}, nil
+}
+
+func (f *fakeBackend) ListAPITokensPermissionGroups(ctx context.Context) ([]policy.PermissionGroup, error) {
+	f.call()
+	return nil, nil
+}
+
+func (f *fakeBackend) ListZones(ctx context.Context, z ...string) ([]Zone, error) {
+	f.call()
+	return []Zone{{ID: "023e105f4ecef8ad9ca31a8372d0c353", Name: "example.com", Account: ZoneAccount{ID: "01a7362d577a6c3019a474fd6f485823"}}}, nil
+}
+
+func (f *fakeBackend) Accounts(ctx context.Context, params AccountsParams) ([]Account, ResultInfo, error) {
+	f.call()
+	return nil, ResultInfo{}, nil
+}
+
+func (f *fakeBackend) Account(ctx context.Context, accountID string) (Account, ResultInfo, error) {
+	f.call()
+	return Account{ID: accountID}, ResultInfo{}, nil
+}
+
+func (f *fakeBackend) AccountMembers(ctx context.Context, accountID string, pageOpts PageOptions) ([]AccountMember, ResultInfo, error) {
+	f.call()
+	return nil, ResultInfo{}, nil
+}
+
+func (f *fakeBackend) UserDetails(ctx context.Context) (User, error) {
+	f.call()
+	return User{}, nil
+}
+
+func (f *fakeBackend) Raw(ctx context.Context, method, endpoint string, data interface{}, headers http.Header) (RawResponse, error) {
+	f.call()
+	return RawResponse{}, nil
+}
+
+// BenchmarkBatch creates the same tokens through RunBatch, which shares
+// the zone list, token list, and parent policies, and one at a time without
+// the cache. requests/op is the number of API calls per batch.
+func BenchmarkBatch(b *testing.B) {
+	b.Setenv("CFTG_STATE_DIR", b.TempDir())
+	var entries []ManifestToken
+	for i := 0; i < 20; i++ {
+		entries = append(entries, ManifestToken{Name: fmt.Sprintf("dns-%d", i), Services: []string{"dns"}, Scope: "all", Level: "read"})
+	}
+	opts := []Option{WithZones("example.com"), WithParentLimit(false)}
+
+	newGen := func(b *testing.B) (*Generator, *fakeBackend) {
+		fake := &fakeBackend{latency: time.Millisecond}
+		g, err := NewWithBackend(Config{APIToken: "parent", AccountID: "01a7362d577a6c3019a474fd6f485823"}, func(Config, *http.Client) (Backend, error) {
+			return fake, nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		return g, fake
+	}
+
+	b.Run("cached", func(b *testing.B) {
+		g, fake := newGen(b)
+		for i := 0; i < b.N; i++ {
+			for _, r := range g.RunBatch(context.Background(), entries, BatchOptions{Concurrency: 4, Options: opts}) {
+				if r.Err != nil {
+					b.Fatal(r.Err)
+				}
+			}
+		}
+		b.ReportMetric(float64(fake.calls.Load())/float64(b.N), "requests/op")
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		g, fake := newGen(b)
+		for i := 0; i < b.N; i++ {
+			var wg sync.WaitGroup
+			work := make(chan ManifestToken)
+			for w := 0; w < 4; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for e := range work {
+						if _, err := g.generateToken(context.Background(), e.Services, e.Scope, e.Level, opts...); err != nil {
+							b.Error(err)
+						}
+					}
+				}()
+			}
+			for _, e := range entries {
+				work <- e
+			}
+			close(work)
+			wg.Wait()
+		}
+		b.ReportMetric(float64(fake.calls.Load())/float64(b.N), "requests/op")
+	})
+}
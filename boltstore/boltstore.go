@@ -0,0 +1,140 @@
+// Package boltstore keeps the webhook's state in a local bbolt database.
+package boltstore
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+var (
+	requestsBucket = []byte("requests")
+	noncesBucket   = []byte("nonces")
+)
+
+// Store is a cftoken.WebhookStore in a local bbolt database. The file is locked
+// while open, so only one process can use it at a time.
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the database at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is in use by another process", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{requestsBucket, noncesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("opening %s: %w", path, err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) PutRequest(ctx context.Context, r cftoken.WebhookRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(requestsBucket).Put([]byte(r.ID), data)
+	})
+}
+
+func (s *Store) Requests(ctx context.Context, status string) ([]cftoken.WebhookRecord, error) {
+	var records []cftoken.WebhookRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(requestsBucket).ForEach(func(k, v []byte) error {
+			var r cftoken.WebhookRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("request %s: %w", k, err)
+			}
+			if status == "" || r.Status == status {
+				records = append(records, r)
+			}
+			return nil
+		})
+	})
+	slices.SortStableFunc(records, func(a, b cftoken.WebhookRecord) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return records, err
+}
+
+func (s *Store) UseNonce(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	unused := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(noncesBucket)
+		if v := b.Get([]byte(key)); len(v) == 8 && now.Before(time.Unix(int64(binary.BigEndian.Uint64(v)), 0)) {
+			return nil
+		}
+		unused = true
+		return b.Put([]byte(key), binary.BigEndian.AppendUint64(nil, uint64(now.Add(ttl).Unix())))
+	})
+	return unused, err
+}
+
+func (s *Store) Prune(ctx context.Context, before time.Time) error {
+	now := time.Now()
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := deleteWhere(tx.Bucket(requestsBucket), func(v []byte) bool {
+			var r cftoken.WebhookRecord
+			return json.Unmarshal(v, &r) == nil && r.Prunable(before)
+		})
+		if err != nil {
+			return err
+		}
+		return deleteWhere(tx.Bucket(noncesBucket), func(v []byte) bool {
+			return len(v) != 8 || !now.Before(time.Unix(int64(binary.BigEndian.Uint64(v)), 0))
+		})
+	})
+}
+
+// deleteWhere deletes the keys in b whose values match.
+func deleteWhere(b *bolt.Bucket, match func(v []byte) bool) error {
+	var keys [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if match(v) {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error { return nil })
+}
+
+func (s *Store) Close() error { return s.db.Close() }
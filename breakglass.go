@@ -0,0 +1,177 @@
+package cftoken
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultBreakGlassTTL caps break-glass tokens when break_glass.max_ttl isn't
+// configured.
+const DefaultBreakGlassTTL = time.Hour
+
+// BreakGlassConfig controls tokens that override a guardrail.
+type BreakGlassConfig struct {
+	// MaxTTL caps the lifetime of break-glass tokens, e.g. "1h". Defaults to
+	// DefaultBreakGlassTTL.
+	MaxTTL string `yaml:"max_ttl,omitempty"`
+	// AuditLog is the JSON Lines file overrides are appended to. Defaults to
+	// breakglass.log in the state directory.
+	AuditLog string `yaml:"audit_log,omitempty"`
+	// Webhook receives each override as a JSON POST.
+	Webhook string `yaml:"webhook,omitempty"`
+}
+
+// BreakGlassEvent records a token created in spite of a guardrail.
+type BreakGlassEvent struct {
+	Time      time.Time  `json:"time"`
+	Requester string     `json:"requester"`
+	Reason    string     `json:"reason"`
+	Guardrail string     `json:"guardrail"`
+	Violation string     `json:"violation"`
+	TokenID   string     `json:"token_id"`
+	TokenName string     `json:"token_name"`
+	Services  []string   `json:"services,omitempty"`
+	Scope     string     `json:"scope"`
+	Level     string     `json:"level"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+	// Text is a one-line summary, so chat incoming webhooks can post the
+	// event as is.
+	Text string `json:"text"`
+}
+
+// WithBreakGlass lets the token override configured guardrails. reason is
+// required. An overriding token's TTL is capped at break_glass.max_ttl, and
+// the override is appended to the break-glass audit log and sent to the
+// configured webhook; if either fails, the token is revoked.
+func WithBreakGlass(reason string) Option {
+	return func(o *tokenOptions) {
+		o.breakGlass = true
+		o.breakGlassReason = strings.TrimSpace(reason)
+	}
+}
+
+// BreakGlassLogPath returns the default break-glass audit log path, in the
+// state directory.
+func BreakGlassLogPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "breakglass.log"), nil
+}
+
+// guard checks the guardrails for a request. Under break-glass a violation is
+// allowed: the TTL is capped and the violation returned, to be recorded with
+// recordBreakGlass once the token exists.
+func (g *Generator) guard(ctx context.Context, o *tokenOptions, services []Service, scope, level string, zoneIDs []string) (*GuardrailError, error) {
+	if o.breakGlass && o.breakGlassReason == "" {
+		return nil, fmt.Errorf("break-glass requires a reason")
+	}
+	err := g.checkGuardrails(ctx, services, scope, level, zoneIDs)
+	var violation *GuardrailError
+	if err == nil || !o.breakGlass || !errors.As(err, &violation) {
+		return nil, err
+	}
+	if o.ttl == 0 || o.ttl > g.breakGlassTTL {
+		o.ttl = g.breakGlassTTL
+	}
+	return violation, nil
+}
+
+// recordBreakGlass logs and announces a token that overrode a guardrail. A
+// break-glass token must never exist unrecorded, so it is revoked if either
+// step fails.
+func (g *Generator) recordBreakGlass(ctx context.Context, t *Token, o tokenOptions, violation *GuardrailError) error {
+	if violation == nil || t.Existing {
+		return nil
+	}
+	requester := o.requester
+	if requester == "" {
+		requester = Requester()
+	}
+	event := BreakGlassEvent{
+		Time:      time.Now().UTC(),
+		Requester: requester,
+		Reason:    o.breakGlassReason,
+		Guardrail: violation.Group,
+		Violation: violation.Reason,
+		TokenID:   t.ID,
+		TokenName: t.Name,
+		Services:  t.Services,
+		Scope:     t.Scope,
+		Level:     t.Level,
+		ExpiresOn: t.ExpiresOn,
+	}
+	event.Text = fmt.Sprintf("Break-glass: %s created token %q overriding guardrail %q (%s). Reason: %s",
+		requester, t.Name, violation.Group, violation.Reason, event.Reason)
+
+	err := g.appendBreakGlassLog(event)
+	if err == nil && g.breakGlass.Webhook != "" {
+		err = g.postWebhook(ctx, g.breakGlass.Webhook, event)
+	}
+	if err == nil {
+		return nil
+	}
+	if rerr := g.RevokeToken(ctx, t.ID); rerr != nil {
+		return fmt.Errorf("recording break-glass: %w; token %s could not be revoked: %v", err, t.ID, rerr)
+	}
+	return fmt.Errorf("recording break-glass: %w; token %s was revoked", err, t.ID)
+}
+
+func (g *Generator) appendBreakGlassLog(event BreakGlassEvent) error {
+	path := g.breakGlass.AuditLog
+	if path == "" {
+		var err error
+		if path, err = BreakGlassLogPath(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// postWebhook sends v to url as a JSON POST.
+func (g *Generator) postWebhook(ctx context.Context, url string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("notifying webhook: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notifying webhook: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("notifying webhook: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package cftoken
+
+import (
+	"sort"
+	"strings"
+)
+
+// Bundles are named sets of services that are usually granted together, such
+// as everything needed to deploy a Worker. A bundle name is accepted anywhere
+// a service name is; zone and account services in it still get separate
+// policies.
+var Bundles = map[string][]string{
+	// Uploading scripts is account-scoped, but attaching them to routes
+	// needs the zone-scoped Workers Routes groups.
+	"workers-deploy": {"workers", "workers-routes"},
+}
+
+// ExpandServices replaces bundle names in services with the bundle's
+// services, dropping duplicates while keeping the order of first use.
+func ExpandServices(services []string) []string {
+	seen := make(map[string]bool)
+	var expanded []string
+	add := func(s string) {
+		if !seen[s] {
+			seen[s] = true
+			expanded = append(expanded, s)
+		}
+	}
+	for _, s := range services {
+		key := strings.ToLower(strings.TrimSpace(s))
+		members, ok := Bundles[key]
+		if !ok {
+			add(key)
+			continue
+		}
+		for _, m := range members {
+			add(m)
+		}
+	}
+	return expanded
+}
+
+// ListBundles returns the bundle names in sorted order.
+func ListBundles() []string {
+	names := make([]string, 0, len(Bundles))
+	for name := range Bundles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,103 @@
+package cftoken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// ResourceScope indicates whether a service is scoped to a zone or account.
+type ResourceScope = policy.ResourceScope
+
+const (
+	ResourceScopeZone    = policy.ResourceScopeZone
+	ResourceScopeAccount = policy.ResourceScopeAccount
+)
+
+// Permission maps a Cloudflare permission group name to its ID.
+type Permission = policy.Permission
+
+// Service defines a Cloudflare service and the permissions needed to access it.
+type Service = policy.Service
+
+// CatalogVersion identifies the permission ID snapshot in Services: a short
+// SHA-256 over every service's key, scope, and permission group IDs. Receipts
+// and the inventory record it so audits can tell which catalog minted a token.
+func CatalogVersion() string {
+	keys := make([]string, 0, len(Services))
+	for key := range Services {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		svc := Services[key]
+		fmt.Fprintf(h, "%s\x00%s\x00", key, svc.ResourceScope)
+		for _, p := range svc.Permissions {
+			fmt.Fprintf(h, "%s\x00", p.ID)
+		}
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+type catalogPermission struct {
+	ID   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+}
+
+type catalogService struct {
+	Name        string              `json:"name" yaml:"name"`
+	Description string              `json:"description" yaml:"description"`
+	Scope       ResourceScope       `json:"scope" yaml:"scope"`
+	Levels      []string            `json:"levels" yaml:"levels"`
+	Deprecated  bool                `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	ReplacedBy  string              `json:"replaced_by,omitempty" yaml:"replaced_by,omitempty"`
+	Plan        string              `json:"plan,omitempty" yaml:"plan,omitempty"`
+	Permissions []catalogPermission `json:"permissions" yaml:"permissions"`
+}
+
+// ExportCatalog writes the full service catalog, including permission group
+// names, IDs, and resource scopes, to w. Format is "json" or "yaml".
+func ExportCatalog(w io.Writer, format string) error {
+	var catalog []catalogService
+	for _, svc := range ListServices() {
+		entry := catalogService{
+			Name:        svc.Name,
+			Description: svc.Description,
+			Scope:       svc.ResourceScope,
+			Levels:      ServiceLevels(svc),
+			Deprecated:  svc.Deprecated,
+			ReplacedBy:  svc.ReplacedBy,
+			Plan:        svc.Plan,
+		}
+		for _, p := range svc.Permissions {
+			entry.Permissions = append(entry.Permissions, catalogPermission{ID: p.ID, Name: p.Name})
+		}
+		catalog = append(catalog, entry)
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(map[string]interface{}{"services": catalog})
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(map[string]interface{}{"services": catalog}); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unsupported catalog format %q, must be \"json\" or \"yaml\"", format)
+	}
+}
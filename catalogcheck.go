@@ -0,0 +1,81 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// CatalogDrift is a catalog permission that no longer matches Cloudflare's
+// permission group list.
+type CatalogDrift struct {
+	Service    string
+	Permission Permission
+	// LiveName is the group's current name; empty for missing groups.
+	LiveName string
+}
+
+func (d CatalogDrift) String() string {
+	if d.LiveName == "" || d.LiveName == d.Permission.Name {
+		return fmt.Sprintf("%s: %s (%s)", d.Service, d.Permission.Name, d.Permission.ID)
+	}
+	return fmt.Sprintf("%s: %s (%s), now %q", d.Service, d.Permission.Name, d.Permission.ID, d.LiveName)
+}
+
+// CatalogReport is the result of ValidateCatalog.
+type CatalogReport struct {
+	// Checked is the number of catalog permissions compared.
+	Checked int
+	// Missing permissions have an ID Cloudflare no longer lists; tokens
+	// requesting them will be rejected.
+	Missing []CatalogDrift
+	// Renamed permissions still exist under a different name.
+	Renamed []CatalogDrift
+	// Deprecated permissions are marked deprecated in their live name.
+	Deprecated []CatalogDrift
+}
+
+// OK reports whether the catalog matches the live list.
+func (r *CatalogReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Renamed) == 0 && len(r.Deprecated) == 0
+}
+
+// ValidateCatalog checks every permission group ID hard-coded in Services
+// against the live /user/tokens/permission_groups list, so users of the
+// package can catch drift in their own pipelines without regenerating the
+// catalog. api only needs to be able to list permission groups.
+func ValidateCatalog(ctx context.Context, api Backend) (*CatalogReport, error) {
+	groups, err := api.ListAPITokensPermissionGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing permission groups: %w", err)
+	}
+	live := make(map[string]string, len(groups))
+	for _, g := range groups {
+		live[g.ID] = g.Name
+	}
+
+	report := &CatalogReport{}
+	for _, svc := range ListServices() {
+		for _, p := range svc.Permissions {
+			report.Checked++
+			d := CatalogDrift{Service: svc.Name, Permission: p}
+			name, ok := live[p.ID]
+			if !ok {
+				report.Missing = append(report.Missing, d)
+				continue
+			}
+			d.LiveName = name
+			if strings.Contains(strings.ToLower(name), "deprecated") {
+				report.Deprecated = append(report.Deprecated, d)
+			} else if name != p.Name {
+				report.Renamed = append(report.Renamed, d)
+			}
+		}
+	}
+	return report, nil
+}
+
+// ValidateCatalog checks the catalog using the generator's parent credential.
+func (g *Generator) ValidateCatalog(ctx context.Context) (*CatalogReport, error) {
+	return ValidateCatalog(ctx, g.api)
+}
@@ -4,178 +4,293 @@ package cftoken
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
-	cloudflare "github.com/cloudflare/cloudflare-go"
-	"gopkg.in/yaml.v3"
+	"github.com/jackmunro/cloudflare-token-generator/policy"
 )
 
-const configDir = ".goGenerateCFToken"
-
-// Config holds the stored credentials and defaults.
-type Config struct {
-	APIToken  string `yaml:"api_token"`
-	AccountID string `yaml:"account_id"`
-	ZoneID    string `yaml:"zone_id,omitempty"`
+// Token describes a token created by the Generator.
+type Token struct {
+	ID        string
+	Name      string
+	Value     string
+	Services  []string
+	Scope     string
+	Level     string
+	Policies  []policy.Policy
+	Condition *TokenCondition
+	NotBefore *time.Time
+	ExpiresOn *time.Time
+	// Removed lists grants dropped by WithParentLimit(true).
+	Removed []string
+	// Existing is set when WithIfExists(IfExistsSkip) found a token with the
+	// same name; Value is empty.
+	Existing bool
+	// Replaces lists tokens to revoke with RevokeReplaced under
+	// IfExistsReplace.
+	Replaces []string
+	// Rolled is set when IfExistsRoll updated an existing token in place.
+	Rolled bool
+	// Provenance is set by WithProvenance.
+	Provenance *Provenance
+	// Parent names the configured parent that created the token; empty for
+	// api_token.
+	Parent string
+	// Requester is set by WithRequester or WithRequestPolicy.
+	Requester string
+	// TokenCount is how many tokens the parent's user held once this one
+	// was created, counted against TokenLimit; both are zero if the limit
+	// is disabled or no token was created.
+	TokenCount int
+	TokenLimit int
 }
 
 // Generator creates scoped Cloudflare API tokens.
 type Generator struct {
-	api       *cloudflare.API
-	apiToken  string
-	accountID string
-	zoneID    string
+	api    Backend
+	client *http.Client
+	// newBackend opens clients for credentials other than the parent's,
+	// such as a new token being verified.
+	newBackend    BackendFactory
+	authType      string
+	accountID     string
+	zoneID        string
+	zoneGroups    map[string]ZoneGroup
+	guardrails    map[string]Guardrail
+	breakGlass    BreakGlassConfig
+	breakGlassTTL time.Duration
+
+	auditExporters []auditExporter
+	telemetry      *telemetry
+
+	plan         string
+	planMu       sync.Mutex
+	detectedPlan string
+
+	parents []parent
+
+	quotas map[string]Quota
+	// quotaLocks serializes each requester's quota checks; quotaMu guards
+	// the map.
+	quotaLocks map[string]*sync.Mutex
+	quotaMu    sync.Mutex
+
+	tokenLimit int
+}
+
+// New creates a Generator from the given config.
+func New(cfg Config) (*Generator, error) {
+	return newGenerator(cfg, defaultBackend)
 }
 
-// LoadConfig reads the config from ~/.goGenerateCFToken/config.yaml.
-func LoadConfig() (*Config, error) {
-	home, err := os.UserHomeDir()
+func newGenerator(cfg Config, newBackend BackendFactory) (*Generator, error) {
+	switch cfg.AuthType {
+	case "", AuthTypeAPIToken, AuthTypeAPIKey:
+	default:
+		return nil, fmt.Errorf("unknown auth_type %q (use %s or %s)", cfg.AuthType, AuthTypeAPIToken, AuthTypeAPIKey)
+	}
+	client, err := newHTTPClient(cfg)
 	if err != nil {
 		return nil, err
 	}
-	data, err := os.ReadFile(filepath.Join(home, configDir, "config.yaml"))
+	api, err := newBackend(cfg, client)
 	if err != nil {
-		return nil, fmt.Errorf("config not found, run init first: %w", err)
+		return nil, fmt.Errorf("creating cloudflare client: %w", err)
+	}
+	breakGlassTTL := DefaultBreakGlassTTL
+	if cfg.BreakGlass.MaxTTL != "" {
+		if breakGlassTTL, err = ParseTTL(cfg.BreakGlass.MaxTTL); err != nil {
+			return nil, fmt.Errorf("break_glass.max_ttl: %w", err)
+		}
 	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	tel := newTelemetry(nil, nil)
+	client.Transport = tracingTransport{base: client.Transport, t: &tel}
+	exporters, err := auditExporters(cfg.AuditExport, client)
+	if err != nil {
 		return nil, err
 	}
-	return &cfg, nil
-}
-
-// SaveConfig writes the config to ~/.goGenerateCFToken/config.yaml.
-func SaveConfig(cfg *Config) error {
-	home, err := os.UserHomeDir()
+	plan, err := ParsePlan(cfg.Plan)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("plan: %w", err)
 	}
-	dir := filepath.Join(home, configDir)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return err
+	if _, err := cfg.Location(); err != nil {
+		return nil, err
 	}
-	data, err := yaml.Marshal(cfg)
+	parents, err := newParents(cfg, client, newBackend)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return os.WriteFile(filepath.Join(dir, "config.yaml"), data, 0600)
-}
-
-// New creates a Generator from the given config.
-func New(cfg Config) (*Generator, error) {
-	api, err := cloudflare.NewWithAPIToken(cfg.APIToken)
+	quotas, err := parseQuotas(cfg.Quotas)
 	if err != nil {
-		return nil, fmt.Errorf("creating cloudflare client: %w", err)
+		return nil, err
 	}
 	return &Generator{
-		api:       api,
-		apiToken:  cfg.APIToken,
-		accountID: cfg.AccountID,
-		zoneID:    cfg.ZoneID,
+		api:           api,
+		client:        client,
+		newBackend:    newBackend,
+		authType:      cfg.AuthType,
+		accountID:     cfg.AccountID,
+		zoneID:        cfg.ZoneID,
+		zoneGroups:    cfg.ZoneGroups,
+		guardrails:    cfg.Guardrails,
+		breakGlass:    cfg.BreakGlass,
+		breakGlassTTL: breakGlassTTL,
+
+		auditExporters: exporters,
+		telemetry:      &tel,
+		plan:           plan,
+		parents:        parents,
+		quotas:         quotas,
+		tokenLimit:     cfg.TokenLimit,
 	}, nil
 }
 
+// NewWithAPIKey creates a Generator that authenticates with a legacy Global
+// API Key and account email instead of an API token. The key can mint tokens
+// like an API token with API Tokens Write, but grants full access to
+// everything the user can reach, so prefer migrating to a scoped parent token.
+func NewWithAPIKey(key, email string, cfg Config) (*Generator, error) {
+	cfg.AuthType = AuthTypeAPIKey
+	cfg.APIKey = key
+	cfg.Email = email
+	return New(cfg)
+}
+
 // Service convenience methods — each delegates to Generate.
 
-func (g *Generator) DNS(scope string) (string, error)          { return g.Generate("dns", scope) }
-func (g *Generator) Workers(scope string) (string, error)      { return g.Generate("workers", scope) }
-func (g *Generator) R2(scope string) (string, error)           { return g.Generate("r2", scope) }
-func (g *Generator) Pages(scope string) (string, error)        { return g.Generate("pages", scope) }
-func (g *Generator) KV(scope string) (string, error)           { return g.Generate("kv", scope) }
-func (g *Generator) Cache(scope string) (string, error)        { return g.Generate("cache", scope) }
-func (g *Generator) Firewall(scope string) (string, error)     { return g.Generate("firewall", scope) }
-func (g *Generator) SSL(scope string) (string, error)          { return g.Generate("ssl", scope) }
-func (g *Generator) WAF(scope string) (string, error)          { return g.Generate("waf", scope) }
-func (g *Generator) Stream(scope string) (string, error)       { return g.Generate("stream", scope) }
-func (g *Generator) AI(scope string) (string, error)           { return g.Generate("ai", scope) }
-func (g *Generator) D1(scope string) (string, error)           { return g.Generate("d1", scope) }
-func (g *Generator) Queues(scope string) (string, error)       { return g.Generate("queues", scope) }
-func (g *Generator) Images(scope string) (string, error)       { return g.Generate("images", scope) }
-func (g *Generator) Tunnels(scope string) (string, error)      { return g.Generate("tunnels", scope) }
-func (g *Generator) Zone(scope string) (string, error)         { return g.Generate("zone", scope) }
-func (g *Generator) LoadBalancer(scope string) (string, error) { return g.Generate("loadbalancer", scope) }
-func (g *Generator) PageRules(scope string) (string, error)    { return g.Generate("pagerules", scope) }
+func (g *Generator) DNS(scope string) (string, error)      { return g.Generate("dns", scope) }
+func (g *Generator) Workers(scope string) (string, error)  { return g.Generate("workers", scope) }
+func (g *Generator) R2(scope string) (string, error)       { return g.Generate("r2", scope) }
+func (g *Generator) Pages(scope string) (string, error)    { return g.Generate("pages", scope) }
+func (g *Generator) KV(scope string) (string, error)       { return g.Generate("kv", scope) }
+func (g *Generator) Cache(scope string) (string, error)    { return g.Generate("cache", scope) }
+func (g *Generator) Firewall(scope string) (string, error) { return g.Generate("firewall", scope) }
+func (g *Generator) SSL(scope string) (string, error)      { return g.Generate("ssl", scope) }
+func (g *Generator) WAF(scope string) (string, error)      { return g.Generate("waf", scope) }
+func (g *Generator) Stream(scope string) (string, error)   { return g.Generate("stream", scope) }
+func (g *Generator) AI(scope string) (string, error)       { return g.Generate("ai", scope) }
+func (g *Generator) D1(scope string) (string, error)       { return g.Generate("d1", scope) }
+func (g *Generator) Queues(scope string) (string, error)   { return g.Generate("queues", scope) }
+func (g *Generator) Images(scope string) (string, error)   { return g.Generate("images", scope) }
+func (g *Generator) Tunnels(scope string) (string, error)  { return g.Generate("tunnels", scope) }
+func (g *Generator) Zone(scope string) (string, error)     { return g.Generate("zone", scope) }
+func (g *Generator) LoadBalancer(scope string) (string, error) {
+	return g.Generate("loadbalancer", scope)
+}
+func (g *Generator) PageRules(scope string) (string, error)  { return g.Generate("pagerules", scope) }
+func (g *Generator) Billing(scope string) (string, error)    { return g.Generate("billing", scope) }
+func (g *Generator) Account(scope string) (string, error)    { return g.Generate("account", scope) }
+func (g *Generator) Members(scope string) (string, error)    { return g.Generate("members", scope) }
+func (g *Generator) Analytics(scope string) (string, error)  { return g.Generate("analytics", scope) }
+func (g *Generator) Bots(scope string) (string, error)       { return g.Generate("bots", scope) }
+func (g *Generator) RateLimit(scope string) (string, error)  { return g.Generate("ratelimit", scope) }
+func (g *Generator) CacheRules(scope string) (string, error) { return g.Generate("cacherules", scope) }
+func (g *Generator) ConfigRules(scope string) (string, error) {
+	return g.Generate("configrules", scope)
+}
+func (g *Generator) Snippets(scope string) (string, error) { return g.Generate("snippets", scope) }
+func (g *Generator) WaitingRoom(scope string) (string, error) {
+	return g.Generate("waitingroom", scope)
+}
+func (g *Generator) SecondaryDNS(scope string) (string, error) {
+	return g.Generate("secondary-dns", scope)
+}
+func (g *Generator) DNSFirewall(scope string) (string, error) {
+	return g.Generate("dns-firewall", scope)
+}
+func (g *Generator) WorkersRoutes(scope string) (string, error) {
+	return g.Generate("workers-routes", scope)
+}
 
 // Generate creates a Cloudflare API token for the given service and scope.
 // Scope is "all" for all resources, or a specific zone/account ID.
-func (g *Generator) Generate(service, scope string) (string, error) {
-	return g.GenerateMulti([]string{service}, scope, "edit")
+func (g *Generator) Generate(service, scope string, opts ...Option) (string, error) {
+	return g.GenerateMulti([]string{service}, scope, "edit", opts...)
 }
 
 // GenerateMulti creates a single Cloudflare API token covering multiple services.
-// Services are looked up by name. Scope is "all" for all resources, or a specific ID.
+// Services are looked up by name, and bundle names expand to their services.
+// Scope is "all" for all resources, a specific ID, or "@group" for every zone
+// in a configured zone group.
 // Level is "read" for read-only permissions or "edit" for read+write permissions.
-func (g *Generator) GenerateMulti(services []string, scope, level string) (string, error) {
-	level = strings.ToLower(level)
-	if level != "read" && level != "edit" {
-		return "", fmt.Errorf("invalid permission level %q, must be \"read\" or \"edit\"", level)
+// Options set the token name, expiry, and request conditions.
+func (g *Generator) GenerateMulti(services []string, scope, level string, opts ...Option) (string, error) {
+	token, err := g.GenerateToken(services, scope, level, opts...)
+	if err != nil {
+		return "", err
 	}
+	return token.Value, nil
+}
+
+// GenerateToken is like GenerateMulti but returns the created token's ID,
+// policies, and validity window alongside its value.
+func (g *Generator) GenerateToken(services []string, scope, level string, opts ...Option) (*Token, error) {
+	ctx, op := g.startOp(context.Background(), "GenerateToken")
+	token, err := g.generateToken(ctx, services, scope, level, opts...)
+	op.end(token, err)
+	return token, err
+}
+
+func (g *Generator) generateToken(ctx context.Context, services []string, scope, level string, opts ...Option) (*Token, error) {
+	o := applyOptions(opts)
+	level = strings.ToLower(level)
+	services = ExpandServices(services)
 
 	var svcs []Service
 	for _, s := range services {
 		svc, ok := Services[strings.ToLower(strings.TrimSpace(s))]
 		if !ok {
-			return "", fmt.Errorf("unknown service %q, use ListServices() to see available services", s)
-		}
-		if len(filterPermissions(svc.Permissions, level)) == 0 {
-			return "", fmt.Errorf("service %q does not support %q level (available: %s)",
-				svc.Name, level, strings.Join(ServiceLevels(svc), ", "))
+			return nil, fmt.Errorf("unknown service %q, use ListServices() to see available services", s)
 		}
 		svcs = append(svcs, svc)
 	}
-
-	// Group services by resource scope to create correct policies.
-	var zoneSvcs, accountSvcs []Service
-	for _, svc := range svcs {
-		if svc.ResourceScope == ResourceScopeZone {
-			zoneSvcs = append(zoneSvcs, svc)
-		} else {
-			accountSvcs = append(accountSvcs, svc)
-		}
+	if err := o.admit(services, scope, level); err != nil {
+		return nil, err
+	}
+	if err := g.checkPlan(ctx, svcs); err != nil {
+		return nil, err
 	}
 
-	var policies []cloudflare.APITokenPolicies
-
-	if len(zoneSvcs) > 0 {
-		resources, err := g.buildResources(zoneSvcs[0], scope)
+	buildScope := scope
+	var zoneIDs []string
+	if group, ok := strings.CutPrefix(scope, "@"); ok {
+		ids, err := g.ResolveZoneGroup(ctx, group)
 		if err != nil {
-			return "", err
-		}
-		var permGroups []cloudflare.APITokenPermissionGroups
-		for _, svc := range zoneSvcs {
-			for _, p := range filterPermissions(svc.Permissions, level) {
-				permGroups = append(permGroups, cloudflare.APITokenPermissionGroups{ID: p.ID})
-			}
+			return nil, err
 		}
-		policies = append(policies, cloudflare.APITokenPolicies{
-			Effect:           "allow",
-			Resources:        resources,
-			PermissionGroups: permGroups,
-		})
+		// Account-scoped services use the configured account.
+		buildScope, zoneIDs = "all", ids
 	}
-
-	if len(accountSvcs) > 0 {
-		resources, err := g.buildResources(accountSvcs[0], scope)
-		if err != nil {
-			return "", err
+	if len(o.zones) > 0 {
+		if zoneIDs != nil {
+			return nil, fmt.Errorf("zones cannot be combined with a zone group scope")
 		}
-		var permGroups []cloudflare.APITokenPermissionGroups
-		for _, svc := range accountSvcs {
-			for _, p := range filterPermissions(svc.Permissions, level) {
-				permGroups = append(permGroups, cloudflare.APITokenPermissionGroups{ID: p.ID})
-			}
+		ids, err := g.resolveZones(ctx, o.zones)
+		if err != nil {
+			return nil, fmt.Errorf("resolving zones: %w", err)
 		}
-		policies = append(policies, cloudflare.APITokenPolicies{
-			Effect:           "allow",
-			Resources:        resources,
-			PermissionGroups: permGroups,
-		})
+		zoneIDs = ids
+	}
+	violation, err := g.guard(ctx, &o, svcs, scope, level, zoneIDs)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := g.checkQuota(ctx, o, scope, level)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	popts := o.policyOptions(g.accountID)
+	popts.ZoneIDs = zoneIDs
+	policies, err := policy.Build(svcs, buildScope, level, popts)
+	if err != nil {
+		return nil, err
 	}
 
 	var names []string
@@ -184,140 +299,186 @@ func (g *Generator) GenerateMulti(services []string, scope, level string) (strin
 	}
 	tokenName := fmt.Sprintf("%s-%s-%s", strings.Join(names, "-"), scope, level)
 
-	return g.createToken(tokenName, policies)
+	token, err := g.createToken(ctx, tokenName, policies, o)
+	if err != nil {
+		return nil, err
+	}
+	token.Services = names
+	token.Scope = scope
+	token.Level = level
+	if err := g.recordBreakGlass(ctx, token, o, violation); err != nil {
+		return nil, err
+	}
+	if err := g.recordIssued(ctx, token, o, violation); err != nil {
+		return nil, err
+	}
+	if err := g.recordQuota(ctx, o, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// GenerateForAccounts creates a single token whose account-scoped policy covers
+// every account in accountIDs, for operators managing several customer
+// accounts. Zone-scoped services are scoped by scope exactly as in GenerateMulti.
+func (g *Generator) GenerateForAccounts(services []string, scope string, accountIDs []string, level string, opts ...Option) (string, error) {
+	if len(accountIDs) == 0 {
+		return "", fmt.Errorf("at least one account ID is required")
+	}
+	return g.GenerateMulti(services, scope, level, append(opts, WithAccounts(accountIDs...))...)
 }
 
-func (g *Generator) createToken(name string, policies []cloudflare.APITokenPolicies) (string, error) {
-	token := cloudflare.APIToken{
+func (g *Generator) createToken(ctx context.Context, name string, policies []policy.Policy, o tokenOptions) (*Token, error) {
+	token := APIToken{
 		Name:     name,
 		Policies: policies,
 	}
+	o.apply(&token)
+
+	p := g.parentFor(token.Policies)
+	var removed []string
+	if o.parentLimit {
+		parent, err := g.parentPolicies(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		token.Policies, removed = ClampPolicies(token.Policies, parent, g.zoneAccounts(ctx, token.Policies))
+		if len(removed) > 0 && !o.clamp {
+			return nil, &ExceedsParentError{Excess: removed}
+		}
+		if len(token.Policies) == 0 {
+			return nil, fmt.Errorf("parent token grants none of the requested permissions")
+		}
+	}
 
-	result, err := g.api.CreateAPIToken(context.Background(), token)
+	existing, replaces, err := g.resolveExisting(ctx, token, o.ifExists)
+	if err != nil || existing != nil {
+		if existing != nil {
+			existing.Removed = removed
+			existing.Provenance = o.provenance
+		}
+		return existing, err
+	}
+
+	count, err := g.checkTokenLimit(ctx, p)
 	if err != nil {
-		return "", fmt.Errorf("creating token: %w", err)
+		return nil, err
 	}
 
-	return result.Value, nil
+	var result APIToken
+	if o.idempotencyKey != "" {
+		result, err = g.createIdempotent(ctx, p, token)
+	} else {
+		result, err = p.api.CreateAPIToken(ctx, token)
+	}
+	if err != nil {
+		return nil, explainAPIError("creating token", err)
+	}
+
+	if len(result.Policies) == 0 {
+		result.Policies = token.Policies
+	}
+	if c := batchCacheFrom(ctx); c != nil {
+		c.created(p.name, &Token{ID: result.ID, Name: token.Name})
+	}
+	return &Token{
+		ID:        result.ID,
+		Name:      token.Name,
+		Value:     result.Value,
+		Policies:  result.Policies,
+		Condition: token.Condition,
+		NotBefore: token.NotBefore,
+		ExpiresOn: token.ExpiresOn,
+		Removed:   removed,
+		Replaces:  replaces,
+		Parent:    p.name,
+		Requester: o.requester,
+
+		Provenance: o.provenance,
+		TokenCount: count,
+		TokenLimit: max(g.tokenLimit, 0),
+	}, nil
 }
 
 // ServiceLevels returns the permission levels available for a service.
 // Every service supports "edit" (all permissions). A service supports
 // "read" only if it has at least one permission whose name contains "Read".
 func ServiceLevels(svc Service) []string {
-	for _, p := range svc.Permissions {
-		if strings.Contains(strings.ToLower(p.Name), "read") {
-			return []string{"read", "edit"}
-		}
-	}
-	return []string{"edit"}
+	return policy.Levels(svc)
 }
 
-func filterPermissions(perms []Permission, level string) []Permission {
-	if level == "edit" {
-		return perms
-	}
-	var filtered []Permission
-	for _, p := range perms {
-		if strings.Contains(strings.ToLower(p.Name), "read") {
-			filtered = append(filtered, p)
-		}
+// GodMode generates a single token with edit-level access to every service.
+// It dynamically fetches all available permission groups from the Cloudflare API
+// to ensure complete coverage.
+func (g *Generator) GodMode(opts ...Option) (string, error) {
+	token, err := g.GodModeToken(opts...)
+	if err != nil {
+		return "", err
 	}
-	return filtered
+	return token.Value, nil
 }
 
-func (g *Generator) buildResources(svc Service, scope string) (map[string]interface{}, error) {
-	resources := make(map[string]interface{})
-
-	switch strings.ToLower(scope) {
-	case "all":
-		if svc.ResourceScope == ResourceScopeZone {
-			resources["com.cloudflare.api.account.zone.*"] = "*"
-		} else {
-			if g.accountID == "" {
-				return nil, fmt.Errorf("account_id required for account-scoped service %q with scope \"all\"", svc.Name)
-			}
-			resources["com.cloudflare.api.account."+g.accountID] = "*"
-		}
-	default:
-		// Scope is a specific resource ID
-		if svc.ResourceScope == ResourceScopeZone {
-			resources["com.cloudflare.api.account.zone."+scope] = "*"
-		} else {
-			resources["com.cloudflare.api.account."+scope] = "*"
-		}
-	}
-
-	return resources, nil
+// GodModeToken is like GodMode but returns the created token's ID, policies,
+// and validity window alongside its value.
+func (g *Generator) GodModeToken(opts ...Option) (*Token, error) {
+	ctx, op := g.startOp(context.Background(), "GodModeToken")
+	token, err := g.godModeToken(ctx, opts...)
+	op.end(token, err)
+	return token, err
 }
 
-// permissionGroup represents a permission group returned by the Cloudflare API.
-type permissionGroup struct {
-	ID     string   `json:"id"`
-	Name   string   `json:"name"`
-	Scopes []string `json:"scopes"`
-}
-
-// fetchPermissionGroups fetches all available permission groups from the Cloudflare API.
-func (g *Generator) fetchPermissionGroups() ([]permissionGroup, error) {
-	req, err := http.NewRequest("GET", "https://api.cloudflare.com/client/v4/user/tokens/permission_groups", nil)
-	if err != nil {
-		return nil, err
+func (g *Generator) godModeToken(ctx context.Context, opts ...Option) (*Token, error) {
+	if g.accountID == "" {
+		return nil, fmt.Errorf("account_id required for godmode")
 	}
-	req.Header.Set("Authorization", "Bearer "+g.apiToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("fetching permission groups: %w", err)
+	o := applyOptions(opts)
+	var all []string
+	for _, svc := range ListServices() {
+		all = append(all, svc.Name)
 	}
-	defer resp.Body.Close()
-
-	var result struct {
-		Result  []permissionGroup `json:"result"`
-		Success bool              `json:"success"`
+	if err := o.admit(all, "all", "edit"); err != nil {
+		return nil, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decoding permission groups: %w", err)
+	violation, err := g.guard(ctx, &o, ListServices(), "all", "edit", nil)
+	if err != nil {
+		return nil, err
 	}
-	if !result.Success {
-		return nil, fmt.Errorf("API returned success=false (HTTP %d)", resp.StatusCode)
+	unlock, err := g.checkQuota(ctx, o, "all", "edit")
+	if err != nil {
+		return nil, err
 	}
-	return result.Result, nil
-}
+	defer unlock()
 
-// GodMode generates a single token with edit-level access to every service.
-// It dynamically fetches all available permission groups from the Cloudflare API
-// to ensure complete coverage.
-func (g *Generator) GodMode() (string, error) {
-	if g.accountID == "" {
-		return "", fmt.Errorf("account_id required for godmode")
+	perms, err := g.api.ListAPITokensPermissionGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching permission groups: %w", err)
 	}
-
-	perms, err := g.fetchPermissionGroups()
+	// Leave out groups for products the account's plan doesn't offer.
+	unavailable, err := g.unavailablePermissions(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var zonePerms, accountPerms []cloudflare.APITokenPermissionGroups
+	var zonePerms, accountPerms []policy.PermissionGroup
 	for _, p := range perms {
 		// Sub-tokens cannot manage other tokens.
 		nameLower := strings.ToLower(p.Name)
-		if strings.Contains(nameLower, "api token") {
+		if strings.Contains(nameLower, "api token") || unavailable[p.ID] {
 			continue
 		}
 		scope := deriveScope(p.Scopes)
 		switch scope {
 		case "zone":
-			zonePerms = append(zonePerms, cloudflare.APITokenPermissionGroups{ID: p.ID})
+			zonePerms = append(zonePerms, policy.PermissionGroup{ID: p.ID})
 		case "account":
-			accountPerms = append(accountPerms, cloudflare.APITokenPermissionGroups{ID: p.ID})
+			accountPerms = append(accountPerms, policy.PermissionGroup{ID: p.ID})
 		}
 	}
 
-	var policies []cloudflare.APITokenPolicies
+	var policies []policy.Policy
 
 	if len(zonePerms) > 0 {
-		policies = append(policies, cloudflare.APITokenPolicies{
+		policies = append(policies, policy.Policy{
 			Effect:           "allow",
 			Resources:        map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"},
 			PermissionGroups: zonePerms,
@@ -325,14 +486,29 @@ func (g *Generator) GodMode() (string, error) {
 	}
 
 	if len(accountPerms) > 0 {
-		policies = append(policies, cloudflare.APITokenPolicies{
+		policies = append(policies, policy.Policy{
 			Effect:           "allow",
 			Resources:        map[string]interface{}{"com.cloudflare.api.account." + g.accountID: "*"},
 			PermissionGroups: accountPerms,
 		})
 	}
 
-	return g.createToken("godmode", policies)
+	token, err := g.createToken(ctx, "godmode", policies, o)
+	if err != nil {
+		return nil, err
+	}
+	token.Scope = "all"
+	token.Level = "edit"
+	if err := g.recordBreakGlass(ctx, token, o, violation); err != nil {
+		return nil, err
+	}
+	if err := g.recordIssued(ctx, token, o, violation); err != nil {
+		return nil, err
+	}
+	if err := g.recordQuota(ctx, o, token); err != nil {
+		return nil, err
+	}
+	return token, nil
 }
 
 func deriveScope(scopes []string) string {
@@ -360,8 +536,8 @@ func ListServices() []Service {
 }
 
 // DiscoverAccounts lists accounts accessible by the configured token.
-func (g *Generator) DiscoverAccounts(ctx context.Context) ([]cloudflare.Account, error) {
-	accounts, _, err := g.api.Accounts(ctx, cloudflare.AccountsListParams{})
+func (g *Generator) DiscoverAccounts(ctx context.Context) ([]Account, error) {
+	accounts, _, err := g.api.Accounts(ctx, AccountsParams{})
 	if err != nil {
 		return nil, err
 	}
@@ -369,8 +545,14 @@ func (g *Generator) DiscoverAccounts(ctx context.Context) ([]cloudflare.Account,
 }
 
 // DiscoverZones lists zones accessible by the configured token.
-func (g *Generator) DiscoverZones(ctx context.Context) ([]cloudflare.Zone, error) {
-	zones, err := g.api.ListZones(ctx)
+func (g *Generator) DiscoverZones(ctx context.Context) ([]Zone, error) {
+	list := g.api.ListZones
+	if c := batchCacheFrom(ctx); c != nil {
+		list = func(ctx context.Context, _ ...string) ([]Zone, error) {
+			return c.listZones(ctx, g.api.ListZones)
+		}
+	}
+	zones, err := list(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,206 @@
+// Package client is a high-level facade over cftoken for programs that just
+// need to mint a scoped token. It hides Config and Generator plumbing, fills
+// in defaults, retries transient API failures, and returns typed results.
+//
+//	c, err := client.New(ctx, client.FromEnv())
+//	if err != nil {
+//		return err
+//	}
+//	tok, err := c.MintDNSToken(ctx, client.MintOpts{TTL: 24 * time.Hour})
+//	if err != nil {
+//		return err
+//	}
+//	use(tok.Value)
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// Source fills in part of the configuration. Sources passed to New are
+// applied in order, so later ones override earlier ones.
+type Source func(cfg *cftoken.Config) error
+
+// FromEnv reads CLOUDFLARE_API_TOKEN (or CLOUDFLARE_API_KEY with
+// CLOUDFLARE_EMAIL), CLOUDFLARE_ACCOUNT_ID, and CLOUDFLARE_ZONE_ID. Unset
+// variables leave the configuration unchanged.
+func FromEnv() Source {
+	return func(cfg *cftoken.Config) error {
+		if v := os.Getenv("CLOUDFLARE_API_TOKEN"); v != "" {
+			cfg.APIToken = v
+			cfg.AuthType = cftoken.AuthTypeAPIToken
+		} else if key := os.Getenv("CLOUDFLARE_API_KEY"); key != "" {
+			cfg.APIKey = key
+			cfg.Email = os.Getenv("CLOUDFLARE_EMAIL")
+			cfg.AuthType = cftoken.AuthTypeAPIKey
+		}
+		if v := os.Getenv("CLOUDFLARE_ACCOUNT_ID"); v != "" {
+			cfg.AccountID = v
+		}
+		if v := os.Getenv("CLOUDFLARE_ZONE_ID"); v != "" {
+			cfg.ZoneID = v
+		}
+		return nil
+	}
+}
+
+// FromConfigFile loads the CLI's config file (system-wide, then per-user).
+func FromConfigFile() Source {
+	return func(cfg *cftoken.Config) error {
+		loaded, err := cftoken.LoadConfig()
+		if err != nil {
+			return err
+		}
+		*cfg = *loaded
+		return nil
+	}
+}
+
+// FromConfig uses cfg as is.
+func FromConfig(c cftoken.Config) Source {
+	return func(cfg *cftoken.Config) error {
+		*cfg = c
+		return nil
+	}
+}
+
+// Client mints tokens with a parent credential.
+type Client struct {
+	gen     *cftoken.Generator
+	retries int
+}
+
+// New builds a Client from the given sources, defaulting to FromEnv. If no
+// account ID is configured and the parent credential can see exactly one
+// account, that account is used.
+func New(ctx context.Context, sources ...Source) (*Client, error) {
+	if len(sources) == 0 {
+		sources = []Source{FromEnv()}
+	}
+	var cfg cftoken.Config
+	for _, src := range sources {
+		if err := src(&cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.APIToken == "" && cfg.APIKey == "" {
+		return nil, fmt.Errorf("no parent credential configured")
+	}
+
+	gen, err := cftoken.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.AccountID == "" {
+		accounts, err := gen.DiscoverAccounts(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("discovering account: %w", err)
+		}
+		if len(accounts) == 1 {
+			cfg.AccountID = accounts[0].ID
+			if gen, err = cftoken.New(cfg); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &Client{gen: gen, retries: 2}, nil
+}
+
+// Generator returns the underlying Generator for anything the facade doesn't
+// cover.
+func (c *Client) Generator() *cftoken.Generator { return c.gen }
+
+// MintOpts customizes a minted token. The zero value mints an edit token for
+// all zones or the configured account, with no expiry.
+type MintOpts struct {
+	// Scope is "all" (default), a zone or account ID, or "@<group>".
+	Scope string
+	// Level is "edit" (default) or "read".
+	Level string
+	Name  string
+	TTL   time.Duration
+	// AllowIPs restricts the token to these CIDRs.
+	AllowIPs []string
+}
+
+// Token is a minted token.
+type Token struct {
+	ID        string
+	Name      string
+	Value     string
+	Services  []string
+	Scope     string
+	Level     string
+	ExpiresOn *time.Time
+}
+
+// Mint creates a token for services, retrying rate limits, server errors, and
+// network failures with backoff.
+func (c *Client) Mint(ctx context.Context, services []string, opts MintOpts) (*Token, error) {
+	if opts.Scope == "" {
+		opts.Scope = "all"
+	}
+	if opts.Level == "" {
+		opts.Level = "edit"
+	}
+	var options []cftoken.Option
+	if opts.Name != "" {
+		options = append(options, cftoken.WithName(opts.Name))
+	}
+	if opts.TTL > 0 {
+		options = append(options, cftoken.WithTTL(opts.TTL))
+	}
+	if len(opts.AllowIPs) > 0 {
+		options = append(options, cftoken.WithIPCondition(opts.AllowIPs, nil))
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		t, err := c.gen.GenerateToken(services, opts.Scope, opts.Level, options...)
+		if err == nil {
+			return &Token{
+				ID:        t.ID,
+				Name:      t.Name,
+				Value:     t.Value,
+				Services:  t.Services,
+				Scope:     t.Scope,
+				Level:     t.Level,
+				ExpiresOn: t.ExpiresOn,
+			}, nil
+		}
+		if !cftoken.IsRetryable(err) || attempt == c.retries {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// MintDNSToken mints a DNS token.
+func (c *Client) MintDNSToken(ctx context.Context, opts MintOpts) (*Token, error) {
+	return c.Mint(ctx, []string{"dns"}, opts)
+}
+
+// MintWorkersToken mints a Workers token.
+func (c *Client) MintWorkersToken(ctx context.Context, opts MintOpts) (*Token, error) {
+	return c.Mint(ctx, []string{"workers"}, opts)
+}
+
+// MintR2Token mints an R2 token.
+func (c *Client) MintR2Token(ctx context.Context, opts MintOpts) (*Token, error) {
+	return c.Mint(ctx, []string{"r2"}, opts)
+}
+
+// MintPagesToken mints a Pages token.
+func (c *Client) MintPagesToken(ctx context.Context, opts MintOpts) (*Token, error) {
+	return c.Mint(ctx, []string{"pages"}, opts)
+}
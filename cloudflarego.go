@@ -0,0 +1,310 @@
+//go:build !nocloudflarego
+
+package cftoken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	cloudflare "github.com/cloudflare/cloudflare-go"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// defaultBackend is the BackendFactory New uses.
+var defaultBackend BackendFactory = cloudflareGoBackend
+
+// cloudflareGoBackend is the default BackendFactory, backed by cloudflare-go.
+func cloudflareGoBackend(cfg Config, client *http.Client) (Backend, error) {
+	var api *cloudflare.API
+	var err error
+	if cfg.AuthType == AuthTypeAPIKey {
+		api, err = cloudflare.New(cfg.APIKey, cfg.Email, cloudflare.HTTPClient(client))
+	} else {
+		api, err = cloudflare.NewWithAPIToken(cfg.APIToken, cloudflare.HTTPClient(client))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CloudflareGoBackend(api), nil
+}
+
+// CloudflareGoBackend adapts a cloudflare-go v0 client to Backend, for a
+// BackendFactory that configures the client itself.
+func CloudflareGoBackend(api *cloudflare.API) Backend {
+	return sdkBackend{api: api}
+}
+
+// sdkBackend converts between cloudflare-go's types and this package's
+// field by field, so a change to either shows up at compile time.
+type sdkBackend struct {
+	api *cloudflare.API
+}
+
+// sdkError converts a cloudflare-go API error to a *ResponseError wrapping
+// it, so errors.As still finds cloudflare-go's error types.
+func sdkError(err error) error {
+	var cfErr *cloudflare.Error
+	if !errors.As(err, &cfErr) {
+		return err
+	}
+	return &ResponseError{StatusCode: cfErr.StatusCode, Codes: cfErr.ErrorCodes, Messages: cfErr.ErrorMessages, RayID: cfErr.RayID, Err: err}
+}
+
+func sdkResultInfo(info cloudflare.ResultInfo) ResultInfo {
+	return ResultInfo{Page: info.Page, PerPage: info.PerPage, TotalPages: info.TotalPages, Count: info.Count, Total: info.Total}
+}
+
+// convertAll applies convert to each element of in.
+func convertAll[S, T any](in []S, convert func(S) T) []T {
+	if in == nil {
+		return nil
+	}
+	out := make([]T, len(in))
+	for i, v := range in {
+		out[i] = convert(v)
+	}
+	return out
+}
+
+func sdkToken(t cloudflare.APIToken) APIToken {
+	out := APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Status:     t.Status,
+		IssuedOn:   t.IssuedOn,
+		ModifiedOn: t.ModifiedOn,
+		NotBefore:  t.NotBefore,
+		ExpiresOn:  t.ExpiresOn,
+		Policies:   convertAll(t.Policies, sdkPolicy),
+		Value:      t.Value,
+	}
+	if t.Condition != nil {
+		out.Condition = &TokenCondition{}
+		if ip := t.Condition.RequestIP; ip != nil {
+			out.Condition.RequestIP = &RequestIPCondition{In: ip.In, NotIn: ip.NotIn}
+		}
+	}
+	return out
+}
+
+func toSDKToken(t APIToken) cloudflare.APIToken {
+	out := cloudflare.APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Status:     t.Status,
+		IssuedOn:   t.IssuedOn,
+		ModifiedOn: t.ModifiedOn,
+		NotBefore:  t.NotBefore,
+		ExpiresOn:  t.ExpiresOn,
+		Policies:   convertAll(t.Policies, toSDKPolicy),
+		Value:      t.Value,
+	}
+	if t.Condition != nil {
+		out.Condition = &cloudflare.APITokenCondition{}
+		if ip := t.Condition.RequestIP; ip != nil {
+			out.Condition.RequestIP = &cloudflare.APITokenRequestIPCondition{In: ip.In, NotIn: ip.NotIn}
+		}
+	}
+	return out
+}
+
+func sdkPolicy(p cloudflare.APITokenPolicies) policy.Policy {
+	return policy.Policy{ID: p.ID, Effect: p.Effect, Resources: p.Resources, PermissionGroups: convertAll(p.PermissionGroups, sdkPermissionGroup)}
+}
+
+func toSDKPolicy(p policy.Policy) cloudflare.APITokenPolicies {
+	return cloudflare.APITokenPolicies{ID: p.ID, Effect: p.Effect, Resources: p.Resources, PermissionGroups: convertAll(p.PermissionGroups, toSDKPermissionGroup)}
+}
+
+func sdkPermissionGroup(g cloudflare.APITokenPermissionGroups) policy.PermissionGroup {
+	return policy.PermissionGroup{ID: g.ID, Name: g.Name, Scopes: g.Scopes}
+}
+
+func toSDKPermissionGroup(g policy.PermissionGroup) cloudflare.APITokenPermissionGroups {
+	return cloudflare.APITokenPermissionGroups{ID: g.ID, Name: g.Name, Scopes: g.Scopes}
+}
+
+func sdkZone(z cloudflare.Zone) Zone {
+	return Zone{
+		ID:          z.ID,
+		Name:        z.Name,
+		Status:      z.Status,
+		Paused:      z.Paused,
+		Type:        z.Type,
+		NameServers: z.NameServers,
+		OriginalNS:  z.OriginalNS,
+		Plan:        ZonePlan{ID: z.Plan.ID, Name: z.Plan.Name, LegacyID: z.Plan.LegacyID},
+		Account:     ZoneAccount{ID: z.Account.ID, Name: z.Account.Name},
+		CreatedOn:   z.CreatedOn,
+		ModifiedOn:  z.ModifiedOn,
+	}
+}
+
+func sdkAccount(a cloudflare.Account) Account {
+	out := Account{ID: a.ID, Name: a.Name, Type: a.Type, CreatedOn: a.CreatedOn}
+	if a.Settings != nil {
+		out.Settings = &AccountSettings{EnforceTwoFactor: a.Settings.EnforceTwoFactor}
+	}
+	return out
+}
+
+func sdkAccountMember(m cloudflare.AccountMember) AccountMember {
+	out := AccountMember{
+		ID: m.ID,
+		User: AccountMemberUser{
+			ID:        m.User.ID,
+			FirstName: m.User.FirstName,
+			LastName:  m.User.LastName,
+			Email:     m.User.Email,
+			TwoFA:     m.User.TwoFactorAuthenticationEnabled,
+		},
+		Status: m.Status,
+		Roles:  convertAll(m.Roles, sdkAccountRole),
+	}
+	// Member policies are kept as JSON; see AccountMember.
+	for _, p := range m.Policies {
+		data, err := json.Marshal(p)
+		if err != nil {
+			data = []byte("{}")
+		}
+		out.Policies = append(out.Policies, data)
+	}
+	return out
+}
+
+func sdkAccountRole(r cloudflare.AccountRole) AccountRole {
+	out := AccountRole{ID: r.ID, Name: r.Name, Description: r.Description}
+	if r.Permissions != nil {
+		out.Permissions = make(map[string]RolePermission, len(r.Permissions))
+		for area, p := range r.Permissions {
+			out.Permissions[area] = RolePermission{Read: p.Read, Edit: p.Edit}
+		}
+	}
+	return out
+}
+
+func sdkUser(u cloudflare.User) User {
+	return User{ID: u.ID, Email: u.Email, FirstName: u.FirstName, LastName: u.LastName, Username: u.Username, TwoFA: u.TwoFA}
+}
+
+func (b sdkBackend) APITokens(ctx context.Context) ([]APIToken, error) {
+	tokens, err := b.api.APITokens(ctx)
+	if err != nil {
+		return nil, sdkError(err)
+	}
+	return convertAll(tokens, sdkToken), nil
+}
+
+func (b sdkBackend) GetAPIToken(ctx context.Context, tokenID string) (APIToken, error) {
+	token, err := b.api.GetAPIToken(ctx, tokenID)
+	if err != nil {
+		return APIToken{}, sdkError(err)
+	}
+	return sdkToken(token), nil
+}
+
+func (b sdkBackend) CreateAPIToken(ctx context.Context, token APIToken) (APIToken, error) {
+	created, err := b.api.CreateAPIToken(ctx, toSDKToken(token))
+	if err != nil {
+		return APIToken{}, sdkError(err)
+	}
+	return sdkToken(created), nil
+}
+
+func (b sdkBackend) UpdateAPIToken(ctx context.Context, tokenID string, token APIToken) (APIToken, error) {
+	updated, err := b.api.UpdateAPIToken(ctx, tokenID, toSDKToken(token))
+	if err != nil {
+		return APIToken{}, sdkError(err)
+	}
+	return sdkToken(updated), nil
+}
+
+func (b sdkBackend) RollAPIToken(ctx context.Context, tokenID string) (string, error) {
+	value, err := b.api.RollAPIToken(ctx, tokenID)
+	if err != nil {
+		return "", sdkError(err)
+	}
+	return value, nil
+}
+
+func (b sdkBackend) DeleteAPIToken(ctx context.Context, tokenID string) error {
+	if err := b.api.DeleteAPIToken(ctx, tokenID); err != nil {
+		return sdkError(err)
+	}
+	return nil
+}
+
+func (b sdkBackend) VerifyAPIToken(ctx context.Context) (TokenStatus, error) {
+	v, err := b.api.VerifyAPIToken(ctx)
+	if err != nil {
+		return TokenStatus{}, sdkError(err)
+	}
+	return TokenStatus{ID: v.ID, Status: v.Status, NotBefore: v.NotBefore, ExpiresOn: v.ExpiresOn}, nil
+}
+
+func (b sdkBackend) ListAPITokensPermissionGroups(ctx context.Context) ([]policy.PermissionGroup, error) {
+	groups, err := b.api.ListAPITokensPermissionGroups(ctx)
+	if err != nil {
+		return nil, sdkError(err)
+	}
+	return convertAll(groups, sdkPermissionGroup), nil
+}
+
+func (b sdkBackend) ListZones(ctx context.Context, z ...string) ([]Zone, error) {
+	zones, err := b.api.ListZones(ctx, z...)
+	if err != nil {
+		return nil, sdkError(err)
+	}
+	return convertAll(zones, sdkZone), nil
+}
+
+func (b sdkBackend) Accounts(ctx context.Context, params AccountsParams) ([]Account, ResultInfo, error) {
+	accounts, info, err := b.api.Accounts(ctx, cloudflare.AccountsListParams{
+		Name:              params.Name,
+		PaginationOptions: cloudflare.PaginationOptions{Page: params.Page, PerPage: params.PerPage},
+	})
+	if err != nil {
+		return nil, ResultInfo{}, sdkError(err)
+	}
+	return convertAll(accounts, sdkAccount), sdkResultInfo(info), nil
+}
+
+func (b sdkBackend) Account(ctx context.Context, accountID string) (Account, ResultInfo, error) {
+	account, info, err := b.api.Account(ctx, accountID)
+	if err != nil {
+		return Account{}, ResultInfo{}, sdkError(err)
+	}
+	return sdkAccount(account), sdkResultInfo(info), nil
+}
+
+func (b sdkBackend) AccountMembers(ctx context.Context, accountID string, pageOpts PageOptions) ([]AccountMember, ResultInfo, error) {
+	members, info, err := b.api.AccountMembers(ctx, accountID, cloudflare.PaginationOptions{Page: pageOpts.Page, PerPage: pageOpts.PerPage})
+	if err != nil {
+		return nil, ResultInfo{}, sdkError(err)
+	}
+	return convertAll(members, sdkAccountMember), sdkResultInfo(info), nil
+}
+
+func (b sdkBackend) UserDetails(ctx context.Context) (User, error) {
+	user, err := b.api.UserDetails(ctx)
+	if err != nil {
+		return User{}, sdkError(err)
+	}
+	return sdkUser(user), nil
+}
+
+func (b sdkBackend) Raw(ctx context.Context, method, endpoint string, data interface{}, headers http.Header) (RawResponse, error) {
+	resp, err := b.api.Raw(ctx, method, endpoint, data, headers)
+	if err != nil {
+		return RawResponse{}, sdkError(err)
+	}
+	out := RawResponse{Result: resp.Result}
+	if resp.ResultInfo != nil {
+		info := sdkResultInfo(*resp.ResultInfo)
+		out.ResultInfo = &info
+	}
+	return out, nil
+}
@@ -0,0 +1,38 @@
+//go:build !nocloudflarego
+
+package cftoken
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// TestSDKTokenRoundTrip checks that converting a token to cloudflare-go's
+// type and back keeps every field.
+func TestSDKTokenRoundTrip(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	later := now.Add(24 * time.Hour)
+	token := APIToken{
+		ID:         "ed17574386854bf78a67040be0a770b0",
+		Name:       "dns-example.com-edit",
+		Status:     "active",
+		IssuedOn:   &now,
+		ModifiedOn: &now,
+		NotBefore:  &now,
+		ExpiresOn:  &later,
+		Policies: []policy.Policy{{
+			ID:               "f267e341f3dd4697bd3b9f71dd96247f",
+			Effect:           "allow",
+			Resources:        map[string]interface{}{"com.cloudflare.api.account.zone.023e105f4ecef8ad9ca31a8372d0c353": "*"},
+			PermissionGroups: []policy.PermissionGroup{{ID: "4755a26eedb94da69e1066d98aa820be", Name: "DNS Write", Scopes: []string{"com.cloudflare.api.account.zone"}}},
+		}},
+		Condition: &TokenCondition{RequestIP: &RequestIPCondition{In: []string{"192.0.2.0/24"}, NotIn: []string{"192.0.2.1/32"}}},
+		Value:     "secret",
+	}
+	if got := sdkToken(toSDKToken(token)); !reflect.DeepEqual(got, token) {
+		t.Errorf("round trip gave %+v, want %+v", got, token)
+	}
+}
@@ -0,0 +1,482 @@
+// Package cloudflarev4 adapts a cloudflare-go/v4 client to cftoken.Backend,
+// for programs that have moved to the v4 SDK and want one Cloudflare SDK in
+// their build:
+//
+//	gen, err := cftoken.NewWithBackend(cfg, cloudflarev4.Factory())
+//
+// Build with -tags nocloudflarego so cftoken doesn't link cloudflare-go v0
+// as well. The package is its own module, so the main module doesn't
+// require v4.
+package cloudflarev4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/accounts"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+	"github.com/cloudflare/cloudflare-go/v4/shared"
+	"github.com/cloudflare/cloudflare-go/v4/user"
+	"github.com/cloudflare/cloudflare-go/v4/zones"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Factory returns a cftoken.BackendFactory that opens a v4 client with the
+// config's credentials and the Generator's HTTP client, plus opts.
+func Factory(opts ...option.RequestOption) cftoken.BackendFactory {
+	return func(cfg cftoken.Config, client *http.Client) (cftoken.Backend, error) {
+		var auth []option.RequestOption
+		if cfg.AuthType == cftoken.AuthTypeAPIKey {
+			if cfg.APIKey == "" || cfg.Email == "" {
+				return nil, errors.New("invalid credentials: key & email must not be empty")
+			}
+			auth = []option.RequestOption{option.WithAPIKey(cfg.APIKey), option.WithAPIEmail(cfg.Email)}
+		} else {
+			if cfg.APIToken == "" {
+				return nil, errors.New("invalid credentials: API Token must not be empty")
+			}
+			auth = []option.RequestOption{option.WithAPIToken(cfg.APIToken)}
+		}
+		opts := append(append(auth, option.WithHTTPClient(client)), opts...)
+		return New(cloudflare.NewClient(opts...)), nil
+	}
+}
+
+// New adapts client to cftoken.Backend, for a caller that configures the
+// client itself.
+func New(client *cloudflare.Client) cftoken.Backend {
+	return backend{client: client}
+}
+
+type backend struct {
+	client *cloudflare.Client
+}
+
+// sdkError converts a v4 API error to a *cftoken.ResponseError wrapping it,
+// so errors.As still finds *cloudflare.Error.
+func sdkError(err error) error {
+	var cfErr *cloudflare.Error
+	if !errors.As(err, &cfErr) {
+		return err
+	}
+	out := &cftoken.ResponseError{StatusCode: cfErr.StatusCode, Err: err}
+	for _, e := range cfErr.Errors {
+		out.Codes = append(out.Codes, int(e.Code))
+		out.Messages = append(out.Messages, e.Message)
+	}
+	if cfErr.Response != nil {
+		out.RayID = cfErr.Response.Header.Get("Cf-Ray")
+	}
+	return out
+}
+
+// convertAll applies convert to each element of in.
+func convertAll[S, T any](in []S, convert func(S) T) []T {
+	if in == nil {
+		return nil
+	}
+	out := make([]T, len(in))
+	for i, v := range in {
+		out[i] = convert(v)
+	}
+	return out
+}
+
+// timePtr returns nil for the zero time, which v4 uses for unset times.
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func sdkToken(t shared.Token) cftoken.APIToken {
+	return cftoken.APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Status:     string(t.Status),
+		IssuedOn:   timePtr(t.IssuedOn),
+		ModifiedOn: timePtr(t.ModifiedOn),
+		NotBefore:  timePtr(t.NotBefore),
+		ExpiresOn:  timePtr(t.ExpiresOn),
+		Policies:   convertAll(t.Policies, sdkPolicy),
+		Condition:  sdkCondition(t.Condition.RequestIP.In, t.Condition.RequestIP.NotIn),
+	}
+}
+
+func sdkCondition(in, notIn []shared.TokenConditionCIDRList) *cftoken.TokenCondition {
+	if len(in) == 0 && len(notIn) == 0 {
+		return nil
+	}
+	toStrings := func(s shared.TokenConditionCIDRList) string { return string(s) }
+	return &cftoken.TokenCondition{RequestIP: &cftoken.RequestIPCondition{
+		In:    convertAll(in, toStrings),
+		NotIn: convertAll(notIn, toStrings),
+	}}
+}
+
+func sdkPolicy(p shared.TokenPolicy) policy.Policy {
+	out := policy.Policy{ID: p.ID, Effect: string(p.Effect), Resources: make(map[string]interface{}, len(p.Resources))}
+	for _, g := range p.PermissionGroups {
+		out.PermissionGroups = append(out.PermissionGroups, policy.PermissionGroup{ID: g.ID, Name: g.Name})
+	}
+	for key, r := range p.Resources {
+		switch r := r.(type) {
+		case shared.UnionString:
+			out.Resources[key] = string(r)
+		case shared.TokenPolicyResourcesMap:
+			nested := make(map[string]interface{}, len(r))
+			for k, v := range r {
+				nested[k] = v
+			}
+			out.Resources[key] = nested
+		}
+	}
+	return out
+}
+
+func toSDKPolicy(p policy.Policy) shared.TokenPolicyParam {
+	groups := make([]shared.TokenPolicyPermissionGroupParam, len(p.PermissionGroups))
+	for i, g := range p.PermissionGroups {
+		groups[i] = shared.TokenPolicyPermissionGroupParam{ID: cloudflare.F(g.ID)}
+	}
+	resources := make(map[string]shared.TokenPolicyResourcesUnionParam, len(p.Resources))
+	for key, r := range p.Resources {
+		switch r := r.(type) {
+		case string:
+			resources[key] = shared.UnionString(r)
+		case map[string]string:
+			resources[key] = shared.TokenPolicyResourcesMapParam(r)
+		case map[string]interface{}:
+			nested := make(shared.TokenPolicyResourcesMapParam, len(r))
+			for k, v := range r {
+				nested[k] = fmt.Sprint(v)
+			}
+			resources[key] = nested
+		}
+	}
+	return shared.TokenPolicyParam{
+		Effect:           cloudflare.F(shared.TokenPolicyEffect(p.Effect)),
+		PermissionGroups: cloudflare.F(groups),
+		Resources:        cloudflare.F(resources),
+	}
+}
+
+func toSDKCIDRs(cidrs []string) []shared.TokenConditionCIDRListParam {
+	return convertAll(cidrs, func(s string) shared.TokenConditionCIDRListParam { return shared.TokenConditionCIDRListParam(s) })
+}
+
+func toSDKToken(t cftoken.APIToken) shared.TokenParam {
+	out := shared.TokenParam{
+		Name:     cloudflare.F(t.Name),
+		Policies: cloudflare.F(convertAll(t.Policies, toSDKPolicy)),
+	}
+	if t.Status != "" {
+		out.Status = cloudflare.F(shared.TokenStatus(t.Status))
+	}
+	if t.NotBefore != nil {
+		out.NotBefore = cloudflare.F(*t.NotBefore)
+	}
+	if t.ExpiresOn != nil {
+		out.ExpiresOn = cloudflare.F(*t.ExpiresOn)
+	}
+	if c := t.Condition; c != nil && c.RequestIP != nil {
+		var ip shared.TokenConditionRequestIPParam
+		if len(c.RequestIP.In) > 0 {
+			ip.In = cloudflare.F(toSDKCIDRs(c.RequestIP.In))
+		}
+		if len(c.RequestIP.NotIn) > 0 {
+			ip.NotIn = cloudflare.F(toSDKCIDRs(c.RequestIP.NotIn))
+		}
+		out.Condition = cloudflare.F(shared.TokenConditionParam{RequestIP: cloudflare.F(ip)})
+	}
+	return out
+}
+
+func newTokenParams(t cftoken.APIToken) user.TokenNewParams {
+	params := user.TokenNewParams{
+		Name:     cloudflare.F(t.Name),
+		Policies: cloudflare.F(convertAll(t.Policies, toSDKPolicy)),
+	}
+	if t.NotBefore != nil {
+		params.NotBefore = cloudflare.F(*t.NotBefore)
+	}
+	if t.ExpiresOn != nil {
+		params.ExpiresOn = cloudflare.F(*t.ExpiresOn)
+	}
+	if c := t.Condition; c != nil && c.RequestIP != nil {
+		var ip user.TokenNewParamsConditionRequestIP
+		if len(c.RequestIP.In) > 0 {
+			ip.In = cloudflare.F(toSDKCIDRs(c.RequestIP.In))
+		}
+		if len(c.RequestIP.NotIn) > 0 {
+			ip.NotIn = cloudflare.F(toSDKCIDRs(c.RequestIP.NotIn))
+		}
+		params.Condition = cloudflare.F(user.TokenNewParamsCondition{RequestIP: cloudflare.F(ip)})
+	}
+	return params
+}
+
+func (b backend) APITokens(ctx context.Context) ([]cftoken.APIToken, error) {
+	var out []cftoken.APIToken
+	iter := b.client.User.Tokens.ListAutoPaging(ctx, user.TokenListParams{})
+	for iter.Next() {
+		out = append(out, sdkToken(iter.Current()))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, sdkError(err)
+	}
+	return out, nil
+}
+
+func (b backend) GetAPIToken(ctx context.Context, tokenID string) (cftoken.APIToken, error) {
+	t, err := b.client.User.Tokens.Get(ctx, tokenID)
+	if err != nil {
+		return cftoken.APIToken{}, sdkError(err)
+	}
+	return sdkToken(*t), nil
+}
+
+// CreateAPIToken doesn't let the SDK retry: a retried create can leave a
+// second token, which the Generator checks for itself with an idempotency
+// key.
+func (b backend) CreateAPIToken(ctx context.Context, token cftoken.APIToken) (cftoken.APIToken, error) {
+	t, err := b.client.User.Tokens.New(ctx, newTokenParams(token), option.WithMaxRetries(0))
+	if err != nil {
+		return cftoken.APIToken{}, sdkError(err)
+	}
+	out := cftoken.APIToken{
+		ID:         t.ID,
+		Name:       t.Name,
+		Status:     string(t.Status),
+		IssuedOn:   timePtr(t.IssuedOn),
+		ModifiedOn: timePtr(t.ModifiedOn),
+		NotBefore:  timePtr(t.NotBefore),
+		ExpiresOn:  timePtr(t.ExpiresOn),
+		Policies:   convertAll(t.Policies, sdkPolicy),
+		Condition:  sdkCondition(t.Condition.RequestIP.In, t.Condition.RequestIP.NotIn),
+		Value:      string(t.Value),
+	}
+	return out, nil
+}
+
+func (b backend) UpdateAPIToken(ctx context.Context, tokenID string, token cftoken.APIToken) (cftoken.APIToken, error) {
+	t, err := b.client.User.Tokens.Update(ctx, tokenID, user.TokenUpdateParams{Token: toSDKToken(token)})
+	if err != nil {
+		return cftoken.APIToken{}, sdkError(err)
+	}
+	return sdkToken(*t), nil
+}
+
+func (b backend) RollAPIToken(ctx context.Context, tokenID string) (string, error) {
+	value, err := b.client.User.Tokens.Value.Update(ctx, tokenID, user.TokenValueUpdateParams{Body: map[string]interface{}{}})
+	if err != nil {
+		return "", sdkError(err)
+	}
+	return string(*value), nil
+}
+
+func (b backend) DeleteAPIToken(ctx context.Context, tokenID string) error {
+	if _, err := b.client.User.Tokens.Delete(ctx, tokenID); err != nil {
+		return sdkError(err)
+	}
+	return nil
+}
+
+func (b backend) VerifyAPIToken(ctx context.Context) (cftoken.TokenStatus, error) {
+	v, err := b.client.User.Tokens.Verify(ctx)
+	if err != nil {
+		return cftoken.TokenStatus{}, sdkError(err)
+	}
+	return cftoken.TokenStatus{ID: v.ID, Status: string(v.Status), NotBefore: v.NotBefore, ExpiresOn: v.ExpiresOn}, nil
+}
+
+func (b backend) ListAPITokensPermissionGroups(ctx context.Context) ([]policy.PermissionGroup, error) {
+	var out []policy.PermissionGroup
+	iter := b.client.User.Tokens.PermissionGroups.ListAutoPaging(ctx, user.TokenPermissionGroupListParams{})
+	for iter.Next() {
+		g := iter.Current()
+		scopes := convertAll(g.Scopes, func(s user.TokenPermissionGroupListResponseScope) string { return string(s) })
+		out = append(out, policy.PermissionGroup{ID: g.ID, Name: g.Name, Scopes: scopes})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, sdkError(err)
+	}
+	return out, nil
+}
+
+func sdkZone(z zones.Zone) cftoken.Zone {
+	return cftoken.Zone{
+		ID:          z.ID,
+		Name:        z.Name,
+		Status:      string(z.Status),
+		Paused:      z.Paused,
+		Type:        string(z.Type),
+		NameServers: z.NameServers,
+		OriginalNS:  z.OriginalNameServers,
+		Plan:        cftoken.ZonePlan{ID: z.Plan.ID, Name: z.Plan.Name, LegacyID: z.Plan.LegacyID},
+		Account:     cftoken.ZoneAccount{ID: z.Account.ID, Name: z.Account.Name},
+		CreatedOn:   z.CreatedOn,
+		ModifiedOn:  z.ModifiedOn,
+	}
+}
+
+func (b backend) ListZones(ctx context.Context, names ...string) ([]cftoken.Zone, error) {
+	list := func(params zones.ZoneListParams) ([]cftoken.Zone, error) {
+		var out []cftoken.Zone
+		iter := b.client.Zones.ListAutoPaging(ctx, params)
+		for iter.Next() {
+			out = append(out, sdkZone(iter.Current()))
+		}
+		if err := iter.Err(); err != nil {
+			return nil, sdkError(err)
+		}
+		return out, nil
+	}
+	if len(names) == 0 {
+		return list(zones.ZoneListParams{})
+	}
+	var out []cftoken.Zone
+	for _, name := range names {
+		found, err := list(zones.ZoneListParams{Name: cloudflare.F(name)})
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, found...)
+	}
+	return out, nil
+}
+
+func sdkAccount(a accounts.Account) cftoken.Account {
+	return cftoken.Account{
+		ID:        a.ID,
+		Name:      a.Name,
+		CreatedOn: a.CreatedOn,
+		Settings:  &cftoken.AccountSettings{EnforceTwoFactor: a.Settings.EnforceTwofactor},
+	}
+}
+
+func (b backend) Accounts(ctx context.Context, params cftoken.AccountsParams) ([]cftoken.Account, cftoken.ResultInfo, error) {
+	list := accounts.AccountListParams{}
+	if params.Page > 0 {
+		list.Page = cloudflare.F(float64(params.Page))
+	}
+	if params.PerPage > 0 {
+		list.PerPage = cloudflare.F(float64(params.PerPage))
+	}
+	if params.Name != "" {
+		list.Name = cloudflare.F(params.Name)
+	}
+	page, err := b.client.Accounts.List(ctx, list)
+	if err != nil {
+		return nil, cftoken.ResultInfo{}, sdkError(err)
+	}
+	info := cftoken.ResultInfo{Page: int(page.ResultInfo.Page), PerPage: int(page.ResultInfo.PerPage), Count: len(page.Result)}
+	return convertAll(page.Result, sdkAccount), info, nil
+}
+
+func (b backend) Account(ctx context.Context, accountID string) (cftoken.Account, cftoken.ResultInfo, error) {
+	a, err := b.client.Accounts.Get(ctx, accounts.AccountGetParams{AccountID: cloudflare.F(accountID)})
+	if err != nil {
+		return cftoken.Account{}, cftoken.ResultInfo{}, sdkError(err)
+	}
+	return sdkAccount(*a), cftoken.ResultInfo{}, nil
+}
+
+func sdkMember(m shared.Member) cftoken.AccountMember {
+	out := cftoken.AccountMember{
+		ID: m.ID,
+		User: cftoken.AccountMemberUser{
+			ID:        m.User.ID,
+			FirstName: m.User.FirstName,
+			LastName:  m.User.LastName,
+			Email:     m.User.Email,
+			TwoFA:     m.User.TwoFactorAuthenticationEnabled,
+		},
+		Status: string(m.Status),
+		Roles:  convertAll(m.Roles, sdkRole),
+	}
+	// Member policies are kept as JSON; see cftoken.AccountMember.
+	for _, p := range m.Policies {
+		out.Policies = append(out.Policies, json.RawMessage(p.JSON.RawJSON()))
+	}
+	return out
+}
+
+// sdkRole converts a role, keying its permissions by area as the API does.
+func sdkRole(r shared.Role) cftoken.AccountRole {
+	p := r.Permissions
+	grants := map[string]shared.PermissionGrant{
+		"analytics":     p.Analytics,
+		"billing":       p.Billing,
+		"cache_purge":   p.CachePurge,
+		"dns":           p.DNS,
+		"dns_records":   p.DNSRecords,
+		"lb":            p.LB,
+		"logs":          p.Logs,
+		"organization":  p.Organization,
+		"ssl":           p.SSL,
+		"waf":           p.WAF,
+		"zone_settings": p.ZoneSettings,
+		"zones":         p.Zones,
+	}
+	out := cftoken.AccountRole{ID: r.ID, Name: r.Name, Description: r.Description, Permissions: make(map[string]cftoken.RolePermission, len(grants))}
+	for area, g := range grants {
+		out.Permissions[area] = cftoken.RolePermission{Read: g.Read, Edit: g.Write}
+	}
+	return out
+}
+
+func (b backend) AccountMembers(ctx context.Context, accountID string, pageOpts cftoken.PageOptions) ([]cftoken.AccountMember, cftoken.ResultInfo, error) {
+	list := accounts.MemberListParams{AccountID: cloudflare.F(accountID)}
+	if pageOpts.Page > 0 {
+		list.Page = cloudflare.F(float64(pageOpts.Page))
+	}
+	if pageOpts.PerPage > 0 {
+		list.PerPage = cloudflare.F(float64(pageOpts.PerPage))
+	}
+	page, err := b.client.Accounts.Members.List(ctx, list)
+	if err != nil {
+		return nil, cftoken.ResultInfo{}, sdkError(err)
+	}
+	info := cftoken.ResultInfo{Page: int(page.ResultInfo.Page), PerPage: int(page.ResultInfo.PerPage), Count: len(page.Result)}
+	return convertAll(page.Result, sdkMember), info, nil
+}
+
+// UserDetails returns what v4 reports about the user, which doesn't
+// include their email or username.
+func (b backend) UserDetails(ctx context.Context) (cftoken.User, error) {
+	u, err := b.client.User.Get(ctx)
+	if err != nil {
+		return cftoken.User{}, sdkError(err)
+	}
+	return cftoken.User{ID: u.ID, FirstName: u.FirstName, LastName: u.LastName, TwoFA: u.TwoFactorAuthenticationEnabled}, nil
+}
+
+// Raw calls endpoint through the client, so it gets the same credentials,
+// retries, and errors as the typed calls.
+func (b backend) Raw(ctx context.Context, method, endpoint string, data interface{}, headers http.Header) (cftoken.RawResponse, error) {
+	var opts []option.RequestOption
+	for name, values := range headers {
+		for _, v := range values {
+			opts = append(opts, option.WithHeader(name, v))
+		}
+	}
+	var resp *http.Response
+	// Paths are resolved against the client's /client/v4/ base URL.
+	if err := b.client.Execute(ctx, method, strings.TrimPrefix(endpoint, "/"), data, &resp, opts...); err != nil {
+		return cftoken.RawResponse{}, sdkError(err)
+	}
+	defer resp.Body.Close()
+	var out cftoken.RawResponse
+	err := json.NewDecoder(resp.Body).Decode(&out)
+	return out, err
+}
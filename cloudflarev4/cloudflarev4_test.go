@@ -0,0 +1,107 @@
+package cloudflarev4
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cloudflare/cloudflare-go/v4"
+	"github.com/cloudflare/cloudflare-go/v4/option"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+func newTestBackend(t *testing.T, handler http.HandlerFunc) cftoken.Backend {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return New(cloudflare.NewClient(option.WithAPIToken("parent"), option.WithBaseURL(srv.URL+"/client/v4/"), option.WithMaxRetries(0)))
+}
+
+func TestCreateAPIToken(t *testing.T) {
+	policies := []policy.Policy{{
+		Effect: "allow",
+		Resources: map[string]interface{}{
+			"com.cloudflare.api.account.01a7362d577a6c3019a474fd6f485823": map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"},
+		},
+		PermissionGroups: []policy.PermissionGroup{{ID: "c8fed203ed3043cba015a93ad1616f1f", Name: "Zone Read"}},
+	}}
+	var sent map[string]json.RawMessage
+	b := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/client/v4/user/tokens" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &sent)
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"success":true,"errors":[],"messages":[],"result":{
+			"id":"ed17574386854bf78a67040be0a770b0","name":"zone-all-read","status":"active",
+			"policies":[{"id":"f267e341f3dd4697bd3b9f71dd96247f","effect":"allow",
+				"resources":{"com.cloudflare.api.account.01a7362d577a6c3019a474fd6f485823":{"com.cloudflare.api.account.zone.*":"*"}},
+				"permission_groups":[{"id":"c8fed203ed3043cba015a93ad1616f1f","name":"Zone Read"}]}],
+			"condition":{"request_ip":{"in":["192.0.2.0/24"]}},
+			"value":"secret"}}`)
+	})
+
+	got, err := b.CreateAPIToken(context.Background(), cftoken.APIToken{
+		Name:      "zone-all-read",
+		Policies:  policies,
+		Condition: &cftoken.TokenCondition{RequestIP: &cftoken.RequestIPCondition{In: []string{"192.0.2.0/24"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sentPolicies []policy.Policy
+	if err := json.Unmarshal(sent["policies"], &sentPolicies); err != nil {
+		t.Fatal(err)
+	}
+	// Only group IDs are sent.
+	want := policies[0]
+	want.PermissionGroups = []policy.PermissionGroup{{ID: want.PermissionGroups[0].ID}}
+	if len(sentPolicies) != 1 || !reflect.DeepEqual(sentPolicies[0], want) {
+		t.Errorf("sent policies %s, want %+v", sent["policies"], want)
+	}
+	if string(sent["condition"]) != `{"request_ip":{"in":["192.0.2.0/24"]}}` {
+		t.Errorf("sent condition %s", sent["condition"])
+	}
+
+	want = policies[0]
+	want.ID = "f267e341f3dd4697bd3b9f71dd96247f"
+	if got.ID != "ed17574386854bf78a67040be0a770b0" || got.Value != "secret" || got.Status != "active" {
+		t.Errorf("got token %+v", got)
+	}
+	if len(got.Policies) != 1 || !reflect.DeepEqual(got.Policies[0], want) {
+		t.Errorf("got policies %+v, want %+v", got.Policies, want)
+	}
+	if got.Condition == nil || !reflect.DeepEqual(got.Condition.RequestIP.In, []string{"192.0.2.0/24"}) {
+		t.Errorf("got condition %+v", got.Condition)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	b := newTestBackend(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cf-Ray", "8a1b2c3d4e5f6789-LHR")
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"success":false,"errors":[{"code":9109,"message":"Unauthorized to access requested resource"}],"messages":[],"result":null}`)
+	})
+
+	_, err := b.GetAPIToken(context.Background(), "ed17574386854bf78a67040be0a770b0")
+	var resp *cftoken.ResponseError
+	if !errors.As(err, &resp) {
+		t.Fatalf("error %v is not a *cftoken.ResponseError", err)
+	}
+	if resp.StatusCode != http.StatusForbidden || !reflect.DeepEqual(resp.Codes, []int{9109}) || resp.RayID != "8a1b2c3d4e5f6789-LHR" {
+		t.Errorf("got %+v", resp)
+	}
+	var cfErr *cloudflare.Error
+	if !errors.As(err, &cfErr) {
+		t.Error("the v4 error is not wrapped")
+	}
+}
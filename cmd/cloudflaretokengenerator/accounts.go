@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runListAccounts prints the accounts the parent token can access, with
+// their type and the roles the parent token's user holds in each.
+func runListAccounts(args []string) error {
+	fs := newFlagSet("list-accounts")
+	cf := addConfigFlags(fs)
+	output := fs.String("output", "table", "output format: table or json")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return usageError("invalid --output %q, must be table or json", *output)
+	}
+
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	accounts, err := gen.ListAccounts(context.Background())
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(accounts)
+	}
+
+	if len(accounts) == 0 {
+		fmt.Println("No accounts found (token may lack Account Settings Read permission)")
+		return nil
+	}
+	fmt.Printf("%-34s %-30s %-10s %s\n", "ACCOUNT ID", "NAME", "TYPE", "ROLES")
+	fmt.Printf("%-34s %-30s %-10s %s\n", "----------", "----", "----", "-----")
+	noRoles, isDefault := false, false
+	for _, a := range accounts {
+		roles := strings.Join(a.Roles, ", ")
+		if a.Roles == nil {
+			roles, noRoles = "?", true
+		} else if roles == "" {
+			roles = "-"
+		}
+		id := a.ID
+		if id == cfg.AccountID {
+			id, isDefault = id+" *", true
+		}
+		fmt.Printf("%-34s %-30s %-10s %s\n", id, a.Name, a.Type, roles)
+	}
+	if isDefault {
+		fmt.Fprintln(os.Stderr, "\n* default account (use-account to change)")
+	}
+	if noRoles {
+		fmt.Fprintln(os.Stderr, "Roles need the parent token to have the Memberships Read permission")
+	}
+	return nil
+}
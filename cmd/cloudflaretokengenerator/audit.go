@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+func runAudit(args []string) error {
+	fs := newFlagSet("audit")
+	cf := addConfigFlags(fs)
+	rulesPath := fs.String("rules", "", "YAML file of rules every token must meet")
+	output := fs.String("output", "table", "output format: table, csv, or sarif")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *rulesPath == "" {
+		return usageError("usage: cloudflaretokengenerator audit --rules <rules.yaml>")
+	}
+
+	switch *output {
+	case "table", "csv", "sarif":
+	default:
+		return fmt.Errorf("invalid --output %q, must be table, csv, or sarif", *output)
+	}
+
+	rules, err := cftoken.LoadAuditRules(*rulesPath)
+	if err != nil {
+		return err
+	}
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	report, err := gen.Audit(context.Background(), rules)
+	if err != nil {
+		return err
+	}
+
+	if *output != "table" {
+		if err := cftoken.ExportAuditReport(os.Stdout, report, *output); err != nil {
+			return err
+		}
+	} else if len(report.Violations) > 0 {
+		fmt.Printf("%-34s %-30s %-22s %s\n", "TOKEN ID", "NAME", "RULE", "VIOLATION")
+		fmt.Printf("%-34s %-30s %-22s %s\n", "--------", "----", "----", "---------")
+		for _, v := range report.Violations {
+			fmt.Printf("%-34s %-30s %-22s %s\n", v.TokenID, v.TokenName, v.Rule, v.Message)
+		}
+		fmt.Println()
+	}
+
+	tokens := make(map[string]bool)
+	for _, v := range report.Violations {
+		tokens[v.TokenID] = true
+	}
+	fmt.Fprintf(os.Stderr, "Audited %d tokens: %d violations in %d tokens\n", report.Tokens, len(report.Violations), len(tokens))
+	if len(report.Violations) > 0 {
+		return fmt.Errorf("%d tokens violate the rules in %s", len(tokens), *rulesPath)
+	}
+	return nil
+}
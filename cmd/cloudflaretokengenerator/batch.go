@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/requestpolicy"
+)
+
+func runBatch(args []string) error {
+	fs := newFlagSet("batch")
+	cf := addConfigFlags(fs)
+	concurrency := fs.Int("concurrency", 4, "number of tokens to create in parallel")
+	retries := fs.Int("retries", 2, "retries per token for transient API failures")
+	ifExists := fs.String("if-exists", "", "when a token with the same name exists: skip, replace, roll, or error")
+	policyFile := fs.String("policy-file", "", "YAML file of CEL rules every request must satisfy")
+	drain := addDrainFlag(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator batch <manifest.yaml> [--concurrency N] [--retries N] [--if-exists mode]")
+	}
+	mode, err := cftoken.ParseIfExists(*ifExists)
+	if err != nil {
+		return err
+	}
+	var extra []cftoken.Option
+	if *policyFile != "" {
+		p, err := requestpolicy.Load(*policyFile)
+		if err != nil {
+			return err
+		}
+		extra = append(extra, cftoken.WithRequestPolicy(p, ""))
+	}
+
+	manifest, err := cftoken.LoadManifest(positional[0])
+	if err != nil {
+		return err
+	}
+	extra = append(extra, cftoken.WithProvenance(cftoken.DetectProvenance(positional[0])))
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+
+	warned := make(map[string]bool)
+	for _, t := range manifest.Tokens {
+		for _, w := range cftoken.DeprecationWarnings(t.Services) {
+			if !warned[w] {
+				warned[w] = true
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+			}
+		}
+	}
+
+	if *retries == 0 {
+		*retries = -1
+	}
+	ctx, stop := interruptContext(*drain)
+	defer stop()
+	results := gen.RunBatch(ctx, manifest.Tokens, cftoken.BatchOptions{
+		Concurrency: *concurrency,
+		Retries:     *retries,
+		IfExists:    mode,
+		Options:     extra,
+		Progress:    progressBar(),
+	})
+
+	return finishBatch(ctx, gen, results)
+}
+
+// finishBatch prints the secrets that weren't delivered to a sink, records
+// the created tokens in the inventory, and prints the summary.
+func finishBatch(ctx context.Context, gen *cftoken.Generator, results []cftoken.BatchResult) error {
+	// Secrets without a sink go to stdout, one NAME=value line each. Once
+	// printed, any tokens they replace can be revoked.
+	for i, r := range results {
+		if r.Status == cftoken.BatchCreated && !r.Delivered {
+			line := stdoutSink(fmt.Sprintf("%s=%s\n", r.Entry.Name, r.Token.Value))
+			if err := gen.Deliver(context.Background(), r.Token, line, 0); err != nil {
+				results[i].Status = cftoken.BatchFailed
+				results[i].Err = err
+				continue
+			}
+			if err := revokeReplaced(gen, r.Token); err != nil {
+				results[i].Status = cftoken.BatchFailed
+				results[i].Err = err
+			}
+		}
+	}
+
+	var created []*cftoken.Token
+	var sinks []string
+	for _, r := range results {
+		// Tokens whose delivery failed are revoked, unless that failed too
+		// or they were rolled in place, so record those that still exist.
+		var derr *cftoken.DeliveryError
+		if errors.As(r.Err, &derr) && !derr.Live() {
+			continue
+		}
+		if r.Token != nil && !r.Token.Existing {
+			created = append(created, r.Token)
+			sinks = append(sinks, r.Entry.Sink)
+		}
+	}
+	if len(created) > 0 {
+		recordTokens(created, sinks)
+		last := created[0]
+		for _, t := range created {
+			if t.TokenCount > last.TokenCount {
+				last = t
+			}
+		}
+		warnTokenLimit(last)
+	}
+
+	err := printBatchSummary(results)
+	if ctx.Err() != nil {
+		notStarted := 0
+		for _, r := range results {
+			if errors.Is(r.Err, context.Canceled) {
+				notStarted++
+			}
+		}
+		return fmt.Errorf("interrupted: %d of %d tokens were not started", notStarted, len(results))
+	}
+	return err
+}
+
+// progressBar returns a batch progress callback that redraws a bar on stderr
+// when it is a terminal.
+func progressBar() func(done, total int, r cftoken.BatchResult) {
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	const width = 30
+	counts := make(map[cftoken.BatchStatus]int)
+	return func(done, total int, r cftoken.BatchResult) {
+		counts[r.Status]++
+		filled := width * done / total
+		fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d  created %d  failed %d  skipped %d",
+			strings.Repeat("#", filled), strings.Repeat("-", width-filled), done, total,
+			counts[cftoken.BatchCreated], counts[cftoken.BatchFailed], counts[cftoken.BatchSkipped])
+		if done == total {
+			fmt.Fprintln(os.Stderr)
+		}
+	}
+}
+
+// printBatchSummary prints a per-token table and totals to stderr and returns
+// an error if any token failed.
+func printBatchSummary(results []cftoken.BatchResult) error {
+	counts := make(map[cftoken.BatchStatus]int)
+	var hints []string
+	fmt.Fprintf(os.Stderr, "\n%-30s %-8s %-8s %s\n", "NAME", "STATUS", "ATTEMPTS", "DETAIL")
+	fmt.Fprintf(os.Stderr, "%-30s %-8s %-8s %s\n", "----", "------", "--------", "------")
+	for _, r := range results {
+		counts[r.Status]++
+		detail := ""
+		switch {
+		case r.Err != nil:
+			detail = r.Err.Error()
+			var apiErr *cftoken.APIError
+			if errors.As(r.Err, &apiErr) && !slices.Contains(hints, apiErr.Hint) {
+				hints = append(hints, apiErr.Hint)
+			}
+		case r.Token != nil && r.Token.Existing:
+			detail = "exists as " + r.Token.ID
+		case r.Delivered:
+			detail = "delivered to " + r.Entry.Sink
+		case r.Token != nil:
+			detail = "id " + r.Token.ID
+		}
+		fmt.Fprintf(os.Stderr, "%-30s %-8s %-8d %s\n", r.Entry.Name, r.Status, r.Attempts, detail)
+	}
+	fmt.Fprintf(os.Stderr, "\nCreated: %d  Failed: %d  Skipped: %d\n",
+		counts[cftoken.BatchCreated], counts[cftoken.BatchFailed], counts[cftoken.BatchSkipped])
+	for _, h := range hints {
+		fmt.Fprintf(os.Stderr, "Hint: %s\n", h)
+	}
+
+	failed := counts[cftoken.BatchFailed]
+	if failed == 0 {
+		return nil
+	}
+	err := fmt.Errorf("%d of %d tokens failed", failed, len(results))
+	if failed < len(results) {
+		return withExitCode(exitPartial, err)
+	}
+	// Nothing was created: exit as the first failure would have on its own.
+	for _, r := range results {
+		if r.Err != nil {
+			return withExitCode(exitCode(r.Err), err)
+		}
+	}
+	return err
+}
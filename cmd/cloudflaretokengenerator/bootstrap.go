@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+func runBootstrap(args []string) error {
+	if len(args) == 0 || args[0] != "env" {
+		return usageError("usage: cloudflaretokengenerator bootstrap env <name> --zones <pattern> [--template file.yaml] [--sink spec]")
+	}
+	return runBootstrapEnv(args[1:])
+}
+
+// runBootstrapEnv provisions the standard tokens for an environment: the
+// template's per-zone tokens for every matching zone, plus its one-off
+// tokens, created as a batch.
+func runBootstrapEnv(args []string) error {
+	fs := newFlagSet("bootstrap env")
+	cf := addConfigFlags(fs)
+	var zoneEntries stringList
+	fs.Var(&zoneEntries, "zones", "zone ID, name, or pattern in the environment (repeatable; default from the template)")
+	templateFile := fs.String("template", "", "token template (default: dns and cache purge per zone, one workers token)")
+	sink := fs.String("sink", "", "sink for entries without one, e.g. 'file:/run/secrets/{{.Name}}'")
+	ttl := fs.String("ttl", "", "lifetime of entries without a ttl")
+	ifExists := fs.String("if-exists", "skip", "when a token with the same name exists: skip, replace, roll, or error")
+	concurrency := fs.Int("concurrency", 4, "number of tokens to create in parallel")
+	dryRun := fs.Bool("dry-run", false, "print the tokens that would be created as a manifest")
+	drain := addDrainFlag(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator bootstrap env <name> --zones <pattern> [--template file.yaml] [--sink spec]")
+	}
+	env := positional[0]
+	mode, err := cftoken.ParseIfExists(*ifExists)
+	if err != nil {
+		return usageError("%v", err)
+	}
+	if *ttl != "" {
+		if _, err := cftoken.ParseTTL(*ttl); err != nil {
+			return usageError("invalid --ttl: %v", err)
+		}
+	}
+
+	tmpl := &cftoken.DefaultEnvTemplate
+	if *templateFile != "" {
+		if tmpl, err = cftoken.LoadEnvTemplate(*templateFile); err != nil {
+			return err
+		}
+	}
+	entries := []string(zoneEntries)
+	if len(entries) == 0 {
+		if entries, err = tmpl.ZoneEntries(env); err != nil {
+			return err
+		}
+	}
+	if len(entries) == 0 && len(tmpl.PerZone) > 0 {
+		return usageError("--zones is required: the template has per-zone tokens and no zones")
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	ctx, stop := interruptContext(*drain)
+	defer stop()
+	var zones []cftoken.Zone
+	if len(entries) > 0 {
+		if zones, err = gen.MatchZones(ctx, entries); err != nil {
+			return err
+		}
+	}
+	manifest, err := tmpl.Expand(env, zones, *sink)
+	if err != nil {
+		return err
+	}
+	for i := range manifest.Tokens {
+		if manifest.Tokens[i].TTL == "" {
+			manifest.Tokens[i].TTL = *ttl
+		}
+	}
+
+	if *dryRun {
+		out, err := yaml.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(out))
+		fmt.Fprintf(os.Stderr, "%d zones, %d tokens would be created\n", len(zones), len(manifest.Tokens))
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Provisioning %s: %d zones, %d tokens\n", env, len(zones), len(manifest.Tokens))
+	results := gen.RunBatch(ctx, manifest.Tokens, cftoken.BatchOptions{
+		Concurrency: *concurrency,
+		IfExists:    mode,
+		Options:     []cftoken.Option{cftoken.WithProvenance(cftoken.DetectProvenance(*templateFile))},
+		Progress:    progressBar(),
+	})
+	return finishBatch(ctx, gen, results)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// runDescribeZone prints a zone's details, the services and bundles that
+// apply to it, and the IDs and resource keys needed to scope a token to it.
+func runDescribeZone(args []string) error {
+	fs := newFlagSet("describe-zone")
+	cf := addConfigFlags(fs)
+	output := fs.String("output", "text", "output format: text or json")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator describe-zone <zone-id-or-name> [--output text|json]")
+	}
+	if *output != "text" && *output != "json" {
+		return usageError("invalid --output %q, must be text or json", *output)
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	z, err := gen.DescribeZone(context.Background(), positional[0])
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(z)
+	}
+
+	status := z.Status
+	if z.Type != "" {
+		status += " (" + z.Type + " setup)"
+	}
+	if z.Paused {
+		status += ", paused"
+	}
+	fmt.Printf("Zone:         %s\n", z.Name)
+	fmt.Printf("ID:           %s\n", z.ID)
+	fmt.Printf("Status:       %s\n", status)
+	fmt.Printf("Plan:         %s (%s)\n", z.PlanName, z.Plan)
+	fmt.Printf("Account:      %s (%s)\n", z.AccountName, z.AccountID)
+	fmt.Printf("Name servers: %s\n", strings.Join(z.NameServers, ", "))
+	if len(z.OriginalNameServers) > 0 {
+		fmt.Printf("Previous NS:  %s\n", strings.Join(z.OriginalNameServers, ", "))
+	}
+	if !z.CreatedOn.IsZero() {
+		fmt.Printf("Created:      %s\n", z.CreatedOn.Format("2006-01-02"))
+	}
+	if z.Status == "pending" {
+		fmt.Fprintln(os.Stderr, "Warning: the zone is pending; tokens work, but traffic isn't proxied until its name servers point to Cloudflare")
+	}
+
+	fmt.Println("\nScoping a token to this zone:")
+	fmt.Printf("  generate <services> %s\n", z.ID)
+	fmt.Printf("  generate <services> --zone-scope %s\n", z.Name)
+	fmt.Printf("  generate --perm-id <id> --scope zone:%s\n", z.ID)
+	fmt.Printf("  Zone resource:    %s\n", z.Resource)
+	fmt.Printf("  Account resource: %s\n", z.AccountResource)
+
+	if len(z.Bundles) > 0 {
+		fmt.Printf("\nBundles:      %s\n", strings.Join(z.Bundles, ", "))
+	}
+	fmt.Printf("\nZone services on the %s plan:\n", z.Plan)
+	for _, line := range wrapList(z.Services, 76) {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
+
+// runDescribeToken prints a token's status, validity, IP conditions, and
+// policies, with permission groups and resources named.
+func runDescribeToken(args []string) error {
+	fs := newFlagSet("describe-token")
+	cf := addConfigFlags(fs)
+	output := fs.String("output", "text", "output format: text or json")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator describe-token <token-id> [--output text|json]")
+	}
+	if *output != "text" && *output != "json" {
+		return usageError("invalid --output %q, must be text or json", *output)
+	}
+
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	t, err := gen.DescribeToken(context.Background(), positional[0])
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		return enc.Encode(t)
+	}
+
+	loc, _ := cfg.Location()
+	when := func(ts *time.Time, unset string) string {
+		if ts == nil {
+			return unset
+		}
+		return ts.In(loc).Format(time.RFC3339)
+	}
+	fmt.Printf("Token:        %s (%s)\n", t.Name, t.ID)
+	fmt.Printf("Status:       %s\n", t.Status)
+	fmt.Printf("Issued:       %s\n", when(t.IssuedOn, "-"))
+	fmt.Printf("Modified:     %s\n", when(t.ModifiedOn, "-"))
+	if t.NotBefore != nil {
+		fmt.Printf("Not before:   %s\n", when(t.NotBefore, ""))
+	}
+	fmt.Printf("Expires:      %s\n", when(t.ExpiresOn, "never"))
+	fmt.Printf("Last used:    %s\n", when(t.LastUsedOn, "never"))
+	if c := t.Condition; c != nil && c.RequestIP != nil {
+		if len(c.RequestIP.In) > 0 {
+			fmt.Printf("Allowed IPs:  %s\n", strings.Join(c.RequestIP.In, ", "))
+		}
+		if len(c.RequestIP.NotIn) > 0 {
+			fmt.Printf("Denied IPs:   %s\n", strings.Join(c.RequestIP.NotIn, ", "))
+		}
+	}
+
+	for i, p := range t.Policies {
+		fmt.Printf("\nPolicy %d (%s)\n", i+1, p.Effect)
+		fmt.Println("  Permissions:")
+		for _, perm := range p.Permissions {
+			service := ""
+			if perm.Service != "" {
+				service = "  [" + perm.Service + "]"
+			}
+			fmt.Printf("    %-40s %s%s\n", perm.Name, perm.ID, service)
+		}
+		fmt.Println("  Resources:")
+		for _, r := range p.Resources {
+			fmt.Printf("    %s\n", r.Description)
+		}
+	}
+	return nil
+}
+
+// wrapList joins items with commas into lines no longer than width.
+func wrapList(items []string, width int) []string {
+	var lines []string
+	line := ""
+	for i, item := range items {
+		if i < len(items)-1 {
+			item += ","
+		}
+		if line != "" && len(line)+1+len(item) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += item
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
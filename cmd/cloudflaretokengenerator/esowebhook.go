@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/boltstore"
+	"github.com/jackmunro/cloudflare-token-generator/redisstore"
+	"github.com/jackmunro/cloudflare-token-generator/requestpolicy"
+)
+
+// runESOWebhook serves External Secrets Operator's webhook generator, with
+// /healthz and /readyz probes and its OpenAPI document at /openapi.yaml,
+// until SIGINT or SIGTERM, then stops accepting requests and lets those in
+// flight finish.
+func runESOWebhook(args []string) error {
+	fs := newFlagSet("eso-webhook")
+	cf := addConfigFlags(fs)
+	listen := fs.String("listen", ":8080", "address to listen on")
+	authEnv := fs.String("auth-token-env", "CFTG_WEBHOOK_TOKEN", "environment variable holding the bearer token callers must send")
+	ttl := fs.String("ttl", "24h", "lifetime of tokens from requests without a ttl")
+	maxTTL := fs.String("max-ttl", "24h", "longest ttl a request may ask for")
+	policyFile := fs.String("policy-file", "", "YAML file of CEL rules every request must satisfy")
+	signingKeys := fs.String("signing-keys", "", "YAML file of client IDs and shared keys; requests must be signed by one of them")
+	signingKeyEnv := fs.String("signing-key-env", "CFTG_WEBHOOK_HMAC_KEYS", "environment variable holding comma-separated client-id:key pairs, added to --signing-keys")
+	accessConfig := fs.String("access-config", "", "YAML file with the Cloudflare Access team, audience, and grants; requests must carry an Access JWT")
+	accessTeam := fs.String("access-team", "", "Cloudflare Access team domain, overriding --access-config's team_domain")
+	accessAudience := fs.String("access-audience", "", "Cloudflare Access application AUD tag, overriding --access-config's audience")
+	storeURL := fs.String("store", "", "redis:// or rediss:// URL for request records, nonces, and quotas shared by every replica (default: a bbolt database in --state-dir)")
+	stateDir := fs.String("state-dir", "", "directory for the request log, signature nonces, and inventory (default $CFTG_STATE_DIR or the config directory)")
+	tlsCert := fs.String("tls-cert", "", "serve HTTPS with this certificate (requires --tls-key)")
+	tlsKey := fs.String("tls-key", "", "private key for --tls-cert")
+	drain := addDrainFlag(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := flagsFromEnv(fs, webhookEnvPrefix); err != nil {
+		return err
+	}
+	if len(positional) != 0 || (*tlsCert == "") != (*tlsKey == "") {
+		return usageError("usage: cloudflaretokengenerator eso-webhook [--listen ADDR] [--auth-token-env VAR] [--signing-keys file.yaml] [--access-config file.yaml] [--tls-cert C --tls-key K]; any flag can be set as $%s<FLAG>", webhookEnvPrefix)
+	}
+	opts := cftoken.ESOWebhookOptions{AuthToken: os.Getenv(*authEnv)}
+	if *signingKeys != "" {
+		if opts.SigningKeys, err = cftoken.LoadSigningKeys(*signingKeys); err != nil {
+			return withExitCode(exitConfig, err)
+		}
+	}
+	if v := os.Getenv(*signingKeyEnv); v != "" {
+		keys, err := cftoken.ParseSigningKeys(v)
+		if err != nil {
+			return withExitCode(exitConfig, fmt.Errorf("$%s: %w", *signingKeyEnv, err))
+		}
+		if opts.SigningKeys == nil {
+			opts.SigningKeys = make(map[string][]byte, len(keys))
+		}
+		for client, key := range keys {
+			if _, dup := opts.SigningKeys[client]; dup {
+				return withExitCode(exitConfig, fmt.Errorf("$%s: client %q is also in %s", *signingKeyEnv, client, *signingKeys))
+			}
+			opts.SigningKeys[client] = key
+		}
+	}
+	if *accessConfig != "" {
+		if opts.Access, err = cftoken.ReadAccessConfig(*accessConfig); err != nil {
+			return withExitCode(exitConfig, err)
+		}
+		if *accessTeam != "" {
+			opts.Access.TeamDomain = *accessTeam
+		}
+		if *accessAudience != "" {
+			opts.Access.Audience = *accessAudience
+		}
+		if err := opts.Access.Validate(); err != nil {
+			return withExitCode(exitConfig, fmt.Errorf("%s: %w", *accessConfig, err))
+		}
+	} else if *accessTeam != "" || *accessAudience != "" {
+		return usageError("--access-team and --access-audience need --access-config for the grants")
+	}
+	if opts.AuthToken == "" && opts.SigningKeys == nil && opts.Access == nil {
+		return usageError("$%s must hold the bearer token callers send, or set --signing-keys, $%s, or --access-config", *authEnv, *signingKeyEnv)
+	}
+	if opts.DefaultTTL, err = cftoken.ParseTTL(*ttl); err != nil {
+		return usageError("invalid --ttl: %v", err)
+	}
+	if opts.MaxTTL, err = cftoken.ParseTTL(*maxTTL); err != nil {
+		return usageError("invalid --max-ttl: %v", err)
+	}
+	if opts.DefaultTTL > opts.MaxTTL {
+		return usageError("--ttl %s exceeds --max-ttl %s", *ttl, *maxTTL)
+	}
+	if *policyFile != "" {
+		if opts.Policy, err = requestpolicy.Load(*policyFile); err != nil {
+			return err
+		}
+	}
+
+	if *stateDir != "" {
+		// The inventory and quotas follow CFTG_STATE_DIR.
+		os.Setenv("CFTG_STATE_DIR", *stateDir)
+	}
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	store, recoverAfter, err := openWebhookStore(*storeURL)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	opts.Store = store
+	interrupted, err := cftoken.RecoverWebhookRequests(context.Background(), store, recoverAfter)
+	if err != nil {
+		return err
+	}
+	for _, rec := range interrupted {
+		logger.Printf("Warning: request %s from %s for %s on %s was in flight when the webhook last stopped; a token may have been created without being delivered",
+			rec.ID, rec.Requester, strings.Join(rec.Services, ","), rec.Scope)
+	}
+	webhook := gen.ESOWebhookHandler(opts)
+	mux := http.NewServeMux()
+	// Probes and the API document are unauthenticated and left out of the
+	// access log, which probes would otherwise fill.
+	mux.Handle("/healthz", cftoken.LivenessHandler())
+	mux.Handle("/readyz", gen.ReadinessHandler(0, store.Ping))
+	mux.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(cftoken.ESOWebhookOpenAPI)
+	})
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		webhook.ServeHTTP(rec, r)
+		logger.Printf("%s %s %d %s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	}))
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := interruptContext(*drain)
+	defer stop()
+	errc := make(chan error, 1)
+	go func() {
+		fmt.Fprintf(os.Stderr, "✓ Serving the External Secrets webhook on %s\n", *listen)
+		if *tlsCert != "" {
+			errc <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *drain)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// openWebhookStore opens the Redis store at url, or the bbolt database in
+// the state directory if url is empty, and returns how long a request must
+// have been pending before it is reported as interrupted.
+func openWebhookStore(url string) (cftoken.WebhookStore, time.Duration, error) {
+	if url != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		store, err := redisstore.Open(ctx, url)
+		if err != nil {
+			return nil, 0, withExitCode(exitConfig, fmt.Errorf("--store: %w", err))
+		}
+		// Other replicas may have requests in flight.
+		return store, 10 * time.Minute, nil
+	}
+	dir, err := cftoken.StateDir()
+	if err != nil {
+		return nil, 0, withExitCode(exitConfig, err)
+	}
+	store, err := boltstore.Open(filepath.Join(dir, "eso-webhook.db"))
+	if err != nil {
+		return nil, 0, withExitCode(exitConfig, err)
+	}
+	return store, 0, nil
+}
+
+// webhookEnvPrefix starts the environment variables that stand in for
+// eso-webhook's flags, e.g. CFTG_WEBHOOK_LISTEN for --listen.
+const webhookEnvPrefix = "CFTG_WEBHOOK_"
+
+// statusRecorder captures the response status for the access log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
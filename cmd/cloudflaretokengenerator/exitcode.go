@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Exit codes let wrappers and CI branch on the kind of failure instead of
+// parsing stderr. Anything not classified exits with exitFailure.
+const (
+	exitFailure    = 1
+	exitConfig     = 2 // missing, unreadable, unsafe, or invalid config
+	exitAuth       = 3 // the parent credential was rejected
+	exitAPI        = 4 // any other Cloudflare API or network failure
+	exitValidation = 5 // bad flags or arguments, or a request refused locally
+	exitPartial    = 6 // a batch or bulk revoke where some tokens failed
+)
+
+// exitError attaches an exit code to an error.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func withExitCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &exitError{code: code, err: err}
+}
+
+// usageError returns a validation error for a malformed command line.
+func usageError(format string, args ...any) error {
+	return withExitCode(exitValidation, fmt.Errorf(format, args...))
+}
+
+// exitCode returns the exit code for err.
+func exitCode(err error) int {
+	var coded *exitError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	var apiErr *cftoken.APIError
+	var credential *cftoken.CredentialError
+	var resp *cftoken.ResponseError
+	rejected := errors.As(err, &resp) && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden)
+	if errors.As(err, &credential) || rejected ||
+		errors.As(err, &apiErr) && (apiErr.Code == 1000 || apiErr.Code == 10000) {
+		return exitAuth
+	}
+	var netErr net.Error
+	if resp != nil || errors.As(err, &netErr) {
+		return exitAPI
+	}
+
+	var denied *cftoken.PolicyDeniedError
+	var guardrail *cftoken.GuardrailError
+	var exceeds *cftoken.ExceedsParentError
+	var exists *cftoken.TokenExistsError
+	var plan *cftoken.PlanError
+	var quota *cftoken.QuotaError
+	var limit *policy.LimitError
+	var tokenLimit *cftoken.TokenLimitError
+	if errors.As(err, &denied) || errors.As(err, &guardrail) || errors.As(err, &exceeds) || errors.As(err, &exists) || errors.As(err, &plan) ||
+		errors.As(err, &quota) || errors.As(err, &limit) || errors.As(err, &tokenLimit) {
+		return exitValidation
+	}
+	return exitFailure
+}
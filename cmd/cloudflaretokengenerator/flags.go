@@ -0,0 +1,584 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/requestpolicy"
+	"github.com/jackmunro/cloudflare-token-generator/timeparse"
+)
+
+// newFlagSet returns a flag set for a subcommand. Parse errors are returned
+// to the caller instead of being printed by the flag package.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags parses args allowing flags to appear before, between, or after
+// positional arguments, and returns the positional arguments in order. Parse
+// errors exit with exitValidation.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, withExitCode(exitValidation, err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// flagsFromEnv sets every flag not given on the command line from the
+// environment variable named prefix plus the flag name in upper case with
+// dashes as underscores, so a deployment can be configured without
+// arguments while flags still take precedence.
+func flagsFromEnv(fs *flag.FlagSet, prefix string) error {
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		name := prefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		v, ok := os.LookupEnv(name)
+		if err != nil || given[f.Name] || !ok {
+			return
+		}
+		if serr := fs.Set(f.Name, v); serr != nil {
+			err = usageError("invalid $%s: %v", name, serr)
+		}
+	})
+	return err
+}
+
+// configFlags are the flags shared by every command that loads the config.
+type configFlags struct {
+	strict      bool
+	tenant      string
+	apiTokenEnv string
+	accountID   string
+
+	// cfg is the config once loaded.
+	cfg *cftoken.Config
+}
+
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	cf := &configFlags{}
+	fs.BoolVar(&cf.strict, "strict", false, "refuse to run if the config file permissions are unsafe")
+	fs.StringVar(&cf.tenant, "tenant", "", "use the named tenant's account, zone, and token")
+	fs.StringVar(&cf.apiTokenEnv, "api-token-env", "", "read the parent token from this environment variable and ignore the config file")
+	fs.StringVar(&cf.accountID, "account-id", "", "account to use instead of the config's account_id")
+	return cf
+}
+
+// load checks the config file permissions and loads the config. Problems are
+// printed as warnings, or returned as an error with --strict. Errors exit
+// with exitConfig.
+//
+// With --api-token-env no file is read at all, and local state goes to a
+// temporary directory unless CFTG_STATE_DIR says otherwise, so the tool can
+// run in a container with nothing mounted.
+func (cf *configFlags) load() (*cftoken.Config, error) {
+	if cf.cfg != nil {
+		return cf.cfg, nil
+	}
+	var cfg *cftoken.Config
+	var err error
+	if cf.apiTokenEnv != "" {
+		cfg, err = cf.ephemeral()
+	} else if cfg, err = cf.loadFile(); err == nil && cf.accountID != "" {
+		cfg.AccountID = cf.accountID
+	}
+	if err != nil {
+		return nil, err
+	}
+	cf.cfg = cfg
+	return cfg, nil
+}
+
+// parseTime parses the value of a time flag with timeparse.Time, in the
+// config's timezone.
+func (cf *configFlags) parseTime(name, value string) (time.Time, error) {
+	cfg, err := cf.load()
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := cfg.Location()
+	if err != nil {
+		return time.Time{}, withExitCode(exitConfig, err)
+	}
+	t, err := timeparse.Time(value, time.Now().In(loc))
+	if err != nil {
+		return time.Time{}, usageError("invalid %s: %w", name, err)
+	}
+	return t, nil
+}
+
+func (cf *configFlags) ephemeral() (*cftoken.Config, error) {
+	if cf.tenant != "" {
+		return nil, usageError("--tenant needs the config file and cannot be combined with --api-token-env")
+	}
+	token := os.Getenv(cf.apiTokenEnv)
+	if token == "" {
+		return nil, withExitCode(exitConfig, fmt.Errorf("--api-token-env: $%s is not set", cf.apiTokenEnv))
+	}
+	if os.Getenv("CFTG_STATE_DIR") == "" {
+		os.Setenv("CFTG_STATE_DIR", ephemeralStateDir())
+	}
+	return &cftoken.Config{APIToken: token, AccountID: cf.accountID}, nil
+}
+
+// ephemeralStateDir returns a directory for local state that won't outlive
+// the machine: under $XDG_RUNTIME_DIR or /dev/shm when available, which are
+// usually tmpfs, and the temporary directory otherwise.
+func ephemeralStateDir() string {
+	base := os.Getenv("XDG_RUNTIME_DIR")
+	if base == "" {
+		if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+			base = "/dev/shm"
+		} else {
+			base = os.TempDir()
+		}
+	}
+	return filepath.Join(base, fmt.Sprintf("cloudflare-token-generator-%d", os.Getuid()))
+}
+
+func (cf *configFlags) loadFile() (*cftoken.Config, error) {
+	problems, err := cftoken.CheckConfigPermissions()
+	if err != nil {
+		return nil, withExitCode(exitConfig, err)
+	}
+	for _, p := range problems {
+		if cf.strict {
+			return nil, withExitCode(exitConfig, fmt.Errorf("unsafe config: %s", p))
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", p)
+	}
+	cfg, err := cftoken.LoadConfig()
+	if err != nil {
+		return nil, withExitCode(exitConfig, err)
+	}
+	if cf.tenant != "" {
+		cfg, err = cfg.ForTenant(cf.tenant)
+		return cfg, withExitCode(exitConfig, err)
+	}
+	return cfg, nil
+}
+
+// generator loads the config and creates a Generator from it.
+func (cf *configFlags) generator() (*cftoken.Generator, *cftoken.Config, error) {
+	cfg, err := cf.load()
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.UsesAPIKey() {
+		fmt.Fprintln(os.Stderr, "Warning: using a Global API Key as the parent credential; it grants full access to your account. Create an API token with API Tokens Write and set api_token instead.")
+	}
+	gen, err := cftoken.New(*cfg)
+	if err != nil {
+		return nil, nil, withExitCode(exitConfig, err)
+	}
+	warnParentExpiry(gen, cfg)
+	return gen, cfg, nil
+}
+
+// tokenFlags are the flags that customize a created token.
+type tokenFlags struct {
+	name       string
+	ttl        string
+	notBefore  string
+	allowIP    string
+	denyIP     string
+	receipt    string
+	parent     string
+	ifExists   string
+	idemKey    string
+	team       string
+	purpose    string
+	print      string
+	json       bool
+	output     string
+	fish       bool
+	envVar     string
+	sink       string
+	tokenFD    int
+	noEcho     bool
+	policy     string
+	breakGlass string
+}
+
+func addTokenFlags(fs *flag.FlagSet) *tokenFlags {
+	tf := &tokenFlags{}
+	fs.StringVar(&tf.name, "name", "", "token name (defaults to <services>-<scope>-<level>)")
+	fs.StringVar(&tf.ttl, "ttl", "", "token lifetime, e.g. 12h, 30d, or 6mo")
+	fs.StringVar(&tf.notBefore, "not-before", "", "time the token becomes valid, e.g. 2025-01-31, next-monday-9am, +2h, or RFC 3339")
+	fs.StringVar(&tf.allowIP, "allow-ip", "", "comma-separated CIDRs the token may be used from")
+	fs.StringVar(&tf.denyIP, "deny-ip", "", "comma-separated CIDRs the token may not be used from")
+	fs.StringVar(&tf.receipt, "receipt", "", "write a signed receipt of the granted token to this file")
+	fs.StringVar(&tf.parent, "parent-limit", "", "check the request against the parent token: reject or clamp")
+	fs.StringVar(&tf.team, "team", "", "owning team, recorded in a managed cftg:<team>:<purpose>:<hash> name")
+	fs.StringVar(&tf.purpose, "purpose", "", "token purpose, recorded in a managed cftg:<team>:<purpose>:<hash> name")
+	fs.StringVar(&tf.print, "print", "value", "what to print on stdout: id, value, all, or credential-process")
+	fs.BoolVar(&tf.json, "json", false, "print the token as a JSON object on stdout")
+	fs.StringVar(&tf.output, "output", "", "shell: print an export statement for eval")
+	fs.BoolVar(&tf.fish, "fish", false, "with --output shell, print fish's set -gx instead")
+	fs.StringVar(&tf.envVar, "env-var", "CLOUDFLARE_API_TOKEN", "variable exported by --output shell")
+	fs.StringVar(&tf.sink, "sink", "", "deliver the secret to file:<path>, fd:<n>, or clipboard instead of stdout")
+	fs.IntVar(&tf.tokenFD, "token-fd", 0, "write the secret to this inherited file descriptor (same as --sink fd:N)")
+	fs.BoolVar(&tf.noEcho, "no-echo", false, "never write the secret to stdout; requires --sink or --token-fd")
+	fs.StringVar(&tf.breakGlass, "break-glass", "", "override zone group guardrails, giving the reason; the TTL is capped and the override logged")
+	fs.StringVar(&tf.policy, "policy-file", "", "YAML file of CEL rules the request must satisfy")
+	fs.StringVar(&tf.ifExists, "if-exists", "", "when a token with the same name exists: skip, replace, roll, or error")
+	fs.StringVar(&tf.idemKey, "idempotency-key", "", "append \" #<key>\" to the name and check for the token before retrying a failed create")
+	return tf
+}
+
+// options converts the flags into token options. Invalid flags exit with
+// exitValidation, and a config that can't be loaded to read them with
+// exitConfig.
+func (tf *tokenFlags) options(cf *configFlags) (opts []cftoken.Option, err error) {
+	defer func() {
+		var coded *exitError
+		if !errors.As(err, &coded) {
+			err = withExitCode(exitValidation, err)
+		}
+	}()
+	if tf.name != "" {
+		opts = append(opts, cftoken.WithName(tf.name))
+	}
+	if tf.ttl != "" {
+		d, err := cftoken.ParseTTL(tf.ttl)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cftoken.WithTTL(d))
+	}
+	if tf.notBefore != "" {
+		t, err := cf.parseTime("--not-before", tf.notBefore)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cftoken.WithNotBefore(t))
+	}
+	if tf.team != "" || tf.purpose != "" {
+		if tf.name != "" {
+			return nil, fmt.Errorf("--name cannot be combined with --team or --purpose")
+		}
+		opts = append(opts, cftoken.WithTags(tf.team, tf.purpose))
+	}
+	if tf.allowIP != "" || tf.denyIP != "" {
+		opts = append(opts, cftoken.WithIPCondition(splitList(tf.allowIP), splitList(tf.denyIP)))
+	}
+	switch tf.parent {
+	case "":
+	case "reject":
+		opts = append(opts, cftoken.WithParentLimit(false))
+	case "clamp":
+		opts = append(opts, cftoken.WithParentLimit(true))
+	default:
+		return nil, fmt.Errorf("invalid --parent-limit %q, must be \"reject\" or \"clamp\"", tf.parent)
+	}
+	switch tf.print {
+	case "id", "value", "all":
+	case "credential-process":
+		if tf.json {
+			return nil, fmt.Errorf("--print credential-process cannot be combined with --json")
+		}
+		if tf.ttl == "" {
+			fmt.Fprintln(os.Stderr, "Warning: without --ttl the credential has no Expiration, so callers may cache it forever")
+		}
+	default:
+		return nil, fmt.Errorf("invalid --print %q, must be id, value, all, or credential-process", tf.print)
+	}
+	if tf.tokenFD != 0 {
+		if tf.sink != "" {
+			return nil, fmt.Errorf("--token-fd cannot be combined with --sink")
+		}
+		tf.sink = fmt.Sprintf("fd:%d", tf.tokenFD)
+	}
+	if tf.sink != "" {
+		if _, err := cftoken.ParseSink(tf.sink); err != nil {
+			return nil, err
+		}
+	} else if tf.noEcho {
+		return nil, fmt.Errorf("--no-echo needs somewhere to put the secret: --sink or --token-fd")
+	} else if tf.print == "id" && !tf.json {
+		return nil, fmt.Errorf("--print id doesn't print the secret, so it would be lost; deliver it with --sink or --token-fd")
+	}
+	switch tf.output {
+	case "":
+		if tf.fish {
+			return nil, fmt.Errorf("--fish needs --output shell")
+		}
+	case "shell":
+		if tf.json || tf.print != "value" || tf.sink != "" || tf.noEcho {
+			return nil, fmt.Errorf("--output shell prints the secret to stdout and cannot be combined with --json, --print, --sink, --token-fd, or --no-echo")
+		}
+		if !envVarPattern.MatchString(tf.envVar) {
+			return nil, fmt.Errorf("invalid --env-var %q", tf.envVar)
+		}
+	default:
+		return nil, fmt.Errorf("invalid --output %q, must be shell", tf.output)
+	}
+	if tf.print == "credential-process" && (tf.sink != "" || tf.noEcho) {
+		return nil, fmt.Errorf("--print credential-process writes the secret to stdout and cannot be combined with --sink, --token-fd, or --no-echo")
+	}
+	if tf.breakGlass != "" {
+		opts = append(opts, cftoken.WithBreakGlass(tf.breakGlass))
+	}
+	if tf.policy != "" {
+		p, err := requestpolicy.Load(tf.policy)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cftoken.WithRequestPolicy(p, ""))
+	}
+	if tf.ifExists != "" {
+		mode, err := cftoken.ParseIfExists(tf.ifExists)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, cftoken.WithIfExists(mode))
+	}
+	if tf.idemKey != "" {
+		opts = append(opts, cftoken.WithIdempotencyKey(tf.idemKey))
+	}
+	opts = append(opts, cftoken.WithProvenance(cftoken.DetectProvenance("")))
+	return opts, nil
+}
+
+// tokenJSON is the --json form of a created token.
+type tokenJSON struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Value     string     `json:"value,omitempty"`
+	Services  []string   `json:"services,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+	Level     string     `json:"level,omitempty"`
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+	// Existing is set when --if-exists skip found the token already there;
+	// Value is then empty.
+	Existing bool `json:"existing,omitempty"`
+	// Parent names the configured parent token that created it.
+	Parent string `json:"parent,omitempty"`
+}
+
+// credentialProcessJSON is the --print credential-process form of a created
+// token: the versioned JSON object external credential processes print, with
+// Expiration telling the caller when to run the process again.
+type credentialProcessJSON struct {
+	Version    int        `json:"Version"`
+	TokenID    string     `json:"TokenId"`
+	Token      string     `json:"Token"`
+	Expiration *time.Time `json:"Expiration,omitempty"`
+}
+
+// deliveryRetries is how many times a failed --sink write is retried before
+// the token is revoked.
+const deliveryRetries = 2
+
+// stdoutSink writes output carrying a secret to stdout, so a failed write,
+// e.g. to a closed pipe, is handled like any failed delivery.
+type stdoutSink []byte
+
+func (s stdoutSink) Deliver(*cftoken.Token) error {
+	_, err := os.Stdout.Write(s)
+	return err
+}
+
+func (s stdoutSink) String() string { return "stdout" }
+
+// printToken delivers the secret to --sink if given, then writes the token to
+// stdout as selected by --print or --json. The secret only reaches stdout when
+// there is no sink. Unless stdout gets everything, the ID and expiry go to
+// stderr. If the secret can't be delivered, the token is revoked (or rolled,
+// under --if-exists roll) and a *cftoken.DeliveryError returned.
+func (tf *tokenFlags) printToken(gen *cftoken.Generator, t *cftoken.Token) error {
+	ctx := context.Background()
+	value := t.Value
+	if tf.sink != "" {
+		sink, err := cftoken.ParseSink(tf.sink)
+		if err != nil {
+			return err
+		}
+		if err := gen.Deliver(ctx, t, sink, deliveryRetries); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Delivered secret to %s\n", sink)
+		value = ""
+	}
+
+	var out bytes.Buffer
+	note := ""
+	// The ID-only output carries no secret.
+	secret := value != "" && (tf.json || tf.print != "id")
+	if tf.json {
+		data, err := json.MarshalIndent(tokenJSON{
+			ID:        t.ID,
+			Name:      t.Name,
+			Value:     value,
+			Services:  t.Services,
+			Scope:     t.Scope,
+			Level:     t.Level,
+			NotBefore: t.NotBefore,
+			ExpiresOn: t.ExpiresOn,
+			Existing:  t.Existing,
+			Parent:    t.Parent,
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(&out, string(data))
+	} else {
+		expires := "never"
+		if t.ExpiresOn != nil {
+			expires = t.ExpiresOn.Format(time.RFC3339)
+		}
+		switch {
+		case tf.output == "shell":
+			fmt.Fprintln(&out, exportStatement(tf.envVar, value, tf.fish))
+			note = fmt.Sprintf("✓ Created token %q (%s), expires %s", t.Name, t.ID, expires)
+		case tf.print == "credential-process":
+			data, err := json.Marshal(credentialProcessJSON{
+				Version:    1,
+				TokenID:    t.ID,
+				Token:      value,
+				Expiration: t.ExpiresOn,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(&out, string(data))
+		case tf.print == "id":
+			fmt.Fprintln(&out, t.ID)
+			note = fmt.Sprintf("✓ Created token %q, expires %s", t.Name, expires)
+		case tf.print == "all":
+			fmt.Fprintf(&out, "id=%s\nname=%s\n", t.ID, t.Name)
+			if value != "" {
+				fmt.Fprintf(&out, "value=%s\n", value)
+			}
+			fmt.Fprintf(&out, "expires_on=%s\n", expires)
+		default:
+			if value != "" {
+				fmt.Fprintln(&out, value)
+			}
+			note = fmt.Sprintf("✓ Created token %q (%s), expires %s", t.Name, t.ID, expires)
+		}
+	}
+
+	if secret {
+		if err := gen.Deliver(ctx, t, stdoutSink(out.Bytes()), 0); err != nil {
+			return err
+		}
+	} else {
+		os.Stdout.Write(out.Bytes())
+	}
+	if note != "" {
+		fmt.Fprintln(os.Stderr, note)
+	}
+	return nil
+}
+
+var envVarPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// exportStatement returns a statement setting name to value when evaluated by
+// a POSIX shell, or by fish. The value is single-quoted either way.
+func exportStatement(name, value string, fish bool) string {
+	if fish {
+		value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+		return fmt.Sprintf("set -gx %s '%s'", name, value)
+	}
+	return fmt.Sprintf("export %s='%s'", name, strings.ReplaceAll(value, `'`, `'\''`))
+}
+
+// report prints which configured parent created the token, what
+// --parent-limit clamp removed from it, and whether the user is close to
+// Cloudflare's token limit.
+func (tf *tokenFlags) report(t *cftoken.Token) {
+	if t.Parent != "" {
+		fmt.Fprintf(os.Stderr, "Created with parent token %q\n", t.Parent)
+	}
+	for _, r := range t.Removed {
+		fmt.Fprintf(os.Stderr, "Removed (not held by parent token): %s\n", r)
+	}
+	warnTokenLimit(t)
+}
+
+// warnTokenLimit warns when t brought its user within 10% of the token limit.
+func warnTokenLimit(t *cftoken.Token) {
+	if t.NearTokenLimit() {
+		fmt.Fprintf(os.Stderr, "Warning: %d of %d API tokens in use; run gc to remove unused ones before the limit is reached\n", t.TokenCount, t.TokenLimit)
+	}
+}
+
+// revokeReplaced revokes the tokens t replaced under --if-exists replace.
+func revokeReplaced(gen *cftoken.Generator, t *cftoken.Token) error {
+	if len(t.Replaces) == 0 {
+		return nil
+	}
+	if err := gen.RevokeReplaced(context.Background(), t); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ Revoked %d replaced token(s) named %q\n", len(t.Replaces), t.Name)
+	return nil
+}
+
+// writeReceipt writes a signed receipt for t if --receipt was given.
+func (tf *tokenFlags) writeReceipt(t *cftoken.Token) error {
+	if tf.receipt == "" {
+		return nil
+	}
+	key, err := cftoken.LoadReceiptKey()
+	if err != nil {
+		return fmt.Errorf("loading receipt key: %w", err)
+	}
+	signed, err := cftoken.SignReceipt(cftoken.NewReceipt(t, cftoken.Requester()), key)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tf.receipt, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("writing receipt: %w", err)
+	}
+	return nil
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+func runInstall(args []string) error {
+	if len(args) == 0 || args[0] != "rotate-timer" {
+		return usageError("usage: cloudflaretokengenerator install rotate-timer --name <name> <services> <scope> [level]")
+	}
+	return runInstallRotateTimer(args[1:])
+}
+
+// rotateUnit describes a scheduled rotation for the unit templates.
+type rotateUnit struct {
+	Name     string
+	Label    string
+	Args     []string
+	Every    string
+	Interval time.Duration
+	CredPath string
+}
+
+// Command returns the unit's ExecStart line, quoted for systemd.
+func (u rotateUnit) Command() string {
+	quoted := make([]string, len(u.Args))
+	for i, a := range u.Args {
+		quoted[i] = systemdQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Seconds returns the rotation interval in whole seconds.
+func (u rotateUnit) Seconds() int64 { return int64(u.Interval / time.Second) }
+
+var systemdServiceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Rotate Cloudflare API token {{.Name}}
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+Environment=HOME=%h
+UMask=0077
+ExecStart={{.Command}}
+`))
+
+var systemdTimerTemplate = template.Must(template.New("timer").Parse(`[Unit]
+Description=Rotate Cloudflare API token {{.Name}} every {{.Every}}
+
+[Timer]
+OnBootSec=5min
+OnUnitActiveSec={{.Seconds}}s
+Unit={{.Label}}.service
+
+[Install]
+WantedBy=timers.target
+`))
+
+var launchdTemplate = template.Must(template.New("plist").Funcs(template.FuncMap{"xml": template.HTMLEscapeString}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>StartInterval</key>
+	<integer>{{.Seconds}}</integer>
+	<key>RunAtLoad</key>
+	<true/>
+</dict>
+</plist>
+`))
+
+// runInstallRotateTimer prints, or writes to --dir, a systemd service and
+// timer (or a launchd agent on macOS) that rolls a named token on a schedule
+// and delivers the new secret to a file. With systemd the file is in
+// /etc/credstore, where services pick it up with LoadCredential=.
+func runInstallRotateTimer(args []string) error {
+	fs := newFlagSet("install rotate-timer")
+	cf := addConfigFlags(fs)
+	name := fs.String("name", "", "token name; also names the units (required)")
+	presetName := fs.String("preset", "", "rotate a token built from a saved preset")
+	every := fs.String("every", "24h", "how often to rotate, e.g. 12h or 7d")
+	ttl := fs.String("ttl", "", "token lifetime (default twice --every, so the old secret outlives a missed run)")
+	credential := fs.String("credential", "", "credential name the secret is stored under (default derived from --name)")
+	format := fs.String("format", "", "unit format: systemd or launchd (default launchd on macOS, systemd elsewhere)")
+	dir := fs.String("dir", "", "write the unit files to this directory instead of stdout")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *name == "" || (*presetName == "") == (len(positional) < 2) {
+		return usageError("usage: cloudflaretokengenerator install rotate-timer --name <name> (<services> <scope> [level] | --preset <name>)")
+	}
+	interval, err := cftoken.ParseTTL(*every)
+	if err != nil {
+		return usageError("invalid --every: %v", err)
+	}
+	if *ttl == "" {
+		*ttl = strings.TrimSuffix((2 * interval).String(), "0m0s")
+	} else if _, err := cftoken.ParseTTL(*ttl); err != nil {
+		return usageError("invalid --ttl: %v", err)
+	}
+	if *credential == "" {
+		*credential = unitName(*name)
+	}
+	if strings.ContainsAny(*credential, "/\\ \t") {
+		return usageError("--credential %q must be a plain name", *credential)
+	}
+	if *format == "" {
+		*format = "systemd"
+		if runtime.GOOS == "darwin" {
+			*format = "launchd"
+		}
+	}
+
+	bin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	unit := rotateUnit{Name: *name, Every: *every, Interval: interval}
+
+	var files []struct{ name, content string }
+	render := func(file string, tmpl *template.Template) error {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, unit); err != nil {
+			return err
+		}
+		files = append(files, struct{ name, content string }{file, buf.String()})
+		return nil
+	}
+	switch *format {
+	case "systemd":
+		unit.Label = "cftg-rotate-" + unitName(*name)
+		unit.CredPath = "/etc/credstore/" + *credential
+		unit.Args = rotateArgs(bin, cf, *presetName, positional, *name, *ttl, unit.CredPath)
+		if err := render(unit.Label+".service", systemdServiceTemplate); err != nil {
+			return err
+		}
+		if err := render(unit.Label+".timer", systemdTimerTemplate); err != nil {
+			return err
+		}
+	case "launchd":
+		configPath, err := cftoken.ConfigPath()
+		if err != nil {
+			return err
+		}
+		unit.Label = "com.cloudflare-token-generator.rotate." + unitName(*name)
+		unit.CredPath = filepath.Join(filepath.Dir(configPath), "credentials", *credential)
+		unit.Args = rotateArgs(bin, cf, *presetName, positional, *name, *ttl, unit.CredPath)
+		if err := render(unit.Label+".plist", launchdTemplate); err != nil {
+			return err
+		}
+	default:
+		return usageError("invalid --format %q, must be systemd or launchd", *format)
+	}
+
+	if *dir == "" {
+		for i, f := range files {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("# %s\n%s", f.name, f.content)
+		}
+	} else {
+		if err := os.MkdirAll(*dir, 0755); err != nil {
+			return err
+		}
+		for _, f := range files {
+			path := filepath.Join(*dir, f.name)
+			if err := os.WriteFile(path, []byte(f.content), 0644); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "✓ Wrote %s\n", path)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "The secret is written to %s on every run.\n", unit.CredPath)
+	if *format == "systemd" {
+		fmt.Fprintf(os.Stderr, "Enable with: systemctl daemon-reload && systemctl enable --now %s.timer\n", unit.Label)
+		fmt.Fprintf(os.Stderr, "Services read it with: LoadCredential=%s\n", *credential)
+	} else {
+		fmt.Fprintf(os.Stderr, "Load with: launchctl load ~/Library/LaunchAgents/%s.plist\n", unit.Label)
+	}
+	return nil
+}
+
+// rotateArgs is the generate command a rotation unit runs. --if-exists roll
+// keeps the token's ID and rolls its secret, and the sink revokes or re-rolls
+// the token if the secret can't be written.
+func rotateArgs(bin string, cf *configFlags, preset string, positional []string, name, ttl, credPath string) []string {
+	args := []string{bin, "generate"}
+	if preset != "" {
+		args = append(args, "--preset", preset)
+	} else {
+		args = append(args, positional...)
+	}
+	if cf.tenant != "" {
+		args = append(args, "--tenant", cf.tenant)
+	}
+	if cf.strict {
+		args = append(args, "--strict")
+	}
+	return append(args, "--name", name, "--ttl", ttl, "--if-exists", "roll", "--no-echo", "--sink", "file:"+credPath)
+}
+
+// unitName replaces characters unit names and launchd labels don't allow.
+func unitName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// systemdQuote quotes an ExecStart argument when needed. Percent and dollar
+// signs are doubled so systemd doesn't expand them as specifiers or
+// variables.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+func runInventory(args []string) error {
+	if len(args) > 0 {
+		switch args[0] {
+		case "sync":
+			return runInventorySync(args[1:])
+		case "query":
+			return runInventoryQuery(args[1:])
+		}
+	}
+	return usageError("usage: cloudflaretokengenerator inventory sync [--dry-run] [--all] | inventory query [<expr>] [--output table|json]")
+}
+
+// runInventoryQuery prints the inventory entries matching a query. It only
+// reads the local inventory; run inventory sync first for current statuses.
+func runInventoryQuery(args []string) error {
+	fs := newFlagSet("inventory query")
+	output := fs.String("output", "table", "output format: table or json")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return usageError("invalid --output %q, must be table or json", *output)
+	}
+	q, err := cftoken.ParseInventoryQuery(strings.Join(positional, " "))
+	if err != nil {
+		return usageError("invalid query: %v", err)
+	}
+	inv, err := cftoken.LoadInventory()
+	if err != nil {
+		return fmt.Errorf("loading inventory: %w", err)
+	}
+	matches := inv.Query(q)
+
+	if *output == "json" {
+		if matches == nil {
+			matches = []cftoken.InventoryEntry{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(matches)
+	}
+	if len(matches) == 0 {
+		fmt.Println("No inventory entries match")
+		return nil
+	}
+	fmt.Printf("%-40s %-32s %-20s %-9s %-10s %s\n", "NAME", "ID", "SERVICES", "STATUS", "CREATED", "EXPIRES")
+	for _, e := range matches {
+		status, expires := e.Status, "never"
+		if status == "" {
+			status = "-"
+		}
+		if e.ExpiresOn != nil {
+			expires = e.ExpiresOn.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%-40s %-32s %-20s %-9s %-10s %s\n", e.Name, e.ID, strings.Join(e.Services, ","), status,
+			e.CreatedAt.Local().Format("2006-01-02"), expires)
+	}
+	fmt.Fprintf(os.Stderr, "\n%d of %d entries\n", len(matches), len(inv.Tokens))
+	return nil
+}
+
+// runInventorySync reconciles the local inventory with the tokens live in the
+// account. It only reads from Cloudflare.
+func runInventorySync(args []string) error {
+	fs := newFlagSet("inventory sync")
+	cf := addConfigFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "report differences without updating the inventory")
+	all := fs.Bool("all", false, "list every untracked token, not only those with managed names")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	var report *cftoken.SyncReport
+	entries := 0
+	sync := func(inv *cftoken.Inventory) (err error) {
+		report, err = gen.SyncInventory(context.Background(), inv)
+		entries = len(inv.Tokens)
+		return err
+	}
+	if *dryRun {
+		inv, err := cftoken.LoadInventory()
+		if err != nil {
+			return fmt.Errorf("loading inventory: %w", err)
+		}
+		err = sync(inv)
+	} else {
+		// The inventory stays locked while the account is listed, so
+		// entries added meanwhile aren't lost when it is saved.
+		err = cftoken.UpdateInventory(sync)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, c := range report.Changes {
+		from := c.From
+		if from == "" {
+			from = "unsynced"
+		}
+		fmt.Printf("%-40s %s  %s -> %s\n", c.Name, c.ID, from, c.To)
+	}
+	for _, e := range report.Missing {
+		fmt.Printf("%-40s %s  missing in Cloudflare\n", e.Name, e.ID)
+	}
+	untracked := 0
+	for _, t := range report.Untracked {
+		if !t.Tagged && !*all {
+			continue
+		}
+		untracked++
+		fmt.Printf("%-40s %s  not in inventory\n", t.Name, t.ID)
+	}
+	fmt.Fprintf(os.Stderr, "\nEntries: %d  Changed: %d  Missing: %d  Untracked: %d\n",
+		entries, len(report.Changes), len(report.Missing), untracked)
+	if !*all && untracked < len(report.Untracked) {
+		fmt.Fprintf(os.Stderr, "%d other tokens have unmanaged names (see --all)\n", len(report.Untracked)-untracked)
+	}
+
+	if !*dryRun {
+		fmt.Fprintln(os.Stderr, "✓ Inventory updated")
+	}
+	return nil
+}
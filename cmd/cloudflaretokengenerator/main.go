@@ -3,12 +3,17 @@ package main
 import (
 	"bufio"
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
+	"slices"
 	"strings"
+	"time"
 
-	cloudflare "github.com/cloudflare/cloudflare-go"
+	"gopkg.in/yaml.v3"
 
 	cftoken "github.com/jackmunro/cloudflare-token-generator"
 )
@@ -19,35 +24,94 @@ func main() {
 		os.Exit(1)
 	}
 
+	var err error
 	switch os.Args[1] {
 	case "init":
-		if err := runInit(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runInit(os.Args[2:])
 	case "generate":
-		if err := runGenerate(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runGenerate(os.Args[2:])
+	case "whoami":
+		err = runWhoami(os.Args[2:])
+	case "roll-parent":
+		err = runRollParent(os.Args[2:])
+	case "search-permissions":
+		err = runSearchPermissions(os.Args[2:])
+	case "lookup":
+		err = runLookup(os.Args[2:])
 	case "list-services":
-		runListServices()
+		err = runListServices(os.Args[2:])
+	case "batch":
+		err = runBatch(os.Args[2:])
+	case "bootstrap":
+		err = runBootstrap(os.Args[2:])
+	case "watch-zones":
+		err = runWatchZones(os.Args[2:])
 	case "godmode":
-		if err := runGodMode(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runGodMode(os.Args[2:])
 	case "list-zones":
-		if err := runListZones(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
+		err = runListZones(os.Args[2:])
+	case "list-accounts":
+		err = runListAccounts(os.Args[2:])
+	case "describe-zone":
+		err = runDescribeZone(os.Args[2:])
+	case "describe-token":
+		err = runDescribeToken(os.Args[2:])
+	case "list-tokens":
+		err = runListTokens(os.Args[2:])
+	case "revoke":
+		err = runRevoke(os.Args[2:])
+	case "expire":
+		err = runExpire(os.Args[2:])
+	case "stale":
+		err = runStale(os.Args[2:])
+	case "gc":
+		err = runGC(os.Args[2:])
+	case "inventory":
+		err = runInventory(os.Args[2:])
+	case "audit":
+		err = runAudit(os.Args[2:])
+	case "suggest":
+		err = runSuggest(os.Args[2:])
+	case "import-token":
+		err = runImportToken(os.Args[2:])
+	case "use-account":
+		err = runUseAccount(os.Args[2:])
+	case "use-zone":
+		err = runUseZone(os.Args[2:])
+	case "verify-receipt":
+		err = runVerifyReceipt(os.Args[2:])
+	case "receipt-key":
+		err = runReceiptKey()
+	case "config":
+		err = runConfig(os.Args[2:])
+	case "version", "--version":
+		err = runVersion()
+	case "backup":
+		err = runBackup(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	case "install":
+		err = runInstall(os.Args[2:])
+	case "operator":
+		err = runOperator(os.Args[2:])
+	case "eso-webhook":
+		err = runESOWebhook(os.Args[2:])
+	case "self-update":
+		err = runSelfUpdate(os.Args[2:])
 	case "help", "--help", "-h":
 		printUsage()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitValidation)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var apiErr *cftoken.APIError
+		if errors.As(err, &apiErr) {
+			fmt.Fprintf(os.Stderr, "Hint: %s\n", apiErr.Hint)
+		}
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -55,11 +119,76 @@ func printUsage() {
 	fmt.Println(`Usage: cloudflaretokengenerator <command> [args]
 
 Commands:
-  init                                          Configure API token, account, and zone
+  init [--format yaml|toml|json]                Configure API token, account, and zone
+       [--from-wrangler]                        (reusing wrangler/cloudflared credentials)
   generate <services> <scope> [level]           Generate a scoped API token
+  generate --perm-id <id>... --scope <s>...     Generate a token from raw permission group IDs
+  generate - < request.json                     Generate a token from a JSON request, answering in JSON
+  batch <manifest.yaml>                         Create every token in a manifest in parallel
+                                                (--concurrency, --retries, --if-exists, --policy-file,
+                                                --drain-timeout)
+  bootstrap env <name> --zones <pattern>        Create an environment's standard tokens: DNS and cache
+                                                purge per zone and one Workers token, or a --template
+                                                (--sink SPEC, --ttl D, --dry-run)
+  watch-zones [--template F] [--webhook URL]    Create the template's per-zone tokens for each zone added
+                                                to the account (--interval 5m, --once, --state FILE)
   godmode                                       Generate a token with edit access to all services
-  list-services                                 List available services
+  list-services [--output table|json|yaml]      List available services (--plan P to show only those
+                                                on a plan, --validate to check the permission IDs
+                                                against Cloudflare)
+  search-permissions <keyword>...               Find live permission groups by name, with their IDs,
+                                                scopes, and the services that grant them
+  lookup <permission-id>                        Name a permission group ID and the service it controls
   list-zones                                    List zones accessible by your token
+  list-accounts [--output table|json]           List accounts accessible by your token, with their type
+                                                and your roles in each
+  describe-zone <id-or-name>                    Show a zone's plan, status, name servers, the services
+                                                and bundles that apply, and the IDs to scope tokens with
+  list-tokens [--team T] [--purpose P]          List existing tokens (--older-than D, --tagged,
+                                                --output table|csv, --provenance)
+  describe-token <token-id>                     Show a token's status, validity, IP conditions, and policies
+                                                with permission and zone names
+  revoke <token-id>... | --team T | --purpose P Revoke tokens by ID, managed tags, or name (--match GLOB,
+                                                --created-before DATE, --older-than D, --dry-run,
+                                                --concurrency N, --interactive to pick from a list,
+                                                --drain-timeout)
+  expire <token-id> --at DATE | --in D          Set or extend an existing token's expiry in place
+  stale [--unused-for 90d]                      List tokens not used recently
+  gc [--dry-run]                                Revoke expired, disabled, or orphaned tokens made by this
+                                                tool (--older-than D, --expired-for D, --unused-for D)
+  inventory sync [--dry-run] [--all]            Reconcile the local inventory with live tokens
+  inventory query [<expr>] [--output json]      List inventory entries matching a query
+  import-token <token-id> [--name N] [--save]   Convert an existing token into a preset
+  audit --rules <rules.yaml>                    Check every token in the account against org rules
+                                                (--output table|csv|sarif)
+  suggest --for-user <email> [--save]           Suggest presets matching an account member's roles
+  whoami                                        Show the parent token in use, its status, and expiry
+  roll-parent                                   Roll the parent token's secret and save it to the config
+  use-account [account-id]                      Switch the default account
+  use-zone [zone-id]                            Switch the default zone
+  verify-receipt <file> [--public-key pem]      Verify a signed token receipt
+  receipt-key                                   Print the receipt signing public key
+  config chmod                                  Restrict config file permissions to the current user
+  config export [--no-secrets] [--format F]     Print the config as YAML or JSON, optionally without credentials
+  config import <file> [--overwrite]            Merge presets, zone groups, guardrails, and tenants from a file
+  backup <file>                                 Write an encrypted archive of the config and local state
+                                                (passphrase in $CFTG_BACKUP_PASSPHRASE)
+  restore <file> [--force]                      Restore the config and local state from a backup
+  install rotate-timer --name N <services> <scope>
+                                                Print a systemd service and timer (launchd plist on macOS)
+                                                that rolls the token on a schedule (--every D, --ttl D,
+                                                --preset P, --credential NAME, --dir DIR)
+  operator --policy-file F | --unrestricted     Reconcile CloudflareToken resources into Secrets when
+                                                running in Kubernetes (--namespace NS, --interval D)
+  eso-webhook [--listen ADDR]                   Mint tokens for External Secrets Operator's webhook
+                                                generator (--auth-token-env VAR, --ttl D, --max-ttl D,
+                                                --policy-file F, --signing-keys F, --access-config F,
+                                                --access-team T --access-audience AUD, --state-dir DIR,
+                                                --store redis://HOST for replicas sharing state,
+                                                --tls-cert C --tls-key K); serves /healthz and /readyz
+                                                probes and its OpenAPI document at /openapi.yaml
+  version                                       Show the version and service catalog version
+  self-update [--check] [--version TAG]         Replace this binary with a verified release
   help                                          Show this help
 
 Services:
@@ -69,17 +198,79 @@ Scope:
   all                           All resources (all zones or configured account)
   <zone-id>                     Specific zone ID (zone-scoped services)
   <account-id>                  Specific account ID (account-scoped services)
+  @<group>                      Every zone in a zone group from the config
+
+Global flags:
+  --strict                      Refuse to run if config.yaml is readable by others or owned by another user
+  --tenant <name>               Use a tenant's account, default zone, and parent token
+
+Generate flags:
+  --preset <name>               Use services, scope, and level from a saved preset
+  --accounts <id1,id2>          Grant account-scoped services on each listed account
+  --scope account[:<id>|:all]   Account for account-scoped services (repeatable)
+  --zone-scope <zone>           Zone ID, name, or pattern for zone-scoped services (repeatable)
+  --verify-after                Call a read endpoint for each service with the new token and report failures
+
+Token flags (generate, godmode):
+  --name <name>                 Token name (default <services>-<scope>-<level>)
+  --ttl <duration>              Expire the token after a duration, e.g. 12h, 30d, or 6mo
+  --not-before <time>           Time the token becomes valid, e.g. 2025-01-31, next-monday-9am, or +2h
+  --allow-ip <cidrs>            Comma-separated CIDRs the token may be used from
+  --deny-ip <cidrs>             Comma-separated CIDRs the token may not be used from
+  --receipt <file>              Write a signed (ed25519) receipt of what was granted, without the secret
+  --parent-limit reject|clamp   Never exceed the parent token's own permissions: reject the request, or
+                                remove the excess and report what was removed
+  --team <team>                 Name the token cftg:<team>:<purpose>:<hash> so it can be filtered later
+  --purpose <purpose>           (see list-tokens and revoke)
+  --print id|value|all          What to print on stdout (default value; the ID and expiry go to stderr);
+                                id needs --sink or --token-fd for the secret
+  --print credential-process    Print {"Version":1,"TokenId","Token","Expiration"} JSON for credential helpers
+  --json                        Print the ID, name, value, scope, and validity as JSON
+  --sink <spec>                 Deliver the secret to file:<path>, fd:<n>, or clipboard instead of stdout
+  --token-fd <n>                Write the secret to an inherited file descriptor (same as --sink fd:<n>)
+  --no-echo                     Never write the secret to stdout; fails unless --sink or --token-fd is set
+  --break-glass <reason>        Override zone group guardrails (short TTL, logged)
+  --policy-file <file>          Reject the request unless it satisfies the file's CEL rules
+  --if-exists <mode>            If a token with the same name exists: skip it, replace it (revoking the
+                                old one afterwards), roll its secret in place, or error
+  --idempotency-key <key>       Name the token "<name> #<key>"; if creating it fails ambiguously (timeout,
+                                server error), look for it by that name before retrying
+
+eso-webhook environment (flags take precedence):
+  CFTG_WEBHOOK_<FLAG>           Any eso-webhook flag, upper case with dashes as underscores, e.g.
+                                CFTG_WEBHOOK_LISTEN, CFTG_WEBHOOK_POLICY_FILE, CFTG_WEBHOOK_ACCESS_TEAM,
+                                CFTG_WEBHOOK_ACCESS_AUDIENCE
+  CFTG_WEBHOOK_TOKEN            Bearer token callers must send (renamed by --auth-token-env)
+  CFTG_WEBHOOK_HMAC_KEYS        Comma-separated client-id:key pairs that may sign requests (renamed by
+                                --signing-key-env)
 
 Level:
   edit                          Read and write permissions (default)
   read                          Read-only permissions
 
+Exit codes:
+  1  other failure                4  Cloudflare API or network error
+  2  config error                 5  invalid flags, arguments, or a request refused by policy
+  3  parent credential rejected   6  batch or revoke left some tokens failed
+
 Examples:
   cloudflaretokengenerator init
   cloudflaretokengenerator generate dns all
   cloudflaretokengenerator generate workers,kv all edit
   cloudflaretokengenerator generate workers,kv,d1 all read
   cloudflaretokengenerator generate dns 023e105f4ecef8ad9ca31a8372d0c353
+  cloudflaretokengenerator generate dns all --ttl 24h --allow-ip 203.0.113.0/24
+  eval "$(cloudflaretokengenerator generate dns all --ttl 1h --output shell)"
+  cloudflaretokengenerator generate dns,cache @prod
+  cloudflaretokengenerator generate --preset ci-deploy
+  cloudflaretokengenerator generate workers,kv --accounts 0123abcd,4567ef01
+  cloudflaretokengenerator generate workers-deploy --scope account:all --zone-scope example.com
+  cloudflaretokengenerator generate --tenant customerA dns all
+  cloudflaretokengenerator generate dns all --team platform --purpose ci
+  cloudflaretokengenerator revoke --purpose ci --older-than 90d --dry-run
+  cloudflaretokengenerator revoke --match 'ci-*' --created-before 2024-01-01 --dry-run
+  cloudflaretokengenerator expire 3f5b2c9a1d7e4f60b8c2a9d1e5f7a3b4 --at 2025-12-31
+  cloudflaretokengenerator import-token 3f5b2c9a1d7e4f60b8c2a9d1e5f7a3b4 --save
   cloudflaretokengenerator godmode`)
 }
 
@@ -88,151 +279,420 @@ func readLine(r *bufio.Reader) string {
 	return strings.TrimSpace(line)
 }
 
-func runInit() error {
+func runInit(args []string) error {
+	fs := newFlagSet("init")
+	format := fs.String("format", "", "config file format: yaml, toml, or json (default: keep the existing file's format)")
+	fromWrangler := fs.Bool("from-wrangler", false, "reuse credentials from wrangler (.dev.vars, its config, environment) and ~/.cloudflared")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *format != "" && !slices.Contains(cftoken.ConfigFormats, *format) {
+		return usageError("invalid config format %q (use yaml, toml, or json)", *format)
+	}
 	reader := bufio.NewReader(os.Stdin)
 
-	fmt.Print("Enter your Cloudflare API Token: ")
-	apiToken := readLine(reader)
+	var imported cftoken.Config
+	if *fromWrangler {
+		imp, err := cftoken.ImportToolCredentials(".")
+		if err != nil {
+			return fmt.Errorf("importing credentials: %w", err)
+		}
+		for _, w := range imp.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		}
+		for _, src := range imp.Sources {
+			fmt.Fprintf(os.Stderr, "✓ Using %s from %s\n", src.Key, src.Path)
+		}
+		imported = imp.Config
+	}
+
+	apiToken := imported.APIToken
+	if apiToken == "" {
+		fmt.Print("Enter your Cloudflare API Token: ")
+		apiToken = readLine(reader)
+	}
 	if apiToken == "" {
 		return fmt.Errorf("API token is required")
 	}
 
 	// Verify token
-	api, err := cloudflare.NewWithAPIToken(apiToken)
+	gen, err := cftoken.New(cftoken.Config{APIToken: apiToken})
 	if err != nil {
 		return fmt.Errorf("invalid token: %w", err)
 	}
-	_, err = api.VerifyAPIToken(context.Background())
-	if err != nil {
+	if err := gen.Verify(context.Background()); err != nil {
 		return fmt.Errorf("token verification failed: %w", err)
 	}
 	fmt.Println("✓ Token verified")
 
 	// Try to discover accounts
-	var accountID string
-	accounts, _, accErr := api.Accounts(context.Background(), cloudflare.AccountsListParams{})
-	if accErr == nil && len(accounts) > 0 {
-		fmt.Println("\nAvailable accounts:")
-		for i, a := range accounts {
-			fmt.Printf("  [%d] %s (%s)\n", i+1, a.Name, a.ID)
-		}
-		fmt.Print("\nSelect account (number) or enter Account ID: ")
-		input := readLine(reader)
-		if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(accounts) {
-			accountID = accounts[n-1].ID
+	accountID := imported.AccountID
+	if accountID == "" {
+		accounts, accErr := gen.DiscoverAccounts(context.Background())
+		if accErr == nil && len(accounts) > 0 {
+			accountID = selectID(reader, "Available accounts", "Select account (number) or enter Account ID", accountChoices(accounts), "")
 		} else {
-			accountID = input
+			fmt.Print("\nEnter your Account ID: ")
+			accountID = readLine(reader)
 		}
-	} else {
-		fmt.Print("\nEnter your Account ID: ")
-		accountID = readLine(reader)
 	}
 	if accountID == "" {
 		return fmt.Errorf("account ID is required")
 	}
 
 	// Try to discover zones
-	var zoneID string
-	zones, zoneErr := api.ListZones(context.Background())
-	if zoneErr == nil && len(zones) > 0 {
-		fmt.Println("\nAvailable zones:")
-		for i, z := range zones {
-			fmt.Printf("  [%d] %s (%s)\n", i+1, z.Name, z.ID)
-		}
-		fmt.Print("\nSelect default zone (number), enter Zone ID, or press Enter to skip: ")
-		input := readLine(reader)
-		if input != "" {
-			if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(zones) {
-				zoneID = zones[n-1].ID
-			} else {
-				zoneID = input
-			}
+	zoneID := imported.ZoneID
+	if zoneID == "" {
+		zones, zoneErr := gen.DiscoverZones(context.Background())
+		if zoneErr == nil && len(zones) > 0 {
+			zoneID = selectID(reader, "Available zones", "Select default zone (number), enter Zone ID, or press Enter to skip", zoneChoices(zones), "")
+		} else {
+			fmt.Print("\nEnter default Zone ID (or press Enter to skip): ")
+			zoneID = readLine(reader)
 		}
-	} else {
-		fmt.Print("\nEnter default Zone ID (or press Enter to skip): ")
-		zoneID = readLine(reader)
 	}
 
-	cfg := &cftoken.Config{
-		APIToken:  apiToken,
-		AccountID: accountID,
-		ZoneID:    zoneID,
+	cfg, err := cftoken.LoadUserConfig()
+	if err != nil {
+		return err
 	}
-	if err := cftoken.SaveConfig(cfg); err != nil {
+	cfg.APIToken = apiToken
+	cfg.AccountID = accountID
+	cfg.ZoneID = zoneID
+	save := cftoken.SaveConfig
+	if *format != "" {
+		save = func(cfg *cftoken.Config) error { return cftoken.SaveConfigAs(cfg, *format) }
+	}
+	if err := save(cfg); err != nil {
 		return fmt.Errorf("saving config: %w", err)
 	}
-	fmt.Println("\n✓ Config saved to ~/.goGenerateCFToken/config.yaml")
+	path, _ := cftoken.ConfigPath()
+	fmt.Printf("\n✓ Config saved to %s\n", path)
 	return nil
 }
 
-func runGenerate() error {
-	if len(os.Args) < 4 {
-		return fmt.Errorf("usage: cloudflaretokengenerator generate <services> <scope> [level]")
+func runGenerate(args []string) (err error) {
+	fs := newFlagSet("generate")
+	cf := addConfigFlags(fs)
+	tf := addTokenFlags(fs)
+	presetName := fs.String("preset", "", "use a saved preset")
+	accounts := fs.String("accounts", "", "comma-separated account IDs for account-scoped services")
+	verifyAfter := fs.Bool("verify-after", false, "exercise each service with the new token before returning")
+	var permIDs, scopes stringList
+	fs.Var(&permIDs, "perm-id", "grant this permission group ID directly (repeatable)")
+	fs.Var(&scopes, "scope", "resource for --perm-id (zone:<id>, zone:*, account:<id>, or account), or the account for account-scoped services (repeatable)")
+	var zoneScopes stringList
+	fs.Var(&zoneScopes, "zone-scope", "zone ID, name, or pattern for zone-scoped services (repeatable)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
 	}
-	services := strings.Split(os.Args[2], ",")
-	scope := os.Args[3]
-	level := "edit"
-	if len(os.Args) >= 5 {
-		level = os.Args[4]
+	// "generate -" takes the request as JSON on stdin and answers in JSON.
+	fromStdin := len(positional) == 1 && positional[0] == "-"
+	if fromStdin {
+		defer func() {
+			if err != nil {
+				writeRequestError(err)
+			}
+		}()
+		if len(permIDs) > 0 || *presetName != "" || *accounts != "" || len(zoneScopes) > 0 {
+			return usageError("generate - reads the request from stdin and cannot be combined with --perm-id, --preset, --accounts, or --zone-scope")
+		}
+		req, err := readTokenRequest(os.Stdin)
+		if err != nil {
+			return err
+		}
+		req.apply(tf)
+		positional = []string{strings.Join(req.Services, ","), req.Scope}
+		if req.Level != "" {
+			positional = append(positional, req.Level)
+		}
+		*presetName = req.Preset
+		*accounts = strings.Join(req.Accounts, ",")
+		zoneScopes = req.Zones
+	}
+	if len(permIDs) > 0 {
+		if len(scopes) == 0 || len(zoneScopes) > 0 || len(positional) > 0 || *presetName != "" || *accounts != "" {
+			return usageError("usage: cloudflaretokengenerator generate --perm-id <id>... --scope <zone:ID|zone:*|account:ID|account>...")
+		}
+	} else if len(scopes) > 0 && *accounts != "" {
+		return usageError("--scope and --accounts both select accounts; use one")
 	}
 
-	cfg, err := cftoken.LoadConfig()
+	gen, cfg, err := cf.generator()
 	if err != nil {
 		return err
 	}
 
-	gen, err := cftoken.New(*cfg)
+	var services []string
+	var scope string
+	level := "edit"
+	if *presetName != "" {
+		preset, ok := cfg.Presets[*presetName]
+		if !ok {
+			return fmt.Errorf("unknown preset %q", *presetName)
+		}
+		services, scope = preset.Services, preset.Scope
+		if preset.Level != "" {
+			level = preset.Level
+		}
+	} else if len(permIDs) == 0 {
+		// With --accounts, --scope, or --zone-scope the scope argument is
+		// only a fallback, so it may be omitted.
+		if len(positional) == 1 && (*accounts != "" || len(scopes) > 0 || len(zoneScopes) > 0) {
+			positional = append(positional, "all")
+		}
+		if len(positional) < 2 {
+			return usageError("usage: cloudflaretokengenerator generate <services> <scope> [level]")
+		}
+		services = strings.Split(positional[0], ",")
+		scope = positional[1]
+		if len(positional) >= 3 {
+			level = positional[2]
+		}
+	}
+
+	opts, err := tf.options(cf)
 	if err != nil {
 		return err
 	}
+	if *accounts != "" {
+		opts = append(opts, cftoken.WithAccounts(splitList(*accounts)...))
+	}
+	if len(permIDs) == 0 && len(scopes) > 0 {
+		ids, err := accountScopes(scopes, cfg.AccountID)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, cftoken.WithAccounts(ids...))
+	}
+	if len(zoneScopes) > 0 {
+		opts = append(opts, cftoken.WithZones(zoneScopes...))
+	}
 
-	token, err := gen.GenerateMulti(services, scope, level)
+	for _, w := range cftoken.DeprecationWarnings(services) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
+	if err := gen.Verify(context.Background()); err != nil {
+		return err
+	}
+	var token *cftoken.Token
+	if len(permIDs) > 0 {
+		token, err = gen.GenerateFromPermissions(permIDs, scopes, opts...)
+	} else {
+		token, err = gen.GenerateToken(services, scope, level, opts...)
+	}
 	if err != nil {
 		return err
 	}
 
-	fmt.Println(token)
+	if token.Existing {
+		fmt.Fprintf(os.Stderr, "✓ Token %q already exists (%s), not creating another\n", token.Name, token.ID)
+		if fromStdin {
+			return tf.printToken(gen, token)
+		}
+		return nil
+	}
+
+	if err := tf.printToken(gen, token); err != nil {
+		return err
+	}
+	recordTokens([]*cftoken.Token{token}, []string{tf.sink})
+	tf.report(token)
+	if err := tf.writeReceipt(token); err != nil {
+		return err
+	}
+	if err := revokeReplaced(gen, token); err != nil {
+		return err
+	}
+	if *verifyAfter {
+		return verifyToken(gen, token)
+	}
 	return nil
 }
 
-func runGodMode() error {
-	cfg, err := cftoken.LoadConfig()
+// accountScopes converts --scope values for a service token to account IDs.
+// "account" and "account:all" mean the configured account.
+func accountScopes(scopes []string, configured string) ([]string, error) {
+	var ids []string
+	for _, s := range scopes {
+		kind, id, _ := strings.Cut(s, ":")
+		if kind != "account" {
+			return nil, usageError("--scope %q: with services, --scope selects accounts (account, account:all, or account:<id>); use --zone-scope for zones", s)
+		}
+		if id == "" || id == "all" {
+			if configured == "" {
+				return nil, withExitCode(exitConfig, fmt.Errorf("--scope %q needs account_id in the config", s))
+			}
+			id = configured
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// verifyToken probes each service of a new token and reports the results on
+// stderr, returning an error if any probe failed.
+func verifyToken(gen *cftoken.Generator, token *cftoken.Token) error {
+	failed := 0
+	for _, r := range gen.VerifyToken(context.Background(), token) {
+		switch {
+		case r.Skipped:
+			fmt.Fprintf(os.Stderr, "- %s: skipped (%s)\n", r.Service, r.Reason)
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(os.Stderr, "✗ %s: %v\n", r.Service, r.Err)
+		default:
+			fmt.Fprintf(os.Stderr, "✓ %s\n", r.Service)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d service(s) failed verification with the new token", failed)
+	}
+	return nil
+}
+
+func runGodMode(args []string) error {
+	fs := newFlagSet("godmode")
+	cf := addConfigFlags(fs)
+	tf := addTokenFlags(fs)
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	opts, err := tf.options(cf)
 	if err != nil {
 		return err
 	}
 
-	gen, err := cftoken.New(*cfg)
+	gen, _, err := cf.generator()
 	if err != nil {
 		return err
 	}
 
-	token, err := gen.GodMode()
+	token, err := gen.GodModeToken(opts...)
 	if err != nil {
 		return err
 	}
+	if token.Existing {
+		fmt.Fprintf(os.Stderr, "✓ Token %q already exists (%s), not creating another\n", token.Name, token.ID)
+		return nil
+	}
 
-	fmt.Println(token)
-	return nil
+	if err := tf.printToken(gen, token); err != nil {
+		return err
+	}
+	recordTokens([]*cftoken.Token{token}, []string{tf.sink})
+	tf.report(token)
+	if err := tf.writeReceipt(token); err != nil {
+		return err
+	}
+	return revokeReplaced(gen, token)
 }
 
-func runListServices() {
+func runListServices(args []string) error {
+	fs := newFlagSet("list-services")
+	output := fs.String("output", "table", "output format: table, json, or yaml")
+	validate := fs.Bool("validate", false, "check every permission group ID against Cloudflare's live list")
+	planFlag := fs.String("plan", "", "only list services offered on this plan: free, pro, business, enterprise, or auto for the account's")
+	cf := addConfigFlags(fs)
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *validate {
+		return validateCatalog(cf)
+	}
+	if *output != "table" {
+		return cftoken.ExportCatalog(os.Stdout, *output)
+	}
+	plan, err := cftoken.ParsePlan(*planFlag)
+	if err != nil {
+		return usageError("%v", err)
+	}
+	if plan == cftoken.PlanAuto {
+		gen, _, err := cf.generator()
+		if err != nil {
+			return err
+		}
+		if plan, err = gen.DetectPlan(context.Background()); err != nil {
+			return fmt.Errorf("detecting plan: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Account plan: %s\n", plan)
+	}
+
 	fmt.Println("Available services:")
 	fmt.Println()
 	fmt.Printf("  %-16s %-10s %-12s %s\n", "SERVICE", "SCOPE", "LEVELS", "DESCRIPTION")
 	fmt.Printf("  %-16s %-10s %-12s %s\n", "-------", "-----", "------", "-----------")
-	for _, svc := range cftoken.ListServices() {
+	for _, svc := range cftoken.ServicesForPlan(plan) {
 		levels := strings.Join(cftoken.ServiceLevels(svc), ",")
-		fmt.Printf("  %-16s %-10s %-12s %s\n", svc.Name, svc.ResourceScope, levels, svc.Description)
+		desc := svc.Description
+		if svc.Plan != "" {
+			desc += " (" + svc.Plan + " plan)"
+		}
+		if svc.Deprecated {
+			desc += " (deprecated"
+			if svc.ReplacedBy != "" {
+				desc += ", use " + svc.ReplacedBy
+			}
+			desc += ")"
+		}
+		fmt.Printf("  %-16s %-10s %-12s %s\n", svc.Name, svc.ResourceScope, levels, desc)
 	}
+	fmt.Println()
+	fmt.Println("Bundles:")
+	fmt.Println()
+	for _, name := range cftoken.ListBundles() {
+		fmt.Printf("  %-16s %s\n", name, strings.Join(cftoken.Bundles[name], ", "))
+	}
+	return nil
 }
 
-func runListZones() error {
-	cfg, err := cftoken.LoadConfig()
+// validateCatalog reports catalog permissions that drifted from the live
+// permission group list, failing if there are any.
+func validateCatalog(cf *configFlags) error {
+	gen, _, err := cf.generator()
 	if err != nil {
 		return err
 	}
+	report, err := gen.ValidateCatalog(context.Background())
+	if err != nil {
+		return err
+	}
+	sections := []struct {
+		title string
+		drift []cftoken.CatalogDrift
+	}{
+		{"Missing", report.Missing},
+		{"Renamed", report.Renamed},
+		{"Deprecated", report.Deprecated},
+	}
+	for _, s := range sections {
+		if len(s.drift) == 0 {
+			continue
+		}
+		fmt.Printf("%s:\n", s.title)
+		for _, d := range s.drift {
+			fmt.Printf("  %s\n", d)
+		}
+	}
+	if report.OK() {
+		fmt.Fprintf(os.Stderr, "✓ All %d catalog permissions match (catalog %s)\n", report.Checked, cftoken.CatalogVersion())
+		return nil
+	}
+	return fmt.Errorf("%d of %d catalog permissions drifted; run go generate to refresh the catalog",
+		len(report.Missing)+len(report.Renamed)+len(report.Deprecated), report.Checked)
+}
 
-	gen, err := cftoken.New(*cfg)
+func runListZones(args []string) error {
+	fs := newFlagSet("list-zones")
+	cf := addConfigFlags(fs)
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	gen, _, err := cf.generator()
 	if err != nil {
 		return err
 	}
@@ -254,3 +714,401 @@ func runListZones() error {
 	}
 	return nil
 }
+
+func runImportToken(args []string) error {
+	fs := newFlagSet("import-token")
+	cf := addConfigFlags(fs)
+	name := fs.String("name", "", "preset name (defaults to the token's name)")
+	save := fs.Bool("save", false, "save the preset to the config")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator import-token <token-id> [--name NAME] [--save]")
+	}
+	tokenID := positional[0]
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+
+	preset, warnings, err := gen.ImportToken(context.Background(), tokenID)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if err != nil {
+		return err
+	}
+
+	presetName := *name
+	if presetName == "" {
+		presetName = tokenID
+	}
+
+	out, err := yaml.Marshal(map[string]*cftoken.Preset{presetName: preset})
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+
+	if *save {
+		userCfg, err := cftoken.LoadUserConfig()
+		if err != nil {
+			return err
+		}
+		if userCfg.Presets == nil {
+			userCfg.Presets = make(map[string]cftoken.Preset)
+		}
+		userCfg.Presets[presetName] = *preset
+		if err := cftoken.SaveConfig(userCfg); err != nil {
+			return fmt.Errorf("saving config: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Saved preset %q\n", presetName)
+	}
+	return nil
+}
+
+func runSuggest(args []string) error {
+	fs := newFlagSet("suggest")
+	cf := addConfigFlags(fs)
+	email := fs.String("for-user", "", "email of the account member to mirror")
+	name := fs.String("name", "", "preset name prefix (defaults to the email's local part)")
+	save := fs.Bool("save", false, "save the suggested presets to the config")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return usageError("usage: cloudflaretokengenerator suggest --for-user <email> [--name NAME] [--save]")
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+
+	suggested, warnings, err := gen.SuggestForMember(context.Background(), *email)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if err != nil {
+		return err
+	}
+
+	prefix := *name
+	if prefix == "" {
+		prefix, _, _ = strings.Cut(*email, "@")
+	}
+	presets := make(map[string]cftoken.Preset)
+	for _, p := range suggested {
+		presetName := prefix
+		if len(suggested) > 1 {
+			presetName = prefix + "-" + p.Level
+		}
+		presets[presetName] = p
+	}
+
+	out, err := yaml.Marshal(presets)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+
+	if *save {
+		userCfg, err := cftoken.LoadUserConfig()
+		if err != nil {
+			return err
+		}
+		if userCfg.Presets == nil {
+			userCfg.Presets = make(map[string]cftoken.Preset)
+		}
+		for presetName, p := range presets {
+			userCfg.Presets[presetName] = p
+			fmt.Fprintf(os.Stderr, "✓ Saved preset %q\n", presetName)
+		}
+		if err := cftoken.SaveConfig(userCfg); err != nil {
+			return fmt.Errorf("saving config: %w", err)
+		}
+	}
+	return nil
+}
+
+func runConfig(args []string) error {
+	if len(args) < 1 {
+		return usageError("usage: cloudflaretokengenerator config <chmod|export|import>")
+	}
+	switch args[0] {
+	case "chmod":
+		if err := cftoken.FixConfigPermissions(); err != nil {
+			return err
+		}
+		path, _ := cftoken.ConfigPath()
+		fmt.Printf("✓ Restricted %s to the current user\n", path)
+		return nil
+	case "export":
+		return runConfigExport(args[1:])
+	case "import":
+		return runConfigImport(args[1:])
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// runConfigExport writes the effective config, by default to stdout.
+func runConfigExport(args []string) error {
+	fs := newFlagSet("config export")
+	noSecrets := fs.Bool("no-secrets", false, "leave out tokens, API keys, and webhook URLs")
+	format := fs.String("format", "yaml", "output format: yaml or json")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	cfg, err := cftoken.LoadConfig()
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	if *noSecrets {
+		*cfg = cfg.WithoutSecrets()
+	} else {
+		fmt.Fprintln(os.Stderr, "Warning: the export includes credentials; use --no-secrets for a config to share")
+	}
+	data, err := cftoken.ExportConfig(*cfg, *format)
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	if *output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ Exported config to %s\n", *output)
+	return nil
+}
+
+// runConfigImport merges a shared config into the user config. Credentials
+// in the file are never imported.
+func runConfigImport(args []string) error {
+	fs := newFlagSet("config import")
+	overwrite := fs.Bool("overwrite", false, "replace local presets, groups, and settings with the same name")
+	dryRun := fs.Bool("dry-run", false, "show what would change without saving")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator config import <file.yaml> [--overwrite] [--dry-run]")
+	}
+
+	shared, ignored, err := cftoken.ReadSharedConfig(positional[0])
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	for _, key := range ignored {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring %s from %s; credentials are never imported\n", key, positional[0])
+	}
+	cfg, err := cftoken.LoadUserConfig()
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	changed, kept := cfg.MergeShared(shared, *overwrite)
+	for _, key := range changed {
+		fmt.Printf("Import %s\n", key)
+	}
+	for _, key := range kept {
+		fmt.Printf("Keep local %s (use --overwrite to replace)\n", key)
+	}
+	if len(changed) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to import")
+		return nil
+	}
+	if *dryRun {
+		return nil
+	}
+	if err := cftoken.SaveConfig(cfg); err != nil {
+		return err
+	}
+	path, _ := cftoken.ConfigPath()
+	fmt.Fprintf(os.Stderr, "✓ Imported %d entries into %s\n", len(changed), path)
+	return nil
+}
+
+func runUseAccount(args []string) error {
+	fs := newFlagSet("use-account")
+	cf := addConfigFlags(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+
+	var accountID string
+	if len(positional) > 0 {
+		accountID = positional[0]
+	} else {
+		accounts, err := gen.DiscoverAccounts(context.Background())
+		if err != nil {
+			return fmt.Errorf("listing accounts: %w", err)
+		}
+		if len(accounts) == 0 {
+			return fmt.Errorf("no accounts found (token may lack Account Read permission), pass the account ID as an argument")
+		}
+		accountID = selectID(bufio.NewReader(os.Stdin), "Available accounts", "Select account (number) or enter Account ID",
+			accountChoices(accounts), cfg.AccountID)
+	}
+	if accountID == "" {
+		return fmt.Errorf("account ID is required")
+	}
+
+	userCfg, err := cftoken.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	if cf.tenant != "" {
+		t := tenantEntry(userCfg, cfg, cf.tenant)
+		t.AccountID = accountID
+		userCfg.Tenants[cf.tenant] = t
+	} else {
+		userCfg.AccountID = accountID
+	}
+	if err := cftoken.SaveConfig(userCfg); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+	fmt.Printf("✓ Default account set to %s\n", accountID)
+	return nil
+}
+
+func runUseZone(args []string) error {
+	fs := newFlagSet("use-zone")
+	cf := addConfigFlags(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+
+	var zoneID string
+	if len(positional) > 0 {
+		zoneID = positional[0]
+	} else {
+		zones, err := gen.DiscoverZones(context.Background())
+		if err != nil {
+			return fmt.Errorf("listing zones: %w", err)
+		}
+		if len(zones) == 0 {
+			return fmt.Errorf("no zones found (token may lack Zone Read permission), pass the zone ID as an argument")
+		}
+		zoneID = selectID(bufio.NewReader(os.Stdin), "Available zones", "Select default zone (number), enter Zone ID, or press Enter to clear",
+			zoneChoices(zones), cfg.ZoneID)
+	}
+
+	userCfg, err := cftoken.LoadUserConfig()
+	if err != nil {
+		return err
+	}
+	if cf.tenant != "" {
+		t := tenantEntry(userCfg, cfg, cf.tenant)
+		t.ZoneID = zoneID
+		userCfg.Tenants[cf.tenant] = t
+	} else {
+		userCfg.ZoneID = zoneID
+	}
+	if err := cftoken.SaveConfig(userCfg); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+	if zoneID == "" {
+		fmt.Println("✓ Default zone cleared")
+	} else {
+		fmt.Printf("✓ Default zone set to %s\n", zoneID)
+	}
+	return nil
+}
+
+// tenantEntry returns the user config's entry for the tenant, falling back to
+// the merged config's entry when the tenant is only defined system-wide, and
+// makes sure userCfg.Tenants is initialized.
+func tenantEntry(userCfg, merged *cftoken.Config, name string) cftoken.Tenant {
+	if userCfg.Tenants == nil {
+		userCfg.Tenants = make(map[string]cftoken.Tenant)
+	}
+	if t, ok := userCfg.Tenants[name]; ok {
+		return t
+	}
+	return merged.Tenants[name]
+}
+
+func runVerifyReceipt(args []string) error {
+	fs := newFlagSet("verify-receipt")
+	pubPath := fs.String("public-key", "", "PEM public key to verify against (defaults to the local receipt key)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator verify-receipt <file> [--public-key pem]")
+	}
+
+	var pub ed25519.PublicKey
+	if *pubPath != "" {
+		data, err := os.ReadFile(*pubPath)
+		if err != nil {
+			return err
+		}
+		if pub, err = cftoken.ParsePublicKey(data); err != nil {
+			return fmt.Errorf("%s: %w", *pubPath, err)
+		}
+	} else {
+		key, err := cftoken.ReadReceiptKey()
+		if errors.Is(err, cftoken.ErrNoReceiptKey) {
+			return fmt.Errorf("%w; pass the signer's --public-key", err)
+		}
+		if err != nil {
+			return err
+		}
+		pub = key.Public().(ed25519.PublicKey)
+	}
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+	r, err := cftoken.VerifyReceipt(data, pub)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("✓ Receipt signature valid")
+	fmt.Printf("  Token:     %s (%s)\n", r.TokenName, r.TokenID)
+	fmt.Printf("  Requester: %s\n", r.Requester)
+	fmt.Printf("  Issued:    %s\n", r.Timestamp.Format(time.RFC3339))
+	if len(r.Services) > 0 {
+		fmt.Printf("  Services:  %s (scope %s, level %s)\n", strings.Join(r.Services, ","), r.Scope, r.Level)
+	}
+	if r.ExpiresOn != nil {
+		fmt.Printf("  Expires:   %s\n", r.ExpiresOn.Format(time.RFC3339))
+	}
+	fmt.Printf("  Policies:  %d\n", len(r.Policies))
+	return nil
+}
+
+func runReceiptKey() error {
+	key, err := cftoken.LoadReceiptKey()
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return err
+	}
+	return pem.Encode(os.Stdout, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/operator"
+	"github.com/jackmunro/cloudflare-token-generator/requestpolicy"
+)
+
+// runOperator reconciles CloudflareToken resources in the cluster the pod
+// runs in until SIGINT or SIGTERM. The parent credential comes from the
+// config file, usually a Secret mounted at the system config path.
+func runOperator(args []string) error {
+	fs := newFlagSet("operator")
+	cf := addConfigFlags(fs)
+	namespace := fs.String("namespace", "", "only reconcile resources in this namespace (default all)")
+	interval := fs.Duration("interval", time.Minute, "how often to reconcile every resource")
+	policyFile := fs.String("policy-file", "", "YAML file of CEL rules every resource's request must satisfy, with the requester system:serviceaccount:<namespace>:<name>")
+	unrestricted := fs.Bool("unrestricted", false, "run without --policy-file, letting anyone who can create a CloudflareToken mint whatever the parent token can grant")
+	drain := addDrainFlag(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return usageError("usage: cloudflaretokengenerator operator --policy-file F | --unrestricted [--namespace NS] [--interval D]")
+	}
+	if *interval <= 0 {
+		return usageError("invalid --interval %s", *interval)
+	}
+	if *policyFile == "" && !*unrestricted {
+		return usageError("operator needs --policy-file: without one, anyone who can create a CloudflareToken in any namespace gets whatever the parent token can grant (pass --unrestricted to accept that)")
+	}
+	var policy cftoken.RequestPolicy
+	if *policyFile != "" {
+		if policy, err = requestpolicy.Load(*policyFile); err != nil {
+			return err
+		}
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	kube, err := operator.InCluster()
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	c := &operator.Controller{Gen: gen, Kube: kube, Namespace: *namespace, Policy: policy, Logf: logger.Printf}
+
+	ctx, stop := interruptContext(*drain)
+	defer stop()
+	fmt.Fprintf(os.Stderr, "✓ Reconciling %s every %s\n", operator.Plural, *interval)
+	return c.Run(ctx, *interval)
+}
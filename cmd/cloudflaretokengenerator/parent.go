@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// parentCheckInterval is how long a parent expiry lookup is reused before
+// the token is verified again.
+const parentCheckInterval = 12 * time.Hour
+
+// parentCheck is the cached result of the last parent expiry lookup, keyed
+// by a hash of the token so a rolled or replaced token is checked afresh.
+type parentCheck struct {
+	Key       string     `json:"key"`
+	ID        string     `json:"id"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+	CheckedAt time.Time  `json:"checked_at"`
+}
+
+// parentExpiryWarning returns the configured warning window, or 0 if the
+// check is disabled.
+func parentExpiryWarning(cfg *cftoken.Config) (time.Duration, error) {
+	switch cfg.ParentExpiryWarning {
+	case "":
+		return cftoken.DefaultParentExpiryWarning, nil
+	case "0":
+		return 0, nil
+	}
+	d, err := cftoken.ParseTTL(cfg.ParentExpiryWarning)
+	if err != nil {
+		return 0, fmt.Errorf("parent_expiry_warning: %w", err)
+	}
+	return d, nil
+}
+
+// warnParentExpiry prints a warning when the parent token expires within
+// the configured window. The lookup is cached in the state directory, and
+// any failure is ignored: the command itself will report a broken token.
+func warnParentExpiry(gen *cftoken.Generator, cfg *cftoken.Config) {
+	window, err := parentExpiryWarning(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return
+	}
+	if window == 0 || cfg.UsesAPIKey() || cfg.APIToken == "" {
+		return
+	}
+	sum := sha256.Sum256([]byte(cfg.APIToken))
+	key := hex.EncodeToString(sum[:8])
+	dir, err := cftoken.StateDir()
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dir, "parent-check.json")
+
+	var check parentCheck
+	if data, err := os.ReadFile(path); err != nil || json.Unmarshal(data, &check) != nil ||
+		check.Key != key || time.Since(check.CheckedAt) > parentCheckInterval {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		// A failed lookup is cached too, so an unreachable API doesn't slow
+		// down every command.
+		check = parentCheck{Key: key, CheckedAt: time.Now().UTC()}
+		if info, err := gen.ParentInfo(ctx); err == nil {
+			check.ID, check.ExpiresOn = info.ID, info.ExpiresOn
+		}
+		if data, err := json.MarshalIndent(check, "", "  "); err == nil && os.MkdirAll(dir, 0700) == nil {
+			os.WriteFile(path, append(data, '\n'), 0600)
+		}
+	}
+	info := cftoken.ParentInfo{ID: check.ID, ExpiresOn: check.ExpiresOn}
+	if info.ExpiresWithin(window) {
+		fmt.Fprintf(os.Stderr, "Warning: the parent token %s %s; run roll-parent or replace api_token\n", check.ID, expiresPhrase(check.ExpiresOn))
+	}
+}
+
+// expiresPhrase describes an expiry relative to now, e.g. "expires in 3 days".
+func expiresPhrase(expires *time.Time) string {
+	if expires == nil {
+		return "never expires"
+	}
+	left := time.Until(*expires)
+	switch {
+	case left <= 0:
+		return "expired on " + expires.Format(time.RFC3339)
+	case left < 48*time.Hour:
+		return fmt.Sprintf("expires in %s", left.Round(time.Minute))
+	}
+	return fmt.Sprintf("expires in %d days (%s)", int(left.Hours()/24), expires.Format("2006-01-02"))
+}
+
+// runWhoami describes the parent credential the other commands would use.
+func runWhoami(args []string) error {
+	fs := newFlagSet("whoami")
+	cf := addConfigFlags(fs)
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+
+	source := "--api-token-env " + cf.apiTokenEnv
+	if cf.apiTokenEnv == "" {
+		source, _ = cftoken.ConfigPath()
+		if cf.tenant != "" {
+			source += " (tenant " + cf.tenant + ")"
+		}
+	}
+	account := cfg.AccountID
+	if account == "" {
+		account = "not set"
+	}
+	fmt.Printf("Credentials:  %s\n", source)
+	fmt.Printf("Account:      %s\n", account)
+	if cfg.UsesAPIKey() {
+		fmt.Printf("Parent:       Global API Key for %s\n", cfg.Email)
+		return nil
+	}
+
+	info, err := gen.ParentInfo(context.Background())
+	if err != nil {
+		return err
+	}
+	name := info.Name
+	if name == "" {
+		name = "(name not readable)"
+	}
+	fmt.Printf("Parent token: %s (%s)\n", name, info.ID)
+	fmt.Printf("Status:       %s\n", info.Status)
+	if info.NotBefore != nil {
+		fmt.Printf("Not before:   %s\n", info.NotBefore.Format(time.RFC3339))
+	}
+	fmt.Printf("Expiry:       %s\n", expiresPhrase(info.ExpiresOn))
+	for _, p := range cfg.Parents {
+		fmt.Printf("Also:         %s (%s)\n", p.Name, parentTags(p))
+	}
+	return nil
+}
+
+// parentTags summarizes what a configured parent token can grant.
+func parentTags(p cftoken.ParentToken) string {
+	list := func(what string, items []string) string {
+		if len(items) == 0 {
+			return "any " + what
+		}
+		return what + " " + strings.Join(items, ", ")
+	}
+	return list("services", p.Services) + "; " + list("zones", p.Zones) + "; " + list("accounts", p.Accounts)
+}
+
+// runRollParent rolls the parent token's secret and writes the new one to
+// the user config in its place. Rolling keeps the token's expiry; extend it
+// in the dashboard if that's what's running out.
+func runRollParent(args []string) error {
+	fs := newFlagSet("roll-parent")
+	cf := addConfigFlags(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return usageError("usage: cloudflaretokengenerator roll-parent [--tenant T]")
+	}
+	if cf.apiTokenEnv != "" {
+		return usageError("roll-parent rewrites the config file and cannot be combined with --api-token-env")
+	}
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	if cfg.UsesAPIKey() {
+		return withExitCode(exitConfig, fmt.Errorf("the parent credential is a Global API Key and can't be rolled"))
+	}
+
+	// Only roll a token this command can write back, or its secret is lost.
+	userCfg, err := cftoken.LoadUserConfig()
+	if err != nil {
+		return withExitCode(exitConfig, err)
+	}
+	path, _ := cftoken.ConfigPath()
+	tenant, inTenant := userCfg.Tenants[cf.tenant]
+	inTenant = inTenant && cf.tenant != "" && tenant.APIToken == cfg.APIToken
+	if !inTenant && userCfg.APIToken != cfg.APIToken {
+		return withExitCode(exitConfig, fmt.Errorf("the parent token isn't set in %s; roll it where it is configured", path))
+	}
+
+	value, err := gen.RollParent(context.Background())
+	if err != nil {
+		return err
+	}
+	if inTenant {
+		tenant.APIToken = value
+		userCfg.Tenants[cf.tenant] = tenant
+	} else {
+		userCfg.APIToken = value
+	}
+	if err := cftoken.SaveConfig(userCfg); err != nil {
+		// The old secret no longer works, so this is the only copy.
+		fmt.Println(value)
+		return fmt.Errorf("the parent token was rolled but saving %s failed: %w; the new secret is above, save it as api_token", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Rolled the parent token and saved the new secret to %s\n", path)
+	return nil
+}
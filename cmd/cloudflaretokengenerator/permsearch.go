@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// runSearchPermissions prints the live permission groups matching a keyword,
+// with the IDs and scopes needed for --perm-id or a custom service.
+func runSearchPermissions(args []string) error {
+	fs := newFlagSet("search-permissions")
+	cf := addConfigFlags(fs)
+	output := fs.String("output", "table", "output format: table or json")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return usageError("usage: cloudflaretokengenerator search-permissions <keyword>... [--output table|json]")
+	}
+	if *output != "table" && *output != "json" {
+		return usageError("invalid --output %q, must be table or json", *output)
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	query := strings.Join(positional, " ")
+	matches, err := gen.SearchPermissionGroups(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(matches)
+	}
+	if len(matches) == 0 {
+		fmt.Printf("No permission groups match %q\n", query)
+		return nil
+	}
+	fmt.Printf("%-45s %-34s %-9s %s\n", "NAME", "ID", "SCOPE", "SERVICES")
+	fmt.Printf("%-45s %-34s %-9s %s\n", "----", "--", "-----", "--------")
+	for _, m := range matches {
+		services := strings.Join(m.Services, ",")
+		if services == "" {
+			services = "-"
+		}
+		fmt.Printf("%-45s %-34s %-9s %s\n", m.Name, m.ID, m.Scope, services)
+	}
+	fmt.Fprintf(os.Stderr, "\nGrant a group with: generate --perm-id <id> --scope zone:<id>|account\n")
+	return nil
+}
+
+// runLookup names the permission group with an ID (or name) and the catalog
+// service it controls. Groups missing from the catalog are looked up in the
+// live list, which needs a config.
+func runLookup(args []string) error {
+	fs := newFlagSet("lookup")
+	cf := addConfigFlags(fs)
+	output := fs.String("output", "text", "output format: text or json")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return usageError("usage: cloudflaretokengenerator lookup <permission-id-or-name> [--output text|json]")
+	}
+	if *output != "text" && *output != "json" {
+		return usageError("invalid --output %q, must be text or json", *output)
+	}
+
+	query := strings.TrimSpace(positional[0])
+	type result struct {
+		ID          string   `json:"id"`
+		Name        string   `json:"name"`
+		Access      string   `json:"access"`
+		Scope       string   `json:"scope"`
+		Service     string   `json:"service,omitempty"`
+		Description string   `json:"description,omitempty"`
+		Plan        string   `json:"plan,omitempty"`
+		Deprecated  bool     `json:"deprecated,omitempty"`
+		ReplacedBy  string   `json:"replaced_by,omitempty"`
+		Services    []string `json:"services"`
+	}
+	var r result
+	if svc, p, ok := cftoken.LookupPermission(query); ok {
+		r = result{
+			ID:          p.ID,
+			Name:        p.Name,
+			Scope:       string(svc.ResourceScope),
+			Service:     svc.Name,
+			Description: svc.Description,
+			Plan:        svc.Plan,
+			Deprecated:  svc.Deprecated,
+			ReplacedBy:  svc.ReplacedBy,
+			Services:    cftoken.ServicesGranting(p.ID),
+		}
+	} else {
+		gen, _, err := cf.generator()
+		if err != nil {
+			return fmt.Errorf("%s is not in the catalog, and the live permission groups can't be listed: %w", query, err)
+		}
+		matches, err := gen.SearchPermissionGroups(context.Background(), query)
+		if err != nil {
+			return err
+		}
+		var found *cftoken.PermissionGroupMatch
+		for i, m := range matches {
+			if strings.EqualFold(m.ID, query) || strings.EqualFold(m.Name, query) {
+				found = &matches[i]
+				break
+			}
+		}
+		if found == nil {
+			return fmt.Errorf("no permission group has the ID or name %q; try search-permissions", query)
+		}
+		r = result{ID: found.ID, Name: found.Name, Scope: found.Scope, Services: []string{}}
+	}
+	r.Access = "write"
+	if policy.IsRead(policy.Permission{ID: r.ID, Name: r.Name}) {
+		r.Access = "read"
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	fmt.Printf("Permission:   %s\n", r.Name)
+	fmt.Printf("ID:           %s\n", r.ID)
+	fmt.Printf("Access:       %s\n", r.Access)
+	fmt.Printf("Scope:        %s\n", r.Scope)
+	if r.Service == "" {
+		fmt.Println("Service:      none in the catalog")
+		return nil
+	}
+	fmt.Printf("Service:      %s (%s)\n", r.Service, r.Description)
+	plan := r.Plan
+	if plan == "" {
+		plan = "every plan"
+	}
+	fmt.Printf("Plan:         %s\n", plan)
+	if r.Deprecated {
+		if r.ReplacedBy != "" {
+			fmt.Printf("Deprecated:   yes, replaced by %s\n", r.ReplacedBy)
+		} else {
+			fmt.Println("Deprecated:   yes")
+		}
+	}
+	if len(r.Services) > 1 {
+		fmt.Printf("Granted by:   %s\n", strings.Join(r.Services, ", "))
+	}
+	return nil
+}
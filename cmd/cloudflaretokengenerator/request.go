@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// tokenRequest is the JSON document `generate -` reads from stdin, for
+// callers that would rather not assemble flags:
+//
+//	{"services": ["dns"], "scope": "all", "level": "read", "ttl": "1h"}
+//
+// Fields other than services and scope are optional and mirror the flags of
+// the same name. Flags given on the command line still apply.
+type tokenRequest struct {
+	Services []string `json:"services"`
+	Scope    string   `json:"scope"`
+	Level    string   `json:"level,omitempty"`
+	Preset   string   `json:"preset,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	TTL      string   `json:"ttl,omitempty"`
+	Team     string   `json:"team,omitempty"`
+	Purpose  string   `json:"purpose,omitempty"`
+	Accounts []string `json:"accounts,omitempty"`
+	Zones    []string `json:"zones,omitempty"`
+	AllowIP  []string `json:"allow_ip,omitempty"`
+	DenyIP   []string `json:"deny_ip,omitempty"`
+	IfExists string   `json:"if_exists,omitempty"`
+}
+
+// readTokenRequest decodes a single tokenRequest from r, rejecting unknown
+// fields so typos aren't silently ignored.
+func readTokenRequest(r io.Reader) (*tokenRequest, error) {
+	dec := json.NewDecoder(io.LimitReader(r, 1<<20))
+	dec.DisallowUnknownFields()
+	var req tokenRequest
+	if err := dec.Decode(&req); err != nil {
+		return nil, usageError("reading request from stdin: %v", err)
+	}
+	if req.Preset == "" && (len(req.Services) == 0 || req.Scope == "") {
+		return nil, usageError("request needs services and scope, or a preset")
+	}
+	return &req, nil
+}
+
+// apply copies the request's options onto the token flags, leaving flags
+// the request doesn't set alone.
+func (req *tokenRequest) apply(tf *tokenFlags) {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&tf.name, req.Name)
+	set(&tf.ttl, req.TTL)
+	set(&tf.team, req.Team)
+	set(&tf.purpose, req.Purpose)
+	set(&tf.ifExists, req.IfExists)
+	set(&tf.allowIP, strings.Join(req.AllowIP, ","))
+	set(&tf.denyIP, strings.Join(req.DenyIP, ","))
+	tf.json = true
+}
+
+// writeRequestError reports err as {"error": "...", "exit_code": N} on
+// stdout, so callers reading the response don't need to parse stderr.
+func writeRequestError(err error) {
+	data, _ := json.Marshal(struct {
+		Error    string `json:"error"`
+		ExitCode int    `json:"exit_code"`
+	}{err.Error(), exitCode(err)})
+	fmt.Fprintln(os.Stdout, string(data))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// choice is a selectable account or zone.
+type choice struct {
+	Name string
+	ID   string
+}
+
+func accountChoices(accounts []cftoken.Account) []choice {
+	var choices []choice
+	for _, a := range accounts {
+		choices = append(choices, choice{Name: a.Name, ID: a.ID})
+	}
+	return choices
+}
+
+func zoneChoices(zones []cftoken.Zone) []choice {
+	var choices []choice
+	for _, z := range zones {
+		choices = append(choices, choice{Name: z.Name, ID: z.ID})
+	}
+	return choices
+}
+
+// selectID prints the numbered choices under header, marking current with an
+// asterisk, and prompts for a selection. A number picks from the list; any
+// other input is returned as a literal ID so users can still enter IDs the
+// token can't discover.
+func selectID(r *bufio.Reader, header, prompt string, choices []choice, current string) string {
+	fmt.Printf("\n%s:\n", header)
+	for i, c := range choices {
+		marker := " "
+		if c.ID == current {
+			marker = "*"
+		}
+		fmt.Printf(" %s[%d] %s (%s)\n", marker, i+1, c.Name, c.ID)
+	}
+	fmt.Printf("\n%s: ", prompt)
+	input := readLine(r)
+	if n, err := strconv.Atoi(input); err == nil && n >= 1 && n <= len(choices) {
+		return choices[n-1].ID
+	}
+	return input
+}
+
+// selectMany prints the numbered items under header and prompts for a
+// selection such as "1,3,5-7" or "all". It returns the chosen indexes in list
+// order; empty input selects nothing.
+func selectMany(r *bufio.Reader, header string, items []string) ([]int, error) {
+	fmt.Printf("\n%s:\n", header)
+	for i, item := range items {
+		fmt.Printf("  [%d] %s\n", i+1, item)
+	}
+	fmt.Print("\nSelect (e.g. 1,3,5-7 or all; empty to cancel): ")
+	input := readLine(r)
+	if input == "" {
+		return nil, nil
+	}
+
+	chosen := make([]bool, len(items))
+	if input == "all" {
+		for i := range chosen {
+			chosen[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(input, ",") {
+			lo, hi, isRange := strings.Cut(strings.TrimSpace(part), "-")
+			if !isRange {
+				hi = lo
+			}
+			from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+			to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+			if err1 != nil || err2 != nil || from < 1 || to > len(items) || from > to {
+				return nil, fmt.Errorf("invalid selection %q", part)
+			}
+			for n := from; n <= to; n++ {
+				chosen[n-1] = true
+			}
+		}
+	}
+
+	var indexes []int
+	for i, ok := range chosen {
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func confirm(r *bufio.Reader, prompt string) bool {
+	fmt.Printf("%s [y/N]: ", prompt)
+	answer := strings.ToLower(readLine(r))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// Set at release build time with -ldflags "-X main.version=... -X
+// main.releasePublicKey=...". releasePublicKey is the base64 ed25519 key that
+// signs each release's checksums.txt.
+var (
+	version          = "dev"
+	releasePublicKey = ""
+)
+
+const releasesURL = "https://api.github.com/repos/jackm43/cloudflare-token-generator/releases"
+
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *release) assetURL(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+func runSelfUpdate(args []string) error {
+	fs := newFlagSet("self-update")
+	check := fs.Bool("check", false, "only report whether a newer release exists")
+	tag := fs.String("version", "", "install this release tag instead of the latest")
+	skipSig := fs.Bool("insecure-skip-signature", false, "accept a release verified by checksum only (builds without a release key)")
+	allowDowngrade := fs.Bool("allow-downgrade", false, "install the release even if it is older than the running version")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 2 * time.Minute}
+	url := releasesURL + "/latest"
+	if *tag != "" {
+		url = releasesURL + "/tags/" + *tag
+	}
+	var rel release
+	if err := getJSON(client, url, &rel); err != nil {
+		return fmt.Errorf("checking releases: %w", err)
+	}
+
+	current := buildVersion()
+	newer, err := compareVersions(rel.TagName, current)
+	if err != nil {
+		return err
+	}
+	if newer == 0 {
+		fmt.Fprintf(os.Stderr, "✓ Already running %s\n", current)
+		return nil
+	}
+	if *check {
+		if newer < 0 {
+			fmt.Printf("%s is older than the running %s\n", rel.TagName, current)
+			return nil
+		}
+		fmt.Printf("%s is available (running %s)\n", rel.TagName, current)
+		return nil
+	}
+	if newer < 0 && !*allowDowngrade {
+		return fmt.Errorf("release %s is older than the running %s; pass --allow-downgrade to install it anyway", rel.TagName, current)
+	}
+
+	asset := fmt.Sprintf("cloudflaretokengenerator_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		asset += ".exe"
+	}
+	binURL, ok := rel.assetURL(asset)
+	if !ok {
+		return fmt.Errorf("release %s has no build for %s/%s", rel.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	sumsURL, ok := rel.assetURL("checksums.txt")
+	if !ok {
+		return fmt.Errorf("release %s has no checksums.txt", rel.TagName)
+	}
+
+	sums, err := download(client, sumsURL)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksumsSignature(client, &rel, sums, *skipSig); err != nil {
+		return err
+	}
+	want, err := checksumFor(sums, asset)
+	if err != nil {
+		return err
+	}
+
+	bin, err := download(client, binURL)
+	if err != nil {
+		return err
+	}
+	got := sha256.Sum256(bin)
+	if hex.EncodeToString(got[:]) != want {
+		return fmt.Errorf("checksum mismatch for %s", asset)
+	}
+
+	if err := replaceExecutable(bin); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "✓ Updated %s -> %s\n", current, rel.TagName)
+	return nil
+}
+
+// compareVersions compares a release tag with the running version by
+// semantic version, returning -1, 0, or +1 as tag is older, the same, or
+// newer. A leading "v" is optional. Development builds have no version to
+// compare, so any release counts as newer.
+func compareVersions(tag, current string) (int, error) {
+	canonical := func(v string) string {
+		if !strings.HasPrefix(v, "v") {
+			v = "v" + v
+		}
+		return v
+	}
+	t := canonical(tag)
+	if !semver.IsValid(t) {
+		return 0, fmt.Errorf("release tag %q is not a semantic version", tag)
+	}
+	c := canonical(current)
+	if !semver.IsValid(c) {
+		return 1, nil
+	}
+	return semver.Compare(t, c), nil
+}
+
+// verifyChecksumsSignature checks checksums.txt.sig against the embedded
+// release key. Builds without a key refuse unless skip is set.
+func verifyChecksumsSignature(client *http.Client, rel *release, sums []byte, skip bool) error {
+	if releasePublicKey == "" {
+		if !skip {
+			return fmt.Errorf("this build has no release signing key; rerun with --insecure-skip-signature to trust the checksum alone")
+		}
+		fmt.Fprintln(os.Stderr, "Warning: release signature not verified, relying on checksums.txt only")
+		return nil
+	}
+	pub, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid embedded release key")
+	}
+	sigURL, ok := rel.assetURL("checksums.txt.sig")
+	if !ok {
+		return fmt.Errorf("release %s is not signed (no checksums.txt.sig)", rel.TagName)
+	}
+	sigData, err := download(client, sigURL)
+	if err != nil {
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigData)))
+	if err != nil {
+		return fmt.Errorf("decoding checksums.txt.sig: %w", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), sums, sig) {
+		return fmt.Errorf("release %s: checksums.txt signature is invalid", rel.TagName)
+	}
+	return nil
+}
+
+// checksumFor finds name in sha256sum-format checksums.
+func checksumFor(sums []byte, name string) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("checksums.txt has no entry for %s", name)
+}
+
+// replaceExecutable atomically swaps the running binary for bin.
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".cloudflaretokengenerator-update-*")
+	if err != nil {
+		return fmt.Errorf("writing update: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bin); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	// Windows can't replace a running executable, but it can rename it.
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+func getJSON(client *http.Client, url string, v interface{}) error {
+	data, err := download(client, url)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func download(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
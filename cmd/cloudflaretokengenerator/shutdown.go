@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// addDrainFlag adds --drain-timeout to a command that works through many
+// tokens.
+func addDrainFlag(fs *flag.FlagSet) *time.Duration {
+	return fs.Duration("drain-timeout", 30*time.Second, "on SIGINT or SIGTERM, how long in-flight tokens may take to finish")
+}
+
+// interruptContext returns a context cancelled by the first SIGINT or
+// SIGTERM. RunBatch and RevokeTokens then start no new work but finish what
+// is in flight, so created tokens are still delivered to their sinks and
+// recorded in the inventory. If that takes longer than drain, or a second
+// signal arrives, the process exits at once. Call stop when the work is done.
+func interruptContext(drain time.Duration) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Fprintf(os.Stderr, "\nReceived %s; finishing in-flight tokens (up to %s, signal again to exit now)\n", sig, drain)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case <-sigs:
+		case <-time.After(drain):
+			fmt.Fprintf(os.Stderr, "Drain timeout of %s reached\n", drain)
+		case <-done:
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Warning: exiting with tokens still in flight; they may be missing from the inventory")
+		os.Exit(exitFailure)
+	}()
+	return ctx, func() {
+		signal.Stop(sigs)
+		close(done)
+		cancel()
+	}
+}
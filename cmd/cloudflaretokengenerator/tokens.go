@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// filterFlags select existing tokens by their managed name tags, name, and
+// age.
+type filterFlags struct {
+	team          string
+	purpose       string
+	olderThan     string
+	match         string
+	createdBefore string
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	ff := &filterFlags{}
+	fs.StringVar(&ff.team, "team", "", "only tokens tagged with this team")
+	fs.StringVar(&ff.purpose, "purpose", "", "only tokens tagged with this purpose")
+	fs.StringVar(&ff.olderThan, "older-than", "", "only tokens issued at least this long ago, e.g. 90d")
+	fs.StringVar(&ff.match, "match", "", "only tokens whose name matches this glob, e.g. 'ci-*'")
+	fs.StringVar(&ff.createdBefore, "created-before", "", "only tokens issued before this time, e.g. 2024-01-01, -30d, or RFC 3339")
+	return ff
+}
+
+func (ff *filterFlags) filter(cf *configFlags) (cftoken.TokenFilter, error) {
+	f := cftoken.TokenFilter{Team: ff.team, Purpose: ff.purpose, Match: ff.match}
+	if ff.olderThan != "" {
+		d, err := cftoken.ParseTTL(ff.olderThan)
+		if err != nil {
+			return f, usageError("invalid --older-than: %w", err)
+		}
+		f.OlderThan = d
+	}
+	if ff.match != "" {
+		if _, err := path.Match(ff.match, ""); err != nil {
+			return f, usageError("invalid --match %q: %w", ff.match, err)
+		}
+	}
+	if ff.createdBefore != "" {
+		t, err := cf.parseTime("--created-before", ff.createdBefore)
+		if err != nil {
+			return f, err
+		}
+		f.CreatedBefore = t
+	}
+	return f, nil
+}
+
+// selects reports whether the flags select tokens on their own, without IDs.
+func (ff *filterFlags) selects() bool {
+	return ff.team != "" || ff.purpose != "" || ff.match != "" || ff.createdBefore != ""
+}
+
+func runListTokens(args []string) error {
+	fs := newFlagSet("list-tokens")
+	cf := addConfigFlags(fs)
+	ff := addFilterFlags(fs)
+	tagged := fs.Bool("tagged", false, "only tokens with managed cftg: names")
+	output := fs.String("output", "table", "output format: table or csv")
+	provenance := fs.Bool("provenance", false, "show where each token was created, from the local inventory")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	filter, err := ff.filter(cf)
+	if err != nil {
+		return err
+	}
+	filter.TaggedOnly = *tagged
+	filter.LastUsed = true
+	if *output != "table" && *output != "csv" {
+		return fmt.Errorf("invalid --output %q, must be table or csv", *output)
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	tokens, err := gen.ListTokens(context.Background(), filter)
+	if err != nil {
+		return err
+	}
+	var origins map[string]*cftoken.Provenance
+	if *provenance {
+		if origins, err = inventoryProvenance(); err != nil {
+			return err
+		}
+	}
+	if *output == "csv" {
+		return writeTokensCSV(tokens, origins)
+	}
+	if len(tokens) == 0 {
+		fmt.Println("No matching tokens")
+		return nil
+	}
+
+	printTokenTable(tokens)
+	if *provenance {
+		fmt.Println()
+		fmt.Println("Provenance (from the local inventory):")
+		for _, t := range tokens {
+			origin := "unknown"
+			if p := origins[t.ID]; p != nil {
+				origin = p.String()
+			}
+			fmt.Printf("  %-34s %s\n", t.ID, origin)
+		}
+	}
+	return nil
+}
+
+// inventoryProvenance maps token IDs to the provenance recorded in the
+// inventory.
+func inventoryProvenance() (map[string]*cftoken.Provenance, error) {
+	inv, err := cftoken.LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+	origins := make(map[string]*cftoken.Provenance)
+	for _, e := range inv.Tokens {
+		if e.Provenance != nil {
+			origins[e.ID] = e.Provenance
+		}
+	}
+	return origins, nil
+}
+
+func printTokenTable(tokens []cftoken.TokenInfo) {
+	fmt.Printf("%-34s %-12s %-12s %-8s %-12s %-12s %-12s %s\n", "TOKEN ID", "TEAM", "PURPOSE", "STATUS", "ISSUED", "LAST USED", "EXPIRES", "NAME")
+	fmt.Printf("%-34s %-12s %-12s %-8s %-12s %-12s %-12s %s\n", "--------", "----", "-------", "------", "------", "---------", "-------", "----")
+	for _, t := range tokens {
+		fmt.Printf("%-34s %-12s %-12s %-8s %-12s %-12s %-12s %s\n",
+			t.ID, t.Tags.Team, t.Tags.Purpose, t.Status, formatDate(t.IssuedOn), formatDate(t.LastUsedOn), formatDate(t.ExpiresOn), t.Name)
+	}
+}
+
+func runStale(args []string) error {
+	fs := newFlagSet("stale")
+	cf := addConfigFlags(fs)
+	unused := fs.String("unused-for", "90d", "report tokens not used for this long")
+	tagged := fs.Bool("tagged", false, "only tokens with managed cftg: names")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	d, err := cftoken.ParseTTL(*unused)
+	if err != nil {
+		return fmt.Errorf("invalid --unused-for: %w", err)
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	tokens, err := gen.ListTokens(context.Background(), cftoken.TokenFilter{UnusedFor: d, TaggedOnly: *tagged})
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		fmt.Printf("No tokens unused for %s\n", *unused)
+		return nil
+	}
+	printTokenTable(tokens)
+	fmt.Fprintf(os.Stderr, "\n%d tokens unused for %s. Revoke them with revoke <token-id>..., or run gc --unused-for %s for tokens made by this tool.\n", len(tokens), *unused, *unused)
+	return nil
+}
+
+func runRevoke(args []string) error {
+	fs := newFlagSet("revoke")
+	cf := addConfigFlags(fs)
+	ff := addFilterFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "list the tokens that would be revoked without revoking them")
+	interactive := fs.Bool("interactive", false, "pick tokens to revoke from a list, then confirm")
+	concurrency := fs.Int("concurrency", 4, "number of tokens to revoke in parallel")
+	drain := addDrainFlag(fs)
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	filter, err := ff.filter(cf)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 && !ff.selects() && !*interactive {
+		return usageError("usage: cloudflaretokengenerator revoke <token-id>... | --team T | --purpose P | --match GLOB | --created-before DATE | --interactive [--older-than D] [--dry-run]")
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	type target struct{ id, name string }
+	var targets []target
+	for _, id := range ids {
+		targets = append(targets, target{id: id, name: id})
+	}
+	if *interactive {
+		filter.LastUsed = true
+		tokens, err := gen.ListTokens(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if len(tokens) == 0 {
+			fmt.Println("No matching tokens")
+			return nil
+		}
+		items := make([]string, len(tokens))
+		for i, t := range tokens {
+			items[i] = fmt.Sprintf("%-40s created %s  last used %s  expires %s", t.Name,
+				formatDate(t.IssuedOn), formatDate(t.LastUsedOn), formatDate(t.ExpiresOn))
+		}
+		reader := bufio.NewReader(os.Stdin)
+		chosen, err := selectMany(reader, "Tokens", items)
+		if err != nil {
+			return err
+		}
+		for _, i := range chosen {
+			targets = append(targets, target{id: tokens[i].ID, name: tokens[i].Name})
+		}
+		if len(targets) == 0 {
+			fmt.Println("Nothing selected")
+			return nil
+		}
+		if !*dryRun && !confirm(reader, fmt.Sprintf("Revoke %d tokens?", len(targets))) {
+			fmt.Println("Cancelled")
+			return nil
+		}
+	} else if ff.selects() {
+		tokens, err := gen.ListTokens(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, t := range tokens {
+			targets = append(targets, target{id: t.ID, name: t.Name})
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("No matching tokens")
+		return nil
+	}
+
+	if *dryRun {
+		for _, t := range targets {
+			fmt.Printf("Would revoke %s (%s)\n", t.name, t.id)
+		}
+		fmt.Fprintf(os.Stderr, "\n%d tokens would be revoked\n", len(targets))
+		return nil
+	}
+
+	names := make(map[string]string, len(targets))
+	targetIDs := make([]string, len(targets))
+	for i, t := range targets {
+		names[t.id] = t.name
+		targetIDs[i] = t.id
+	}
+	runCtx, stop := interruptContext(*drain)
+	defer stop()
+	results := gen.RevokeTokens(runCtx, targetIDs, cftoken.RevokeOptions{
+		Concurrency: *concurrency,
+		Progress: func(done, total int, r cftoken.RevokeResult) {
+			if r.Err != nil {
+				fmt.Fprintf(os.Stderr, "[%d/%d] ✗ %v\n", done, total, r.Err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "[%d/%d] ✓ Revoked %s (%s)\n", done, total, names[r.ID], r.ID)
+		},
+	})
+
+	failed := 0
+	var firstErr error
+	for _, r := range results {
+		if r.Err != nil {
+			if failed == 0 {
+				firstErr = r.Err
+			}
+			failed++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "\nRevoked: %d  Failed: %d\n", len(results)-failed, failed)
+	if runCtx.Err() != nil {
+		return fmt.Errorf("interrupted: %d of %d tokens were not revoked", failed, len(results))
+	}
+	if failed == 0 {
+		return nil
+	}
+	err = fmt.Errorf("%d of %d tokens could not be revoked", failed, len(results))
+	if failed < len(results) {
+		return withExitCode(exitPartial, err)
+	}
+	return withExitCode(exitCode(firstErr), err)
+}
+
+// writeTokensCSV writes one row per token to stdout.
+// writeTokensCSV writes tokens as CSV. With origins, provenance columns are
+// added.
+func writeTokensCSV(tokens []cftoken.TokenInfo, origins map[string]*cftoken.Provenance) error {
+	w := csv.NewWriter(os.Stdout)
+	header := []string{"id", "name", "team", "purpose", "status", "issued_on", "last_used_on", "expires_on"}
+	if origins != nil {
+		header = append(header, "commit", "host", "job_url", "manifest")
+	}
+	w.Write(header)
+	for _, t := range tokens {
+		row := []string{t.ID, t.Name, t.Tags.Team, t.Tags.Purpose, t.Status, formatTime(t.IssuedOn), formatTime(t.LastUsedOn), formatTime(t.ExpiresOn)}
+		if origins != nil {
+			var p cftoken.Provenance
+			if origins[t.ID] != nil {
+				p = *origins[t.ID]
+			}
+			row = append(row, p.Commit, p.Host, p.JobURL, p.Manifest)
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// formatTime prints a timestamp as RFC 3339, or "" if it isn't set.
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// formatDate prints a timestamp as a date, or "-" if it isn't set.
+func formatDate(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
+
+func runExpire(args []string) error {
+	fs := newFlagSet("expire")
+	cf := addConfigFlags(fs)
+	at := fs.String("at", "", "expire at this time, e.g. 2025-12-31 (midnight), next-friday-5pm, or RFC 3339")
+	in := fs.String("in", "", "expire this long from now, e.g. 7d, 12h, or 6mo")
+	ids, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) != 1 || (*at == "") == (*in == "") {
+		return usageError("usage: cloudflaretokengenerator expire <token-id> --at DATE | --in DURATION")
+	}
+
+	var expires time.Time
+	if *in != "" {
+		d, err := cftoken.ParseTTL(*in)
+		if err != nil {
+			return usageError("invalid --in: %w", err)
+		}
+		expires = time.Now().Add(d)
+	} else if expires, err = cf.parseTime("--at", *at); err != nil {
+		return err
+	}
+
+	gen, cfg, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	token, err := gen.SetExpiry(context.Background(), ids[0], expires)
+	if token == nil {
+		return err
+	}
+	if ierr := cftoken.UpdateInventory(func(inv *cftoken.Inventory) error {
+		inv.SetExpiry(token.ID, *token.ExpiresOn)
+		return nil
+	}); ierr != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not update inventory: %v\n", ierr)
+	}
+	loc, _ := cfg.Location()
+	fmt.Fprintf(os.Stderr, "✓ %s (%s) now expires %s\n", token.Name, token.ID, token.ExpiresOn.In(loc).Format(time.RFC3339))
+	return err
+}
+
+func runGC(args []string) error {
+	fs := newFlagSet("gc")
+	cf := addConfigFlags(fs)
+	dryRun := fs.Bool("dry-run", false, "list the tokens that would be revoked without revoking them")
+	olderThan := fs.String("older-than", "", "only tokens issued at least this long ago, e.g. 30d")
+	expiredFor := fs.String("expired-for", "", "only collect expired tokens once expired this long, e.g. 7d")
+	unusedFor := fs.String("unused-for", "", "also collect tokens not used for this long, e.g. 90d")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	opts := cftoken.GCOptions{}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"--older-than", *olderThan, &opts.OlderThan},
+		{"--expired-for", *expiredFor, &opts.ExpiredFor},
+		{"--unused-for", *unusedFor, &opts.UnusedFor},
+	} {
+		if f.value == "" {
+			continue
+		}
+		d, err := cftoken.ParseTTL(f.value)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", f.name, err)
+		}
+		*f.dst = d
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	inv, err := cftoken.LoadInventory()
+	if err != nil {
+		return fmt.Errorf("loading inventory: %w", err)
+	}
+	opts.Inventory = inv
+
+	ctx := context.Background()
+	garbage, err := gen.FindGarbage(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(garbage) == 0 {
+		fmt.Println("Nothing to collect")
+		return nil
+	}
+
+	failed := 0
+	var removed []string
+	for _, g := range garbage {
+		switch {
+		case *dryRun:
+			fmt.Printf("Would revoke %s (%s): %s\n", g.Name, g.ID, g.Reason)
+			continue
+		case g.Gone:
+			fmt.Fprintf(os.Stderr, "✓ Forgot %s (%s): %s\n", g.Name, g.ID, g.Reason)
+		default:
+			if err := gen.RevokeToken(ctx, g.ID); err != nil {
+				failed++
+				fmt.Fprintf(os.Stderr, "✗ %v\n", err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "✓ Revoked %s (%s): %s\n", g.Name, g.ID, g.Reason)
+		}
+		removed = append(removed, g.ID)
+	}
+	if len(removed) > 0 {
+		// Reload rather than save inv, which may be stale by now.
+		if err := cftoken.UpdateInventory(func(inv *cftoken.Inventory) error {
+			inv.Remove(removed...)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("saving inventory: %w", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tokens could not be revoked", failed, len(garbage))
+	}
+	return nil
+}
+
+// recordTokens adds newly created tokens, with their sinks, to the local
+// inventory and drops the tokens they replaced. Failures only warn, since the
+// tokens themselves were created.
+func recordTokens(tokens []*cftoken.Token, sinks []string) {
+	err := cftoken.UpdateInventory(func(inv *cftoken.Inventory) error {
+		for i, t := range tokens {
+			inv.Remove(t.Replaces...)
+			inv.Add(t, sinks[i])
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not update inventory: %v\n", err)
+	}
+}
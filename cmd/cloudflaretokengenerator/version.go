@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// buildVersion returns the release version, falling back to the module
+// version recorded by `go install` for non-release builds.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+func runVersion() error {
+	permissions := 0
+	for _, svc := range cftoken.Services {
+		permissions += len(svc.Permissions)
+	}
+	fmt.Printf("cloudflaretokengenerator %s\n", buildVersion())
+	fmt.Printf("catalog %s (%d services, %d permission groups)\n", cftoken.CatalogVersion(), len(cftoken.Services), permissions)
+	fmt.Printf("%s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
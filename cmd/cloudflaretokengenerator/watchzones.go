@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// runWatchZones lists the account's zones on an interval and, for each zone
+// not in the state file, creates the template's per-zone tokens and posts a
+// summary to the webhook. A zone is only recorded once all its tokens exist,
+// so failures are retried on the next pass.
+func runWatchZones(args []string) error {
+	fs := newFlagSet("watch-zones")
+	cf := addConfigFlags(fs)
+	templateFile := fs.String("template", "", "token template; its per_zone entries are created for each new zone (default: dns and cache purge)")
+	env := fs.String("env", "", "value of {{.Env}} in the template")
+	var zoneEntries stringList
+	fs.Var(&zoneEntries, "zones", "only watch zones matching this ID, name, or pattern (repeatable; default from the template, else all)")
+	statePath := fs.String("state", "", "file recording the zones already onboarded (default next to the config)")
+	webhook := fs.String("webhook", "", "URL to POST a JSON summary to for each new zone")
+	sink := fs.String("sink", "", "sink for entries without one, e.g. 'file:/run/secrets/{{.Name}}'")
+	ttl := fs.String("ttl", "", "lifetime of entries without a ttl")
+	interval := fs.Duration("interval", 5*time.Minute, "how often to list zones")
+	once := fs.Bool("once", false, "check once and exit, e.g. from cron")
+	backfill := fs.Bool("backfill", false, "on the first run, onboard existing zones instead of only recording them")
+	drain := addDrainFlag(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return usageError("usage: cloudflaretokengenerator watch-zones [--template file.yaml] [--webhook URL] [--interval D] [--once]")
+	}
+	if *interval <= 0 {
+		return usageError("invalid --interval %s", *interval)
+	}
+	if *ttl != "" {
+		if _, err := cftoken.ParseTTL(*ttl); err != nil {
+			return usageError("invalid --ttl: %v", err)
+		}
+	}
+
+	tmpl := &cftoken.DefaultEnvTemplate
+	if *templateFile != "" {
+		if tmpl, err = cftoken.LoadEnvTemplate(*templateFile); err != nil {
+			return err
+		}
+	}
+	if len(tmpl.PerZone) == 0 {
+		return usageError("%s has no per_zone tokens", *templateFile)
+	}
+	entries := []string(zoneEntries)
+	if len(entries) == 0 {
+		if entries, err = tmpl.ZoneEntries(*env); err != nil {
+			return err
+		}
+	}
+	if *statePath == "" {
+		if *statePath, err = cftoken.KnownZonesPath(); err != nil {
+			return err
+		}
+	}
+
+	gen, _, err := cf.generator()
+	if err != nil {
+		return err
+	}
+	w := &zoneWatcher{
+		gen:      gen,
+		tmpl:     &cftoken.EnvTemplate{PerZone: tmpl.PerZone},
+		env:      *env,
+		entries:  entries,
+		state:    *statePath,
+		webhook:  *webhook,
+		sink:     *sink,
+		ttl:      *ttl,
+		backfill: *backfill,
+		source:   *templateFile,
+	}
+
+	ctx, stop := interruptContext(*drain)
+	defer stop()
+	if *once {
+		return w.check(ctx)
+	}
+	fmt.Fprintf(os.Stderr, "✓ Watching for new zones every %s\n", *interval)
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		if err := w.check(context.WithoutCancel(ctx)); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+type zoneWatcher struct {
+	gen      *cftoken.Generator
+	tmpl     *cftoken.EnvTemplate
+	env      string
+	entries  []string
+	state    string
+	webhook  string
+	sink     string
+	ttl      string
+	backfill bool
+	source   string
+}
+
+// check onboards the zones not yet in the state file.
+func (w *zoneWatcher) check(ctx context.Context) error {
+	known, err := cftoken.LoadKnownZones(w.state)
+	if err != nil {
+		return err
+	}
+	var zones []cftoken.Zone
+	if len(w.entries) > 0 {
+		zones, err = w.gen.MatchZones(ctx, w.entries)
+	} else {
+		zones, err = w.gen.DiscoverZones(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("listing zones: %w", err)
+	}
+
+	if known == nil && !w.backfill {
+		known = cftoken.KnownZones{}
+		for _, z := range zones {
+			known[z.ID] = z.Name
+		}
+		if err := known.Save(w.state); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "✓ Recorded %d existing zones in %s; tokens will be generated for zones added from now on\n", len(zones), w.state)
+		return nil
+	}
+	if known == nil {
+		known = cftoken.KnownZones{}
+	}
+	unknown := known.Unknown(zones)
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	manifest, err := w.tmpl.Expand(w.env, unknown, w.sink)
+	if err != nil {
+		return err
+	}
+	for i := range manifest.Tokens {
+		if manifest.Tokens[i].TTL == "" {
+			manifest.Tokens[i].TTL = w.ttl
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d new zones, creating %d tokens\n", len(unknown), len(manifest.Tokens))
+	results := w.gen.RunBatch(ctx, manifest.Tokens, cftoken.BatchOptions{
+		IfExists: cftoken.IfExistsSkip,
+		Options:  []cftoken.Option{cftoken.WithProvenance(cftoken.DetectProvenance(w.source))},
+	})
+	batchErr := finishBatch(ctx, w.gen, results)
+
+	// Expand lists each zone's entries together, in zone order.
+	per := len(w.tmpl.PerZone)
+	for i, z := range unknown {
+		zoneResults := results[i*per : (i+1)*per]
+		event := cftoken.NewZoneOnboardedEvent(w.env, z, zoneResults)
+		if event.Failed == 0 {
+			known[z.ID] = z.Name
+		}
+		if w.webhook != "" {
+			if err := w.gen.NotifyZoneOnboarded(ctx, w.webhook, event); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %s: %v\n", z.Name, err)
+			}
+		}
+	}
+	if err := known.Save(w.state); err != nil {
+		return err
+	}
+	return batchErr
+}
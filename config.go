@@ -0,0 +1,238 @@
+package cftoken
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/timeparse"
+)
+
+const configDir = ".goGenerateCFToken"
+
+// Parent credential types for Config.AuthType.
+const (
+	AuthTypeAPIToken = "api_token"
+	AuthTypeAPIKey   = "api_key"
+)
+
+// Config holds the stored credentials and defaults.
+type Config struct {
+	APIToken  string `yaml:"api_token"`
+	AccountID string `yaml:"account_id"`
+	ZoneID    string `yaml:"zone_id,omitempty"`
+
+	// AuthType selects the parent credential: AuthTypeAPIToken (the default)
+	// uses APIToken, AuthTypeAPIKey uses the legacy Global API Key and Email.
+	AuthType string `yaml:"auth_type,omitempty"`
+	APIKey   string `yaml:"api_key,omitempty"`
+	Email    string `yaml:"email,omitempty"`
+
+	// ProxyURL overrides HTTPS_PROXY for API calls. CACertPath is a PEM
+	// bundle trusted in addition to the system roots.
+	ProxyURL   string `yaml:"proxy_url,omitempty"`
+	CACertPath string `yaml:"ca_cert_path,omitempty"`
+
+	// Parents are additional parent tokens tagged with what they can grant.
+	// Each token is created with the least privileged one able to grant it;
+	// api_token is the fallback and is used for everything else.
+	Parents []ParentToken `yaml:"parents,omitempty"`
+
+	// ParentExpiryWarning is how long before the parent token expires the
+	// CLI warns about it, e.g. "30d". Defaults to 14 days; "0" disables the
+	// check.
+	ParentExpiryWarning string `yaml:"parent_expiry_warning,omitempty"`
+
+	// Timezone is the IANA zone, e.g. "Europe/London", in which dates and
+	// times such as "2025-01-31" or "next-friday-5pm" are read. Defaults to
+	// the system's local zone.
+	Timezone string `yaml:"timezone,omitempty"`
+
+	// Plan is the account's Cloudflare plan (free, pro, business, or
+	// enterprise), or auto to detect it. When set, services the plan doesn't
+	// offer are refused before any API call and left out of godmode tokens.
+	Plan string `yaml:"plan,omitempty"`
+
+	Presets    map[string]Preset    `yaml:"presets,omitempty"`
+	Tenants    map[string]Tenant    `yaml:"tenants,omitempty"`
+	ZoneGroups map[string]ZoneGroup `yaml:"zone_groups,omitempty"`
+	// Guardrails limit tokens on the zones of the named zone groups.
+	Guardrails map[string]Guardrail `yaml:"guardrails,omitempty"`
+	// Quotas limit tokens per requester, keyed by requester name, with "*"
+	// for requesters without their own entry.
+	Quotas map[string]Quota `yaml:"quotas,omitempty"`
+	// TokenLimit, if positive, is how many API tokens each parent's user can
+	// hold. The parent's tokens are then listed before each create, and one
+	// at the limit fails with suggestions of tokens to remove.
+	TokenLimit int `yaml:"token_limit,omitempty"`
+	// BreakGlass controls tokens created in spite of a guardrail.
+	BreakGlass BreakGlassConfig `yaml:"break_glass,omitempty"`
+	// AuditExport sends token events to SIEMs, keyed by a name of your
+	// choosing.
+	AuditExport map[string]AuditExportConfig `yaml:"audit_export,omitempty"`
+	// Include lists shared configs merged under this one, so a platform team
+	// can manage presets, zone groups, and guardrails centrally.
+	Include Includes `yaml:"include,omitempty"`
+}
+
+// Tenant is a customer account managed from the same install, with its own
+// defaults and optionally its own parent token.
+type Tenant struct {
+	APIToken  string `yaml:"api_token,omitempty"`
+	AccountID string `yaml:"account_id"`
+	ZoneID    string `yaml:"zone_id,omitempty"`
+}
+
+// ForTenant returns a copy of the config with the named tenant's account,
+// zone, and token applied. A tenant without its own token uses the top-level
+// api_token.
+func (c Config) ForTenant(name string) (*Config, error) {
+	t, ok := c.Tenants[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant %q", name)
+	}
+	if t.AccountID == "" {
+		return nil, fmt.Errorf("tenant %q has no account_id", name)
+	}
+	c.AccountID = t.AccountID
+	c.ZoneID = t.ZoneID
+	if t.APIToken != "" {
+		c.APIToken = t.APIToken
+		c.AuthType = AuthTypeAPIToken
+	}
+	return &c, nil
+}
+
+// Location returns the time zone named by Timezone.
+func (c Config) Location() (*time.Location, error) {
+	loc, err := timeparse.Location(c.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("timezone: %w", err)
+	}
+	return loc, nil
+}
+
+// UsesAPIKey reports whether the config authenticates with a Global API Key
+// instead of an API token.
+func (c Config) UsesAPIKey() bool {
+	return c.AuthType == AuthTypeAPIKey
+}
+
+// ConfigPath returns the per-user config file path:
+// %APPDATA%\cloudflare-token-generator\config.yaml on Windows and
+// ~/.goGenerateCFToken/config.yaml elsewhere. If the directory holds a
+// config.yml, config.toml, or config.json instead, that file is returned.
+func ConfigPath() (string, error) {
+	if runtime.GOOS == "windows" {
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			return configFile(filepath.Join(appData, "cloudflare-token-generator")), nil
+		}
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return configFile(filepath.Join(home, configDir)), nil
+}
+
+// StateDir returns the directory holding local state: the inventory, the
+// receipt signing key, the break-glass log, the include cache, and the
+// watch-zones state. It is $CFTG_STATE_DIR if set, otherwise the directory
+// of the per-user config.
+func StateDir() (string, error) {
+	if dir := os.Getenv("CFTG_STATE_DIR"); dir != "" {
+		return dir, nil
+	}
+	path, err := ConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(path), nil
+}
+
+// SystemConfigPath returns the system-wide config file path:
+// %ProgramData%\cloudflare-token-generator\config.yaml on Windows and
+// /etc/cloudflare-token-generator/config.yaml elsewhere, or the config.yml,
+// config.toml, or config.json found there instead.
+func SystemConfigPath() string {
+	if runtime.GOOS == "windows" {
+		programData := os.Getenv("ProgramData")
+		if programData == "" {
+			programData = `C:\ProgramData`
+		}
+		return configFile(filepath.Join(programData, "cloudflare-token-generator"))
+	}
+	return configFile("/etc/cloudflare-token-generator")
+}
+
+// LoadConfig reads the system-wide config and then the user config on top of
+// it, so any key set in the user config overrides the system value. At least
+// one of the two files must exist. Include sources are then merged under the
+// result.
+func LoadConfig() (*Config, error) {
+	userPath, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	found := false
+	for _, path := range []string{SystemConfigPath(), userPath} {
+		ok, err := readConfigFile(path, &cfg)
+		if err != nil {
+			return nil, err
+		}
+		found = found || ok
+	}
+	if !found {
+		return nil, fmt.Errorf("config not found, run init first: %s does not exist", userPath)
+	}
+	if err := cfg.resolveIncludes(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// LoadUserConfig reads only the user config, returning an empty Config if it
+// doesn't exist. Use it for read-modify-write updates so values inherited from
+// the system-wide config aren't copied into the user's file.
+func LoadUserConfig() (*Config, error) {
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if _, err := readConfigFile(path, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// SaveConfig writes the config to the user config path, keeping the format
+// of the existing file. Use SaveConfigAs to choose the format.
+func SaveConfig(cfg *Config) error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	return writeConfigFile(path, cfg)
+}
+
+// readConfigFile unmarshals path into cfg, reporting whether the file existed.
+func readConfigFile(path string, cfg *Config) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := decodeConfig(data, configFormat(path), cfg); err != nil {
+		return false, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return true, nil
+}
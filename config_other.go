@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cftoken
+
+import "os"
+
+// fileOwner is not supported on this platform.
+func fileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
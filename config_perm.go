@@ -0,0 +1,65 @@
+package cftoken
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// CheckConfigPermissions inspects the user config file and its directory and
+// describes each problem found: a config file that is group/world-readable or
+// owned by another user, or a config directory that is a symlink to a
+// group/world-accessible location. Permission bits are not checked on Windows.
+func CheckConfigPermissions() ([]string, error) {
+	if runtime.GOOS == "windows" {
+		return nil, nil
+	}
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	dir := filepath.Dir(path)
+	if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		target, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return nil, fmt.Errorf("resolving %s: %w", dir, err)
+		}
+		if targetInfo, err := os.Stat(target); err == nil && targetInfo.Mode().Perm()&0077 != 0 {
+			problems = append(problems, fmt.Sprintf("%s is a symlink to %s, which is accessible by other users (mode %04o)",
+				dir, target, targetInfo.Mode().Perm()))
+		}
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return problems, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		problems = append(problems, fmt.Sprintf("%s is accessible by other users (mode %04o), run `config chmod` to fix",
+			path, info.Mode().Perm()))
+	}
+	if uid, ok := fileOwner(info); ok && uid != os.Getuid() {
+		problems = append(problems, fmt.Sprintf("%s is owned by uid %d, not the current user (uid %d)", path, uid, os.Getuid()))
+	}
+	return problems, nil
+}
+
+// FixConfigPermissions restricts the user config directory to 0700 and the
+// config file to 0600.
+func FixConfigPermissions() error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package cftoken
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the uid owning the file described by info.
+func fileOwner(info os.FileInfo) (int, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(st.Uid), true
+}
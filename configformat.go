@@ -0,0 +1,131 @@
+package cftoken
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormats are the config file formats, in the order LoadConfig looks
+// for config.<ext> when more than one exists. "yml" is read as YAML.
+var ConfigFormats = []string{"yaml", "yml", "toml", "json"}
+
+// configFile returns the config file in dir: the first config.<ext> that
+// exists, or config.yaml if none does.
+func configFile(dir string) string {
+	for _, ext := range ConfigFormats {
+		path := filepath.Join(dir, "config."+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+// configFormat returns the format of a config file from its extension,
+// defaulting to YAML.
+func configFormat(path string) string {
+	switch ext := strings.TrimPrefix(filepath.Ext(path), "."); ext {
+	case "toml", "json":
+		return ext
+	}
+	return "yaml"
+}
+
+func validConfigFormat(format string) error {
+	for _, f := range ConfigFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid config format %q (use yaml, toml, or json)", format)
+}
+
+// decodeConfig unmarshals data in format into cfg. TOML is converted to YAML
+// first, so every format shares the yaml key names and custom decoders.
+func decodeConfig(data []byte, format string, cfg *Config) error {
+	if format == "toml" {
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		var err error
+		if data, err = yaml.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	// JSON is valid YAML.
+	return yaml.Unmarshal(data, cfg)
+}
+
+// encodeConfig marshals cfg in format, using the yaml key names.
+func encodeConfig(cfg *Config, format string) ([]byte, error) {
+	data, err := yaml.Marshal(cfg)
+	if err != nil || format == "yaml" || format == "yml" {
+		return data, err
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if format == "json" {
+		out, err := json.MarshalIndent(doc, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SaveConfigAs writes the config to the user config directory as
+// config.<format> and removes the user config files in other formats, so the
+// new file is the one LoadConfig reads.
+func SaveConfigAs(cfg *Config, format string) error {
+	if err := validConfigFormat(format); err != nil {
+		return err
+	}
+	current, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(current)
+	path := filepath.Join(dir, "config."+format)
+	if err := writeConfigFile(path, cfg); err != nil {
+		return err
+	}
+	for _, ext := range ConfigFormats {
+		other := filepath.Join(dir, "config."+ext)
+		if other == path {
+			continue
+		}
+		if err := os.Remove(other); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConfigFile writes cfg to path in the format its extension names.
+func writeConfigFile(path string, cfg *Config) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := encodeConfig(cfg, configFormat(path))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
@@ -0,0 +1,199 @@
+package cftoken
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// WithoutSecrets returns a copy of the config with credentials removed: the
+// parent token or Global API Key and email, tenant and additional parent
+// tokens, the break-glass webhook URL, which usually embeds its own secret,
+// and audit export headers.
+func (c Config) WithoutSecrets() Config {
+	c.APIToken = ""
+	c.APIKey = ""
+	c.Email = ""
+	if c.AuthType == AuthTypeAPIKey {
+		c.AuthType = ""
+	}
+	if c.Tenants != nil {
+		tenants := make(map[string]Tenant, len(c.Tenants))
+		for name, t := range c.Tenants {
+			t.APIToken = ""
+			tenants[name] = t
+		}
+		c.Tenants = tenants
+	}
+	if c.Parents != nil {
+		parents := make([]ParentToken, len(c.Parents))
+		for i, p := range c.Parents {
+			p.APIToken = ""
+			parents[i] = p
+		}
+		c.Parents = parents
+	}
+	c.BreakGlass.Webhook = ""
+	if c.AuditExport != nil {
+		exports := make(map[string]AuditExportConfig, len(c.AuditExport))
+		for name, e := range c.AuditExport {
+			e.Headers = nil
+			exports[name] = e
+		}
+		c.AuditExport = exports
+	}
+	return c
+}
+
+// ExportConfig encodes the config as "yaml" or "json", using the config
+// file's key names in both. An empty api_token is left out.
+func ExportConfig(c Config, format string) ([]byte, error) {
+	if format != "" && format != "yaml" && format != "json" {
+		return nil, fmt.Errorf("invalid export format %q (use yaml or json)", format)
+	}
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.APIToken == "" {
+		// Re-encode through a node to drop the key, keeping field order.
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		root := doc.Content[0]
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value == "api_token" {
+				root.Content = append(root.Content[:i], root.Content[i+2:]...)
+				break
+			}
+		}
+		if data, err = yaml.Marshal(&doc); err != nil {
+			return nil, err
+		}
+	}
+	if format != "json" {
+		return data, nil
+	}
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
+
+// ReadSharedConfig reads a config exported with ExportConfig, in YAML or
+// JSON, or a TOML config named *.toml. Credentials in the file are removed;
+// ignored lists the keys that had one.
+func ReadSharedConfig(path string) (cfg Config, ignored []string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, nil, err
+	}
+	if err := decodeConfig(data, configFormat(path), &cfg); err != nil {
+		return Config{}, nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if cfg.APIToken != "" {
+		ignored = append(ignored, "api_token")
+	}
+	if cfg.APIKey != "" {
+		ignored = append(ignored, "api_key")
+	}
+	for name, t := range cfg.Tenants {
+		if t.APIToken != "" {
+			ignored = append(ignored, "tenants."+name+".api_token")
+		}
+	}
+	if cfg.BreakGlass.Webhook != "" {
+		ignored = append(ignored, "break_glass.webhook")
+	}
+	for name, e := range cfg.AuditExport {
+		if len(e.Headers) > 0 {
+			ignored = append(ignored, "audit_export."+name+".headers")
+		}
+	}
+	sort.Strings(ignored)
+	return cfg.WithoutSecrets(), ignored, nil
+}
+
+// MergeShared copies the shared settings from other into c: presets, zone
+// groups, guardrails, audit exports, tenants, break-glass limits, and include sources, plus account_id,
+// zone_id, proxy_url, and ca_cert_path where c has none. Entries c already
+// has are kept unless overwrite is set. It returns the names of entries
+// added or replaced, e.g. "presets.ci-deploy", and of entries kept.
+func (c *Config) MergeShared(other Config, overwrite bool) (changed, kept []string) {
+	mergeMap(&c.Presets, other.Presets, "presets.", overwrite, &changed, &kept)
+	mergeMap(&c.ZoneGroups, other.ZoneGroups, "zone_groups.", overwrite, &changed, &kept)
+	mergeMap(&c.Guardrails, other.Guardrails, "guardrails.", overwrite, &changed, &kept)
+	mergeMap(&c.AuditExport, other.AuditExport, "audit_export.", overwrite, &changed, &kept)
+
+	// Tenants keep their local token.
+	for name, t := range other.Tenants {
+		local, exists := c.Tenants[name]
+		if exists && !overwrite {
+			kept = append(kept, "tenants."+name)
+			continue
+		}
+		if c.Tenants == nil {
+			c.Tenants = make(map[string]Tenant)
+		}
+		t.APIToken = local.APIToken
+		c.Tenants[name] = t
+		changed = append(changed, "tenants."+name)
+	}
+
+	for _, source := range other.Include {
+		if !slices.Contains(c.Include, source) {
+			c.Include = append(c.Include, source)
+			changed = append(changed, "include."+source)
+		}
+	}
+
+	for _, f := range []struct {
+		key string
+		dst *string
+		src string
+	}{
+		{"account_id", &c.AccountID, other.AccountID},
+		{"zone_id", &c.ZoneID, other.ZoneID},
+		{"proxy_url", &c.ProxyURL, other.ProxyURL},
+		{"ca_cert_path", &c.CACertPath, other.CACertPath},
+		{"break_glass.max_ttl", &c.BreakGlass.MaxTTL, other.BreakGlass.MaxTTL},
+		{"break_glass.audit_log", &c.BreakGlass.AuditLog, other.BreakGlass.AuditLog},
+	} {
+		if f.src == "" || *f.dst == f.src {
+			continue
+		}
+		if *f.dst != "" && !overwrite {
+			kept = append(kept, f.key)
+			continue
+		}
+		*f.dst = f.src
+		changed = append(changed, f.key)
+	}
+	sort.Strings(changed)
+	sort.Strings(kept)
+	return changed, kept
+}
+
+func mergeMap[V any](dst *map[string]V, src map[string]V, prefix string, overwrite bool, changed, kept *[]string) {
+	for name, v := range src {
+		if _, exists := (*dst)[name]; exists && !overwrite {
+			*kept = append(*kept, prefix+name)
+			continue
+		}
+		if *dst == nil {
+			*dst = make(map[string]V)
+		}
+		(*dst)[name] = v
+		*changed = append(*changed, prefix+name)
+	}
+}
@@ -0,0 +1,79 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeliveryError is returned by Deliver when a secret couldn't be delivered.
+// By then the token has been revoked, or rolled if it existed before, so no
+// live secret is left that nobody has.
+type DeliveryError struct {
+	TokenID  string
+	Sink     string
+	Attempts int
+	Err      error
+	// Cleanup is "revoked" or "rolled" once the undelivered secret is
+	// unusable, or empty if that failed with CleanupErr.
+	Cleanup    string
+	CleanupErr error
+}
+
+func (e *DeliveryError) Error() string {
+	msg := fmt.Sprintf("delivering token %s to %s failed after %d attempt(s): %v", e.TokenID, e.Sink, e.Attempts, e.Err)
+	switch e.Cleanup {
+	case "revoked":
+		return msg + "; the token was revoked"
+	case "rolled":
+		return msg + "; the token's secret was rolled, so the undelivered value no longer works"
+	}
+	return fmt.Sprintf("%s; making the token unusable also failed (%v), revoke it manually", msg, e.CleanupErr)
+}
+
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// Live reports whether the token still exists with the same ID, i.e. it was
+// rolled or could not be revoked.
+func (e *DeliveryError) Live() bool { return e.Cleanup != "revoked" }
+
+// Deliver writes t's secret to sink, retrying failed writes up to retries
+// times with backoff. If every attempt fails, the secret would be lost
+// while still valid, so a newly created token is revoked and a token rolled
+// in place under IfExistsRoll is rolled again, and *DeliveryError is
+// returned.
+func (g *Generator) Deliver(ctx context.Context, t *Token, sink Sink, retries int) error {
+	var err error
+	attempts := 0
+	backoff := 500 * time.Millisecond
+	for {
+		attempts++
+		if err = sink.Deliver(t); err == nil {
+			return nil
+		}
+		if attempts > retries {
+			break
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		backoff *= 2
+	}
+
+	derr := &DeliveryError{TokenID: t.ID, Sink: sink.String(), Attempts: attempts, Err: err}
+	// Cleanup must happen even if ctx was cancelled.
+	cleanupCtx := context.WithoutCancel(ctx)
+	if t.Rolled {
+		if _, derr.CleanupErr = g.api.RollAPIToken(cleanupCtx, t.ID); derr.CleanupErr == nil {
+			derr.Cleanup = "rolled"
+		}
+	} else if derr.CleanupErr = g.RevokeToken(cleanupCtx, t.ID); derr.CleanupErr == nil {
+		derr.Cleanup = "revoked"
+	}
+	t.Value = ""
+	return derr
+}
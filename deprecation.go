@@ -0,0 +1,33 @@
+package cftoken
+
+import "fmt"
+
+// Deprecations returns the deprecated services, sorted by name, so callers
+// can find what needs migrating before Cloudflare retires the products.
+func Deprecations() []Service {
+	var deprecated []Service
+	for _, svc := range ListServices() {
+		if svc.Deprecated {
+			deprecated = append(deprecated, svc)
+		}
+	}
+	return deprecated
+}
+
+// DeprecationWarnings returns a warning for each deprecated service among
+// services, which may include bundle names. Unknown names are ignored.
+func DeprecationWarnings(services []string) []string {
+	var warnings []string
+	for _, name := range ExpandServices(services) {
+		svc, ok := Services[name]
+		if !ok || !svc.Deprecated {
+			continue
+		}
+		if svc.ReplacedBy != "" {
+			warnings = append(warnings, fmt.Sprintf("service %q is deprecated; use %q instead", name, svc.ReplacedBy))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("service %q is deprecated", name))
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,199 @@
+package cftoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Resource key prefixes in token policies.
+const (
+	zoneResourcePrefix    = "com.cloudflare.api.account.zone."
+	accountResourcePrefix = "com.cloudflare.api.account."
+	userResourcePrefix    = "com.cloudflare.api.user."
+)
+
+// TokenDescription is a token with its policies decoded for people.
+type TokenDescription struct {
+	ID         string              `json:"id"`
+	Name       string              `json:"name"`
+	Status     string              `json:"status"`
+	IssuedOn   *time.Time          `json:"issued_on,omitempty"`
+	ModifiedOn *time.Time          `json:"modified_on,omitempty"`
+	NotBefore  *time.Time          `json:"not_before,omitempty"`
+	ExpiresOn  *time.Time          `json:"expires_on,omitempty"`
+	LastUsedOn *time.Time          `json:"last_used_on,omitempty"`
+	Condition  *TokenCondition     `json:"condition,omitempty"`
+	Policies   []PolicyDescription `json:"policies"`
+}
+
+// PolicyDescription is one policy of a described token.
+type PolicyDescription struct {
+	ID          string                  `json:"id,omitempty"`
+	Effect      string                  `json:"effect"`
+	Permissions []PermissionDescription `json:"permissions"`
+	Resources   []ResourceDescription   `json:"resources"`
+}
+
+// PermissionDescription is a permission group with its name and, if the
+// catalog knows it, the service granting it (see LookupPermission).
+type PermissionDescription struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Service string `json:"service,omitempty"`
+}
+
+// ResourceDescription is a policy resource. Nested resources, such as all
+// zones of one account, are flattened into one entry with the keys joined by
+// " > ".
+type ResourceDescription struct {
+	Key string `json:"key"`
+	// Description names the resource, e.g. "zone example.com" or "all zones
+	// in account Acme".
+	Description string `json:"description"`
+}
+
+// DescribeToken fetches a token and decodes its policies: permission groups
+// are named from the live permission group list, and zones and accounts from
+// the ones the parent token can list. Names that can't be looked up are left
+// as IDs.
+func (g *Generator) DescribeToken(ctx context.Context, id string) (*TokenDescription, error) {
+	resp, err := g.api.Raw(ctx, http.MethodGet, "/user/tokens/"+id, nil, nil)
+	if err != nil {
+		return nil, explainAPIError("reading token "+id, err)
+	}
+	var token struct {
+		APIToken
+		LastUsedOn *time.Time `json:"last_used_on"`
+	}
+	if err := json.Unmarshal(resp.Result, &token); err != nil {
+		return nil, fmt.Errorf("decoding token %s: %w", id, err)
+	}
+
+	d := &TokenDescription{
+		ID:         token.ID,
+		Name:       token.Name,
+		Status:     token.Status,
+		IssuedOn:   token.IssuedOn,
+		ModifiedOn: token.ModifiedOn,
+		NotBefore:  token.NotBefore,
+		ExpiresOn:  token.ExpiresOn,
+		LastUsedOn: token.LastUsedOn,
+		Condition:  token.Condition,
+	}
+	names := g.resourceNames(ctx, token.Policies)
+	groupNames := make(map[string]string)
+	if groups, err := g.api.ListAPITokensPermissionGroups(ctx); err == nil {
+		for _, pg := range groups {
+			groupNames[pg.ID] = pg.Name
+		}
+	}
+	for _, p := range token.Policies {
+		pd := PolicyDescription{ID: p.ID, Effect: p.Effect}
+		for _, pg := range p.PermissionGroups {
+			perm := PermissionDescription{ID: pg.ID, Name: groupNames[pg.ID]}
+			if perm.Name == "" {
+				perm.Name = permissionName(pg)
+			}
+			if svc, _, ok := LookupPermission(pg.ID); ok {
+				perm.Service = svc.Name
+			}
+			pd.Permissions = append(pd.Permissions, perm)
+		}
+		pd.Resources = describeResources(p.Resources, names)
+		d.Policies = append(d.Policies, pd)
+	}
+	return d, nil
+}
+
+// resourceNames returns zone and account names by ID, listing only what the
+// policies refer to. Lookups that fail are skipped.
+func (g *Generator) resourceNames(ctx context.Context, policies []policy.Policy) map[string]string {
+	var keys []string
+	for _, p := range policies {
+		for key, v := range p.Resources {
+			keys = append(keys, key)
+			if nested, ok := v.(map[string]interface{}); ok {
+				for k := range nested {
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+	needZones, needAccounts := false, false
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, zoneResourcePrefix):
+			needZones = needZones || k != zoneResourcePrefix+"*"
+		case strings.HasPrefix(k, accountResourcePrefix):
+			needAccounts = needAccounts || k != accountResourcePrefix+"*"
+		}
+	}
+
+	names := make(map[string]string)
+	if needZones {
+		if zones, err := g.DiscoverZones(ctx); err == nil {
+			for _, z := range zones {
+				names[z.ID] = z.Name
+			}
+		}
+	}
+	if needAccounts {
+		if accounts, err := g.DiscoverAccounts(ctx); err == nil {
+			for _, a := range accounts {
+				names[a.ID] = a.Name
+			}
+		}
+	}
+	return names
+}
+
+// describeResources describes a policy's resources, sorted by key.
+func describeResources(resources map[string]interface{}, names map[string]string) []ResourceDescription {
+	var out []ResourceDescription
+	for key, v := range resources {
+		nested, ok := v.(map[string]interface{})
+		if !ok {
+			out = append(out, ResourceDescription{Key: key, Description: describeResource(key, names)})
+			continue
+		}
+		outer := describeResource(key, names)
+		for inner := range nested {
+			out = append(out, ResourceDescription{
+				Key:         key + " > " + inner,
+				Description: describeResource(inner, names) + " in " + outer,
+			})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// describeResource names a single resource key.
+func describeResource(key string, names map[string]string) string {
+	named := func(kind, id string) string {
+		if name, ok := names[id]; ok && name != "" {
+			return fmt.Sprintf("%s %s (%s)", kind, name, id)
+		}
+		return kind + " " + id
+	}
+	switch {
+	case key == zoneResourcePrefix+"*":
+		return "all zones"
+	case strings.HasPrefix(key, zoneResourcePrefix):
+		return named("zone", strings.TrimPrefix(key, zoneResourcePrefix))
+	case key == accountResourcePrefix+"*":
+		return "all accounts"
+	case strings.HasPrefix(key, accountResourcePrefix):
+		return named("account", strings.TrimPrefix(key, accountResourcePrefix))
+	case strings.HasPrefix(key, userResourcePrefix):
+		return "user " + strings.TrimPrefix(key, userResourcePrefix)
+	}
+	return key
+}
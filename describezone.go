@@ -0,0 +1,98 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ZoneDescription is what DescribeZone reports about a zone.
+type ZoneDescription struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Type is "full", "partial" (CNAME setup), or "secondary".
+	Type   string `json:"type"`
+	Paused bool   `json:"paused"`
+	// Plan is free, pro, business, or enterprise; PlanName is Cloudflare's
+	// display name for it.
+	Plan                string    `json:"plan"`
+	PlanName            string    `json:"plan_name"`
+	NameServers         []string  `json:"name_servers"`
+	OriginalNameServers []string  `json:"original_name_servers,omitempty"`
+	AccountID           string    `json:"account_id"`
+	AccountName         string    `json:"account_name"`
+	CreatedOn           time.Time `json:"created_on"`
+
+	// Resource is the zone's resource key in token policies, and
+	// AccountResource its account's.
+	Resource        string `json:"resource"`
+	AccountResource string `json:"account_resource"`
+
+	// Services are the zone-scoped services the zone's plan offers, and
+	// Bundles the bundles with a zone-scoped service whose services it all
+	// offers. Deprecated services are left out.
+	Services []string `json:"services"`
+	Bundles  []string `json:"bundles"`
+}
+
+// DescribeZone looks up a zone by ID or name among the zones the parent token
+// can list, and reports its details with the services and bundles that
+// apply to it.
+func (g *Generator) DescribeZone(ctx context.Context, idOrName string) (*ZoneDescription, error) {
+	if isZonePattern(idOrName) {
+		return nil, fmt.Errorf("%q is a pattern; describe-zone takes one zone ID or name", idOrName)
+	}
+	zones, err := g.MatchZones(ctx, []string{idOrName})
+	if err != nil {
+		return nil, err
+	}
+	if len(zones) != 1 || zones[0].Name == "" {
+		return nil, fmt.Errorf("zone %s not found among the zones the parent token can list", idOrName)
+	}
+	z := zones[0]
+	d := &ZoneDescription{
+		ID:                  z.ID,
+		Name:                z.Name,
+		Status:              z.Status,
+		Type:                z.Type,
+		Paused:              z.Paused,
+		Plan:                z.Plan.LegacyID,
+		PlanName:            z.Plan.Name,
+		NameServers:         z.NameServers,
+		OriginalNameServers: z.OriginalNS,
+		AccountID:           z.Account.ID,
+		AccountName:         z.Account.Name,
+		CreatedOn:           z.CreatedOn,
+		Resource:            "com.cloudflare.api.account.zone." + z.ID,
+		AccountResource:     "com.cloudflare.api.account." + z.Account.ID,
+	}
+
+	// Plans outside the known four, such as partner plans, are treated as
+	// unknown so nothing is ruled out.
+	plan := d.Plan
+	if _, ok := planRank[plan]; !ok {
+		plan = ""
+	}
+	offered := make(map[string]bool)
+	for _, svc := range ServicesForPlan(plan) {
+		if svc.Deprecated {
+			continue
+		}
+		offered[svc.Name] = true
+		if svc.ResourceScope == ResourceScopeZone {
+			d.Services = append(d.Services, svc.Name)
+		}
+	}
+	for _, name := range ListBundles() {
+		zoneScoped, all := false, true
+		for _, s := range Bundles[name] {
+			all = all && offered[s]
+			zoneScoped = zoneScoped || Services[s].ResourceScope == ResourceScopeZone
+		}
+		if all && zoneScoped {
+			d.Bundles = append(d.Bundles, name)
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,137 @@
+package cftoken
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvTemplate describes the standard set of tokens for an environment:
+// entries repeated for every zone in it, and entries created once. String
+// fields are Go templates over EnvVars, e.g. "{{.Env}}-dns-{{.Zone}}".
+type EnvTemplate struct {
+	// Zones are the environment's zones, as zone IDs, names, or patterns,
+	// e.g. "*.{{.Env}}.example.com", when not given on the command line.
+	Zones []string `yaml:"zones,omitempty"`
+	// PerZone entries are scoped to each zone; their scope is ignored.
+	PerZone []ManifestToken `yaml:"per_zone,omitempty"`
+	// Once entries are created a single time, with their own scope.
+	Once []ManifestToken `yaml:"once,omitempty"`
+}
+
+// EnvVars are the values available to an EnvTemplate. Zone and ZoneID are
+// empty in Once entries. Name is the rendered token name, for sinks.
+type EnvVars struct {
+	Env    string
+	Zone   string
+	ZoneID string
+	Name   string
+}
+
+// DefaultEnvTemplate provisions a DNS edit token and a cache purge token per
+// zone, and one Workers token for the account.
+var DefaultEnvTemplate = EnvTemplate{
+	PerZone: []ManifestToken{
+		{Name: "{{.Env}}-dns-{{.Zone}}", Services: []string{"dns"}, Level: "edit"},
+		{Name: "{{.Env}}-cache-purge-{{.Zone}}", Services: []string{"cache"}, Level: "edit"},
+	},
+	Once: []ManifestToken{
+		{Name: "{{.Env}}-workers", Services: []string{"workers"}, Scope: "all", Level: "edit"},
+	},
+}
+
+// LoadEnvTemplate reads an EnvTemplate from a YAML file.
+func LoadEnvTemplate(path string) (*EnvTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var t EnvTemplate
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(t.PerZone) == 0 && len(t.Once) == 0 {
+		return nil, fmt.Errorf("%s: no per_zone or once tokens", path)
+	}
+	return &t, nil
+}
+
+// ZoneEntries returns the template's zones for env, rendered like the
+// token fields.
+func (t *EnvTemplate) ZoneEntries(env string) ([]string, error) {
+	entries := make([]string, len(t.Zones))
+	for i, z := range t.Zones {
+		var err error
+		if entries[i], err = renderEnv(z, EnvVars{Env: env}); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Expand renders the template for env and zones into a manifest. Entries
+// without a sink get defaultSink, itself a template, if it is not empty.
+func (t *EnvTemplate) Expand(env string, zones []Zone, defaultSink string) (*Manifest, error) {
+	m := &Manifest{}
+	add := func(entry ManifestToken, vars EnvVars) error {
+		var err error
+		if entry.Name, err = renderEnv(entry.Name, vars); err != nil {
+			return err
+		}
+		vars.Name = entry.Name
+		if entry.Sink == "" {
+			entry.Sink = defaultSink
+		}
+		if entry.Sink, err = renderEnv(entry.Sink, vars); err != nil {
+			return err
+		}
+		if entry.Scope, err = renderEnv(entry.Scope, vars); err != nil {
+			return err
+		}
+		if vars.ZoneID != "" {
+			entry.Scope = vars.ZoneID
+		}
+		entry.Services = append([]string(nil), entry.Services...)
+		m.Tokens = append(m.Tokens, entry)
+		return nil
+	}
+	for _, z := range zones {
+		name := z.Name
+		if name == "" {
+			name = z.ID
+		}
+		for _, entry := range t.PerZone {
+			if err := add(entry, EnvVars{Env: env, Zone: name, ZoneID: z.ID}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, entry := range t.Once {
+		if err := add(entry, EnvVars{Env: env}); err != nil {
+			return nil, err
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func renderEnv(text string, vars EnvVars) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("template %q: %w", text, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("template %q: %w", text, err)
+	}
+	return buf.String(), nil
+}
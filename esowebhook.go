@@ -0,0 +1,245 @@
+package cftoken
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ESOWebhookOpenAPI is the OpenAPI 3 document describing the webhook and
+// its probes, from which the webhookclient package is generated.
+//
+//go:embed api/eso-webhook.yaml
+var ESOWebhookOpenAPI []byte
+
+// ESOWebhookRequest is the body External Secrets Operator's webhook
+// generator is configured to send, e.g.
+//
+//	{"services": ["dns"], "scope": "example.com", "level": "edit", "ttl": "24h"}
+//
+// Level defaults to "read", so write access is only given when asked for.
+type ESOWebhookRequest struct {
+	Services []string `json:"services"`
+	Scope    string   `json:"scope"`
+	Level    string   `json:"level,omitempty"`
+	TTL      string   `json:"ttl,omitempty"`
+	Name     string   `json:"name,omitempty"`
+}
+
+// ESOWebhookResponse is returned for a minted token. Point the generator's
+// result jsonPath at "$.token".
+type ESOWebhookResponse struct {
+	Token     string     `json:"token"`
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+}
+
+// ESOWebhookOptions configures ESOWebhookHandler.
+type ESOWebhookOptions struct {
+	// AuthToken is the bearer token callers must send. Required unless
+	// SigningKeys is set, and checked as well if both are.
+	AuthToken string
+	// SigningKeys, keyed by client ID, requires every request to be signed
+	// by one of those clients as SignRequest does. The client ID becomes the
+	// requester seen by Policy. A nonce is accepted once, and the timestamp
+	// must be within SignatureMaxSkew (DefaultSignatureMaxSkew if zero).
+	SigningKeys      map[string][]byte
+	SignatureMaxSkew time.Duration
+	// Access, if set, requires a valid Cloudflare Access JWT and allows
+	// only what its grants give the caller, who becomes the requester.
+	// AuthToken is then optional, and checked as well if set.
+	Access *AccessConfig
+	// DefaultTTL applies to requests without a ttl, and MaxTTL caps any
+	// requested. ESO mints a new token on every refresh and never revokes
+	// the previous one, so every token must expire; both default to 24h.
+	DefaultTTL time.Duration
+	MaxTTL     time.Duration
+	// Policy, if set, is evaluated for every request with the requester
+	// "external-secrets", the client ID of a signed request, or the Access
+	// identity.
+	Policy RequestPolicy
+	// Options are applied to every token.
+	Options []Option
+	// Store, if set, records every accepted request and what became of it,
+	// and the nonces of signed requests, so they survive a restart. A
+	// request that can't be recorded is refused. If Store is also a
+	// QuotaLedger, such as a redisstore.Store, quotas are counted there, so every
+	// replica sharing it enforces the same quota.
+	Store WebhookStore
+}
+
+// ESOWebhookHandler returns a handler for External Secrets Operator's
+// webhook generator. Each authorized POST mints a token as described by an
+// ESOWebhookRequest and answers with an ESOWebhookResponse. Failures are
+// answered with {"error": "..."}.
+func (g *Generator) ESOWebhookHandler(opts ESOWebhookOptions) http.Handler {
+	if opts.MaxTTL <= 0 {
+		opts.MaxTTL = 24 * time.Hour
+	}
+	if opts.DefaultTTL <= 0 || opts.DefaultTTL > opts.MaxTTL {
+		opts.DefaultTTL = opts.MaxTTL
+	}
+	var verifier *signatureVerifier
+	if len(opts.SigningKeys) > 0 {
+		verifier = newSignatureVerifier(opts.SigningKeys, opts.SignatureMaxSkew, opts.Store)
+	}
+	var pruneMu sync.Mutex
+	var pruned time.Time
+	var access *accessVerifier
+	var accessErr error
+	if opts.Access != nil {
+		if accessErr = opts.Access.Validate(); accessErr == nil {
+			access = newAccessVerifier(opts.Access, g.client)
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeWebhookError(w, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		if accessErr != nil {
+			writeWebhookError(w, http.StatusInternalServerError, "access config: "+accessErr.Error())
+			return
+		}
+		auth, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if (opts.AuthToken == "" && verifier == nil && access == nil) ||
+			(opts.AuthToken != "" && subtle.ConstantTimeCompare([]byte(auth), []byte(opts.AuthToken)) != 1) {
+			writeWebhookError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+		if err != nil {
+			writeWebhookError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		requester := "external-secrets"
+		if verifier != nil {
+			if requester, err = verifier.verify(r, body); err != nil {
+				writeWebhookError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+		}
+		var identity *AccessIdentity
+		if access != nil {
+			if identity, err = access.verify(r.Context(), r); err != nil {
+				writeWebhookError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+			requester = identity.Name()
+		}
+
+		var req ESOWebhookRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			writeWebhookError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+		if len(req.Services) == 0 || req.Scope == "" {
+			writeWebhookError(w, http.StatusBadRequest, "services and scope are required")
+			return
+		}
+		if req.Level == "" {
+			req.Level = "read"
+		}
+		if identity != nil {
+			if err := opts.Access.Authorize(identity, req.Services, req.Scope, req.Level); err != nil {
+				writeWebhookError(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+		ttl := opts.DefaultTTL
+		if req.TTL != "" {
+			if ttl, err = ParseTTL(req.TTL); err != nil {
+				writeWebhookError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if ttl > opts.MaxTTL {
+				writeWebhookError(w, http.StatusBadRequest, fmt.Sprintf("ttl %s exceeds the maximum of %s", req.TTL, opts.MaxTTL))
+				return
+			}
+		}
+
+		tokenOpts := append([]Option{WithTTL(ttl), WithRequester(requester)}, opts.Options...)
+		if req.Name != "" {
+			tokenOpts = append(tokenOpts, WithName(req.Name))
+		}
+		if opts.Policy != nil {
+			tokenOpts = append(tokenOpts, WithRequestPolicy(opts.Policy, requester))
+		}
+		if ledger, ok := opts.Store.(QuotaLedger); ok {
+			tokenOpts = append(tokenOpts, WithQuotaLedger(ledger))
+		}
+		now := time.Now()
+		record := WebhookRecord{ID: newWebhookRequestID(), Requester: requester, Services: req.Services,
+			Scope: req.Scope, Level: req.Level, Status: WebhookPending, CreatedAt: now, UpdatedAt: now}
+		if opts.Store != nil {
+			if err := opts.Store.PutRequest(r.Context(), record); err != nil {
+				writeWebhookError(w, http.StatusServiceUnavailable, "recording request: "+err.Error())
+				return
+			}
+			pruneMu.Lock()
+			if now.Sub(pruned) > time.Hour {
+				pruned = now
+				opts.Store.Prune(r.Context(), now.Add(-webhookRecordRetention))
+			}
+			pruneMu.Unlock()
+		}
+		t, err := g.GenerateToken(req.Services, req.Scope, req.Level, tokenOpts...)
+		if opts.Store != nil {
+			record.Status, record.UpdatedAt = WebhookIssued, time.Now()
+			if err != nil {
+				record.Status, record.Error = WebhookFailed, err.Error()
+			} else {
+				record.TokenID, record.TokenName, record.ExpiresOn = t.ID, t.Name, t.ExpiresOn
+			}
+			// The token is delivered even if this fails; the record stays
+			// pending and is reported as interrupted on the next start.
+			opts.Store.PutRequest(context.WithoutCancel(r.Context()), record)
+		}
+		var quota *QuotaError
+		if errors.As(err, &quota) && quota.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(quota.RetryAfter.Seconds())+1))
+		}
+		if err != nil {
+			writeWebhookError(w, webhookStatus(err), err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(ESOWebhookResponse{Token: t.Value, ID: t.ID, Name: t.Name, ExpiresOn: t.ExpiresOn})
+	})
+}
+
+// webhookStatus maps a GenerateToken error to an HTTP status.
+func webhookStatus(err error) int {
+	var denied *PolicyDeniedError
+	var guardrail *GuardrailError
+	var plan *PlanError
+	var quota *QuotaError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &quota):
+		return http.StatusTooManyRequests
+	case errors.As(err, &denied), errors.As(err, &guardrail), errors.As(err, &plan):
+		return http.StatusForbidden
+	case errors.As(err, &apiErr), IsRetryable(err):
+		return http.StatusBadGateway
+	}
+	return http.StatusBadRequest
+}
+
+func writeWebhookError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,36 @@
+// Command mintdns mints a short-lived DNS token using the parent credential in
+// CLOUDFLARE_API_TOKEN and prints it, as a starting point for embedding token
+// minting in other programs.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/client"
+)
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := client.New(ctx, client.FromEnv())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	tok, err := c.MintDNSToken(ctx, client.MintOpts{
+		Name: "mintdns-example",
+		TTL:  time.Hour,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Created %s (%s), expires %s\n", tok.Name, tok.ID, tok.ExpiresOn.Format(time.RFC3339))
+	fmt.Println(tok.Value)
+}
@@ -0,0 +1,47 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SetExpiry updates the expiry of an existing token in place, keeping its
+// ID, secret, policies, and conditions. It is meant for putting a deadline
+// on tokens created without one, or extending one about to expire. Times in
+// the past are refused; revoke the token instead.
+func (g *Generator) SetExpiry(ctx context.Context, id string, at time.Time) (token *Token, err error) {
+	ctx, op := g.startOp(ctx, "SetExpiry")
+	defer func() { op.end(token, err) }()
+	if !at.After(time.Now()) {
+		return nil, fmt.Errorf("expiry %s is in the past; revoke the token instead", at.Format(time.RFC3339))
+	}
+	current, err := g.api.GetAPIToken(ctx, id)
+	if err != nil {
+		return nil, explainAPIError("reading token "+id, err)
+	}
+	if current.NotBefore != nil && !at.After(*current.NotBefore) {
+		return nil, fmt.Errorf("expiry %s is before the token becomes valid (%s)", at.Format(time.RFC3339), current.NotBefore.Format(time.RFC3339))
+	}
+	at = at.UTC().Truncate(time.Second)
+	current.ExpiresOn = &at
+	updated, err := g.api.UpdateAPIToken(ctx, id, current)
+	if err != nil {
+		return nil, explainAPIError("updating token "+id, err)
+	}
+	if len(updated.Policies) == 0 {
+		updated.Policies = current.Policies
+	}
+	token = &Token{
+		ID:        id,
+		Name:      current.Name,
+		Policies:  updated.Policies,
+		Condition: current.Condition,
+		NotBefore: current.NotBefore,
+		ExpiresOn: &at,
+	}
+	if err := g.exportAudit(ctx, AuditEvent{Action: AuditTokenExpiryChanged, TokenID: id, TokenName: current.Name, ExpiresOn: &at}); err != nil {
+		return token, fmt.Errorf("token %s expiry was updated, but %w", id, err)
+	}
+	return token, nil
+}
@@ -0,0 +1,123 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GCOptions controls FindGarbage.
+type GCOptions struct {
+	// Inventory, if set, adds its tokens to those recognized by the tagging
+	// convention, and supplies their sinks.
+	Inventory *Inventory
+	// OlderThan only considers tokens issued at least this long ago.
+	OlderThan time.Duration
+	// ExpiredFor only collects expired tokens once they have been expired
+	// this long.
+	ExpiredFor time.Duration
+	// UnusedFor, if set, also collects tokens not used for this long (see
+	// TokenFilter.UnusedFor).
+	UnusedFor time.Duration
+}
+
+// Garbage is a token FindGarbage selected for removal.
+type Garbage struct {
+	ID     string
+	Name   string
+	Reason string
+	// Gone is set for inventory entries whose token no longer exists; they
+	// only need removing from the inventory.
+	Gone bool
+}
+
+// sinkChecker is implemented by sinks that can tell whether their target
+// still exists.
+type sinkChecker interface {
+	Exists() (bool, error)
+}
+
+// FindGarbage returns tokens created by this tool, recognized by a managed
+// name or an inventory entry, that are expired, disabled, unused for
+// opts.UnusedFor, or whose sink target no longer exists. Inventory entries
+// for tokens that were deleted elsewhere are returned with Gone set.
+func (g *Generator) FindGarbage(ctx context.Context, opts GCOptions) ([]Garbage, error) {
+	tokens, err := g.api.APITokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tokens: %w", err)
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool, len(tokens))
+	var garbage []Garbage
+	for _, t := range tokens {
+		seen[t.ID] = true
+		var entry InventoryEntry
+		inInventory := false
+		if opts.Inventory != nil {
+			entry, inInventory = opts.Inventory.Lookup(t.ID)
+		}
+		if _, tagged := ParseTaggedName(t.Name); !tagged && !inInventory {
+			continue
+		}
+		if opts.OlderThan > 0 && (t.IssuedOn == nil || now.Sub(*t.IssuedOn) < opts.OlderThan) {
+			continue
+		}
+
+		reason := ""
+		switch {
+		case t.ExpiresOn != nil && now.Sub(*t.ExpiresOn) > opts.ExpiredFor:
+			reason = "expired " + t.ExpiresOn.Format("2006-01-02")
+		case t.Status == "disabled":
+			reason = "disabled"
+		case entry.Sink != "":
+			if missing, err := sinkMissing(entry.Sink); err != nil {
+				return nil, err
+			} else if missing {
+				reason = "sink " + entry.Sink + " no longer exists"
+			}
+		}
+		if reason == "" && opts.UnusedFor > 0 {
+			info := TokenInfo{APIToken: t}
+			if info.LastUsedOn, err = g.LastUsed(ctx, t.ID); err != nil {
+				return nil, err
+			}
+			if unusedFor(info, opts.UnusedFor, now) {
+				reason = "never used"
+				if info.LastUsedOn != nil {
+					reason = "unused since " + info.LastUsedOn.Format("2006-01-02")
+				}
+			}
+		}
+		if reason != "" {
+			garbage = append(garbage, Garbage{ID: t.ID, Name: t.Name, Reason: reason})
+		}
+	}
+
+	if opts.Inventory != nil {
+		for _, e := range opts.Inventory.Tokens {
+			if !seen[e.ID] {
+				garbage = append(garbage, Garbage{ID: e.ID, Name: e.Name, Reason: "no longer exists", Gone: true})
+			}
+		}
+	}
+	return garbage, nil
+}
+
+// sinkMissing reports whether the sink's target is known to be gone. Sinks
+// that can't check are assumed present.
+func sinkMissing(spec string) (bool, error) {
+	sink, err := ParseSink(spec)
+	if err != nil {
+		return false, nil
+	}
+	checker, ok := sink.(sinkChecker)
+	if !ok {
+		return false, nil
+	}
+	exists, err := checker.Exists()
+	if err != nil {
+		return false, fmt.Errorf("checking %s: %w", spec, err)
+	}
+	return !exists, nil
+}
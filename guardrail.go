@@ -0,0 +1,129 @@
+package cftoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Guardrail limits what tokens may grant on a zone group's zones. Empty lists
+// allow anything.
+type Guardrail struct {
+	// Levels are the permission levels allowed, e.g. [read].
+	Levels []string `yaml:"levels,omitempty"`
+	// Services are the zone-scoped services allowed.
+	Services []string `yaml:"services,omitempty"`
+}
+
+// GuardrailError is returned when a request would break a guardrail.
+type GuardrailError struct {
+	Group  string
+	Reason string
+}
+
+func (e *GuardrailError) Error() string {
+	return fmt.Sprintf("guardrail for zone group %q: %s (use break-glass to override)", e.Group, e.Reason)
+}
+
+// checkGuardrails rejects requests granting zone-scoped services on guarded
+// zones beyond what the guardrail allows. A scope of "all" covers every
+// guarded group; a zone ID or another group is checked against each guarded
+// group's current members.
+func (g *Generator) checkGuardrails(ctx context.Context, services []Service, scope, level string, zoneIDs []string) error {
+	if len(g.guardrails) == 0 {
+		return nil
+	}
+	var zoneServices []string
+	for _, svc := range services {
+		if svc.ResourceScope == ResourceScopeZone {
+			zoneServices = append(zoneServices, svc.Name)
+		}
+	}
+	if len(zoneServices) == 0 {
+		return nil
+	}
+
+	requested := make(map[string]bool)
+	for _, id := range zoneIDs {
+		requested[id] = true
+	}
+	if scope != "all" && !strings.HasPrefix(scope, "@") {
+		requested[scope] = true
+	}
+
+	names := make([]string, 0, len(g.guardrails))
+	for name := range g.guardrails {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		rail := g.guardrails[name]
+		covered := scope == "all" || scope == "@"+name
+		if !covered {
+			ids, err := g.guardedZones(ctx, name)
+			if err != nil {
+				return fmt.Errorf("checking guardrail: %w", err)
+			}
+			for _, id := range ids {
+				if requested[id] {
+					covered = true
+					break
+				}
+			}
+		}
+		if !covered {
+			continue
+		}
+		if len(rail.Levels) > 0 && !containsFold(rail.Levels, level) {
+			return &GuardrailError{Group: name, Reason: fmt.Sprintf("level %q is not allowed (allowed: %s)", level, strings.Join(rail.Levels, ", "))}
+		}
+		for _, svc := range zoneServices {
+			if len(rail.Services) > 0 && !containsFold(rail.Services, svc) {
+				return &GuardrailError{Group: name, Reason: fmt.Sprintf("service %q is not allowed (allowed: %s)", svc, strings.Join(rail.Services, ", "))}
+			}
+		}
+	}
+	return nil
+}
+
+// guardedZones returns the zone IDs in a guarded zone group. Unlike
+// ResolveZoneGroup, an entry that matches no zone right now, such as a
+// pattern before its first zone is added or a zone that was deleted, guards
+// nothing instead of failing every request.
+func (g *Generator) guardedZones(ctx context.Context, name string) ([]string, error) {
+	entries := g.zoneGroups[name]
+	var zones []Zone
+	if slices.ContainsFunc(entries, func(e string) bool { return !zoneIDPattern.MatchString(e) }) {
+		var err error
+		if zones, err = g.DiscoverZones(ctx); err != nil {
+			return nil, fmt.Errorf("zone group %q: listing zones: %w", name, err)
+		}
+	}
+	var ids []string
+	for _, entry := range entries {
+		matched, err := matchZones([]string{entry}, zones)
+		if errors.Is(err, errNoZonesMatch) || errors.Is(err, errZoneNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("zone group %q: %w", name, err)
+		}
+		for _, z := range matched {
+			ids = append(ids, z.ID)
+		}
+	}
+	return ids, nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
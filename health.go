@@ -0,0 +1,84 @@
+package cftoken
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultReadinessCache is how long ReadinessHandler reuses a check's
+// result when no other duration is given.
+const DefaultReadinessCache = 30 * time.Second
+
+// LivenessHandler returns a handler for a liveness probe. It answers 200
+// {"status": "ok"} whenever the process can serve requests, and never calls
+// Cloudflare, so a Cloudflare outage doesn't get the process restarted.
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, "ok", nil)
+	})
+}
+
+// ReadinessHandler returns a handler for a readiness probe. It answers 200
+// {"status": "ready"} while the parent credentials verify, which also shows
+// the Cloudflare API is reachable, and the inventory in the state directory
+// can be read, and every extra check passes, such as a WebhookStore's Ping;
+// otherwise 503 {"status": "not ready", "error": "..."}. A result, good or
+// bad, is reused for cacheFor (DefaultReadinessCache if zero), so frequent
+// probes don't spend the parent token's rate limit.
+func (g *Generator) ReadinessHandler(cacheFor time.Duration, checks ...func(context.Context) error) http.Handler {
+	if cacheFor <= 0 {
+		cacheFor = DefaultReadinessCache
+	}
+	var (
+		mu      sync.Mutex
+		checked time.Time
+		lastErr error
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if time.Since(checked) >= cacheFor {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+			lastErr = g.ready(ctx, checks)
+			cancel()
+			checked = time.Now()
+		}
+		err := lastErr
+		mu.Unlock()
+		if err != nil {
+			writeHealth(w, http.StatusServiceUnavailable, "not ready", err)
+			return
+		}
+		writeHealth(w, http.StatusOK, "ready", nil)
+	})
+}
+
+// ready runs the checks behind ReadinessHandler.
+func (g *Generator) ready(ctx context.Context, checks []func(context.Context) error) error {
+	if err := g.Verify(ctx); err != nil {
+		return err
+	}
+	if _, err := LoadInventory(); err != nil {
+		return fmt.Errorf("state directory: %w", err)
+	}
+	for _, check := range checks {
+		if err := check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, status int, state string, err error) {
+	body := map[string]string{"status": state}
+	if err != nil {
+		body["error"] = err.Error()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,293 @@
+package cftoken
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// httpBackendBaseURL is the Cloudflare API root the HTTP backend calls.
+const httpBackendBaseURL = "https://" + transportHost + "/client/v4"
+
+// httpBackendRetries is how many times a rate-limited or failed request is
+// retried, with the delay doubling from a second each time.
+const httpBackendRetries = 3
+
+// httpBackend is a Backend that calls the Cloudflare REST API directly with
+// net/http, covering only the token, permission group, zone, account, and
+// user endpoints the Generator uses.
+type httpBackend struct {
+	client  *http.Client
+	baseURL string
+	auth    http.Header
+}
+
+// NewHTTPBackend is New with a small net/http client in place of
+// cloudflare-go's, for binaries that don't want its request machinery. It
+// retries rate limits and server errors but, unlike cloudflare-go, doesn't
+// throttle requests client-side. Built with the nocloudflarego tag, New
+// uses it too and cloudflare-go isn't linked at all.
+func NewHTTPBackend(cfg Config) (*Generator, error) {
+	return newGenerator(cfg, newHTTPBackend)
+}
+
+func newHTTPBackend(cfg Config, client *http.Client) (Backend, error) {
+	auth := make(http.Header)
+	if cfg.AuthType == AuthTypeAPIKey {
+		if cfg.APIKey == "" || cfg.Email == "" {
+			return nil, errors.New("invalid credentials: key & email must not be empty")
+		}
+		auth.Set("X-Auth-Key", cfg.APIKey)
+		auth.Set("X-Auth-Email", cfg.Email)
+	} else {
+		if cfg.APIToken == "" {
+			return nil, errors.New("invalid credentials: API Token must not be empty")
+		}
+		auth.Set("Authorization", "Bearer "+cfg.APIToken)
+	}
+	return &httpBackend{client: client, baseURL: httpBackendBaseURL, auth: auth}, nil
+}
+
+// envelope is the standard Cloudflare API response wrapper.
+type envelope struct {
+	Success    bool            `json:"success"`
+	Errors     []responseInfo  `json:"errors"`
+	Messages   []responseInfo  `json:"messages"`
+	Result     json.RawMessage `json:"result"`
+	ResultInfo *ResultInfo     `json:"result_info,omitempty"`
+}
+
+// responseInfo is an error or message in an envelope.
+type responseInfo struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// do sends a request and decodes the response envelope. API errors are
+// returned as *ResponseError.
+func (b *httpBackend) do(ctx context.Context, method, endpoint string, data interface{}, headers http.Header) (envelope, error) {
+	var body []byte
+	if data != nil {
+		var err error
+		if body, err = json.Marshal(data); err != nil {
+			return envelope{}, err
+		}
+	}
+
+	var resp *http.Response
+	var respBody []byte
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, b.baseURL+endpoint, bytes.NewReader(body))
+		if err != nil {
+			return envelope{}, err
+		}
+		for k, v := range b.auth {
+			req.Header[k] = v
+		}
+		for k, v := range headers {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "cloudflare-token-generator")
+
+		resp, err = b.client.Do(req)
+		if err == nil {
+			respBody, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		// A failed POST may still have created a token, so only rate limits,
+		// which Cloudflare rejects before doing anything, are safe to retry.
+		retry := err == nil && resp.StatusCode == http.StatusTooManyRequests ||
+			method != http.MethodPost && (err != nil || resp.StatusCode >= http.StatusInternalServerError)
+		if !retry || attempt == httpBackendRetries {
+			if err != nil {
+				return envelope{}, fmt.Errorf("%s %s: %w", method, endpoint, err)
+			}
+			break
+		}
+		delay := time.Second << attempt
+		if resp != nil {
+			if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && secs > 0 && secs <= 30 {
+				delay = time.Duration(secs) * time.Second
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return envelope{}, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	respErr := &ResponseError{StatusCode: resp.StatusCode, RayID: resp.Header.Get("cf-ray")}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		respErr.Messages = []string{"internal server error"}
+		return envelope{}, respErr
+	}
+	var env envelope
+	if err := json.Unmarshal(respBody, &env); err != nil {
+		return envelope{}, fmt.Errorf("%s %s: decoding response: %w", method, endpoint, err)
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return env, nil
+	}
+	for _, e := range env.Errors {
+		respErr.Codes = append(respErr.Codes, e.Code)
+		respErr.Messages = append(respErr.Messages, e.Message)
+	}
+	return envelope{}, respErr
+}
+
+// call calls endpoint and decodes its result into out.
+func (b *httpBackend) call(ctx context.Context, method, endpoint string, data, out interface{}) (*ResultInfo, error) {
+	env, err := b.do(ctx, method, endpoint, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if out != nil && len(env.Result) > 0 {
+		if err := json.Unmarshal(env.Result, out); err != nil {
+			return nil, fmt.Errorf("%s %s: decoding result: %w", method, endpoint, err)
+		}
+	}
+	return env.ResultInfo, nil
+}
+
+func (b *httpBackend) APITokens(ctx context.Context) ([]APIToken, error) {
+	var tokens []APIToken
+	_, err := b.call(ctx, http.MethodGet, "/user/tokens", nil, &tokens)
+	return tokens, err
+}
+
+func (b *httpBackend) GetAPIToken(ctx context.Context, tokenID string) (APIToken, error) {
+	var token APIToken
+	_, err := b.call(ctx, http.MethodGet, "/user/tokens/"+url.PathEscape(tokenID), nil, &token)
+	return token, err
+}
+
+func (b *httpBackend) CreateAPIToken(ctx context.Context, token APIToken) (APIToken, error) {
+	var created APIToken
+	_, err := b.call(ctx, http.MethodPost, "/user/tokens", token, &created)
+	return created, err
+}
+
+func (b *httpBackend) UpdateAPIToken(ctx context.Context, tokenID string, token APIToken) (APIToken, error) {
+	var updated APIToken
+	_, err := b.call(ctx, http.MethodPut, "/user/tokens/"+url.PathEscape(tokenID), token, &updated)
+	return updated, err
+}
+
+func (b *httpBackend) RollAPIToken(ctx context.Context, tokenID string) (string, error) {
+	var value string
+	_, err := b.call(ctx, http.MethodPut, "/user/tokens/"+url.PathEscape(tokenID)+"/value", struct{}{}, &value)
+	return value, err
+}
+
+func (b *httpBackend) DeleteAPIToken(ctx context.Context, tokenID string) error {
+	_, err := b.call(ctx, http.MethodDelete, "/user/tokens/"+url.PathEscape(tokenID), nil, nil)
+	return err
+}
+
+func (b *httpBackend) VerifyAPIToken(ctx context.Context) (TokenStatus, error) {
+	var verified TokenStatus
+	_, err := b.call(ctx, http.MethodGet, "/user/tokens/verify", nil, &verified)
+	return verified, err
+}
+
+func (b *httpBackend) ListAPITokensPermissionGroups(ctx context.Context) ([]policy.PermissionGroup, error) {
+	var groups []policy.PermissionGroup
+	_, err := b.call(ctx, http.MethodGet, "/user/tokens/permission_groups", nil, &groups)
+	return groups, err
+}
+
+// ListZones lists every zone, or just the zones with the given names.
+func (b *httpBackend) ListZones(ctx context.Context, z ...string) ([]Zone, error) {
+	var zones []Zone
+	for _, name := range z {
+		var page []Zone
+		if _, err := b.call(ctx, http.MethodGet, "/zones?"+url.Values{"name": {name}}.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		zones = append(zones, page...)
+	}
+	if len(z) > 0 {
+		return zones, nil
+	}
+	for n := 1; ; n++ {
+		var page []Zone
+		q := url.Values{"page": {strconv.Itoa(n)}, "per_page": {"50"}}
+		info, err := b.call(ctx, http.MethodGet, "/zones?"+q.Encode(), nil, &page)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, page...)
+		if info == nil || n >= info.TotalPages || len(page) == 0 {
+			return zones, nil
+		}
+	}
+}
+
+func (b *httpBackend) Accounts(ctx context.Context, params AccountsParams) ([]Account, ResultInfo, error) {
+	q := pageQuery(params.PageOptions)
+	if params.Name != "" {
+		q.Set("name", params.Name)
+	}
+	var accounts []Account
+	info, err := b.call(ctx, http.MethodGet, "/accounts?"+q.Encode(), nil, &accounts)
+	return accounts, resultInfo(info), err
+}
+
+func (b *httpBackend) Account(ctx context.Context, accountID string) (Account, ResultInfo, error) {
+	var account Account
+	info, err := b.call(ctx, http.MethodGet, "/accounts/"+url.PathEscape(accountID), nil, &account)
+	return account, resultInfo(info), err
+}
+
+func (b *httpBackend) AccountMembers(ctx context.Context, accountID string, pageOpts PageOptions) ([]AccountMember, ResultInfo, error) {
+	if accountID == "" {
+		return nil, ResultInfo{}, errors.New("account ID required")
+	}
+	var members []AccountMember
+	endpoint := "/accounts/" + url.PathEscape(accountID) + "/members?" + pageQuery(pageOpts).Encode()
+	info, err := b.call(ctx, http.MethodGet, endpoint, nil, &members)
+	return members, resultInfo(info), err
+}
+
+func (b *httpBackend) UserDetails(ctx context.Context) (User, error) {
+	var user User
+	_, err := b.call(ctx, http.MethodGet, "/user", nil, &user)
+	return user, err
+}
+
+func (b *httpBackend) Raw(ctx context.Context, method, endpoint string, data interface{}, headers http.Header) (RawResponse, error) {
+	env, err := b.do(ctx, method, endpoint, data, headers)
+	if err != nil {
+		return RawResponse{}, err
+	}
+	return RawResponse{Result: env.Result, ResultInfo: env.ResultInfo}, nil
+}
+
+func pageQuery(opts PageOptions) url.Values {
+	q := url.Values{}
+	if opts.Page > 0 {
+		q.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.PerPage > 0 {
+		q.Set("per_page", strconv.Itoa(opts.PerPage))
+	}
+	return q
+}
+
+func resultInfo(info *ResultInfo) ResultInfo {
+	if info == nil {
+		return ResultInfo{}
+	}
+	return *info
+}
@@ -0,0 +1,47 @@
+package cftoken
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// newHTTPClient builds the HTTP client for all Cloudflare API calls. Proxies
+// come from ProxyURL if set, otherwise from HTTPS_PROXY and NO_PROXY. A
+// CACertPath bundle is trusted in addition to the system roots, for
+// TLS-intercepting corporate proxies.
+func newHTTPClient(cfg Config) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	// Batches and the webhook make many concurrent requests to one host;
+	// keep their connections instead of the default two.
+	transport.MaxIdleConnsPerHost = 32
+
+	if cfg.ProxyURL != "" {
+		u, err := url.Parse(cfg.ProxyURL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy_url %q", cfg.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.CACertPath != "" {
+		pem, err := os.ReadFile(cfg.CACertPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca_cert_path: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", cfg.CACertPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
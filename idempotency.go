@@ -0,0 +1,81 @@
+package cftoken
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// idempotencySep separates a token's name from its idempotency key.
+const idempotencySep = " #"
+
+// idempotentRetries is how many more times an ambiguous create is retried
+// after checking that the token wasn't created.
+const idempotentRetries = 2
+
+// WithIdempotencyKey appends " #<key>" to the token name, so a create that
+// fails without a definite answer from Cloudflare (a timeout, a dropped
+// connection, a server error) can be checked for: the parent's tokens are
+// searched for the name, and a token found there is rolled and returned
+// instead of creating a second one. Otherwise the create is retried. An
+// empty key picks a random one.
+//
+// A caller retrying a whole request with the same key gets the same name,
+// so WithIfExists(IfExistsSkip) or IfExistsRoll also work across processes.
+func WithIdempotencyKey(key string) Option {
+	return func(o *tokenOptions) {
+		if key == "" {
+			b := make([]byte, 6)
+			rand.Read(b)
+			key = hex.EncodeToString(b)
+		}
+		o.idempotencyKey = key
+	}
+}
+
+// trimIdempotencyKey returns name without the suffix added by
+// WithIdempotencyKey.
+func trimIdempotencyKey(name string) string {
+	if i := strings.LastIndex(name, idempotencySep); i >= 0 && !strings.Contains(name[i+len(idempotencySep):], " ") {
+		return name[:i]
+	}
+	return name
+}
+
+// ambiguousCreate reports whether a failed create may still have created the
+// token: anything but an error response from Cloudflare other than a server
+// error.
+func ambiguousCreate(err error) bool {
+	var resp *ResponseError
+	return !errors.As(err, &resp) || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// createIdempotent creates token with p, and after an ambiguous failure
+// looks for a token with its name before trying again. A token that was
+// created without its value reaching us is rolled for a new one.
+func (g *Generator) createIdempotent(ctx context.Context, p *parent, token APIToken) (APIToken, error) {
+	result, err := p.api.CreateAPIToken(ctx, token)
+	for attempt := 0; err != nil && ambiguousCreate(err) && attempt < idempotentRetries && ctx.Err() == nil; attempt++ {
+		tokens, lerr := p.api.APITokens(ctx)
+		if lerr != nil {
+			return APIToken{}, fmt.Errorf("%w; could not check whether token %q was created: %v", err, token.Name, lerr)
+		}
+		for _, t := range tokens {
+			if t.Name != token.Name {
+				continue
+			}
+			value, rerr := p.api.RollAPIToken(ctx, t.ID)
+			if rerr != nil {
+				return APIToken{}, fmt.Errorf("%w; token %s was created but could not be rolled for its value: %v", err, t.ID, rerr)
+			}
+			t.Value = value
+			return t, nil
+		}
+		result, err = p.api.CreateAPIToken(ctx, token)
+	}
+	return result, err
+}
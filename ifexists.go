@@ -0,0 +1,132 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+)
+
+// IfExists selects what happens when a token with the requested name already
+// exists.
+type IfExists string
+
+const (
+	// IfExistsCreate always creates a new token, even if the name is taken.
+	IfExistsCreate IfExists = ""
+	// IfExistsSkip leaves the existing token alone and returns it without a
+	// value, with Token.Existing set.
+	IfExistsSkip IfExists = "skip"
+	// IfExistsReplace creates a new token and lists the old ones in
+	// Token.Replaces, to be revoked with RevokeReplaced once the new secret is
+	// in place.
+	IfExistsReplace IfExists = "replace"
+	// IfExistsRoll updates the existing token's policies and validity in place
+	// and rolls its secret, keeping its ID.
+	IfExistsRoll IfExists = "roll"
+	// IfExistsError fails with *TokenExistsError.
+	IfExistsError IfExists = "error"
+)
+
+// ParseIfExists parses "skip", "replace", "roll", "error", or "create".
+func ParseIfExists(s string) (IfExists, error) {
+	switch m := IfExists(s); m {
+	case IfExistsSkip, IfExistsReplace, IfExistsRoll, IfExistsError:
+		return m, nil
+	case "create", IfExistsCreate:
+		return IfExistsCreate, nil
+	}
+	return "", fmt.Errorf("invalid if-exists mode %q (use skip, replace, roll, or error)", s)
+}
+
+// TokenExistsError is returned under IfExistsError when the name is taken.
+type TokenExistsError struct {
+	Name string
+	ID   string
+}
+
+func (e *TokenExistsError) Error() string {
+	return fmt.Sprintf("a token named %q already exists (%s)", e.Name, e.ID)
+}
+
+// WithIfExists sets how an existing token with the same name is handled. The
+// default, IfExistsCreate, doesn't look for one.
+func WithIfExists(mode IfExists) Option {
+	return func(o *tokenOptions) { o.ifExists = mode }
+}
+
+// tokensNamed returns the IDs of the parent's visible tokens called name.
+func (g *Generator) tokensNamed(ctx context.Context, name string) ([]string, error) {
+	list := g.api.APITokens
+	if c := batchCacheFrom(ctx); c != nil {
+		list = func(ctx context.Context) ([]APIToken, error) { return c.listTokens(ctx, "", g.api.APITokens) }
+	}
+	tokens, err := list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tokens: %w", err)
+	}
+	var ids []string
+	for _, t := range tokens {
+		if t.Name == name {
+			ids = append(ids, t.ID)
+		}
+	}
+	return ids, nil
+}
+
+// resolveExisting applies the IfExists mode before a token is created. It
+// returns a non-nil Token when no new token should be created, and the IDs of
+// tokens the new one replaces.
+func (g *Generator) resolveExisting(ctx context.Context, token APIToken, mode IfExists) (*Token, []string, error) {
+	if mode == IfExistsCreate {
+		return nil, nil, nil
+	}
+	ids, err := g.tokensNamed(ctx, token.Name)
+	if err != nil || len(ids) == 0 {
+		return nil, nil, err
+	}
+
+	switch mode {
+	case IfExistsSkip:
+		return &Token{ID: ids[0], Name: token.Name, Existing: true}, nil, nil
+	case IfExistsError:
+		return nil, nil, &TokenExistsError{Name: token.Name, ID: ids[0]}
+	case IfExistsReplace:
+		return nil, ids, nil
+	case IfExistsRoll:
+		if len(ids) > 1 {
+			return nil, nil, fmt.Errorf("cannot roll: %d tokens are named %q", len(ids), token.Name)
+		}
+		updated, err := g.api.UpdateAPIToken(ctx, ids[0], token)
+		if err != nil {
+			return nil, nil, explainAPIError("updating token "+ids[0], err)
+		}
+		value, err := g.api.RollAPIToken(ctx, ids[0])
+		if err != nil {
+			return nil, nil, explainAPIError("rolling token "+ids[0], err)
+		}
+		if len(updated.Policies) == 0 {
+			updated.Policies = token.Policies
+		}
+		return &Token{
+			ID:        ids[0],
+			Name:      token.Name,
+			Value:     value,
+			Policies:  updated.Policies,
+			Condition: token.Condition,
+			NotBefore: token.NotBefore,
+			ExpiresOn: token.ExpiresOn,
+			Rolled:    true,
+		}, nil, nil
+	}
+	return nil, nil, fmt.Errorf("invalid if-exists mode %q", mode)
+}
+
+// RevokeReplaced deletes the tokens t replaces under IfExistsReplace. Call it
+// once t's secret has been stored wherever it is needed.
+func (g *Generator) RevokeReplaced(ctx context.Context, t *Token) error {
+	for _, id := range t.Replaces {
+		if err := g.RevokeToken(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
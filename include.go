@@ -0,0 +1,176 @@
+package cftoken
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Includes lists shared config sources merged under the local config. In
+// YAML it is either a list or a single source string.
+type Includes []string
+
+// UnmarshalYAML accepts a single string as a one-entry list.
+func (in *Includes) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*in = Includes{node.Value}
+		return nil
+	}
+	var sources []string
+	if err := node.Decode(&sources); err != nil {
+		return err
+	}
+	*in = sources
+	return nil
+}
+
+// includeTimeout bounds fetching one include source.
+const includeTimeout = 15 * time.Second
+
+// resolveIncludes merges each include source under c: presets, zone groups,
+// guardrails, and other shared settings from the source apply only where c
+// has none of its own (see MergeShared). Credentials in a source are
+// ignored, as are its own includes. Fetched sources are cached next to the
+// config and the cached copy is used when a source can't be fetched.
+func (c *Config) resolveIncludes() error {
+	for _, source := range c.Include {
+		data, err := fetchInclude(*c, source)
+		if err != nil {
+			return fmt.Errorf("include %s: %w", source, err)
+		}
+		var shared Config
+		if err := yaml.Unmarshal(data, &shared); err != nil {
+			return fmt.Errorf("include %s: %w", source, err)
+		}
+		c.MergeShared(shared.WithoutSecrets(), false)
+	}
+	return nil
+}
+
+// fetchInclude reads an include source, which is one of:
+//
+//	https://host/path.yaml                       fetched over HTTPS
+//	git+<repo-url>//<path>[?ref=<branch-or-tag>]  read from a shallow clone
+//	<path>                                       a local file, relative to the config directory
+func fetchInclude(cfg Config, source string) ([]byte, error) {
+	var fetch func() ([]byte, error)
+	switch {
+	case strings.HasPrefix(source, "git+"):
+		fetch = func() ([]byte, error) { return fetchGitInclude(strings.TrimPrefix(source, "git+")) }
+	case strings.HasPrefix(source, "https://"):
+		fetch = func() ([]byte, error) { return fetchHTTPSInclude(cfg, source) }
+	case strings.Contains(source, "://"):
+		return nil, fmt.Errorf("unsupported source; use https://, git+, or a file path")
+	default:
+		path := source
+		if !filepath.IsAbs(path) {
+			configPath, err := ConfigPath()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(filepath.Dir(configPath), path)
+		}
+		return os.ReadFile(path)
+	}
+
+	cache, cacheErr := includeCachePath(source)
+	data, err := fetch()
+	if err != nil {
+		if cacheErr == nil {
+			if cached, rerr := os.ReadFile(cache); rerr == nil {
+				return cached, nil
+			}
+		}
+		return nil, err
+	}
+	if cacheErr == nil && os.MkdirAll(filepath.Dir(cache), 0700) == nil {
+		_ = os.WriteFile(cache, data, 0600)
+	}
+	return data, nil
+}
+
+// includeCachePath returns where the last fetched copy of source is kept.
+func includeCachePath(source string) (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(dir, "include-cache", hex.EncodeToString(sum[:8])+".yaml"), nil
+}
+
+func fetchHTTPSInclude(cfg Config, source string) ([]byte, error) {
+	client, err := newHTTPClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), includeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// fetchGitInclude reads a file from a git repository, given as
+// <repo-url>//<path>[?ref=<ref>].
+func fetchGitInclude(spec string) ([]byte, error) {
+	ref := ""
+	if i := strings.LastIndex(spec, "?ref="); i >= 0 {
+		spec, ref = spec[:i], spec[i+len("?ref="):]
+	}
+	start := 0
+	if i := strings.Index(spec, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	i := strings.Index(spec[start:], "//")
+	if i < 0 {
+		return nil, fmt.Errorf("missing //<path> after the repository URL")
+	}
+	repo, file := spec[:start+i], spec[start+i+2:]
+	if _, err := url.Parse(repo); err != nil || file == "" {
+		return nil, fmt.Errorf("invalid git source")
+	}
+
+	dir, err := os.MkdirTemp("", "cftoken-include-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), includeTimeout)
+	defer cancel()
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repo, dir)
+	if out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("git clone: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	path := filepath.Join(dir, filepath.FromSlash(file))
+	if rel, err := filepath.Rel(dir, path); err != nil || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("path %q is outside the repository", file)
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,298 @@
+// Command generate builds services.go from the live Cloudflare permission
+// groups and a service mapping spec.
+//
+// It reads an API token from CLOUDFLARE_API_TOKEN, fetches
+// /user/tokens/permission_groups, resolves each permission group named in the
+// spec to its ID, and writes a formatted Go file containing the service
+// catalog. Run it via `go generate` from the repository root, or directly to
+// build a custom catalog:
+//
+//	CLOUDFLARE_API_TOKEN=... go run ./internal/generate -spec my-services.yaml -out my_services.go -package mypkg
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+const permissionGroupsURL = "https://api.cloudflare.com/client/v4/user/tokens/permission_groups"
+
+// spec is the service mapping file format.
+type spec struct {
+	Services []specService `yaml:"services"`
+}
+
+type specService struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Scope       string   `yaml:"scope"`
+	Deprecated  bool     `yaml:"deprecated"`
+	ReplacedBy  string   `yaml:"replaced_by"`
+	Plan        string   `yaml:"plan"`
+	Permissions []string `yaml:"permissions"`
+}
+
+type permissionGroup struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type permission struct {
+	ID   string
+	Name string
+}
+
+type service struct {
+	Key         string
+	Name        string
+	Description string
+	Scope       string
+	Deprecated  bool
+	ReplacedBy  string
+	Plan        string
+	Permissions []permission
+}
+
+func main() {
+	specPath := flag.String("spec", "internal/generate/services.yaml", "service mapping spec")
+	outPath := flag.String("out", "services.go", "output file")
+	pkg := flag.String("package", "cftoken", "package name of the generated file")
+	varName := flag.String("var", "Services", "name of the generated catalog variable")
+	endpoint := flag.String("endpoint", permissionGroupsURL, "permission groups endpoint")
+	flag.Parse()
+
+	if err := run(*specPath, *outPath, *pkg, *varName, *endpoint); err != nil {
+		fmt.Fprintf(os.Stderr, "generate: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(specPath, outPath, pkg, varName, endpoint string) error {
+	token := os.Getenv("CLOUDFLARE_API_TOKEN")
+	if token == "" {
+		return fmt.Errorf("CLOUDFLARE_API_TOKEN must be set")
+	}
+
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		return err
+	}
+	var s spec
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("parsing %s: %w", specPath, err)
+	}
+
+	groups, err := fetchPermissionGroups(endpoint, token)
+	if err != nil {
+		return err
+	}
+	// Some names, such as "Logs Read", exist at both zone and account scope.
+	byName := make(map[string][]permissionGroup, len(groups))
+	for _, g := range groups {
+		byName[g.Name] = append(byName[g.Name], g)
+	}
+
+	services, err := resolve(s, byName)
+	if err != nil {
+		return err
+	}
+
+	src, err := render(services, specPath, pkg, varName)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(outPath, src, 0644)
+}
+
+func fetchPermissionGroups(endpoint, token string) ([]permissionGroup, error) {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching permission groups: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Result  []permissionGroup `json:"result"`
+		Success bool              `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decoding permission groups: %w", err)
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("API returned success=false (HTTP %d)", resp.StatusCode)
+	}
+	return result.Result, nil
+}
+
+// resolve maps each spec service's permission group names to IDs and derives
+// the resource scope from the permission groups when the spec omits it. A name
+// shared by zone and account permission groups resolves to the one matching
+// the service's scope.
+func resolve(s spec, byName map[string][]permissionGroup) ([]service, error) {
+	seen := make(map[string]bool)
+	var services []service
+	for _, ss := range s.Services {
+		if ss.Name == "" {
+			return nil, fmt.Errorf("spec contains a service without a name")
+		}
+		if seen[ss.Name] {
+			return nil, fmt.Errorf("duplicate service %q in spec", ss.Name)
+		}
+		seen[ss.Name] = true
+
+		svc := service{
+			Key:         ss.Name,
+			Name:        ss.Name,
+			Description: ss.Description,
+			Scope:       ss.Scope,
+			Deprecated:  ss.Deprecated,
+			ReplacedBy:  ss.ReplacedBy,
+			Plan:        ss.Plan,
+		}
+		for _, name := range ss.Permissions {
+			g, err := pick(byName[name], svc.Scope)
+			if err != nil {
+				return nil, fmt.Errorf("service %q: permission group %q %v", ss.Name, name, err)
+			}
+			if svc.Scope == "" {
+				svc.Scope = deriveScope(g.Scopes)
+			}
+			svc.Permissions = append(svc.Permissions, permission{ID: g.ID, Name: g.Name})
+		}
+		if svc.Scope != "zone" && svc.Scope != "account" {
+			return nil, fmt.Errorf("service %q: cannot determine scope, set it in the spec", ss.Name)
+		}
+		switch svc.Plan {
+		case "", "pro", "business", "enterprise":
+		default:
+			return nil, fmt.Errorf("service %q: unknown plan %q (use pro, business, or enterprise)", ss.Name, svc.Plan)
+		}
+		services = append(services, svc)
+	}
+	return services, nil
+}
+
+// pick chooses the permission group for scope among groups sharing a name.
+func pick(groups []permissionGroup, scope string) (permissionGroup, error) {
+	switch {
+	case len(groups) == 0:
+		return permissionGroup{}, fmt.Errorf("not found")
+	case len(groups) == 1:
+		return groups[0], nil
+	case scope == "":
+		return permissionGroup{}, fmt.Errorf("exists at several scopes, set the service's scope in the spec")
+	}
+	for _, g := range groups {
+		if deriveScope(g.Scopes) == scope {
+			return g, nil
+		}
+	}
+	return permissionGroup{}, fmt.Errorf("not found at %s scope", scope)
+}
+
+func deriveScope(scopes []string) string {
+	for _, s := range scopes {
+		if strings.Contains(s, "zone") {
+			return "zone"
+		}
+		if strings.Contains(s, "account") {
+			return "account"
+		}
+	}
+	return ""
+}
+
+var fileTemplate = template.Must(template.New("services").Funcs(template.FuncMap{
+	"title": func(s string) string { return strings.ToUpper(s[:1]) + s[1:] },
+}).Parse(`// Code generated by internal/generate from {{.Spec}}; DO NOT EDIT.
+
+package {{.Package}}
+{{if .Qualifier}}
+import cftoken "github.com/jackmunro/cloudflare-token-generator"
+{{end}}
+// {{.Var}} maps service keys to their definitions.
+var {{.Var}} = map[string]{{.Qualifier}}Service{
+{{- range $i, $group := .Groups}}
+{{- if $i}}
+{{end}}
+	// {{title $group.Scope}}-scoped services
+{{- range $group.Services}}
+	{{printf "%q" .Key}}: {
+		Name:          {{printf "%q" .Name}},
+		Description:   {{printf "%q" .Description}},
+		ResourceScope: {{$.Qualifier}}ResourceScope{{title .Scope}},
+{{- if .Deprecated}}
+		Deprecated:    true,
+{{- end}}
+{{- if .ReplacedBy}}
+		ReplacedBy:    {{printf "%q" .ReplacedBy}},
+{{- end}}
+{{- if .Plan}}
+		Plan:          {{printf "%q" .Plan}},
+{{- end}}
+		Permissions: []{{$.Qualifier}}Permission{
+{{- range .Permissions}}
+			{ID: {{printf "%q" .ID}}, Name: {{printf "%q" .Name}}},
+{{- end}}
+		},
+	},
+{{- end}}
+{{- end}}
+}
+`))
+
+type group struct {
+	Scope    string
+	Services []service
+}
+
+// render emits the catalog with zone-scoped services first, then
+// account-scoped services, each in spec order.
+func render(services []service, specPath, pkg, varName string) ([]byte, error) {
+	var groups []group
+	for _, scope := range []string{"zone", "account"} {
+		g := group{Scope: scope}
+		for _, svc := range services {
+			if svc.Scope == scope {
+				g.Services = append(g.Services, svc)
+			}
+		}
+		if len(g.Services) > 0 {
+			groups = append(groups, g)
+		}
+	}
+
+	qualifier := ""
+	if pkg != "cftoken" {
+		qualifier = "cftoken."
+	}
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, map[string]interface{}{
+		"Spec":      specPath,
+		"Package":   pkg,
+		"Qualifier": qualifier,
+		"Var":       varName,
+		"Groups":    groups,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
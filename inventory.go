@@ -0,0 +1,205 @@
+package cftoken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// InventoryEntry records a token created by this tool.
+type InventoryEntry struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Services  []string   `json:"services,omitempty"`
+	Scope     string     `json:"scope,omitempty"`
+	Level     string     `json:"level,omitempty"`
+	Sink      string     `json:"sink,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+
+	CatalogVersion string `json:"catalog_version,omitempty"`
+	// Provenance is where the token was created, if recorded.
+	Provenance *Provenance `json:"provenance,omitempty"`
+	// Requester is who the token was created for, if known.
+	Requester string `json:"requester,omitempty"`
+
+	// Status is the token's state as of SyncedAt, one of the Inventory*
+	// statuses; empty if the entry has never been synced.
+	Status   string     `json:"status,omitempty"`
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+}
+
+// Inventory entry statuses recorded by SyncInventory.
+const (
+	InventoryActive   = "active"
+	InventoryDisabled = "disabled"
+	InventoryExpired  = "expired"
+	// InventoryRevoked marks tokens that no longer exist in the account.
+	InventoryRevoked = "revoked"
+)
+
+// Inventory is the local record of tokens created by this tool, kept so
+// they can be found again even when their names don't follow the tagging
+// convention.
+type Inventory struct {
+	Tokens []InventoryEntry `json:"tokens"`
+
+	path string
+}
+
+// InventoryPath returns the path of the local token inventory, in the state
+// directory.
+func InventoryPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "inventory.json"), nil
+}
+
+// LoadInventory reads the local inventory. A missing file is an empty
+// inventory.
+func LoadInventory() (*Inventory, error) {
+	path, err := InventoryPath()
+	if err != nil {
+		return nil, err
+	}
+	inv := &Inventory{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return inv, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, inv); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return inv, nil
+}
+
+// UpdateInventory loads the inventory, applies update, and saves the result,
+// holding a lock on the inventory file throughout so that concurrent
+// updates, from this process or another, don't overwrite each other.
+// Nothing is saved if update returns an error.
+func UpdateInventory(update func(inv *Inventory) error) error {
+	path, err := InventoryPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("locking inventory: %w", err)
+	}
+	defer unlock()
+	inv, err := LoadInventory()
+	if err != nil {
+		return err
+	}
+	if err := update(inv); err != nil {
+		return err
+	}
+	return inv.Save()
+}
+
+// Save writes the inventory back with mode 0600, replacing the file in one
+// step so readers never see it half written. Use UpdateInventory to change
+// the inventory on disk; Save alone can lose concurrent updates.
+func (inv *Inventory) Save() error {
+	if inv.path == "" {
+		path, err := InventoryPath()
+		if err != nil {
+			return err
+		}
+		inv.path = path
+	}
+	if err := os.MkdirAll(filepath.Dir(inv.path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(inv.path), ".inventory-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), inv.path)
+}
+
+// Add records t, delivered to sink (which may be empty), replacing any entry
+// with the same ID.
+func (inv *Inventory) Add(t *Token, sink string) {
+	inv.Remove(t.ID)
+	inv.Tokens = append(inv.Tokens, newInventoryEntry(t, sink))
+}
+
+// newInventoryEntry describes t, delivered to sink, as created now.
+func newInventoryEntry(t *Token, sink string) InventoryEntry {
+	return InventoryEntry{
+		ID:        t.ID,
+		Name:      t.Name,
+		Services:  t.Services,
+		Scope:     t.Scope,
+		Level:     t.Level,
+		Sink:      sink,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ExpiresOn: t.ExpiresOn,
+
+		CatalogVersion: CatalogVersion(),
+		Provenance:     t.Provenance,
+		Requester:      t.Requester,
+	}
+}
+
+// Remove drops the entries with the given IDs.
+func (inv *Inventory) Remove(ids ...string) {
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	kept := inv.Tokens[:0]
+	for _, e := range inv.Tokens {
+		if !drop[e.ID] {
+			kept = append(kept, e)
+		}
+	}
+	inv.Tokens = kept
+}
+
+// SetExpiry updates the expiry recorded for id, reporting whether it has an
+// entry.
+func (inv *Inventory) SetExpiry(id string, at time.Time) bool {
+	for i := range inv.Tokens {
+		if inv.Tokens[i].ID == id {
+			inv.Tokens[i].ExpiresOn = &at
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the entry for id.
+func (inv *Inventory) Lookup(id string) (InventoryEntry, bool) {
+	for _, e := range inv.Tokens {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return InventoryEntry{}, false
+}
@@ -0,0 +1,37 @@
+package cftoken
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestUpdateInventoryConcurrent checks that concurrent updates each see the
+// others' entries rather than overwriting them.
+func TestUpdateInventoryConcurrent(t *testing.T) {
+	t.Setenv("CFTG_STATE_DIR", t.TempDir())
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := UpdateInventory(func(inv *Inventory) error {
+				inv.Add(&Token{ID: fmt.Sprintf("token-%d", i)}, "")
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	inv, err := LoadInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inv.Tokens) != n {
+		t.Errorf("inventory has %d entries, want %d", len(inv.Tokens), n)
+	}
+}
@@ -0,0 +1,415 @@
+package cftoken
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// InventoryQuery is a parsed filter over inventory entries, e.g.
+//
+//	services contains 'dns' and created > now()-30d
+//
+// Comparisons are joined with and, or, and not, and grouped with
+// parentheses. String fields (id, name, scope, level, sink, status,
+// requester, catalog_version, commit, host, job, manifest) support =, !=,
+// contains, and ~ (a glob). The services list supports contains, = and !=
+// (on any element), and ~. Time fields (created, expires, synced) support
+// = != < <= > >= against now(), now()±duration (30d, 12h, 90m), a date such
+// as '2026-01-31', or none for an unset time. Values may be quoted with ' or
+// ", or left bare if they are a single word.
+type InventoryQuery struct {
+	src  string
+	root queryNode
+}
+
+// ParseInventoryQuery parses a query. An empty query matches everything.
+func ParseInventoryQuery(s string) (*InventoryQuery, error) {
+	toks, err := lexQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	q := &InventoryQuery{src: s}
+	if len(toks) == 0 {
+		return q, nil
+	}
+	p := &queryParser{toks: toks}
+	if q.root, err = p.or(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.toks[p.pos].text, p.toks[p.pos].at)
+	}
+	return q, nil
+}
+
+func (q *InventoryQuery) String() string { return q.src }
+
+// Match reports whether e satisfies the query, with relative times taken
+// from now.
+func (q *InventoryQuery) Match(e InventoryEntry, now time.Time) bool {
+	return q.root == nil || q.root.match(&e, now)
+}
+
+// Query returns the entries matching q, in inventory order.
+func (inv *Inventory) Query(q *InventoryQuery) []InventoryEntry {
+	now := time.Now()
+	var matched []InventoryEntry
+	for _, e := range inv.Tokens {
+		if q.Match(e, now) {
+			matched = append(matched, e)
+		}
+	}
+	return matched
+}
+
+type queryNode interface {
+	match(e *InventoryEntry, now time.Time) bool
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ inner queryNode }
+
+func (n andNode) match(e *InventoryEntry, now time.Time) bool {
+	return n.left.match(e, now) && n.right.match(e, now)
+}
+
+func (n orNode) match(e *InventoryEntry, now time.Time) bool {
+	return n.left.match(e, now) || n.right.match(e, now)
+}
+
+func (n notNode) match(e *InventoryEntry, now time.Time) bool { return !n.inner.match(e, now) }
+
+type fieldKind int
+
+const (
+	stringField fieldKind = iota
+	listField
+	timeField
+)
+
+type queryField struct {
+	kind fieldKind
+	str  func(e *InventoryEntry) string
+	list func(e *InventoryEntry) []string
+	time func(e *InventoryEntry) *time.Time
+}
+
+func provenanceField(get func(p *Provenance) string) queryField {
+	return queryField{kind: stringField, str: func(e *InventoryEntry) string {
+		if e.Provenance == nil {
+			return ""
+		}
+		return get(e.Provenance)
+	}}
+}
+
+var queryFields = map[string]queryField{
+	"id":              {kind: stringField, str: func(e *InventoryEntry) string { return e.ID }},
+	"name":            {kind: stringField, str: func(e *InventoryEntry) string { return e.Name }},
+	"scope":           {kind: stringField, str: func(e *InventoryEntry) string { return e.Scope }},
+	"level":           {kind: stringField, str: func(e *InventoryEntry) string { return e.Level }},
+	"sink":            {kind: stringField, str: func(e *InventoryEntry) string { return e.Sink }},
+	"status":          {kind: stringField, str: func(e *InventoryEntry) string { return e.Status }},
+	"requester":       {kind: stringField, str: func(e *InventoryEntry) string { return e.Requester }},
+	"catalog_version": {kind: stringField, str: func(e *InventoryEntry) string { return e.CatalogVersion }},
+	"commit":          provenanceField(func(p *Provenance) string { return p.Commit }),
+	"host":            provenanceField(func(p *Provenance) string { return p.Host }),
+	"job":             provenanceField(func(p *Provenance) string { return p.JobURL }),
+	"manifest":        provenanceField(func(p *Provenance) string { return p.Manifest }),
+	"services":        {kind: listField, list: func(e *InventoryEntry) []string { return e.Services }},
+	"created":         {kind: timeField, time: func(e *InventoryEntry) *time.Time { return &e.CreatedAt }},
+	"expires":         {kind: timeField, time: func(e *InventoryEntry) *time.Time { return e.ExpiresOn }},
+	"synced":          {kind: timeField, time: func(e *InventoryEntry) *time.Time { return e.SyncedAt }},
+}
+
+// cmpNode compares a field with a value. For time fields, value is unused
+// and the time is absolute, relative to now, or none.
+type cmpNode struct {
+	field queryField
+	op    string
+	value string
+
+	none     bool
+	relative bool
+	offset   time.Duration
+	at       time.Time
+}
+
+func (n cmpNode) match(e *InventoryEntry, now time.Time) bool {
+	switch n.field.kind {
+	case stringField:
+		return matchString(n.field.str(e), n.op, n.value)
+	case listField:
+		items := n.field.list(e)
+		if n.op == "!=" {
+			return !slices.Contains(items, n.value)
+		}
+		for _, item := range items {
+			if (n.op == "~" && matchString(item, "~", n.value)) || (n.op != "~" && item == n.value) {
+				return true
+			}
+		}
+		return false
+	}
+	t := n.field.time(e)
+	if n.none || t == nil {
+		isNone := t == nil
+		if n.op == "=" {
+			return isNone && n.none
+		}
+		return n.op == "!=" && isNone != n.none
+	}
+	want := n.at
+	if n.relative {
+		want = now.Add(n.offset)
+	}
+	switch n.op {
+	case "=":
+		return t.Equal(want)
+	case "!=":
+		return !t.Equal(want)
+	case "<":
+		return t.Before(want)
+	case "<=":
+		return !t.After(want)
+	case ">":
+		return t.After(want)
+	}
+	return !t.Before(want)
+}
+
+func matchString(s, op, value string) bool {
+	switch op {
+	case "=":
+		return s == value
+	case "!=":
+		return s != value
+	case "contains":
+		return strings.Contains(s, value)
+	}
+	ok, _ := path.Match(value, s)
+	return ok
+}
+
+type queryToken struct {
+	kind string // "word", "string", "op", "(", ")"
+	text string
+	at   int
+}
+
+func lexQuery(s string) ([]queryToken, error) {
+	var toks []queryToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, queryToken{kind: string(c), text: string(c), at: i})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			toks = append(toks, queryToken{kind: "string", text: s[i+1 : i+1+end], at: i})
+			i += end + 2
+		case (c == '+' || c == '-') && len(toks) > 0 && toks[len(toks)-1].kind == ")":
+			// Only an offset from now(); elsewhere a dash is part of a word.
+			toks = append(toks, queryToken{kind: "op", text: string(c), at: i})
+			i++
+		case strings.ContainsRune("=!<>~", rune(c)):
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' && (c == '!' || c == '<' || c == '>') {
+				op += "="
+			}
+			if op == "!" {
+				return nil, fmt.Errorf("unexpected '!' at position %d, use != or not", i)
+			}
+			toks = append(toks, queryToken{kind: "op", text: op, at: i})
+			i += len(op)
+		default:
+			start := i
+			for i < len(s) && !unicode.IsSpace(rune(s[i])) && !strings.ContainsRune("()'\"=!<>~", rune(s[i])) {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected %q at position %d", s[i], i)
+			}
+			toks = append(toks, queryToken{kind: "word", text: s[start:i], at: start})
+		}
+	}
+	return toks, nil
+}
+
+type queryParser struct {
+	toks []queryToken
+	pos  int
+}
+
+func (p *queryParser) peek() *queryToken {
+	if p.pos < len(p.toks) {
+		return &p.toks[p.pos]
+	}
+	return nil
+}
+
+func (p *queryParser) keyword(word string) bool {
+	if t := p.peek(); t != nil && t.kind == "word" && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) next(what string) (queryToken, error) {
+	t := p.peek()
+	if t == nil {
+		return queryToken{}, fmt.Errorf("expected %s at end of query", what)
+	}
+	p.pos++
+	return *t, nil
+}
+
+func (p *queryParser) or() (queryNode, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right queryNode
+		if right, err = p.and(); err == nil {
+			left = orNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) and() (queryNode, error) {
+	left, err := p.not()
+	for err == nil && p.keyword("and") {
+		var right queryNode
+		if right, err = p.not(); err == nil {
+			left = andNode{left, right}
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) not() (queryNode, error) {
+	if p.keyword("not") {
+		inner, err := p.not()
+		return notNode{inner}, err
+	}
+	if t := p.peek(); t != nil && t.kind == "(" {
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next("')'"); err != nil || t.kind != ")" {
+			return nil, fmt.Errorf("expected ')' to close the group at position %d", p.toks[p.pos-1].at)
+		}
+		return node, nil
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (queryNode, error) {
+	ft, err := p.next("a field")
+	if err != nil {
+		return nil, err
+	}
+	field, ok := queryFields[strings.ToLower(ft.text)]
+	if ft.kind != "word" || !ok {
+		return nil, fmt.Errorf("unknown field %q at position %d", ft.text, ft.at)
+	}
+	ot, err := p.next("an operator")
+	if err != nil {
+		return nil, err
+	}
+	op := ot.text
+	if ot.kind == "word" && strings.EqualFold(op, "contains") {
+		op = "contains"
+	} else if ot.kind != "op" || op == "+" || op == "-" {
+		return nil, fmt.Errorf("expected an operator after %s at position %d", ft.text, ot.at)
+	}
+
+	n := cmpNode{field: field, op: op}
+	valid := map[fieldKind][]string{
+		stringField: {"=", "!=", "contains", "~"},
+		listField:   {"=", "!=", "contains", "~"},
+		timeField:   {"=", "!=", "<", "<=", ">", ">="},
+	}[field.kind]
+	if !slices.Contains(valid, op) {
+		return nil, fmt.Errorf("%s does not support %s (use %s)", ft.text, op, strings.Join(valid, " "))
+	}
+	if field.kind == timeField {
+		return n, p.timeValue(&n)
+	}
+	vt, err := p.next("a value")
+	if err != nil {
+		return nil, err
+	}
+	if vt.kind != "word" && vt.kind != "string" {
+		return nil, fmt.Errorf("expected a value after %s %s at position %d", ft.text, op, vt.at)
+	}
+	n.value = vt.text
+	if op == "~" {
+		if _, err := path.Match(n.value, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", n.value, err)
+		}
+	}
+	return n, nil
+}
+
+// timeValue parses now(), now()±duration, none, or a date.
+func (p *queryParser) timeValue(n *cmpNode) error {
+	vt, err := p.next("a time")
+	if err != nil {
+		return err
+	}
+	switch {
+	case vt.kind == "word" && strings.EqualFold(vt.text, "none"):
+		if n.op != "=" && n.op != "!=" {
+			return fmt.Errorf("none can only be compared with = or !=")
+		}
+		n.none = true
+		return nil
+	case vt.kind == "word" && strings.EqualFold(vt.text, "now"):
+		if t, _ := p.next("("); t.kind != "(" {
+			return fmt.Errorf("expected now() at position %d", vt.at)
+		}
+		if t, _ := p.next(")"); t.kind != ")" {
+			return fmt.Errorf("expected now() at position %d", vt.at)
+		}
+		n.relative = true
+		t := p.peek()
+		if t == nil || t.kind != "op" || (t.text != "+" && t.text != "-") {
+			return nil
+		}
+		p.pos++
+		dt, err := p.next("a duration")
+		if err != nil {
+			return err
+		}
+		d, err := ParseTTL(dt.text)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q at position %d", dt.text, dt.at)
+		}
+		if t.text == "-" {
+			d = -d
+		}
+		n.offset = d
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if at, err := time.ParseInLocation(layout, vt.text, time.Local); err == nil {
+			n.at = at
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid time %q at position %d (use now(), now()-30d, none, or a date like 2026-01-31)", vt.text, vt.at)
+}
@@ -0,0 +1,95 @@
+package cftoken
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInventoryQuery(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expires := now.Add(48 * time.Hour)
+	e := InventoryEntry{
+		ID:         "4f1c",
+		Name:       "dns-example.com-edit",
+		Services:   []string{"dns", "workers"},
+		Scope:      "example.com",
+		Level:      "edit",
+		Status:     InventoryActive,
+		Requester:  "ci",
+		CreatedAt:  now.Add(-10 * 24 * time.Hour),
+		ExpiresOn:  &expires,
+		Provenance: &Provenance{Host: "runner-3"},
+	}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"", true},
+		{"level = edit", true},
+		{"level = 'read'", false},
+		{"level != read", true},
+		{`name contains "example"`, true},
+		{"name ~ 'dns-*'", true},
+		{"name ~ 'r2-*'", false},
+		{"services contains dns", true},
+		{"services = workers", true},
+		{"services != r2", true},
+		{"services != dns", false},
+		{"services ~ 'work*'", true},
+		{"host = runner-3", true},
+		{"commit = ''", true},
+		{"created > now()-30d", true},
+		{"created > now()-7d", false},
+		{"created < '2026-02-25'", true},
+		{"expires <= now()+2d", true},
+		{"expires < now()+1d", false},
+		{"expires != none", true},
+		{"synced = none", true},
+		{"level = edit and scope = other.com", false},
+		{"level = read or scope = example.com", true},
+		{"not level = read", true},
+		{"NOT (level = read OR requester = ci)", false},
+		{"(level = read or level = edit) and services contains dns", true},
+	}
+	for _, tt := range tests {
+		q, err := ParseInventoryQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseInventoryQuery(%q): %v", tt.query, err)
+			continue
+		}
+		if got := q.Match(e, now); got != tt.want {
+			t.Errorf("%q matched %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseInventoryQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"owner = me", "unknown field"},
+		{"level", "expected an operator at end"},
+		{"level read", "expected an operator"},
+		{"level =", "expected a value"},
+		{"level < edit", "does not support <"},
+		{"created contains 2026", "does not support contains"},
+		{"created > none", "none can only be compared"},
+		{"created > now", "expected now()"},
+		{"created > now()-soon", "invalid duration"},
+		{"created > yesterday", "invalid time"},
+		{"name = 'dns", "unterminated string"},
+		{"level ! edit", "use != or not"},
+		{"name ~ '[dns'", "invalid pattern"},
+		{"(level = edit", "expected ')'"},
+		{"level = edit)", `unexpected ")"`},
+		{"level = edit and", "expected a field"},
+	}
+	for _, tt := range tests {
+		_, err := ParseInventoryQuery(tt.query)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseInventoryQuery(%q) = %v, want an error containing %q", tt.query, err, tt.want)
+		}
+	}
+}
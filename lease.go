@@ -0,0 +1,126 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Lease holds a short-lived token and replaces it in the background before it
+// expires, for long-running services that want continuously rotating
+// credentials. Replaced tokens are left to expire on their own so in-flight
+// requests using them still succeed.
+type Lease struct {
+	gen      *Generator
+	services []string
+	scope    string
+	level    string
+	ttl      time.Duration
+	opts     []Option
+
+	mu      sync.RWMutex
+	current *Token
+	err     error
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Lease mints a token for services, scope, and level that lives for ttl (at
+// least a minute) and keeps a fresh one available until Close. Renewal starts
+// when a fifth of the lifetime remains; failures are retried with backoff
+// until the current token expires. ctx bounds the lease: cancelling it stops
+// renewal.
+func (g *Generator) Lease(ctx context.Context, services []string, scope, level string, ttl time.Duration, opts ...Option) (*Lease, error) {
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	l := &Lease{
+		gen:      g,
+		services: services,
+		scope:    scope,
+		level:    level,
+		ttl:      ttl,
+		opts:     opts,
+		done:     make(chan struct{}),
+	}
+	token, err := l.mint()
+	if err != nil {
+		return nil, err
+	}
+	l.current = token
+
+	ctx, l.cancel = context.WithCancel(ctx)
+	go l.renew(ctx)
+	return l, nil
+}
+
+// Token returns the current token value. It fails only once the current token
+// has expired and renewal keeps failing.
+func (l *Lease) Token() (string, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.current.ExpiresOn != nil && time.Now().After(*l.current.ExpiresOn) {
+		return "", fmt.Errorf("leased token expired: %w", l.err)
+	}
+	return l.current.Value, nil
+}
+
+// Current returns the current token, including its ID and expiry.
+func (l *Lease) Current() *Token {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.current
+}
+
+// Close stops renewal and revokes the current token.
+func (l *Lease) Close() error {
+	l.cancel()
+	<-l.done
+	l.mu.RLock()
+	id := l.current.ID
+	l.mu.RUnlock()
+	return l.gen.RevokeToken(context.Background(), id)
+}
+
+func (l *Lease) mint() (*Token, error) {
+	opts := append(append([]Option(nil), l.opts...), WithTTL(l.ttl))
+	token, err := l.gen.GenerateToken(l.services, l.scope, l.level, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("renewing leased token: %w", err)
+	}
+	return token, nil
+}
+
+func (l *Lease) renew(ctx context.Context) {
+	defer close(l.done)
+	backoff := time.Second
+	for {
+		l.mu.RLock()
+		wait := time.Until(*l.current.ExpiresOn) - l.ttl/5
+		failing := l.err != nil
+		l.mu.RUnlock()
+		if failing {
+			wait = backoff
+			if backoff < l.ttl/10 {
+				backoff *= 2
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		token, err := l.mint()
+		l.mu.Lock()
+		l.err = err
+		if err == nil {
+			l.current = token
+			backoff = time.Second
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !unix
+
+package cftoken
+
+import "sync"
+
+// fileLocks holds the locks taken by lockFile, by path.
+var (
+	fileLocksMu sync.Mutex
+	fileLocks   = map[string]*sync.Mutex{}
+)
+
+// lockFile takes an exclusive lock on path. File locks aren't supported on
+// this platform, so it only serializes goroutines in this process.
+func lockFile(path string) (unlock func(), err error) {
+	fileLocksMu.Lock()
+	mu, ok := fileLocks[path]
+	if !ok {
+		mu = &sync.Mutex{}
+		fileLocks[path] = mu
+	}
+	fileLocksMu.Unlock()
+	mu.Lock()
+	return mu.Unlock, nil
+}
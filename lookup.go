@@ -0,0 +1,33 @@
+package cftoken
+
+import "strings"
+
+// LookupPermission finds a permission group in the catalog by ID, or by name
+// ignoring case, and returns the service granting it. Several services can
+// grant the same group; the first by service name is returned, and
+// ServicesGranting lists them all.
+func LookupPermission(idOrName string) (Service, Permission, bool) {
+	for _, svc := range ListServices() {
+		for _, p := range svc.Permissions {
+			if p.ID == idOrName || strings.EqualFold(p.Name, idOrName) {
+				return svc, p, true
+			}
+		}
+	}
+	return Service{}, Permission{}, false
+}
+
+// ServicesGranting returns the names of the services granting the
+// permission group with id, sorted.
+func ServicesGranting(id string) []string {
+	var names []string
+	for _, svc := range ListServices() {
+		for _, p := range svc.Permissions {
+			if p.ID == id {
+				names = append(names, svc.Name)
+				break
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,108 @@
+package cftoken
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jackmunro/cloudflare-token-generator/timeparse"
+)
+
+// Manifest describes a set of tokens to create together.
+type Manifest struct {
+	Tokens []ManifestToken `yaml:"tokens"`
+}
+
+// ManifestToken is one token in a manifest.
+type ManifestToken struct {
+	Name     string   `yaml:"name"`
+	Services []string `yaml:"services"`
+	Scope    string   `yaml:"scope"`
+	Level    string   `yaml:"level,omitempty"`
+	TTL      string   `yaml:"ttl,omitempty"`
+	// Team and Purpose, if either is set, name the token with TaggedName
+	// instead of Name.
+	Team    string `yaml:"team,omitempty"`
+	Purpose string `yaml:"purpose,omitempty"`
+	// Sink is where the secret is delivered, e.g. "file:/run/secrets/dns".
+	// Tokens without a sink are returned to the caller.
+	Sink string `yaml:"sink,omitempty"`
+	// IfExists overrides BatchOptions.IfExists for this entry.
+	IfExists IfExists `yaml:"if_exists,omitempty"`
+	// Skip leaves the entry in the manifest without creating it.
+	Skip bool `yaml:"skip,omitempty"`
+}
+
+// LoadManifest reads a YAML manifest and checks that every entry is complete.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &m, nil
+}
+
+// Validate checks that every entry is complete and names are unique.
+func (m *Manifest) Validate() error {
+	seen := make(map[string]bool)
+	for i, t := range m.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("token %d has no name", i+1)
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("duplicate token name %q", t.Name)
+		}
+		seen[t.Name] = true
+		if len(t.Services) == 0 || t.Scope == "" {
+			return fmt.Errorf("token %q needs services and scope", t.Name)
+		}
+		if t.TTL != "" {
+			if _, err := ParseTTL(t.TTL); err != nil {
+				return fmt.Errorf("token %q: %w", t.Name, err)
+			}
+		}
+		if _, err := ParseIfExists(string(t.IfExists)); err != nil {
+			return fmt.Errorf("token %q: %w", t.Name, err)
+		}
+		if t.Sink != "" {
+			if _, err := ParseSink(t.Sink); err != nil {
+				return fmt.Errorf("token %q: %w", t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// options returns the token options for the entry.
+func (t ManifestToken) options() []Option {
+	opts := []Option{WithName(t.Name)}
+	if t.Team != "" || t.Purpose != "" {
+		opts = append(opts, WithTags(t.Team, t.Purpose))
+	}
+	if t.TTL != "" {
+		if d, err := ParseTTL(t.TTL); err == nil {
+			opts = append(opts, WithTTL(d))
+		}
+	}
+	return opts
+}
+
+// ParseTTL parses a positive duration with timeparse.Duration: a Go
+// duration, or whole numbers of y, mo, w, d, h, m, and s such as "90d" or
+// "6mo".
+func ParseTTL(s string) (time.Duration, error) {
+	d, err := timeparse.Duration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+	return d, nil
+}
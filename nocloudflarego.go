@@ -0,0 +1,8 @@
+//go:build nocloudflarego
+
+package cftoken
+
+// defaultBackend is the BackendFactory New uses. Built with the
+// nocloudflarego tag, that's the net/http backend, so cloudflare-go isn't
+// linked.
+var defaultBackend BackendFactory = newHTTPBackend
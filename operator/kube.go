@@ -0,0 +1,178 @@
+package operator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Kube is a minimal Kubernetes REST client covering what the controller
+// needs: CloudflareToken resources and Secrets.
+type Kube struct {
+	// Host is the API server URL, e.g. "https://10.0.0.1:443".
+	Host string
+	// Token is the bearer token sent with each request.
+	Token  string
+	Client *http.Client
+}
+
+// InCluster returns a client using the pod's service account.
+func InCluster() (*Kube, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes pod: KUBERNETES_SERVICE_HOST is not set")
+	}
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("%s/ca.crt: no PEM certificates found", serviceAccountDir)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	return &Kube{
+		Host:   "https://" + net.JoinHostPort(host, port),
+		Token:  strings.TrimSpace(string(token)),
+		Client: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+	}, nil
+}
+
+// StatusError is a non-2xx response from the API server.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes API: %d %s", e.Code, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 from the API server.
+func IsNotFound(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a 409 from the API server.
+func IsConflict(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Code == http.StatusConflict
+}
+
+// do sends body as JSON, or as a merge patch for PATCH, and decodes the
+// response into out if it is not nil.
+func (k *Kube) do(ctx context.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(k.Host, "/")+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if method == http.MethodPatch {
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+		}
+	}
+	if k.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+k.Token)
+	}
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &status) != nil || status.Message == "" {
+			status.Message = http.StatusText(resp.StatusCode)
+		}
+		return &StatusError{Code: resp.StatusCode, Message: status.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// Secret is the subset of a core/v1 Secret the controller writes.
+type Secret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+func secretPath(namespace, name string) string {
+	return "/api/v1/namespaces/" + namespace + "/secrets/" + name
+}
+
+// GetSecret reads a Secret.
+func (k *Kube) GetSecret(ctx context.Context, namespace, name string) (*Secret, error) {
+	var s Secret
+	if err := k.do(ctx, http.MethodGet, secretPath(namespace, name), nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// PutSecret creates s, or replaces it if it already exists.
+func (k *Kube) PutSecret(ctx context.Context, s *Secret) error {
+	s.APIVersion, s.Kind = "v1", "Secret"
+	err := k.do(ctx, http.MethodPut, secretPath(s.Metadata.Namespace, s.Metadata.Name), s, nil)
+	if IsNotFound(err) {
+		err = k.do(ctx, http.MethodPost, "/api/v1/namespaces/"+s.Metadata.Namespace+"/secrets", s, nil)
+	}
+	return err
+}
+
+// ServiceAccount is the subset of a Kubernetes ServiceAccount the controller
+// uses.
+type ServiceAccount struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// GetServiceAccount reads a ServiceAccount.
+func (k *Kube) GetServiceAccount(ctx context.Context, namespace, name string) (*ServiceAccount, error) {
+	var sa ServiceAccount
+	if err := k.do(ctx, http.MethodGet, "/api/v1/namespaces/"+namespace+"/serviceaccounts/"+name, nil, &sa); err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
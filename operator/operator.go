@@ -0,0 +1,430 @@
+// Package operator reconciles CloudflareToken custom resources into scoped
+// Cloudflare API tokens stored in Kubernetes Secrets. It talks to the API
+// server over plain REST, so it adds no Kubernetes client dependencies.
+//
+// Each CloudflareToken names services, a scope, a level, a TTL, and the Secret
+// to write. The controller mints the token, writes the Secret (owned by the
+// resource, so it is garbage collected with it), rotates the token before it
+// expires or when the spec changes, and revokes it when the resource is
+// deleted. Install the CRD from crd.yaml in this directory.
+//
+//	kube, err := operator.InCluster()
+//	c := &operator.Controller{Gen: gen, Kube: kube}
+//	err = c.Run(ctx, time.Minute)
+package operator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// API group, version, and names of the CloudflareToken resource.
+const (
+	Group     = "cftoken.jackm43.github.io"
+	Version   = "v1alpha1"
+	Kind      = "CloudflareToken"
+	Plural    = "cloudflaretokens"
+	Finalizer = Group + "/revoke"
+)
+
+// ObjectMeta is the subset of Kubernetes object metadata the controller uses.
+type ObjectMeta struct {
+	Name              string            `json:"name"`
+	Namespace         string            `json:"namespace,omitempty"`
+	UID               string            `json:"uid,omitempty"`
+	ResourceVersion   string            `json:"resourceVersion,omitempty"`
+	Generation        int64             `json:"generation,omitempty"`
+	DeletionTimestamp *time.Time        `json:"deletionTimestamp,omitempty"`
+	Finalizers        []string          `json:"finalizers,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty"`
+	OwnerReferences   []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference ties a Secret to the CloudflareToken that wrote it.
+type OwnerReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Controller bool   `json:"controller,omitempty"`
+}
+
+// CloudflareToken is the custom resource.
+type CloudflareToken struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Metadata   ObjectMeta  `json:"metadata"`
+	Spec       TokenSpec   `json:"spec"`
+	Status     TokenStatus `json:"status,omitempty"`
+}
+
+// TokenSpec is the token a CloudflareToken asks for.
+type TokenSpec struct {
+	Services []string `json:"services"`
+	// Scope is "all", a zone or account ID, or "@<zone-group>".
+	Scope string `json:"scope"`
+	// Level is "edit" (default) or "read".
+	Level string `json:"level,omitempty"`
+	// TTL is the token lifetime, e.g. "24h" or "7d". Empty means the token
+	// never expires and is only replaced when the spec changes.
+	TTL string `json:"ttl,omitempty"`
+	// RenewBefore is how long before expiry the token is rotated. Defaults to
+	// a third of TTL.
+	RenewBefore string    `json:"renewBefore,omitempty"`
+	SecretRef   SecretRef `json:"secretRef"`
+	// ServiceAccountName is the ServiceAccount, in the resource's namespace,
+	// the token is for. Defaults to "default". See Requester.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+}
+
+// SecretRef names the Secret the token is written to, in the resource's
+// namespace.
+type SecretRef struct {
+	Name string `json:"name"`
+	// Key is the data key holding the token. Defaults to "token".
+	Key string `json:"key,omitempty"`
+}
+
+// TokenStatus records the token currently in the Secret.
+type TokenStatus struct {
+	TokenID            string      `json:"tokenID,omitempty"`
+	TokenName          string      `json:"tokenName,omitempty"`
+	ExpiresOn          *time.Time  `json:"expiresOn,omitempty"`
+	ObservedGeneration int64       `json:"observedGeneration,omitempty"`
+	Conditions         []Condition `json:"conditions,omitempty"`
+}
+
+// Condition is a standard Kubernetes status condition. The controller sets
+// one of type Ready.
+type Condition struct {
+	Type               string    `json:"type"`
+	Status             string    `json:"status"`
+	Reason             string    `json:"reason,omitempty"`
+	Message            string    `json:"message,omitempty"`
+	LastTransitionTime time.Time `json:"lastTransitionTime"`
+}
+
+// Requester is who ct's token is created for, as seen by request policies
+// and quotas: "system:serviceaccount:<namespace>:<serviceAccountName>".
+// Only the namespace is vouched for by Kubernetes RBAC, so rules should key
+// on it, e.g. requester.startsWith("system:serviceaccount:payments:").
+func Requester(ct *CloudflareToken) string {
+	sa := ct.Spec.ServiceAccountName
+	if sa == "" {
+		sa = "default"
+	}
+	return "system:serviceaccount:" + ct.Metadata.Namespace + ":" + sa
+}
+
+// Controller reconciles CloudflareTokens.
+type Controller struct {
+	Gen  *cftoken.Generator
+	Kube *Kube
+	// Namespace limits the controller to one namespace. Empty watches all.
+	Namespace string
+	// Policy, if set, is evaluated for every token with the requester from
+	// Requester, as the webhook evaluates its requests. Without it, anyone
+	// who can create a CloudflareToken gets whatever the parent can grant.
+	// Quotas in the generator's config apply to the same requester.
+	Policy cftoken.RequestPolicy
+	// Logf, if set, receives a line for each action and failure.
+	Logf func(format string, args ...any)
+}
+
+func (c *Controller) logf(format string, args ...any) {
+	if c.Logf != nil {
+		c.Logf(format, args...)
+	}
+}
+
+func (c *Controller) resourcePath(namespace, name string) string {
+	path := "/apis/" + Group + "/" + Version
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+	path += "/" + Plural
+	if name != "" {
+		path += "/" + name
+	}
+	return path
+}
+
+// Run reconciles every CloudflareToken each interval until ctx is cancelled.
+// A pass under way when ctx is cancelled finishes first, so no token is left
+// without its Secret or status. Failures are logged and retried on the next
+// pass.
+func (c *Controller) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := c.ReconcileAll(context.WithoutCancel(ctx)); err != nil {
+			c.logf("reconcile: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// ReconcileAll lists the CloudflareTokens and reconciles each. It returns
+// the listing error, if any; per-resource failures are logged and recorded in
+// the resource's Ready condition.
+func (c *Controller) ReconcileAll(ctx context.Context) error {
+	var list struct {
+		Items []CloudflareToken `json:"items"`
+	}
+	if err := c.Kube.do(ctx, http.MethodGet, c.resourcePath(c.Namespace, ""), nil, &list); err != nil {
+		return fmt.Errorf("listing %s: %w", Plural, err)
+	}
+	for i := range list.Items {
+		ct := &list.Items[i]
+		if err := c.Reconcile(ctx, ct); err != nil {
+			c.logf("%s/%s: %v", ct.Metadata.Namespace, ct.Metadata.Name, err)
+		}
+	}
+	return nil
+}
+
+// Reconcile brings one CloudflareToken up to date.
+func (c *Controller) Reconcile(ctx context.Context, ct *CloudflareToken) error {
+	if ct.Metadata.DeletionTimestamp != nil {
+		return c.finalize(ctx, ct)
+	}
+	if !slices.Contains(ct.Metadata.Finalizers, Finalizer) {
+		finalizers := append(slices.Clone(ct.Metadata.Finalizers), Finalizer)
+		if err := c.patchMetadata(ctx, ct, finalizers); err != nil {
+			return fmt.Errorf("adding finalizer: %w", err)
+		}
+	}
+
+	reason, err := c.rotationReason(ctx, ct)
+	if err != nil || reason == "" {
+		return err
+	}
+	c.logf("%s/%s: issuing token (%s)", ct.Metadata.Namespace, ct.Metadata.Name, reason)
+
+	t, err := c.issue(ctx, ct)
+	if err != nil {
+		reason := "IssueFailed"
+		var denied *cftoken.PolicyDeniedError
+		var quota *cftoken.QuotaError
+		if errors.As(err, &denied) || errors.As(err, &quota) {
+			reason = "Denied"
+		}
+		c.setReady(ctx, ct, "False", reason, err.Error())
+		return err
+	}
+	ct.Status.TokenID = t.ID
+	ct.Status.TokenName = t.Name
+	ct.Status.ExpiresOn = t.ExpiresOn
+	ct.Status.ObservedGeneration = ct.Metadata.Generation
+	message := "token " + t.ID + " written to secret " + ct.Spec.SecretRef.Name
+	// The new secret is in place, so the tokens it replaces can go.
+	if err := c.Gen.RevokeReplaced(ctx, t); err != nil {
+		message += "; revoking the previous token failed: " + err.Error()
+		c.logf("%s/%s: %v", ct.Metadata.Namespace, ct.Metadata.Name, err)
+	}
+	return c.setReady(ctx, ct, "True", "Issued", message)
+}
+
+// rotationReason says why ct needs a new token, or returns "" if it doesn't.
+func (c *Controller) rotationReason(ctx context.Context, ct *CloudflareToken) (string, error) {
+	switch {
+	case ct.Status.TokenID == "":
+		return "no token yet", nil
+	case ct.Status.ObservedGeneration != ct.Metadata.Generation:
+		return "spec changed", nil
+	}
+	if ct.Status.ExpiresOn != nil {
+		renewBefore, err := c.renewBefore(ct.Spec)
+		if err != nil {
+			return "", err
+		}
+		if time.Until(*ct.Status.ExpiresOn) <= renewBefore {
+			return "expiring", nil
+		}
+	}
+	_, err := c.Kube.GetSecret(ctx, ct.Metadata.Namespace, ct.Spec.SecretRef.Name)
+	if IsNotFound(err) {
+		return "secret missing", nil
+	}
+	return "", err
+}
+
+func (c *Controller) renewBefore(spec TokenSpec) (time.Duration, error) {
+	if spec.RenewBefore != "" {
+		d, err := cftoken.ParseTTL(spec.RenewBefore)
+		if err != nil {
+			return 0, fmt.Errorf("invalid renewBefore: %w", err)
+		}
+		return d, nil
+	}
+	if spec.TTL == "" {
+		return 0, nil
+	}
+	ttl, err := cftoken.ParseTTL(spec.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %w", err)
+	}
+	return ttl / 3, nil
+}
+
+// issue mints a token for ct and writes it to the Secret. A Secret that
+// exists but isn't owned by ct is left alone. If the Secret can't be written
+// the new token is revoked; otherwise the caller revokes the tokens it
+// replaces.
+func (c *Controller) issue(ctx context.Context, ct *CloudflareToken) (*cftoken.Token, error) {
+	spec := ct.Spec
+	if len(spec.Services) == 0 || spec.Scope == "" || spec.SecretRef.Name == "" {
+		return nil, fmt.Errorf("spec.services, spec.scope, and spec.secretRef.name are required")
+	}
+	if spec.ServiceAccountName != "" {
+		if _, err := c.Kube.GetServiceAccount(ctx, ct.Metadata.Namespace, spec.ServiceAccountName); err != nil {
+			return nil, fmt.Errorf("service account %s: %w", spec.ServiceAccountName, err)
+		}
+	}
+	existing, err := c.Kube.GetSecret(ctx, ct.Metadata.Namespace, spec.SecretRef.Name)
+	if err != nil && !IsNotFound(err) {
+		return nil, err
+	}
+	if existing != nil && !ownedBy(existing.Metadata, ct.Metadata.UID) {
+		return nil, fmt.Errorf("secret %s exists and is not owned by this %s", spec.SecretRef.Name, Kind)
+	}
+
+	level := spec.Level
+	if level == "" {
+		level = "edit"
+	}
+	// Earlier tokens for the resource are found by name, so none are left
+	// behind even if a status update was lost.
+	opts := []cftoken.Option{
+		cftoken.WithName(fmt.Sprintf("k8s-%s-%s", ct.Metadata.Namespace, ct.Metadata.Name)),
+		cftoken.WithIfExists(cftoken.IfExistsReplace),
+		cftoken.WithRequester(Requester(ct)),
+	}
+	if c.Policy != nil {
+		opts = append(opts, cftoken.WithRequestPolicy(c.Policy, Requester(ct)))
+	}
+	if spec.TTL != "" {
+		ttl, err := cftoken.ParseTTL(spec.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %w", err)
+		}
+		opts = append(opts, cftoken.WithTTL(ttl))
+	}
+	t, err := c.Gen.GenerateToken(spec.Services, spec.Scope, level, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	key := spec.SecretRef.Key
+	if key == "" {
+		key = "token"
+	}
+	secret := &Secret{
+		Metadata: ObjectMeta{
+			Name:      spec.SecretRef.Name,
+			Namespace: ct.Metadata.Namespace,
+			Labels:    map[string]string{"app.kubernetes.io/managed-by": "cloudflare-token-generator"},
+			OwnerReferences: []OwnerReference{{
+				APIVersion: Group + "/" + Version,
+				Kind:       Kind,
+				Name:       ct.Metadata.Name,
+				UID:        ct.Metadata.UID,
+				Controller: true,
+			}},
+		},
+		Type: "Opaque",
+		Data: map[string][]byte{key: []byte(t.Value)},
+	}
+	if err := c.Kube.PutSecret(ctx, secret); err != nil {
+		if rerr := c.Gen.RevokeToken(ctx, t.ID); rerr != nil {
+			return nil, fmt.Errorf("writing secret: %w; token %s could not be revoked: %v", err, t.ID, rerr)
+		}
+		return nil, fmt.Errorf("writing secret: %w; token %s was revoked", err, t.ID)
+	}
+	return t, nil
+}
+
+func ownedBy(meta ObjectMeta, uid string) bool {
+	for _, ref := range meta.OwnerReferences {
+		if ref.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// finalize revokes a deleted resource's token and releases its finalizer.
+func (c *Controller) finalize(ctx context.Context, ct *CloudflareToken) error {
+	if !slices.Contains(ct.Metadata.Finalizers, Finalizer) {
+		return nil
+	}
+	if id := ct.Status.TokenID; id != "" {
+		var resp *cftoken.ResponseError
+		if err := c.Gen.RevokeToken(ctx, id); err != nil && !(errors.As(err, &resp) && resp.StatusCode == http.StatusNotFound) {
+			return err
+		}
+		c.logf("%s/%s: revoked token %s", ct.Metadata.Namespace, ct.Metadata.Name, id)
+	}
+	var kept []string
+	for _, f := range ct.Metadata.Finalizers {
+		if f != Finalizer {
+			kept = append(kept, f)
+		}
+	}
+	return c.patchMetadata(ctx, ct, kept)
+}
+
+// patchMetadata sets the resource's finalizers. The resource version guards
+// against overwriting another writer's change.
+func (c *Controller) patchMetadata(ctx context.Context, ct *CloudflareToken, finalizers []string) error {
+	if finalizers == nil {
+		finalizers = []string{}
+	}
+	patch := map[string]any{"metadata": map[string]any{
+		"finalizers":      finalizers,
+		"resourceVersion": ct.Metadata.ResourceVersion,
+	}}
+	var updated CloudflareToken
+	if err := c.Kube.do(ctx, http.MethodPatch, c.resourcePath(ct.Metadata.Namespace, ct.Metadata.Name), patch, &updated); err != nil {
+		return err
+	}
+	ct.Metadata = updated.Metadata
+	return nil
+}
+
+// setReady records the Ready condition and the token status.
+func (c *Controller) setReady(ctx context.Context, ct *CloudflareToken, status, reason, message string) error {
+	cond := Condition{Type: "Ready", Status: status, Reason: reason, Message: message, LastTransitionTime: time.Now().UTC().Truncate(time.Second)}
+	var conditions []Condition
+	for _, existing := range ct.Status.Conditions {
+		if existing.Type != cond.Type {
+			conditions = append(conditions, existing)
+		} else if existing.Status == cond.Status {
+			cond.LastTransitionTime = existing.LastTransitionTime
+		}
+	}
+	ct.Status.Conditions = append(conditions, cond)
+	// ExpiresOn is sent even when nil, so a merge patch clears it.
+	patch := map[string]any{"status": map[string]any{
+		"tokenID":            ct.Status.TokenID,
+		"tokenName":          ct.Status.TokenName,
+		"expiresOn":          ct.Status.ExpiresOn,
+		"observedGeneration": ct.Status.ObservedGeneration,
+		"conditions":         ct.Status.Conditions,
+	}}
+	err := c.Kube.do(ctx, http.MethodPatch, c.resourcePath(ct.Metadata.Namespace, ct.Metadata.Name)+"/status", patch, nil)
+	if err != nil {
+		return fmt.Errorf("updating status: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package cftoken
+
+import (
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Option customizes a token created by Generate, GenerateMulti, or GodMode.
+type Option func(*tokenOptions)
+
+type tokenOptions struct {
+	name       string
+	ttl        time.Duration
+	notBefore  time.Time
+	condition  *TokenCondition
+	accountIDs []string
+	zones      []string
+
+	parentLimit bool
+	clamp       bool
+
+	maxPolicies         int
+	maxPermissionGroups int
+
+	ifExists       IfExists
+	idempotencyKey string
+
+	team    string
+	purpose string
+	tagged  bool
+
+	policy      RequestPolicy
+	requester   string
+	quotaLedger QuotaLedger
+
+	breakGlass       bool
+	breakGlassReason string
+
+	provenance *Provenance
+}
+
+func applyOptions(opts []Option) tokenOptions {
+	var o tokenOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithName overrides the generated token name.
+func WithName(name string) Option {
+	return func(o *tokenOptions) { o.name = name }
+}
+
+// WithTTL makes the token expire after d.
+func WithTTL(d time.Duration) Option {
+	return func(o *tokenOptions) { o.ttl = d }
+}
+
+// WithNotBefore makes the token valid only from t onwards.
+func WithNotBefore(t time.Time) Option {
+	return func(o *tokenOptions) { o.notBefore = t }
+}
+
+// WithIPCondition restricts the token to requests from the allowed CIDRs and
+// rejects requests from the denied CIDRs. Either list may be empty.
+func WithIPCondition(allow, deny []string) Option {
+	return func(o *tokenOptions) {
+		if o.condition == nil {
+			o.condition = &TokenCondition{}
+		}
+		o.condition.RequestIP = &RequestIPCondition{In: allow, NotIn: deny}
+	}
+}
+
+// WithCondition sets the token's request condition verbatim, replacing any
+// condition set by WithIPCondition.
+func WithCondition(c TokenCondition) Option {
+	return func(o *tokenOptions) { o.condition = &c }
+}
+
+// WithAccounts grants account-scoped services on each listed account instead
+// of the account selected by the scope argument.
+func WithAccounts(accountIDs ...string) Option {
+	return func(o *tokenOptions) { o.accountIDs = accountIDs }
+}
+
+// WithZones grants zone-scoped services on each listed zone instead of the
+// zone selected by the scope argument. Entries are zone IDs, zone names, or
+// patterns such as "*.example.com", as in zone groups. Together with
+// WithAccounts, a token mixing zone and account services gets a separately
+// scoped policy for each.
+func WithZones(zones ...string) Option {
+	return func(o *tokenOptions) { o.zones = zones }
+}
+
+// WithParentLimit checks the requested policies against the parent token's
+// own policies before creating the token, so a token never grants more than
+// its parent. A request exceeding the parent fails with *ExceedsParentError,
+// or, if clamp is true, the excess permissions are removed and listed in
+// Token.Removed.
+func WithParentLimit(clamp bool) Option {
+	return func(o *tokenOptions) {
+		o.parentLimit = true
+		o.clamp = clamp
+	}
+}
+
+// WithPolicyLimits refuses, with a *policy.LimitError, to create a token
+// whose optimized policies number more than maxPolicies or hold more than
+// maxPermissionGroups permission groups. A limit of 0 isn't checked, which
+// is the default.
+func WithPolicyLimits(maxPolicies, maxPermissionGroups int) Option {
+	return func(o *tokenOptions) {
+		o.maxPolicies = maxPolicies
+		o.maxPermissionGroups = maxPermissionGroups
+	}
+}
+
+// policyOptions returns the policy.Options for building the token's
+// policies in the configured account.
+func (o tokenOptions) policyOptions(accountID string) policy.Options {
+	return policy.Options{
+		AccountID:           accountID,
+		AccountIDs:          o.accountIDs,
+		MaxPolicies:         o.maxPolicies,
+		MaxPermissionGroups: o.maxPermissionGroups,
+	}
+}
+
+// admit evaluates the request policy, if any, against a request.
+func (o tokenOptions) admit(services []string, scope, level string) error {
+	if o.policy == nil {
+		return nil
+	}
+	return o.policy.Evaluate(TokenRequest{
+		Services:  services,
+		Scope:     scope,
+		Level:     level,
+		TTL:       o.ttl,
+		Accounts:  o.accountIDs,
+		Zones:     o.zones,
+		Requester: o.requester,
+	})
+}
+
+// apply copies the options onto a token about to be created.
+func (o tokenOptions) apply(token *APIToken) {
+	if o.name != "" {
+		token.Name = o.name
+	}
+	if o.tagged {
+		token.Name = TaggedName(o.team, o.purpose, token.Policies)
+	}
+	if o.idempotencyKey != "" {
+		token.Name += idempotencySep + o.idempotencyKey
+	}
+	if o.ttl > 0 {
+		expires := time.Now().Add(o.ttl).UTC().Truncate(time.Second)
+		token.ExpiresOn = &expires
+	}
+	if !o.notBefore.IsZero() {
+		notBefore := o.notBefore.UTC().Truncate(time.Second)
+		token.NotBefore = &notBefore
+	}
+	token.Condition = o.condition
+}
@@ -0,0 +1,384 @@
+package cftoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// ExceedsParentError is returned when a requested token would grant
+// permissions the parent token doesn't have itself.
+type ExceedsParentError struct {
+	// Excess describes each permission group and resource the parent lacks.
+	Excess []string
+}
+
+func (e *ExceedsParentError) Error() string {
+	return fmt.Sprintf("requested token exceeds the parent token's permissions: %s", strings.Join(e.Excess, "; "))
+}
+
+// ParentPolicies returns the configured parent token's own policies.
+// A Global API Key has no policies to compare against, so it is rejected.
+func (g *Generator) ParentPolicies(ctx context.Context) ([]policy.Policy, error) {
+	if g.authType == AuthTypeAPIKey {
+		return nil, fmt.Errorf("parent limits need an API token parent, not a Global API Key")
+	}
+	verified, err := g.api.VerifyAPIToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("verifying parent token: %w", err)
+	}
+	token, err := g.api.GetAPIToken(ctx, verified.ID)
+	if err != nil {
+		return nil, fmt.Errorf("reading parent token policies: %w", err)
+	}
+	return token.Policies, nil
+}
+
+// CredentialError is returned by Verify when a parent credential can't be
+// used to create tokens.
+type CredentialError struct {
+	// Parent names the configured parent token; empty for api_token.
+	Parent string
+	Reason string
+	Hint   string
+	Err    error
+}
+
+func (e *CredentialError) Error() string {
+	who := "the parent credential"
+	if e.Parent != "" {
+		who = fmt.Sprintf("parent token %q", e.Parent)
+	}
+	msg := who + " " + e.Reason
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%v)", e.Err)
+	}
+	return msg + ". " + e.Hint
+}
+
+func (e *CredentialError) Unwrap() error { return e.Err }
+
+// NewVerified is New followed by Verify, for callers that want a bad
+// credential reported up front rather than on the first token request.
+func NewVerified(ctx context.Context, cfg Config) (*Generator, error) {
+	g, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.Verify(ctx); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Verify checks that the parent credential, and any additional parent
+// tokens, are valid and can create tokens: an active API token holding API
+// Tokens Write, or a Global API Key Cloudflare accepts. New doesn't call the
+// API, so without Verify a bad credential only shows up when the first
+// token is requested. Failures are returned as *CredentialError.
+func (g *Generator) Verify(ctx context.Context) error {
+	if g.authType == AuthTypeAPIKey {
+		if _, err := g.api.UserDetails(ctx); err != nil {
+			return &CredentialError{Reason: "was rejected", Err: err,
+				Hint: "Check api_key and email in the config, or switch to an API token with API Tokens Write."}
+		}
+	} else if err := verifyParent(ctx, g.api, ""); err != nil {
+		return err
+	}
+	for _, p := range g.parents {
+		if err := verifyParent(ctx, p.api, p.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyParent checks that the API token behind api is active and holds API
+// Tokens Write.
+func verifyParent(ctx context.Context, api Backend, name string) error {
+	replace := "Replace api_token in the config (run init) with an active token."
+	if name != "" {
+		replace = "Replace its api_token under parents: in the config."
+	}
+	verified, err := api.VerifyAPIToken(ctx)
+	if err != nil {
+		var resp *ResponseError
+		rejected := errors.As(err, &resp) && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden ||
+			slices.Contains(resp.Codes, 1000) || slices.Contains(resp.Codes, 10000))
+		if !rejected {
+			return fmt.Errorf("verifying parent token: %w", err)
+		}
+		return &CredentialError{Parent: name, Reason: "was rejected by Cloudflare", Hint: replace, Err: err}
+	}
+	now := time.Now()
+	switch {
+	case verified.Status != "active":
+		return &CredentialError{Parent: name, Reason: "is " + verified.Status, Hint: replace}
+	case !verified.ExpiresOn.IsZero() && now.After(verified.ExpiresOn):
+		return &CredentialError{Parent: name, Reason: "expired on " + verified.ExpiresOn.Format(time.RFC3339), Hint: replace}
+	case !verified.NotBefore.IsZero() && now.Before(verified.NotBefore):
+		return &CredentialError{Parent: name, Reason: "is not valid until " + verified.NotBefore.Format(time.RFC3339), Hint: replace}
+	}
+
+	missing := &CredentialError{Parent: name, Reason: "lacks the API Tokens Write permission",
+		Hint: "Edit the token in the dashboard (My Profile > API Tokens) and add User > API Tokens > Edit."}
+	token, err := api.GetAPIToken(ctx, verified.ID)
+	if err != nil {
+		if status := responseStatus(err); status == http.StatusUnauthorized || status == http.StatusForbidden {
+			missing.Err = err
+			return missing
+		}
+		return fmt.Errorf("reading parent token policies: %w", err)
+	}
+	for _, p := range token.Policies {
+		if p.Effect == "deny" {
+			continue
+		}
+		for _, pg := range p.PermissionGroups {
+			if strings.EqualFold(pg.Name, "API Tokens Write") {
+				return nil
+			}
+		}
+	}
+	return missing
+}
+
+// DefaultParentExpiryWarning is how long before the parent token expires the
+// CLI starts warning, unless parent_expiry_warning is set.
+const DefaultParentExpiryWarning = 14 * 24 * time.Hour
+
+// ParentInfo describes the configured parent token.
+type ParentInfo struct {
+	ID string
+	// Name is empty if the token can't read its own details.
+	Name      string
+	Status    string
+	NotBefore *time.Time
+	// ExpiresOn is nil for a token that never expires.
+	ExpiresOn *time.Time
+}
+
+// ExpiresWithin reports whether the token expires within d from now.
+func (p *ParentInfo) ExpiresWithin(d time.Duration) bool {
+	return p.ExpiresOn != nil && time.Until(*p.ExpiresOn) < d
+}
+
+// ParentInfo verifies the parent token and returns its ID, status, and
+// validity window. A Global API Key has no token to describe, so it is
+// rejected.
+func (g *Generator) ParentInfo(ctx context.Context) (*ParentInfo, error) {
+	if g.authType == AuthTypeAPIKey {
+		return nil, fmt.Errorf("the parent credential is a Global API Key, not an API token")
+	}
+	verified, err := g.api.VerifyAPIToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("verifying parent token: %w", err)
+	}
+	info := &ParentInfo{ID: verified.ID, Status: verified.Status}
+	if !verified.NotBefore.IsZero() {
+		info.NotBefore = &verified.NotBefore
+	}
+	if !verified.ExpiresOn.IsZero() {
+		info.ExpiresOn = &verified.ExpiresOn
+	}
+	if token, err := g.api.GetAPIToken(ctx, verified.ID); err == nil {
+		info.Name = token.Name
+	}
+	return info, nil
+}
+
+// RollParent replaces the parent token's secret and returns the new one. The
+// old secret stops working at once, including for this Generator, so save
+// the new one before doing anything else and create a new Generator from it.
+// Rolling keeps the token's ID, permissions, and expiry.
+func (g *Generator) RollParent(ctx context.Context) (string, error) {
+	if g.authType == AuthTypeAPIKey {
+		return "", fmt.Errorf("the parent credential is a Global API Key and can't be rolled")
+	}
+	verified, err := g.api.VerifyAPIToken(ctx)
+	if err != nil {
+		return "", fmt.Errorf("verifying parent token: %w", err)
+	}
+	value, err := g.api.RollAPIToken(ctx, verified.ID)
+	if err != nil {
+		return "", fmt.Errorf("rolling parent token: %w", err)
+	}
+	return value, nil
+}
+
+// ClampPolicies removes from requested every permission group the parent
+// policies don't grant on all of the requested policy's resources. It returns
+// the remaining policies and a description of each removed grant. Policies
+// left without permission groups are dropped. Deny policies only narrow a
+// token, so they are kept unchanged.
+//
+// zoneAccounts maps zone IDs to their account IDs, so a parent policy on an
+// account covers the zones in it. It may be nil, in which case a zone is
+// only covered by a parent policy naming the zone or all zones.
+func ClampPolicies(requested, parent []policy.Policy, zoneAccounts map[string]string) ([]policy.Policy, []string) {
+	var kept []policy.Policy
+	var removed []string
+	for _, req := range requested {
+		if req.Effect == "deny" {
+			kept = append(kept, req)
+			continue
+		}
+		var groups []policy.PermissionGroup
+		for _, pg := range req.PermissionGroups {
+			if missing := uncoveredResources(pg.ID, req.Resources, parent, zoneAccounts); len(missing) > 0 {
+				removed = append(removed, fmt.Sprintf("%s on %s", permissionName(pg), strings.Join(missing, ", ")))
+				continue
+			}
+			groups = append(groups, pg)
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		req.PermissionGroups = groups
+		kept = append(kept, req)
+	}
+	if !slices.ContainsFunc(kept, func(p policy.Policy) bool { return p.Effect != "deny" }) {
+		return nil, removed
+	}
+	return kept, removed
+}
+
+// zoneAccounts maps the zones named by policies to their accounts, listing
+// zones only when a specific zone is named. If the zones can't be listed the
+// map is nil and ClampPolicies matches zones without their accounts.
+func (g *Generator) zoneAccounts(ctx context.Context, policies []policy.Policy) map[string]string {
+	named := false
+	for _, p := range policies {
+		for _, r := range resourceRefs(p.Resources, nil) {
+			named = named || strings.HasPrefix(r.key, zoneResourcePrefix) && r.key != zoneResourcePrefix+"*"
+		}
+	}
+	if !named {
+		return nil
+	}
+	zones, err := g.DiscoverZones(ctx)
+	if err != nil {
+		return nil
+	}
+	accounts := make(map[string]string, len(zones))
+	for _, z := range zones {
+		accounts[z.ID] = z.Account.ID
+	}
+	return accounts
+}
+
+// resourceRef is a resource a policy applies to, with the account it is in
+// when known: the outer account of a nested resource, or a zone's account.
+type resourceRef struct {
+	key     string
+	account string
+	// label names the resource in messages, "outer > inner" when nested.
+	label string
+}
+
+// resourceRefs flattens a policy's resources, looking up zones' accounts in
+// zoneAccounts. A resource narrowed to a subset yields one ref per object.
+func resourceRefs(resources map[string]interface{}, zoneAccounts map[string]string) []resourceRef {
+	var refs []resourceRef
+	for key, value := range resources {
+		subset, ok := value.(map[string]interface{})
+		if !ok {
+			r := resourceRef{key: key, label: key}
+			if strings.HasPrefix(key, zoneResourcePrefix) {
+				r.account = zoneAccounts[strings.TrimPrefix(key, zoneResourcePrefix)]
+			}
+			refs = append(refs, r)
+			continue
+		}
+		for sub := range subset {
+			refs = append(refs, resourceRef{key: sub, account: strings.TrimPrefix(key, accountResourcePrefix), label: key + " > " + sub})
+		}
+	}
+	return refs
+}
+
+// uncoveredResources returns the resources the parent doesn't grant groupID on.
+func uncoveredResources(groupID string, resources map[string]interface{}, parent []policy.Policy, zoneAccounts map[string]string) []string {
+	var missing []string
+	for _, r := range resourceRefs(resources, zoneAccounts) {
+		allowed := false
+		for _, p := range parent {
+			if !hasPermissionGroup(p, groupID) || !policyCovers(p, r) {
+				continue
+			}
+			if p.Effect == "deny" {
+				allowed = false
+				break
+			}
+			allowed = true
+		}
+		if !allowed {
+			missing = append(missing, r.label)
+		}
+	}
+	return missing
+}
+
+func hasPermissionGroup(p policy.Policy, groupID string) bool {
+	for _, pg := range p.PermissionGroups {
+		if pg.ID == groupID {
+			return true
+		}
+	}
+	return false
+}
+
+// policyCovers reports whether one of the policy's resources includes r. An
+// account covers the zones in it, and all accounts cover every zone.
+func policyCovers(p policy.Policy, r resourceRef) bool {
+	zone := strings.HasPrefix(r.key, zoneResourcePrefix)
+	inAccount := func(key string) bool {
+		return key == accountResourcePrefix+"*" || r.account != "" && key == accountResourcePrefix+r.account
+	}
+	for key, value := range p.Resources {
+		// An account resource with a nested subset covers those objects in
+		// that account.
+		if nested, ok := value.(map[string]interface{}); ok {
+			if _, ok := nested[r.key]; ok && (r.account == "" || inAccount(key)) {
+				return true
+			}
+			if _, ok := nested[zoneResourcePrefix+"*"]; ok && zone && inAccount(key) {
+				return true
+			}
+			continue
+		}
+		switch {
+		case key == r.key:
+			return true
+		case key == zoneResourcePrefix+"*" && zone:
+			return true
+		case key == accountResourcePrefix+"*" && strings.HasPrefix(r.key, accountResourcePrefix):
+			return true
+		case zone && inAccount(key):
+			return true
+		}
+	}
+	return false
+}
+
+// permissionName returns a human name for a permission group, using the
+// catalog when the API didn't include one.
+func permissionName(pg policy.PermissionGroup) string {
+	if pg.Name != "" {
+		return pg.Name
+	}
+	for _, svc := range Services {
+		for _, p := range svc.Permissions {
+			if p.ID == pg.ID {
+				return p.Name
+			}
+		}
+	}
+	return pg.ID
+}
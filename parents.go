@@ -0,0 +1,183 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// ParentToken is an additional parent token, limited to the services, zones,
+// and accounts it's tagged with. Tokens are created with the least
+// privileged parent able to grant them, so the broad api_token is only used
+// when nothing narrower will do.
+type ParentToken struct {
+	Name     string `yaml:"name"`
+	APIToken string `yaml:"api_token,omitempty"`
+	// Services lists the services and bundles the token can grant, at any
+	// level. Empty means any permission group.
+	Services []string `yaml:"services,omitempty"`
+	// Zones and Accounts list the zone and account IDs it can grant on.
+	// Empty means any.
+	Zones    []string `yaml:"zones,omitempty"`
+	Accounts []string `yaml:"accounts,omitempty"`
+}
+
+// parent is a parent token and the capabilities it's tagged with. A nil set
+// is unrestricted.
+type parent struct {
+	name     string
+	api      Backend
+	groups   map[string]bool
+	zones    map[string]bool
+	accounts map[string]bool
+}
+
+// unrestricted stands in for the size of an untagged capability when ranking
+// parents, larger than any real list.
+const unrestricted = 1 << 16
+
+func newParents(cfg Config, client *http.Client, newBackend BackendFactory) ([]parent, error) {
+	seen := make(map[string]bool)
+	var parents []parent
+	for i, t := range cfg.Parents {
+		if t.Name == "" {
+			return nil, fmt.Errorf("parents[%d]: name is required", i)
+		}
+		if seen[t.Name] {
+			return nil, fmt.Errorf("parents: duplicate name %q", t.Name)
+		}
+		seen[t.Name] = true
+		if t.APIToken == "" {
+			return nil, fmt.Errorf("parent %q: api_token is required", t.Name)
+		}
+		parentCfg := cfg
+		parentCfg.AuthType, parentCfg.APIToken, parentCfg.APIKey, parentCfg.Email = AuthTypeAPIToken, t.APIToken, "", ""
+		api, err := newBackend(parentCfg, client)
+		if err != nil {
+			return nil, fmt.Errorf("parent %q: creating cloudflare client: %w", t.Name, err)
+		}
+		p := parent{name: t.Name, api: api, zones: idSet(t.Zones), accounts: idSet(t.Accounts)}
+		if len(t.Services) > 0 {
+			p.groups = make(map[string]bool)
+			for _, name := range ExpandServices(t.Services) {
+				svc, ok := Services[strings.ToLower(strings.TrimSpace(name))]
+				if !ok {
+					return nil, fmt.Errorf("parent %q: unknown service %q", t.Name, name)
+				}
+				for _, perm := range svc.Permissions {
+					p.groups[perm.ID] = true
+				}
+			}
+		}
+		parents = append(parents, p)
+	}
+	return parents, nil
+}
+
+func idSet(ids []string) map[string]bool {
+	if len(ids) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// covers reports whether the parent's tags allow every permission group on
+// every resource in policies.
+func (p *parent) covers(policies []policy.Policy) bool {
+	for _, pol := range policies {
+		if p.groups != nil {
+			for _, pg := range pol.PermissionGroups {
+				if !p.groups[pg.ID] {
+					return false
+				}
+			}
+		}
+		for key, value := range pol.Resources {
+			if !p.coversResource(key) {
+				return false
+			}
+			if subset, ok := value.(map[string]interface{}); ok {
+				for sub := range subset {
+					if !p.coversResource(sub) {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+func (p *parent) coversResource(key string) bool {
+	const (
+		zonePrefix    = "com.cloudflare.api.account.zone."
+		accountPrefix = "com.cloudflare.api.account."
+	)
+	switch {
+	case strings.HasPrefix(key, zonePrefix):
+		return p.zones == nil || p.zones[strings.TrimPrefix(key, zonePrefix)]
+	case strings.HasPrefix(key, accountPrefix):
+		return p.accounts == nil || p.accounts[strings.TrimPrefix(key, accountPrefix)]
+	}
+	// User and other resources are only granted by untagged parents.
+	return p.zones == nil && p.accounts == nil
+}
+
+// privilege ranks parents by how much they can grant: the product of their
+// permission groups, zones, and accounts.
+func (p *parent) privilege() int64 {
+	size := func(n int) int64 {
+		if n == 0 {
+			return unrestricted
+		}
+		return int64(n)
+	}
+	return size(len(p.groups)) * size(len(p.zones)) * size(len(p.accounts))
+}
+
+// parentFor returns the least privileged configured parent whose tags cover
+// policies, or the api_token parent if none does. Ties go to the parent
+// listed first.
+func (g *Generator) parentFor(policies []policy.Policy) *parent {
+	var best *parent
+	for i := range g.parents {
+		p := &g.parents[i]
+		if p.covers(policies) && (best == nil || p.privilege() < best.privilege()) {
+			best = p
+		}
+	}
+	if best == nil {
+		return &parent{api: g.api}
+	}
+	return best
+}
+
+// parentPolicies returns p's own policies, for WithParentLimit.
+func (g *Generator) parentPolicies(ctx context.Context, p *parent) ([]policy.Policy, error) {
+	if c := batchCacheFrom(ctx); c != nil {
+		return c.parentPolicies(ctx, p.name, func() ([]policy.Policy, error) { return g.fetchParentPolicies(ctx, p) })
+	}
+	return g.fetchParentPolicies(ctx, p)
+}
+
+func (g *Generator) fetchParentPolicies(ctx context.Context, p *parent) ([]policy.Policy, error) {
+	if p.name == "" {
+		return g.ParentPolicies(ctx)
+	}
+	verified, err := p.api.VerifyAPIToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("verifying parent %q: %w", p.name, err)
+	}
+	token, err := p.api.GetAPIToken(ctx, verified.ID)
+	if err != nil {
+		return nil, fmt.Errorf("reading parent %q policies: %w", p.name, err)
+	}
+	return token.Policies, nil
+}
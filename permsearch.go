@@ -0,0 +1,68 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PermissionGroupMatch is a live permission group found by
+// SearchPermissionGroups.
+type PermissionGroupMatch struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Scope is "zone" or "account" when the group applies to one, otherwise
+	// the group's raw scopes joined by commas.
+	Scope string `json:"scope"`
+	// Services are the catalog services granting the group.
+	Services []string `json:"services,omitempty"`
+}
+
+// SearchPermissionGroups lists the live permission groups whose name contains
+// every word of query, ignoring case, or whose ID equals it. Matches are
+// sorted by name.
+func (g *Generator) SearchPermissionGroups(ctx context.Context, query string) ([]PermissionGroupMatch, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty search")
+	}
+	groups, err := g.api.ListAPITokensPermissionGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing permission groups: %w", err)
+	}
+	services := make(map[string][]string)
+	for _, svc := range ListServices() {
+		for _, p := range svc.Permissions {
+			services[p.ID] = append(services[p.ID], svc.Name)
+		}
+	}
+
+	var matches []PermissionGroupMatch
+	for _, pg := range groups {
+		if !matchesWords(strings.ToLower(pg.Name), words) && !strings.EqualFold(pg.ID, strings.TrimSpace(query)) {
+			continue
+		}
+		scope := deriveScope(pg.Scopes)
+		if scope == "" {
+			scope = strings.Join(pg.Scopes, ",")
+		}
+		matches = append(matches, PermissionGroupMatch{ID: pg.ID, Name: pg.Name, Scope: scope, Services: services[pg.ID]})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Name != matches[j].Name {
+			return matches[i].Name < matches[j].Name
+		}
+		return matches[i].Scope < matches[j].Scope
+	})
+	return matches, nil
+}
+
+func matchesWords(name string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(name, w) {
+			return false
+		}
+	}
+	return true
+}
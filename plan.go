@@ -0,0 +1,148 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Cloudflare plans, from least to most capable. PlanAuto in config detects
+// the plan from the account instead.
+const (
+	PlanFree       = "free"
+	PlanPro        = "pro"
+	PlanBusiness   = "business"
+	PlanEnterprise = "enterprise"
+	PlanAuto       = "auto"
+)
+
+var planRank = map[string]int{PlanFree: 0, PlanPro: 1, PlanBusiness: 2, PlanEnterprise: 3}
+
+// ParsePlan validates a plan name, as accepted by the plan config key.
+func ParsePlan(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if _, ok := planRank[s]; ok || s == "" || s == PlanAuto {
+		return s, nil
+	}
+	return "", fmt.Errorf("unknown plan %q (use free, pro, business, enterprise, or auto)", s)
+}
+
+// PlanIncludes reports whether plan offers a service needing required. An
+// empty plan is unknown and includes everything.
+func PlanIncludes(plan, required string) bool {
+	if plan == "" || required == "" {
+		return true
+	}
+	return planRank[plan] >= planRank[required]
+}
+
+// ServicesForPlan returns the services available on plan, sorted by name.
+func ServicesForPlan(plan string) []Service {
+	var svcs []Service
+	for _, svc := range ListServices() {
+		if PlanIncludes(plan, svc.Plan) {
+			svcs = append(svcs, svc)
+		}
+	}
+	return svcs
+}
+
+// PlanError is returned when a token requests a service its account's plan
+// doesn't offer.
+type PlanError struct {
+	Service  string
+	Required string
+	Plan     string
+}
+
+func (e *PlanError) Error() string {
+	return fmt.Sprintf("service %q requires the %s plan, but the account is on %s (set plan: in config if this is wrong)",
+		e.Service, e.Required, e.Plan)
+}
+
+// Plan returns the account's plan: the configured one, or with plan: auto
+// the one DetectPlan finds, looked up once. It is empty if neither is set.
+func (g *Generator) Plan(ctx context.Context) (string, error) {
+	if g.plan != PlanAuto {
+		return g.plan, nil
+	}
+	g.planMu.Lock()
+	defer g.planMu.Unlock()
+	if g.detectedPlan == "" {
+		plan, err := g.DetectPlan(ctx)
+		if err != nil {
+			return "", fmt.Errorf("detecting plan: %w", err)
+		}
+		g.detectedPlan = plan
+	}
+	return g.detectedPlan, nil
+}
+
+// DetectPlan works out the account's plan: enterprise for enterprise
+// accounts, otherwise the highest plan among the zones the parent token can
+// list.
+func (g *Generator) DetectPlan(ctx context.Context) (string, error) {
+	if g.accountID != "" {
+		account, _, err := g.api.Account(ctx, g.accountID)
+		if err != nil {
+			return "", err
+		}
+		if account.Type == PlanEnterprise {
+			return PlanEnterprise, nil
+		}
+	}
+	zones, err := g.DiscoverZones(ctx)
+	if err != nil {
+		return "", err
+	}
+	plan := PlanFree
+	for _, z := range zones {
+		if rank, ok := planRank[z.Plan.LegacyID]; ok && rank > planRank[plan] {
+			plan = z.Plan.LegacyID
+		}
+	}
+	return plan, nil
+}
+
+// checkPlan returns a *PlanError for the first of svcs the account's plan
+// doesn't offer.
+func (g *Generator) checkPlan(ctx context.Context, svcs []Service) error {
+	if !slices.ContainsFunc(svcs, func(svc Service) bool { return svc.Plan != "" }) {
+		return nil
+	}
+	plan, err := g.Plan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, svc := range svcs {
+		if !PlanIncludes(plan, svc.Plan) {
+			return &PlanError{Service: svc.Name, Required: svc.Plan, Plan: plan}
+		}
+	}
+	return nil
+}
+
+// unavailablePermissions returns the IDs of permission groups that only
+// services outside the account's plan grant.
+func (g *Generator) unavailablePermissions(ctx context.Context) (map[string]bool, error) {
+	plan, err := g.Plan(ctx)
+	if err != nil || plan == "" {
+		return nil, err
+	}
+	available := make(map[string]bool)
+	unavailable := make(map[string]bool)
+	for _, svc := range ListServices() {
+		for _, p := range svc.Permissions {
+			if PlanIncludes(plan, svc.Plan) {
+				available[p.ID] = true
+			} else {
+				unavailable[p.ID] = true
+			}
+		}
+	}
+	for id := range available {
+		delete(unavailable, id)
+	}
+	return unavailable, nil
+}
@@ -0,0 +1,168 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	accountPrefix = "com.cloudflare.api.account."
+	zonePrefix    = "com.cloudflare.api.account.zone."
+)
+
+// Resource is a key in a policy's resources map. A resource grants
+// everything it names unless Subset is set, in which case it grants only
+// those objects within it: for example only the zones of one account, rather
+// than every zone the token's owner can reach.
+type Resource struct {
+	Key    string
+	Subset []Resource
+}
+
+// Zone is the zone with the given ID, or every zone for "*".
+func Zone(id string) Resource { return Resource{Key: zonePrefix + id} }
+
+// Account is the account with the given ID, or every account for "*".
+func Account(id string) Resource { return Resource{Key: accountPrefix + id} }
+
+// Only narrows r to the given objects within it, e.g.
+// Account(id).Only(Zone("*")) for every zone in one account.
+func (r Resource) Only(subset ...Resource) Resource {
+	r.Subset = append(append([]Resource(nil), r.Subset...), subset...)
+	return r
+}
+
+func (r Resource) validate() error {
+	if !strings.HasPrefix(r.Key, "com.cloudflare.") {
+		return fmt.Errorf("invalid resource %q", r.Key)
+	}
+	if len(r.Subset) == 0 {
+		return nil
+	}
+	if strings.HasPrefix(r.Key, zonePrefix) || !strings.HasPrefix(r.Key, accountPrefix) || r.Key == accountPrefix+"*" {
+		return fmt.Errorf("resource %q: only a specific account can be narrowed to a subset", r.Key)
+	}
+	for _, s := range r.Subset {
+		if len(s.Subset) > 0 {
+			return fmt.Errorf("resource %q: subsets cannot be nested further", s.Key)
+		}
+		if err := s.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value is the resource's value in a resources map: "*", or a map of its
+// subset.
+func (r Resource) value() interface{} {
+	if len(r.Subset) == 0 {
+		return "*"
+	}
+	subset := make(map[string]interface{}, len(r.Subset))
+	for _, s := range r.Subset {
+		subset[s.Key] = "*"
+	}
+	return subset
+}
+
+// Builder assembles token policies one statement at a time, for policies
+// Build can't express: deny statements, object-level resource subsets, or
+// several scopes in one token. The first error is reported by Policies.
+type Builder struct {
+	policies []Policy
+	err      error
+}
+
+// NewBuilder returns an empty Builder.
+func NewBuilder() *Builder { return &Builder{} }
+
+// Allow adds a policy granting the permission groups with the given IDs on
+// resources.
+func (b *Builder) Allow(groupIDs []string, resources ...Resource) *Builder {
+	return b.add("allow", groupIDs, resources)
+}
+
+// Deny adds a policy withholding the permission groups with the given IDs on
+// resources, overriding any allow.
+func (b *Builder) Deny(groupIDs []string, resources ...Resource) *Builder {
+	return b.add("deny", groupIDs, resources)
+}
+
+// AllowServices adds a policy granting services at level on resources. The
+// services must share a resource scope.
+func (b *Builder) AllowServices(services []Service, level string, resources ...Resource) *Builder {
+	if b.err != nil {
+		return b
+	}
+	level = strings.ToLower(level)
+	if level != "read" && level != "edit" {
+		b.err = fmt.Errorf("invalid permission level %q, must be \"read\" or \"edit\"", level)
+		return b
+	}
+	if len(services) == 0 {
+		b.err = fmt.Errorf("at least one service is required")
+		return b
+	}
+	var ids []string
+	for _, svc := range services {
+		if svc.ResourceScope != services[0].ResourceScope {
+			b.err = fmt.Errorf("services %q and %q have different resource scopes, add them separately", services[0].Name, svc.Name)
+			return b
+		}
+		perms := FilterPermissions(svc.Permissions, level)
+		if len(perms) == 0 {
+			b.err = fmt.Errorf("service %q does not support %q level (available: %s)",
+				svc.Name, level, strings.Join(Levels(svc), ", "))
+			return b
+		}
+		for _, p := range perms {
+			ids = append(ids, p.ID)
+		}
+	}
+	return b.add("allow", ids, resources)
+}
+
+func (b *Builder) add(effect string, groupIDs []string, resources []Resource) *Builder {
+	if b.err != nil {
+		return b
+	}
+	if len(groupIDs) == 0 {
+		b.err = fmt.Errorf("%s policy: at least one permission group is required", effect)
+		return b
+	}
+	if len(resources) == 0 {
+		b.err = fmt.Errorf("%s policy: at least one resource is required", effect)
+		return b
+	}
+	p := Policy{Effect: effect, Resources: make(map[string]interface{})}
+	for _, id := range groupIDs {
+		if !groupIDPattern.MatchString(id) {
+			b.err = fmt.Errorf("invalid permission group ID %q (expected 32 hex characters)", id)
+			return b
+		}
+		p.PermissionGroups = append(p.PermissionGroups, PermissionGroup{ID: id})
+	}
+	for _, r := range resources {
+		if err := r.validate(); err != nil {
+			b.err = err
+			return b
+		}
+		p.Resources[r.Key] = r.value()
+	}
+	b.policies = append(b.policies, p)
+	return b
+}
+
+// Policies returns the policies added so far, merged by Optimize, or the
+// first error. Statements with the same effect and resources become one
+// policy. Use Options.CheckLimits to bound the result's size.
+func (b *Builder) Policies() ([]Policy, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.policies) == 0 {
+		return nil, fmt.Errorf("no policies added")
+	}
+	return Optimize(b.policies), nil
+}
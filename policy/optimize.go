@@ -0,0 +1,77 @@
+package policy
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// LimitError is returned when policies exceed Options.MaxPolicies or
+// Options.MaxPermissionGroups after Optimize.
+type LimitError struct {
+	// What is "policies" or "permission groups".
+	What  string
+	Count int
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	setting := "MaxPolicies"
+	if e.What == "permission groups" {
+		setting = "MaxPermissionGroups"
+	}
+	return fmt.Sprintf("token would have %d %s, over the limit of %d set by %s; split the request into several tokens", e.Count, e.What, e.Max, setting)
+}
+
+// Optimize removes duplicate permission groups from each policy and merges
+// policies with the same effect and resources, so services sharing
+// permission groups don't inflate the token. The input is not modified.
+func Optimize(policies []Policy) []Policy {
+	var merged []Policy
+	var seen []map[string]bool
+	for _, p := range policies {
+		groups := p.PermissionGroups
+		i := slices.IndexFunc(merged, func(m Policy) bool {
+			return m.Effect == p.Effect && reflect.DeepEqual(m.Resources, p.Resources)
+		})
+		if i < 0 {
+			p.PermissionGroups = nil
+			merged = append(merged, p)
+			seen = append(seen, make(map[string]bool))
+			i = len(merged) - 1
+		}
+		for _, pg := range groups {
+			if !seen[i][pg.ID] {
+				seen[i][pg.ID] = true
+				merged[i].PermissionGroups = append(merged[i].PermissionGroups, pg)
+			}
+		}
+	}
+	return merged
+}
+
+// CheckLimits returns a *LimitError if policies exceed o.MaxPolicies or
+// hold more than o.MaxPermissionGroups permission groups in total. A limit
+// of 0 or less isn't checked.
+func (o Options) CheckLimits(policies []Policy) error {
+	if o.MaxPolicies > 0 && len(policies) > o.MaxPolicies {
+		return &LimitError{What: "policies", Count: len(policies), Max: o.MaxPolicies}
+	}
+	groups := 0
+	for _, p := range policies {
+		groups += len(p.PermissionGroups)
+	}
+	if o.MaxPermissionGroups > 0 && groups > o.MaxPermissionGroups {
+		return &LimitError{What: "permission groups", Count: groups, Max: o.MaxPermissionGroups}
+	}
+	return nil
+}
+
+// finish optimizes policies and checks them against the limits in opts.
+func finish(policies []Policy, opts Options) ([]Policy, error) {
+	policies = Optimize(policies)
+	if err := opts.CheckLimits(policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
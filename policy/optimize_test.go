@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOptimize(t *testing.T) {
+	zone := map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"}
+	account := map[string]interface{}{"com.cloudflare.api.account.1": "*"}
+	in := []Policy{
+		{Effect: "allow", Resources: zone, PermissionGroups: []PermissionGroup{{ID: "a"}, {ID: "b"}}},
+		{Effect: "allow", Resources: account, PermissionGroups: []PermissionGroup{{ID: "c"}}},
+		{Effect: "allow", Resources: map[string]interface{}{"com.cloudflare.api.account.zone.*": "*"}, PermissionGroups: []PermissionGroup{{ID: "b"}, {ID: "d"}}},
+		{Effect: "deny", Resources: zone, PermissionGroups: []PermissionGroup{{ID: "a"}}},
+	}
+	out := Optimize(in)
+	if len(out) != 3 {
+		t.Fatalf("got %d policies, want 3: %+v", len(out), out)
+	}
+	var ids []string
+	for _, pg := range out[0].PermissionGroups {
+		ids = append(ids, pg.ID)
+	}
+	if got := len(ids); got != 3 || ids[0] != "a" || ids[1] != "b" || ids[2] != "d" {
+		t.Errorf("merged zone policy has groups %v, want [a b d]", ids)
+	}
+	if out[2].Effect != "deny" {
+		t.Errorf("deny policy was merged into an allow")
+	}
+	if len(in[0].PermissionGroups) != 2 {
+		t.Errorf("Optimize modified its input")
+	}
+}
+
+func TestCheckLimits(t *testing.T) {
+	policies := []Policy{
+		{Effect: "allow", PermissionGroups: []PermissionGroup{{ID: "a"}, {ID: "b"}}},
+		{Effect: "deny", PermissionGroups: []PermissionGroup{{ID: "c"}}},
+	}
+	tests := []struct {
+		opts Options
+		what string // empty if within the limits
+	}{
+		{Options{}, ""},
+		{Options{MaxPolicies: 2, MaxPermissionGroups: 3}, ""},
+		{Options{MaxPolicies: 1}, "policies"},
+		{Options{MaxPermissionGroups: 2}, "permission groups"},
+	}
+	for _, tt := range tests {
+		err := tt.opts.CheckLimits(policies)
+		var lerr *LimitError
+		switch {
+		case tt.what == "" && err != nil:
+			t.Errorf("%+v: %v", tt.opts, err)
+		case tt.what != "" && (!errors.As(err, &lerr) || lerr.What != tt.what):
+			t.Errorf("%+v: got %v, want a %s limit error", tt.opts, err, tt.what)
+		}
+	}
+}
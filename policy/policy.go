@@ -0,0 +1,280 @@
+// Package policy builds Cloudflare API token policies from service
+// definitions. It makes no network calls, so the service-to-policy mapping can
+// be reused by tools that only need the policies, such as Terraform
+// generators or admission controllers.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ResourceScope indicates whether a service is scoped to a zone or account.
+type ResourceScope string
+
+const (
+	ResourceScopeZone    ResourceScope = "zone"
+	ResourceScopeAccount ResourceScope = "account"
+)
+
+// Policy is one statement of a Cloudflare API token: an effect, the
+// resources it applies to, and the permission groups it grants or denies.
+// It marshals to the JSON the token endpoints take.
+type Policy struct {
+	ID               string                 `json:"id,omitempty"`
+	Effect           string                 `json:"effect"`
+	Resources        map[string]interface{} `json:"resources"`
+	PermissionGroups []PermissionGroup      `json:"permission_groups"`
+}
+
+// PermissionGroup is a permission group in a Policy. Only ID is sent when
+// creating a token; Cloudflare fills in Name and Scopes when listing groups.
+type PermissionGroup struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Permission maps a Cloudflare permission group name to its ID.
+type Permission struct {
+	ID   string
+	Name string
+}
+
+// Service defines a Cloudflare service and the permissions needed to access it.
+type Service struct {
+	Name          string
+	Description   string
+	ResourceScope ResourceScope
+	// Deprecated marks services for Cloudflare products being retired.
+	// ReplacedBy, if set, names the service to migrate to.
+	Deprecated bool
+	ReplacedBy string
+	// Plan is the lowest Cloudflare plan the service's products are offered
+	// on: "pro", "business", or "enterprise". Empty means every plan.
+	Plan        string
+	Permissions []Permission
+}
+
+// Options supplies the context Build needs to resolve scopes.
+type Options struct {
+	// AccountID is used for account-scoped services when scope is "all".
+	AccountID string
+	// AccountIDs, if set, grants account-scoped services on each listed
+	// account regardless of scope.
+	AccountIDs []string
+	// ZoneIDs, if set, grants zone-scoped services on each listed zone
+	// regardless of scope.
+	ZoneIDs []string
+	// MaxPolicies and MaxPermissionGroups, if positive, make Build and
+	// BuildRaw fail with a *LimitError when the optimized token is larger.
+	// Cloudflare doesn't publish per-token limits, so none are checked by
+	// default and the API decides.
+	MaxPolicies         int
+	MaxPermissionGroups int
+}
+
+// Build returns the token policies granting services at level on scope.
+// Scope is "all" for all resources, or a specific zone/account ID. Level is
+// "read" for read-only permissions or "edit" for read+write permissions.
+// Zone-scoped and account-scoped services are grouped into separate policies,
+// each listing a permission group shared by several services once. The
+// result is checked against opts.MaxPolicies and opts.MaxPermissionGroups.
+func Build(services []Service, scope, level string, opts Options) ([]Policy, error) {
+	level = strings.ToLower(level)
+	if level != "read" && level != "edit" {
+		return nil, fmt.Errorf("invalid permission level %q, must be \"read\" or \"edit\"", level)
+	}
+	if len(services) == 0 {
+		return nil, fmt.Errorf("at least one service is required")
+	}
+
+	// Group services by resource scope to create correct policies.
+	var zoneSvcs, accountSvcs []Service
+	for _, svc := range services {
+		if len(FilterPermissions(svc.Permissions, level)) == 0 {
+			return nil, fmt.Errorf("service %q does not support %q level (available: %s)",
+				svc.Name, level, strings.Join(Levels(svc), ", "))
+		}
+		if svc.ResourceScope == ResourceScopeZone {
+			zoneSvcs = append(zoneSvcs, svc)
+		} else {
+			accountSvcs = append(accountSvcs, svc)
+		}
+	}
+
+	var policies []Policy
+
+	if len(zoneSvcs) > 0 {
+		var resources map[string]interface{}
+		if len(opts.ZoneIDs) > 0 {
+			resources = make(map[string]interface{})
+			for _, id := range opts.ZoneIDs {
+				resources["com.cloudflare.api.account.zone."+id] = "*"
+			}
+		} else {
+			var err error
+			resources, err = Resources(zoneSvcs[0], scope, opts.AccountID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		policies = append(policies, Policy{
+			Effect:           "allow",
+			Resources:        resources,
+			PermissionGroups: permissionGroups(zoneSvcs, level),
+		})
+	}
+
+	if len(accountSvcs) > 0 {
+		var resources map[string]interface{}
+		if len(opts.AccountIDs) > 0 {
+			resources = make(map[string]interface{})
+			for _, id := range opts.AccountIDs {
+				resources["com.cloudflare.api.account."+id] = "*"
+			}
+		} else {
+			var err error
+			resources, err = Resources(accountSvcs[0], scope, opts.AccountID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		policies = append(policies, Policy{
+			Effect:           "allow",
+			Resources:        resources,
+			PermissionGroups: permissionGroups(accountSvcs, level),
+		})
+	}
+
+	return finish(policies, opts)
+}
+
+// Resources returns the resources map for svc on scope. accountID is required
+// for account-scoped services when scope is "all".
+func Resources(svc Service, scope, accountID string) (map[string]interface{}, error) {
+	resources := make(map[string]interface{})
+
+	switch strings.ToLower(scope) {
+	case "all":
+		if svc.ResourceScope == ResourceScopeZone {
+			resources["com.cloudflare.api.account.zone.*"] = "*"
+		} else {
+			if accountID == "" {
+				return nil, fmt.Errorf("account_id required for account-scoped service %q with scope \"all\"", svc.Name)
+			}
+			resources["com.cloudflare.api.account."+accountID] = "*"
+		}
+	default:
+		// Scope is a specific resource ID
+		if svc.ResourceScope == ResourceScopeZone {
+			resources["com.cloudflare.api.account.zone."+scope] = "*"
+		} else {
+			resources["com.cloudflare.api.account."+scope] = "*"
+		}
+	}
+
+	return resources, nil
+}
+
+// Levels returns the permission levels available for a service.
+// Every service supports "edit" (all permissions). A service supports
+// "read" only if it has at least one permission whose name contains "Read".
+func Levels(svc Service) []string {
+	for _, p := range svc.Permissions {
+		if IsRead(p) {
+			return []string{"read", "edit"}
+		}
+	}
+	return []string{"edit"}
+}
+
+// FilterPermissions returns the permissions granted at level: all of them
+// for "edit", only read permissions for "read".
+func FilterPermissions(perms []Permission, level string) []Permission {
+	if level == "edit" {
+		return perms
+	}
+	var filtered []Permission
+	for _, p := range perms {
+		if IsRead(p) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// IsRead reports whether p is a read-only permission.
+func IsRead(p Permission) bool {
+	return strings.Contains(strings.ToLower(p.Name), "read")
+}
+
+func permissionGroups(services []Service, level string) []PermissionGroup {
+	var groups []PermissionGroup
+	for _, svc := range services {
+		for _, p := range FilterPermissions(svc.Permissions, level) {
+			groups = append(groups, PermissionGroup{ID: p.ID})
+		}
+	}
+	return groups
+}
+
+var groupIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ParseResource converts a scope of the form "zone:<zone-id>", "zone:*",
+// "account:<account-id>", or "account" (the configured accountID) to a
+// resource key.
+func ParseResource(scope, accountID string) (string, error) {
+	kind, id, _ := strings.Cut(scope, ":")
+	switch kind {
+	case "zone":
+		if id == "" {
+			return "", fmt.Errorf("scope %q: missing zone ID (use zone:<id> or zone:*)", scope)
+		}
+		return "com.cloudflare.api.account.zone." + id, nil
+	case "account":
+		if id == "" || id == "*" {
+			if accountID == "" {
+				return "", fmt.Errorf("scope %q: account_id required", scope)
+			}
+			id = accountID
+		}
+		return "com.cloudflare.api.account." + id, nil
+	}
+	return "", fmt.Errorf("invalid scope %q (use zone:<id>, zone:*, account:<id>, or account)", scope)
+}
+
+// BuildRaw returns a single policy granting the permission groups with the
+// given IDs on each scope (see ParseResource). Unlike Build it doesn't check
+// that the groups suit the resources; Cloudflare rejects mismatches.
+// opts.AccountID resolves the "account" scope; the limits in opts are
+// checked as in Build.
+func BuildRaw(groupIDs, scopes []string, opts Options) ([]Policy, error) {
+	if len(groupIDs) == 0 {
+		return nil, fmt.Errorf("at least one permission group ID is required")
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	var groups []PermissionGroup
+	for _, id := range groupIDs {
+		if !groupIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid permission group ID %q (expected 32 hex characters)", id)
+		}
+		groups = append(groups, PermissionGroup{ID: id})
+	}
+	resources := make(map[string]interface{})
+	for _, scope := range scopes {
+		key, err := ParseResource(scope, opts.AccountID)
+		if err != nil {
+			return nil, err
+		}
+		resources[key] = "*"
+	}
+	return finish([]Policy{{
+		Effect:           "allow",
+		Resources:        resources,
+		PermissionGroups: groups,
+	}}, opts)
+}
@@ -0,0 +1,139 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Preset is a named token definition that can be stored in the config and
+// reused with `generate --preset`.
+type Preset struct {
+	Services []string `yaml:"services"`
+	Scope    string   `yaml:"scope"`
+	Level    string   `yaml:"level"`
+}
+
+// ImportToken reads an existing token's policies and maps them back to a Preset.
+// The mapping is best-effort: permission groups that don't belong to a known
+// service, deny policies, and scopes a single preset can't express are reported
+// as warnings rather than errors.
+func (g *Generator) ImportToken(ctx context.Context, tokenID string) (*Preset, []string, error) {
+	token, err := g.api.GetAPIToken(ctx, tokenID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching token %s: %w", tokenID, err)
+	}
+
+	type match struct {
+		service string
+		perm    Permission
+	}
+	byID := make(map[string]match)
+	for key, svc := range Services {
+		for _, p := range svc.Permissions {
+			byID[p.ID] = match{service: key, perm: p}
+		}
+	}
+
+	var warnings []string
+	services := make(map[string]bool)
+	level := "read"
+	var scopes []string
+
+	for _, pol := range token.Policies {
+		if pol.Effect != "allow" {
+			warnings = append(warnings, fmt.Sprintf("skipping %s policy %s", pol.Effect, pol.ID))
+			continue
+		}
+		mapped := false
+		for _, pg := range pol.PermissionGroups {
+			m, ok := byID[pg.ID]
+			if !ok {
+				name := pg.Name
+				if name == "" {
+					name = pg.ID
+				}
+				warnings = append(warnings, fmt.Sprintf("permission group %q does not belong to a known service", name))
+				continue
+			}
+			mapped = true
+			services[m.service] = true
+			if !policy.IsRead(m.perm) {
+				level = "edit"
+			}
+		}
+		if mapped {
+			scopes = append(scopes, g.scopeFromResources(pol.Resources)...)
+		}
+	}
+
+	if len(services) == 0 {
+		return nil, warnings, fmt.Errorf("token %s has no permissions that map to known services", tokenID)
+	}
+
+	preset := &Preset{Level: level, Scope: "all"}
+	for svc := range services {
+		preset.Services = append(preset.Services, svc)
+	}
+	sort.Strings(preset.Services)
+
+	if len(scopes) > 0 {
+		preset.Scope = scopes[0]
+		for _, s := range scopes[1:] {
+			if s != preset.Scope {
+				warnings = append(warnings, fmt.Sprintf("token uses multiple scopes, using %q (also found %q)", preset.Scope, s))
+				break
+			}
+		}
+	}
+	if level == "edit" {
+		for _, svc := range preset.Services {
+			if len(policy.FilterPermissions(Services[svc].Permissions, "read")) > 0 && !hasWritePermission(token.Policies, Services[svc]) {
+				warnings = append(warnings, fmt.Sprintf("service %q was read-only on the original token but the preset grants edit", svc))
+			}
+		}
+	}
+
+	return preset, warnings, nil
+}
+
+// scopeFromResources converts a policy's resources map back into scope
+// arguments understood by GenerateMulti.
+func (g *Generator) scopeFromResources(resources map[string]interface{}) []string {
+	var scopes []string
+	for key := range resources {
+		switch {
+		case key == "com.cloudflare.api.account.zone.*", key == "com.cloudflare.api.account.*":
+			scopes = append(scopes, "all")
+		case strings.HasPrefix(key, "com.cloudflare.api.account.zone."):
+			scopes = append(scopes, strings.TrimPrefix(key, "com.cloudflare.api.account.zone."))
+		case strings.HasPrefix(key, "com.cloudflare.api.account."):
+			id := strings.TrimPrefix(key, "com.cloudflare.api.account.")
+			if id == g.accountID {
+				scopes = append(scopes, "all")
+			} else {
+				scopes = append(scopes, id)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func hasWritePermission(policies []policy.Policy, svc Service) bool {
+	ids := make(map[string]bool)
+	for _, pol := range policies {
+		for _, pg := range pol.PermissionGroups {
+			ids[pg.ID] = true
+		}
+	}
+	for _, p := range svc.Permissions {
+		if ids[p.ID] && !policy.IsRead(p) {
+			return true
+		}
+	}
+	return false
+}
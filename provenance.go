@@ -0,0 +1,77 @@
+package cftoken
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Provenance records where a token was created, so a leaked token can be
+// traced back to the pipeline or machine that minted it. It is kept in the
+// inventory and in receipts rather than the token name, which Cloudflare
+// limits in length.
+type Provenance struct {
+	Commit   string `json:"commit,omitempty"`
+	Host     string `json:"host,omitempty"`
+	JobURL   string `json:"job_url,omitempty"`
+	Manifest string `json:"manifest,omitempty"`
+}
+
+func (p Provenance) String() string {
+	var parts []string
+	for _, kv := range [][2]string{{"commit", p.Commit}, {"host", p.Host}, {"job", p.JobURL}, {"manifest", p.Manifest}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+"="+kv[1])
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// DetectProvenance describes the current environment. The commit and job URL
+// come from the CI system's environment variables (GitHub Actions, GitLab CI,
+// Buildkite, CircleCI, or Jenkins), with the commit falling back to the git
+// checkout in the working directory. manifest, if not empty, is recorded as
+// an absolute path.
+func DetectProvenance(manifest string) Provenance {
+	p := Provenance{Commit: firstEnv("GITHUB_SHA", "CI_COMMIT_SHA", "BUILDKITE_COMMIT", "CIRCLE_SHA1", "GIT_COMMIT")}
+	if p.Commit == "" {
+		if out, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+			p.Commit = strings.TrimSpace(string(out))
+		}
+	}
+	p.Host, _ = os.Hostname()
+
+	if run := os.Getenv("GITHUB_RUN_ID"); run != "" && os.Getenv("GITHUB_REPOSITORY") != "" {
+		server := os.Getenv("GITHUB_SERVER_URL")
+		if server == "" {
+			server = "https://github.com"
+		}
+		p.JobURL = server + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" + run
+	} else {
+		p.JobURL = firstEnv("CI_JOB_URL", "BUILDKITE_BUILD_URL", "CIRCLE_BUILD_URL", "BUILD_URL")
+	}
+
+	if manifest != "" {
+		if abs, err := filepath.Abs(manifest); err == nil {
+			manifest = abs
+		}
+		p.Manifest = manifest
+	}
+	return p
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// WithProvenance attaches p to the created token as Token.Provenance, to be
+// stored in the inventory and receipts.
+func WithProvenance(p Provenance) Option {
+	return func(o *tokenOptions) { o.provenance = &p }
+}
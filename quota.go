@@ -0,0 +1,229 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Quota limits the tokens one requester can create, so a compromised caller
+// can't mint tokens without bound. Zero fields are unlimited.
+type Quota struct {
+	// MaxPerDay caps the tokens created in any 24 hours.
+	MaxPerDay int `yaml:"max_per_day,omitempty"`
+	// MaxLive caps the requester's tokens that haven't expired or been
+	// revoked.
+	MaxLive int `yaml:"max_live,omitempty"`
+	// BroadCooldown is the minimum time between broad tokens: edit tokens on
+	// every zone or account, such as godmode. For example "1h".
+	BroadCooldown string `yaml:"broad_cooldown,omitempty"`
+
+	cooldown time.Duration
+}
+
+// QuotaError is returned when a request would exceed its requester's quota.
+type QuotaError struct {
+	Requester string
+	Reason    string
+	// RetryAfter is how long until the request could succeed, if known.
+	RetryAfter time.Duration
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded for %s: %s", e.Requester, e.Reason)
+}
+
+// QuotaLedger keeps the tokens counted against quotas. Without one, they are
+// kept in the local inventory and counting is serialized within the process;
+// a ledger shared by several processes lets them enforce one quota.
+type QuotaLedger interface {
+	// LockRequester serializes quota checks for requester across everything
+	// sharing the ledger, until unlock is called.
+	LockRequester(ctx context.Context, requester string) (unlock func(), err error)
+	// QuotaTokens returns the tokens recorded for requester.
+	QuotaTokens(ctx context.Context, requester string) ([]InventoryEntry, error)
+	// RecordQuotaToken records a token, dropping the entries for the IDs in
+	// replaces.
+	RecordQuotaToken(ctx context.Context, e InventoryEntry, replaces []string) error
+}
+
+// WithQuotaLedger counts the token against its requester's quota in l
+// instead of the local inventory.
+func WithQuotaLedger(l QuotaLedger) Option {
+	return func(o *tokenOptions) { o.quotaLedger = l }
+}
+
+// inventoryLedger is the QuotaLedger used without WithQuotaLedger.
+type inventoryLedger struct {
+	g *Generator
+}
+
+// LockRequester takes the requester's own lock, so a slow request only
+// holds up others from the same requester.
+func (l inventoryLedger) LockRequester(ctx context.Context, requester string) (func(), error) {
+	l.g.quotaMu.Lock()
+	mu, ok := l.g.quotaLocks[requester]
+	if !ok {
+		if l.g.quotaLocks == nil {
+			l.g.quotaLocks = make(map[string]*sync.Mutex)
+		}
+		mu = &sync.Mutex{}
+		l.g.quotaLocks[requester] = mu
+	}
+	l.g.quotaMu.Unlock()
+	mu.Lock()
+	return mu.Unlock, nil
+}
+
+func (l inventoryLedger) QuotaTokens(ctx context.Context, requester string) ([]InventoryEntry, error) {
+	inv, err := LoadInventory()
+	if err != nil {
+		return nil, err
+	}
+	var entries []InventoryEntry
+	for _, e := range inv.Tokens {
+		if e.Requester == requester {
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+func (l inventoryLedger) RecordQuotaToken(ctx context.Context, e InventoryEntry, replaces []string) error {
+	return UpdateInventory(func(inv *Inventory) error {
+		inv.Remove(replaces...)
+		inv.Remove(e.ID)
+		inv.Tokens = append(inv.Tokens, e)
+		return nil
+	})
+}
+
+// WithRequester names the caller the token is created for, as seen by
+// request policies and quotas. WithRequestPolicy sets it too.
+func WithRequester(requester string) Option {
+	return func(o *tokenOptions) { o.requester = requester }
+}
+
+func parseQuotas(quotas map[string]Quota) (map[string]Quota, error) {
+	parsed := make(map[string]Quota, len(quotas))
+	for name, q := range quotas {
+		if q.MaxPerDay < 0 || q.MaxLive < 0 {
+			return nil, fmt.Errorf("quotas.%s: limits cannot be negative", name)
+		}
+		if q.BroadCooldown != "" {
+			d, err := ParseTTL(q.BroadCooldown)
+			if err != nil {
+				return nil, fmt.Errorf("quotas.%s.broad_cooldown: %w", name, err)
+			}
+			q.cooldown = d
+		}
+		parsed[name] = q
+	}
+	return parsed, nil
+}
+
+// quotaFor returns the requester's quota, or the "*" quota for requesters
+// without their own.
+func (g *Generator) quotaFor(requester string) (Quota, bool) {
+	if requester == "" {
+		return Quota{}, false
+	}
+	if q, ok := g.quotas[requester]; ok {
+		return q, true
+	}
+	q, ok := g.quotas["*"]
+	return q, ok
+}
+
+// isBroad reports whether a request at scope and level counts against
+// BroadCooldown.
+func isBroad(scope, level string) bool {
+	return level == "edit" && (scope == "all" || strings.Contains(scope, "*"))
+}
+
+// checkQuota refuses the request if it would exceed the requester's quota,
+// counting the tokens recorded for them in the quota ledger. Unless it
+// returns an error, the caller must call unlock once the token is recorded,
+// so concurrent requests are counted one after the other.
+func (g *Generator) checkQuota(ctx context.Context, o tokenOptions, scope, level string) (unlock func(), err error) {
+	q, ok := g.quotaFor(o.requester)
+	if !ok {
+		return func() {}, nil
+	}
+	ledger := g.quotaLedger(o)
+	if unlock, err = ledger.LockRequester(ctx, o.requester); err != nil {
+		return nil, fmt.Errorf("checking quota: %w", err)
+	}
+	entries, err := ledger.QuotaTokens(ctx, o.requester)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("checking quota: %w", err)
+	}
+
+	now := time.Now()
+	var today, live int
+	var oldest, lastBroad time.Time
+	for _, e := range entries {
+		if now.Sub(e.CreatedAt) < 24*time.Hour {
+			today++
+			if oldest.IsZero() || e.CreatedAt.Before(oldest) {
+				oldest = e.CreatedAt
+			}
+		}
+		if e.Status != InventoryRevoked && e.Status != InventoryExpired && (e.ExpiresOn == nil || e.ExpiresOn.After(now)) {
+			live++
+		}
+		if isBroad(e.Scope, e.Level) && e.CreatedAt.After(lastBroad) {
+			lastBroad = e.CreatedAt
+		}
+	}
+
+	var qerr *QuotaError
+	switch {
+	case q.MaxPerDay > 0 && today >= q.MaxPerDay:
+		qerr = &QuotaError{Reason: fmt.Sprintf("%d tokens created in the last 24h (max %d)", today, q.MaxPerDay),
+			RetryAfter: oldest.Add(24 * time.Hour).Sub(now)}
+	case q.MaxLive > 0 && live >= q.MaxLive:
+		qerr = &QuotaError{Reason: fmt.Sprintf("%d live tokens (max %d); revoke some or wait for them to expire", live, q.MaxLive)}
+	case q.cooldown > 0 && isBroad(scope, level) && now.Sub(lastBroad) < q.cooldown:
+		wait := lastBroad.Add(q.cooldown).Sub(now)
+		qerr = &QuotaError{Reason: fmt.Sprintf("broad tokens are limited to one per %s; try again in %s", q.cooldown, wait.Round(time.Second)),
+			RetryAfter: wait}
+	}
+	if qerr != nil {
+		unlock()
+		qerr.Requester = o.requester
+		return nil, qerr
+	}
+	return unlock, nil
+}
+
+// quotaLedger returns the ledger set by WithQuotaLedger, or the local
+// inventory.
+func (g *Generator) quotaLedger(o tokenOptions) QuotaLedger {
+	if o.quotaLedger != nil {
+		return o.quotaLedger
+	}
+	return inventoryLedger{g: g}
+}
+
+// recordQuota adds a token created under a quota to the quota ledger, so
+// later requests count it. It runs last, once nothing else can revoke the
+// token, so revoked tokens aren't counted. A token that can't be recorded is
+// revoked, and the revocation exported like any other.
+func (g *Generator) recordQuota(ctx context.Context, o tokenOptions, t *Token) error {
+	if _, ok := g.quotaFor(t.Requester); !ok || t.Existing {
+		return nil
+	}
+	err := g.quotaLedger(o).RecordQuotaToken(ctx, newInventoryEntry(t, ""), t.Replaces)
+	if err == nil {
+		return nil
+	}
+	err = fmt.Errorf("recording token for quota: %w", err)
+	if rerr := g.RevokeToken(ctx, t.ID); rerr != nil {
+		return fmt.Errorf("%w; token %s could not be revoked: %v", err, t.ID, rerr)
+	}
+	return fmt.Errorf("%w; token %s was revoked", err, t.ID)
+}
@@ -0,0 +1,258 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// GenerateFromPermissions creates a token granting exactly the permission
+// groups with the given IDs on each scope, for permissions no service
+// covers. Scopes are "zone:<zone-id>", "zone:*", "account:<account-id>", or
+// "account" for the configured account.
+//
+// The level seen by request policies and guardrails is "read" if every group
+// is a read permission in the catalog, and "edit" otherwise; guardrails treat
+// the groups as a zone-scoped service named "raw" when any scope is a zone,
+// or an account and any group applies to zones, which covers every zone.
+func (g *Generator) GenerateFromPermissions(groupIDs, scopes []string, opts ...Option) (*Token, error) {
+	ctx, op := g.startOp(context.Background(), "GenerateFromPermissions")
+	token, err := g.generateFromPermissions(ctx, groupIDs, scopes, opts...)
+	op.end(token, err)
+	return token, err
+}
+
+func (g *Generator) generateFromPermissions(ctx context.Context, groupIDs, scopes []string, opts ...Option) (*Token, error) {
+	o := applyOptions(opts)
+	policies, err := policy.BuildRaw(groupIDs, scopes, o.policyOptions(g.accountID))
+	if err != nil {
+		return nil, err
+	}
+	return g.generateFromPolicies(ctx, policies, scopes, o)
+}
+
+// GenerateFromPolicies creates a token with exactly the given policies,
+// usually assembled with a policy.Builder, for grants the service catalog
+// can't express such as deny statements or resource subsets.
+//
+// Request policies and guardrails see it like GenerateFromPermissions, with
+// each resource as a scope: "zone:<id>", "account:<id>", or for a subset
+// "account:<id>/zone:<id>". Resources other than zones, accounts, and users
+// are refused.
+func (g *Generator) GenerateFromPolicies(policies []policy.Policy, opts ...Option) (*Token, error) {
+	ctx, op := g.startOp(context.Background(), "GenerateFromPolicies")
+	token, err := g.generateFromPolicies(ctx, policies, policyScopes(policies), applyOptions(opts))
+	op.end(token, err)
+	return token, err
+}
+
+func (g *Generator) generateFromPolicies(ctx context.Context, policies []policy.Policy, scopes []string, o tokenOptions) (*Token, error) {
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("at least one policy is required")
+	}
+	if err := o.policyOptions(g.accountID).CheckLimits(policies); err != nil {
+		return nil, err
+	}
+	var groupIDs []string
+	for _, p := range policies {
+		if p.Effect == "deny" {
+			continue
+		}
+		for _, pg := range p.PermissionGroups {
+			groupIDs = append(groupIDs, pg.ID)
+		}
+	}
+	level := rawLevel(groupIDs)
+	scope := strings.Join(scopes, ",")
+	if err := o.admit(nil, scope, level); err != nil {
+		return nil, err
+	}
+
+	guardScope, zoneIDs, err := g.rawGuardTarget(ctx, policies)
+	if err != nil {
+		return nil, err
+	}
+	var guarded []Service
+	if guardScope != "" || len(zoneIDs) > 0 {
+		guarded = []Service{{Name: "raw", ResourceScope: ResourceScopeZone}}
+	}
+	violation, err := g.guard(ctx, &o, guarded, guardScope, level, zoneIDs)
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := g.checkQuota(ctx, o, scope, level)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	token, err := g.createToken(ctx, fmt.Sprintf("custom-%s-%s", strings.Join(scopes, "-"), level), policies, o)
+	if err != nil {
+		return nil, err
+	}
+	token.Scope = scope
+	token.Level = level
+	if err := g.recordBreakGlass(ctx, token, o, violation); err != nil {
+		return nil, err
+	}
+	if err := g.recordIssued(ctx, token, o, violation); err != nil {
+		return nil, err
+	}
+	if err := g.recordQuota(ctx, o, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// rawGuardTarget returns what guardrails check raw policies against: the
+// zone IDs they grant on, or "all" for all zones or for an account resource
+// with zone-level permission groups, which reaches every zone in the
+// account. Resource keys other than zones, accounts, and users, and subsets
+// other than zones of one account, are refused rather than ignored.
+func (g *Generator) rawGuardTarget(ctx context.Context, policies []policy.Policy) (string, []string, error) {
+	scope := ""
+	var zoneIDs []string
+	for _, p := range policies {
+		for key, value := range p.Resources {
+			if !knownResource(key) {
+				return "", nil, fmt.Errorf("unrecognized resource %q", key)
+			}
+			subset, nested := value.(map[string]interface{})
+			if nested && (strings.HasPrefix(key, zoneResourcePrefix) || !strings.HasPrefix(key, accountResourcePrefix) || key == accountResourcePrefix+"*") {
+				return "", nil, fmt.Errorf("resource %q: only a specific account can be narrowed to a subset", key)
+			}
+			for sub := range subset {
+				if !strings.HasPrefix(sub, zoneResourcePrefix) || !knownResource(sub) {
+					return "", nil, fmt.Errorf("resource %q: unrecognized subset %q", key, sub)
+				}
+			}
+			if p.Effect == "deny" {
+				continue
+			}
+
+			keys := []string{key}
+			if nested {
+				keys = keys[:0]
+				for sub := range subset {
+					keys = append(keys, sub)
+				}
+			}
+			for _, k := range keys {
+				switch {
+				case k == zoneResourcePrefix+"*":
+					scope = "all"
+				case strings.HasPrefix(k, zoneResourcePrefix):
+					zoneIDs = append(zoneIDs, strings.TrimPrefix(k, zoneResourcePrefix))
+				case strings.HasPrefix(k, accountResourcePrefix) && scope != "all" && len(g.guardrails) > 0:
+					if g.grantsZoneGroups(ctx, p.PermissionGroups) {
+						scope = "all"
+					}
+				}
+			}
+		}
+	}
+	sort.Strings(zoneIDs)
+	return scope, slices.Compact(zoneIDs), nil
+}
+
+// knownResource reports whether key is a zone, account, or user resource.
+func knownResource(key string) bool {
+	for _, prefix := range []string{zoneResourcePrefix, accountResourcePrefix, userResourcePrefix} {
+		if id, ok := strings.CutPrefix(key, prefix); ok {
+			return id != "" && !strings.Contains(id, ".")
+		}
+	}
+	return false
+}
+
+// grantsZoneGroups reports whether any of the permission groups applies to
+// zones. Groups missing from the catalog are looked up in the live list, and
+// assumed to apply to zones if that fails.
+func (g *Generator) grantsZoneGroups(ctx context.Context, groups []policy.PermissionGroup) bool {
+	var unknown []string
+	for _, pg := range groups {
+		svc, _, ok := LookupPermission(pg.ID)
+		if !ok {
+			unknown = append(unknown, pg.ID)
+		} else if svc.ResourceScope == ResourceScopeZone {
+			return true
+		}
+	}
+	if len(unknown) == 0 {
+		return false
+	}
+	live, err := g.api.ListAPITokensPermissionGroups(ctx)
+	if err != nil {
+		return true
+	}
+	scopes := make(map[string]string, len(live))
+	for _, pg := range live {
+		scopes[pg.ID] = deriveScope(pg.Scopes)
+	}
+	for _, id := range unknown {
+		if scopes[id] != "account" {
+			return true
+		}
+	}
+	return false
+}
+
+// policyScopes describes the resources of the allow policies in the scope
+// syntax of GenerateFromPermissions, sorted.
+func policyScopes(policies []policy.Policy) []string {
+	const accountPrefix = "com.cloudflare.api.account."
+	describe := func(key string) string {
+		if id, ok := strings.CutPrefix(key, accountPrefix+"zone."); ok {
+			return "zone:" + id
+		}
+		if id, ok := strings.CutPrefix(key, accountPrefix); ok {
+			return "account:" + id
+		}
+		return key
+	}
+	seen := make(map[string]bool)
+	for _, p := range policies {
+		if p.Effect == "deny" {
+			continue
+		}
+		for key, value := range p.Resources {
+			subset, ok := value.(map[string]interface{})
+			if !ok {
+				seen[describe(key)] = true
+				continue
+			}
+			for sub := range subset {
+				seen[describe(key)+"/"+describe(sub)] = true
+			}
+		}
+	}
+	scopes := make([]string, 0, len(seen))
+	for s := range seen {
+		scopes = append(scopes, s)
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// rawLevel returns "read" if every group ID is a read permission in the
+// catalog.
+func rawLevel(groupIDs []string) string {
+	read := make(map[string]bool)
+	for _, svc := range Services {
+		for _, p := range svc.Permissions {
+			if policy.IsRead(p) {
+				read[p.ID] = true
+			}
+		}
+	}
+	for _, id := range groupIDs {
+		if !read[id] {
+			return "edit"
+		}
+	}
+	return "read"
+}
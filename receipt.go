@@ -0,0 +1,215 @@
+package cftoken
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// Receipt records what a token grants, without its secret value, so it can
+// later be shown that the token was minted by this tool with the declared
+// parameters.
+type Receipt struct {
+	TokenID   string          `json:"token_id"`
+	TokenName string          `json:"token_name"`
+	Services  []string        `json:"services,omitempty"`
+	Scope     string          `json:"scope,omitempty"`
+	Level     string          `json:"level,omitempty"`
+	Policies  []policy.Policy `json:"policies"`
+	Condition *TokenCondition `json:"condition,omitempty"`
+	NotBefore *time.Time      `json:"not_before,omitempty"`
+	ExpiresOn *time.Time      `json:"expires_on,omitempty"`
+	Requester string          `json:"requester"`
+	Timestamp time.Time       `json:"timestamp"`
+	// CatalogVersion is the service catalog the token was minted from.
+	CatalogVersion string `json:"catalog_version,omitempty"`
+	// Provenance is where the token was created, if recorded.
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// SignedReceipt is a Receipt with an ed25519 signature over its exact JSON
+// encoding.
+type SignedReceipt struct {
+	Receipt   json.RawMessage `json:"receipt"`
+	PublicKey string          `json:"public_key"`
+	Signature string          `json:"signature"`
+}
+
+// NewReceipt builds a receipt for t issued at the current time.
+func NewReceipt(t *Token, requester string) Receipt {
+	return Receipt{
+		TokenID:   t.ID,
+		TokenName: t.Name,
+		Services:  t.Services,
+		Scope:     t.Scope,
+		Level:     t.Level,
+		Policies:  t.Policies,
+		Condition: t.Condition,
+		NotBefore: t.NotBefore,
+		ExpiresOn: t.ExpiresOn,
+		Requester: requester,
+		Timestamp: time.Now().UTC(),
+
+		CatalogVersion: CatalogVersion(),
+		Provenance:     t.Provenance,
+	}
+}
+
+// Requester identifies the local user and host, e.g. "alice@bastion-1".
+func Requester() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name + "@" + host
+}
+
+// SignReceipt signs r with key.
+func SignReceipt(r Receipt, key ed25519.PrivateKey) (*SignedReceipt, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedReceipt{
+		Receipt:   data,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)),
+	}, nil
+}
+
+// VerifyReceipt checks a signed receipt against the trusted public key and
+// returns the decoded receipt. The public key embedded in the receipt is only
+// accepted if it matches pub.
+func VerifyReceipt(data []byte, pub ed25519.PublicKey) (*Receipt, error) {
+	var signed SignedReceipt
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("decoding receipt: %w", err)
+	}
+	embedded, err := base64.StdEncoding.DecodeString(signed.PublicKey)
+	if err != nil || !pub.Equal(ed25519.PublicKey(embedded)) {
+		return nil, fmt.Errorf("receipt was signed by a different key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %w", err)
+	}
+	if !ed25519.Verify(pub, signed.Receipt, sig) {
+		return nil, fmt.Errorf("receipt signature is invalid")
+	}
+	var r Receipt
+	if err := json.Unmarshal(signed.Receipt, &r); err != nil {
+		return nil, fmt.Errorf("decoding receipt: %w", err)
+	}
+	return &r, nil
+}
+
+// ReceiptKeyPath returns the path of the local receipt signing key, in the
+// state directory.
+func ReceiptKeyPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "receipt.key"), nil
+}
+
+// ErrNoReceiptKey is returned by ReadReceiptKey when no receipt signing key
+// has been created yet.
+var ErrNoReceiptKey = errors.New("no receipt signing key")
+
+// LoadReceiptKey reads the local receipt signing key, creating it on first use.
+func LoadReceiptKey() (ed25519.PrivateKey, error) {
+	key, err := ReadReceiptKey()
+	if errors.Is(err, ErrNoReceiptKey) {
+		path, err := ReceiptKeyPath()
+		if err != nil {
+			return nil, err
+		}
+		return createReceiptKey(path)
+	}
+	return key, err
+}
+
+// ReadReceiptKey reads the local receipt signing key without creating one.
+// It returns an error wrapping ErrNoReceiptKey if the key doesn't exist, so
+// verifying never leaves a fresh key behind.
+func ReadReceiptKey() (ed25519.PrivateKey, error) {
+	path, err := ReceiptKeyPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w at %s", ErrNoReceiptKey, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+func createReceiptKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParsePublicKey decodes a PEM-encoded ed25519 public key.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 public key")
+	}
+	return edKey, nil
+}
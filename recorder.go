@@ -0,0 +1,259 @@
+package cftoken
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RecordMode selects whether a Recorder calls the API or replays a cassette.
+type RecordMode string
+
+const (
+	// RecordModeRecord sends every request and records it, replacing the
+	// cassette on Save.
+	RecordModeRecord RecordMode = "record"
+	// RecordModeReplay answers every request from the cassette and never
+	// touches the network.
+	RecordModeReplay RecordMode = "replay"
+	// RecordModeAuto replays the cassette if it exists and records one
+	// otherwise.
+	RecordModeAuto RecordMode = "auto"
+)
+
+// redacted replaces secrets in recorded interactions.
+const redacted = "REDACTED"
+
+// redactedHeaders are dropped from recorded responses. Request headers aren't
+// recorded at all.
+var redactedHeaders = []string{"Set-Cookie", "Authorization", AccessJWTHeader}
+
+// Recorder is an http.RoundTripper that records API interactions to a YAML
+// cassette and replays them, so integration tests run offline and
+// deterministically. Credentials are never recorded: authentication
+// headers are dropped and token secrets in response bodies replaced with
+// "REDACTED". Use it with Generator.SetRecorder, or as the transport of any
+// other client.
+//
+// On replay, each request is answered by the first unused interaction with
+// the same method and URL, so a test replays correctly as long as it makes
+// the same calls in the same order. Request bodies aren't compared, since
+// they carry expiry times computed from the clock.
+type Recorder struct {
+	// Base sends requests while recording; nil uses http.DefaultTransport.
+	// SetRecorder sets it to the Generator's own transport.
+	Base http.RoundTripper
+
+	path      string
+	replaying bool
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `yaml:"request"`
+	Response RecordedResponse `yaml:"response"`
+}
+
+// RecordedRequest is the part of a request a cassette keeps.
+type RecordedRequest struct {
+	Method string `yaml:"method"`
+	URL    string `yaml:"url"`
+	Body   string `yaml:"body,omitempty"`
+}
+
+// RecordedResponse is a recorded response.
+type RecordedResponse struct {
+	Status  int         `yaml:"status"`
+	Headers http.Header `yaml:"headers,omitempty"`
+	Body    string      `yaml:"body,omitempty"`
+}
+
+type cassette struct {
+	Interactions []Interaction `yaml:"interactions"`
+}
+
+// NewRecorder opens the cassette at path in the given mode. Replay mode
+// fails if the cassette doesn't exist.
+func NewRecorder(path string, mode RecordMode) (*Recorder, error) {
+	r := &Recorder{path: path}
+	switch mode {
+	case RecordModeRecord:
+		return r, nil
+	case RecordModeReplay, RecordModeAuto:
+	default:
+		return nil, fmt.Errorf("invalid record mode %q (use record, replay, or auto)", mode)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && mode == RecordModeAuto {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading cassette: %w", err)
+	}
+	var c cassette
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parsing cassette %s: %w", path, err)
+	}
+	r.replaying = true
+	r.interactions = c.Interactions
+	r.used = make([]bool, len(c.Interactions))
+	return r, nil
+}
+
+// Replaying reports whether the recorder answers from its cassette.
+func (r *Recorder) Replaying() bool { return r.replaying }
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if r.replaying {
+		return r.replay(req)
+	}
+
+	// Base may rewrite the URL, so note it first.
+	recorded := RecordedRequest{Method: req.Method, URL: req.URL.String(), Body: string(body)}
+	path := req.URL.Path
+	base := r.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	headers := resp.Header.Clone()
+	for _, h := range redactedHeaders {
+		headers.Del(h)
+	}
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{
+		Request: recorded,
+		Response: RecordedResponse{
+			Status:  resp.StatusCode,
+			Headers: headers,
+			Body:    redactSecrets(path, respBody),
+		},
+	})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	url := req.URL.String()
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request.Method != req.Method || in.Request.URL != url {
+			continue
+		}
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Headers.Clone(),
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("cassette %s has no unused interaction for %s %s", r.path, req.Method, url)
+}
+
+// Unused returns the recorded interactions a replay hasn't used, for tests
+// that want to check every recorded call was made.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, in := range r.interactions {
+		if r.replaying && !r.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return unused
+}
+
+// Save writes the recorded interactions to the cassette. It does nothing
+// when replaying.
+func (r *Recorder) Save() error {
+	if r.replaying {
+		return nil
+	}
+	r.mu.Lock()
+	data, err := yaml.Marshal(cassette{Interactions: r.interactions})
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.path, data, 0644)
+}
+
+// redactSecrets replaces token values in a Cloudflare response body: the
+// "value" of a created token, and the new secret returned by a roll.
+func redactSecrets(path string, body []byte) string {
+	var resp map[string]interface{}
+	if !strings.Contains(path, "/tokens") || json.Unmarshal(body, &resp) != nil {
+		return string(body)
+	}
+	switch result := resp["result"].(type) {
+	case string:
+		if strings.HasSuffix(path, "/value") {
+			resp["result"] = redacted
+		}
+	case map[string]interface{}:
+		if _, ok := result["value"]; ok {
+			result["value"] = redacted
+		}
+	default:
+		return string(body)
+	}
+	out, err := json.Marshal(resp)
+	if err != nil {
+		return string(body)
+	}
+	return string(out)
+}
+
+// SetRecorder sends the Generator's API requests through r, recording or
+// replaying them. While recording, r.Base defaults to the Generator's own
+// transport, keeping its proxy and CA settings. Call it before making
+// requests.
+func (g *Generator) SetRecorder(r *Recorder) {
+	tr := g.client.Transport.(tracingTransport)
+	if r.Base == nil {
+		r.Base = tr.base
+	}
+	tr.base = r
+	g.client.Transport = tr
+}
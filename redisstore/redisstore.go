@@ -0,0 +1,187 @@
+// Package redisstore keeps the webhook's state and quota counts in Redis,
+// shared by every replica that uses the same server.
+package redisstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// lockTTL bounds how long a crashed process can hold a requester's
+// quota lock.
+const lockTTL = time.Minute
+
+// unlockScript deletes a lock only if it still holds this holder's value, so
+// a lock that expired and was taken by another process is left alone.
+const unlockScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) end return 0`
+
+// Store is a cftoken.WebhookStore and cftoken.QuotaLedger in Redis, so several webhook
+// replicas behind a load balancer share request records, signature nonces,
+// and quota counts. Keys start with "cftg:".
+type Store struct {
+	client *redis.Client
+}
+
+// Open connects to the Redis server at url, e.g.
+// "redis://:password@redis:6379/0" or "rediss://..." for TLS.
+func Open(ctx context.Context, url string) (*Store, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	s := &Store{client: redis.NewClient(opts)}
+	if err := s.Ping(ctx); err != nil {
+		s.client.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+const (
+	requestsKey = "cftg:webhook:requests"
+	noncePrefix = "cftg:webhook:nonce:"
+	quotaPrefix = "cftg:quota:"
+	lockPrefix  = "cftg:quota-lock:"
+)
+
+func (s *Store) PutRequest(ctx context.Context, r cftoken.WebhookRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, requestsKey, r.ID, data).Err()
+}
+
+func (s *Store) Requests(ctx context.Context, status string) ([]cftoken.WebhookRecord, error) {
+	all, err := s.client.HGetAll(ctx, requestsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var records []cftoken.WebhookRecord
+	for id, v := range all {
+		var r cftoken.WebhookRecord
+		if err := json.Unmarshal([]byte(v), &r); err != nil {
+			return nil, fmt.Errorf("request %s: %w", id, err)
+		}
+		if status == "" || r.Status == status {
+			records = append(records, r)
+		}
+	}
+	slices.SortStableFunc(records, func(a, b cftoken.WebhookRecord) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return records, nil
+}
+
+func (s *Store) UseNonce(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, noncePrefix+key, 1, ttl).Result()
+}
+
+// Prune deletes old request records; nonces expire on their own.
+func (s *Store) Prune(ctx context.Context, before time.Time) error {
+	all, err := s.client.HGetAll(ctx, requestsKey).Result()
+	if err != nil {
+		return err
+	}
+	var stale []string
+	for id, v := range all {
+		var r cftoken.WebhookRecord
+		if json.Unmarshal([]byte(v), &r) == nil && r.Prunable(before) {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return s.client.HDel(ctx, requestsKey, stale...).Err()
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	if err := s.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("redis: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Close() error { return s.client.Close() }
+
+// LockRequester takes a lock in Redis, waiting for other processes to
+// release it. The lock expires after a minute if its holder dies.
+func (s *Store) LockRequester(ctx context.Context, requester string) (func(), error) {
+	key := lockPrefix + requester
+	holder := newHolderID()
+	for {
+		ok, err := s.client.SetNX(ctx, key, holder, lockTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() {
+				s.client.Eval(context.WithoutCancel(ctx), unlockScript, []string{key}, holder)
+			}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// QuotaTokens returns the requester's recorded tokens, first dropping
+// those that expired over 30 days ago, which no quota counts.
+func (s *Store) QuotaTokens(ctx context.Context, requester string) ([]cftoken.InventoryEntry, error) {
+	key := quotaPrefix + requester
+	all, err := s.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	var entries []cftoken.InventoryEntry
+	var stale []string
+	for id, v := range all {
+		var e cftoken.InventoryEntry
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			return nil, fmt.Errorf("quota entry %s: %w", id, err)
+		}
+		if e.ExpiresOn != nil && e.ExpiresOn.Before(cutoff) && e.CreatedAt.Before(cutoff) {
+			stale = append(stale, id)
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(stale) > 0 {
+		s.client.HDel(ctx, key, stale...)
+	}
+	return entries, nil
+}
+
+func (s *Store) RecordQuotaToken(ctx context.Context, e cftoken.InventoryEntry, replaces []string) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	key := quotaPrefix + e.Requester
+	_, err = s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		if len(replaces) > 0 {
+			p.HDel(ctx, key, replaces...)
+		}
+		p.HSet(ctx, key, e.ID, data)
+		return nil
+	})
+	return err
+}
+
+// newHolderID returns a random value identifying one holder of a lock.
+func newHolderID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
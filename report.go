@@ -0,0 +1,91 @@
+package cftoken
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// auditRuleDescriptions describe each rule in SARIF output.
+var auditRuleDescriptions = map[string]string{
+	RuleMaxTTL:              "Token lifetime exceeds the maximum TTL",
+	RuleForbiddenPermission: "Token holds a forbidden permission group",
+	RuleMaxPermissionGroups: "Token holds too many permission groups",
+	RuleIPCondition:         "Token has no IP allow list",
+	RuleNaming:              "Token name breaks the naming convention",
+}
+
+// ExportAuditReport writes an audit report to w. Format is "csv" (one row per
+// violation) or "sarif" (SARIF 2.1.0, for code-scanning dashboards; results
+// point at the rules file).
+func ExportAuditReport(w io.Writer, r *AuditReport, format string) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"token_id", "token_name", "rule", "message"})
+		for _, v := range r.Violations {
+			cw.Write([]string{v.TokenID, v.TokenName, v.Rule, v.Message})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "sarif":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(sarifLog(r))
+	default:
+		return fmt.Errorf("unsupported report format %q, must be \"csv\" or \"sarif\"", format)
+	}
+}
+
+func sarifLog(r *AuditReport) map[string]interface{} {
+	var rules []map[string]interface{}
+	for _, id := range []string{RuleMaxTTL, RuleForbiddenPermission, RuleMaxPermissionGroups, RuleIPCondition, RuleNaming} {
+		rules = append(rules, map[string]interface{}{
+			"id":               id,
+			"shortDescription": map[string]string{"text": auditRuleDescriptions[id]},
+		})
+	}
+
+	results := []map[string]interface{}{}
+	for _, v := range r.Violations {
+		result := map[string]interface{}{
+			"ruleId":  v.Rule,
+			"level":   "error",
+			"message": map[string]string{"text": fmt.Sprintf("Token %q (%s) %s", v.TokenName, v.TokenID, v.Message)},
+			"partialFingerprints": map[string]string{
+				"tokenRule": v.TokenID + "/" + v.Rule,
+			},
+		}
+		location := map[string]interface{}{
+			"logicalLocations": []map[string]string{{
+				"name":               v.TokenName,
+				"fullyQualifiedName": "cloudflare/tokens/" + v.TokenID,
+				"kind":               "resource",
+			}},
+		}
+		if r.RulesFile != "" {
+			location["physicalLocation"] = map[string]interface{}{
+				"artifactLocation": map[string]string{"uri": r.RulesFile},
+				"region":           map[string]int{"startLine": 1},
+			}
+		}
+		result["locations"] = []interface{}{location}
+		results = append(results, result)
+	}
+
+	return map[string]interface{}{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []interface{}{map[string]interface{}{
+			"tool": map[string]interface{}{
+				"driver": map[string]interface{}{
+					"name":           "cloudflare-token-generator",
+					"informationUri": "https://github.com/jackm43/cloudflare-token-generator",
+					"rules":          rules,
+				},
+			},
+			"results": results,
+		}},
+	}
+}
@@ -0,0 +1,47 @@
+package cftoken
+
+import (
+	"fmt"
+	"time"
+)
+
+// TokenRequest describes a token about to be created, as seen by a
+// RequestPolicy.
+type TokenRequest struct {
+	Services []string
+	Scope    string
+	Level    string
+	// TTL is zero for tokens that never expire.
+	TTL       time.Duration
+	Accounts  []string
+	Zones     []string
+	Requester string
+}
+
+// RequestPolicy admits or refuses token requests before their tokens are
+// created. The requestpolicy package implements it with CEL rules.
+type RequestPolicy interface {
+	// Evaluate returns nil to admit req, or an error to refuse it, usually
+	// a *PolicyDeniedError.
+	Evaluate(req TokenRequest) error
+}
+
+// PolicyDeniedError is returned when a request fails a rule.
+type PolicyDeniedError struct {
+	Rule    string
+	Message string
+}
+
+func (e *PolicyDeniedError) Error() string {
+	return fmt.Sprintf("request denied by policy rule %q: %s", e.Rule, e.Message)
+}
+
+// WithRequestPolicy evaluates p against the request before the token is
+// created. requester identifies the caller to the policy; empty means the
+// local user (see Requester).
+func WithRequestPolicy(p RequestPolicy, requester string) Option {
+	return func(o *tokenOptions) {
+		o.policy = p
+		o.requester = requester
+	}
+}
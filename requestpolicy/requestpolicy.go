@@ -0,0 +1,125 @@
+// Package requestpolicy admits token requests with rules written in CEL.
+package requestpolicy
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+// Rule is one admission rule. Expr is a CEL expression over the variables
+// services (list of strings), scope, level, requester (strings), accounts
+// and zones (lists of strings), and ttl (duration, zero when the token
+// doesn't expire). A request is admitted only if Expr evaluates to true.
+type Rule struct {
+	Name    string `yaml:"name"`
+	Expr    string `yaml:"expr"`
+	Message string `yaml:"message"`
+
+	program cel.Program
+}
+
+// Policy is a set of admission rules evaluated against every token
+// request. It is a cftoken.RequestPolicy.
+type Policy struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// Load reads a YAML policy file and compiles its rules.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := p.Compile(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Compile type-checks every rule. Load calls it; policies built in code
+// must call it before use.
+func (p *Policy) Compile() error {
+	env, err := cel.NewEnv(
+		cel.Variable("services", cel.ListType(cel.StringType)),
+		cel.Variable("scope", cel.StringType),
+		cel.Variable("level", cel.StringType),
+		cel.Variable("ttl", cel.DurationType),
+		cel.Variable("accounts", cel.ListType(cel.StringType)),
+		cel.Variable("zones", cel.ListType(cel.StringType)),
+		cel.Variable("requester", cel.StringType),
+	)
+	if err != nil {
+		return err
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		ast, issues := env.Compile(r.Expr)
+		if issues != nil && issues.Err() != nil {
+			return fmt.Errorf("%s: %w", r.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType {
+			return fmt.Errorf("%s: expression must return a bool, not %s", r.Name, ast.OutputType())
+		}
+		if r.program, err = env.Program(ast); err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// Evaluate checks req against every rule, returning
+// *cftoken.PolicyDeniedError for the first rule it fails. A nil policy
+// admits everything.
+func (p *Policy) Evaluate(req cftoken.TokenRequest) error {
+	if p == nil {
+		return nil
+	}
+	if req.Requester == "" {
+		req.Requester = cftoken.Requester()
+	}
+	vars := map[string]interface{}{
+		"services":  nonNil(req.Services),
+		"scope":     req.Scope,
+		"level":     req.Level,
+		"ttl":       req.TTL,
+		"accounts":  nonNil(req.Accounts),
+		"zones":     nonNil(req.Zones),
+		"requester": req.Requester,
+	}
+	for _, r := range p.Rules {
+		if r.program == nil {
+			return fmt.Errorf("policy rule %q is not compiled", r.Name)
+		}
+		out, _, err := r.program.Eval(vars)
+		if err != nil {
+			return fmt.Errorf("evaluating policy rule %q: %w", r.Name, err)
+		}
+		if allowed, ok := out.Value().(bool); !ok || !allowed {
+			msg := r.Message
+			if msg == "" {
+				msg = r.Expr
+			}
+			return &cftoken.PolicyDeniedError{Rule: r.Name, Message: msg}
+		}
+	}
+	return nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
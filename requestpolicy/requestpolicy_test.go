@@ -0,0 +1,57 @@
+package requestpolicy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cftoken "github.com/jackmunro/cloudflare-token-generator"
+)
+
+func TestEvaluate(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Name: "no-godmode", Expr: `!(level == "edit" && scope == "all")`, Message: "edit tokens must be scoped"},
+		{Name: "short-lived", Expr: `ttl > duration("0s") && ttl <= duration("24h")`},
+		{Expr: `requester != "" && !("r2" in services)`},
+	}}
+	if err := p.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		req  cftoken.TokenRequest
+		rule string // empty if admitted
+	}{
+		{"admitted", cftoken.TokenRequest{Services: []string{"dns"}, Scope: "example.com", Level: "edit", TTL: time.Hour, Requester: "ci"}, ""},
+		{"broad edit", cftoken.TokenRequest{Services: []string{"dns"}, Scope: "all", Level: "edit", TTL: time.Hour, Requester: "ci"}, "no-godmode"},
+		{"never expires", cftoken.TokenRequest{Services: []string{"dns"}, Scope: "all", Level: "read", Requester: "ci"}, "short-lived"},
+		{"unnamed rule", cftoken.TokenRequest{Services: []string{"r2"}, Scope: "all", Level: "read", TTL: time.Hour, Requester: "ci"}, "rule 3"},
+	}
+	for _, tt := range tests {
+		err := p.Evaluate(tt.req)
+		var denied *cftoken.PolicyDeniedError
+		switch {
+		case tt.rule == "" && err != nil:
+			t.Errorf("%s: %v", tt.name, err)
+		case tt.rule != "" && (!errors.As(err, &denied) || denied.Rule != tt.rule):
+			t.Errorf("%s: got %v, want a denial by %s", tt.name, err, tt.rule)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{`level ==`, `level`, `owner == "me"`} {
+		p := &Policy{Rules: []Rule{{Expr: expr}}}
+		if err := p.Compile(); err == nil {
+			t.Errorf("Compile(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var p *Policy
+	var policy cftoken.RequestPolicy = p
+	if err := policy.Evaluate(cftoken.TokenRequest{}); err != nil {
+		t.Errorf("nil policy refused a request: %v", err)
+	}
+}
@@ -0,0 +1,95 @@
+package cftoken
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSigningKey = []byte(strings.Repeat("k", 32))
+
+// signAt signs r as client at the given time, as SignRequest does now.
+func signAt(r *http.Request, client string, at time.Time, nonce string, body []byte) {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	r.Header.Set(SignatureClientHeader, client)
+	r.Header.Set(SignatureTimestampHeader, ts)
+	r.Header.Set(SignatureNonceHeader, nonce)
+	mac := signatureMAC(testSigningKey, r.Method, r.URL.Path, r.URL.RawQuery, ts, nonce, body)
+	r.Header.Set(SignatureHeader, "v1="+hex.EncodeToString(mac))
+}
+
+func TestSignatureVerify(t *testing.T) {
+	body := []byte(`{"services":["dns"],"scope":"example.com"}`)
+	now := time.Now()
+	tests := []struct {
+		name string
+		// at is when the request was signed, relative to now.
+		at time.Duration
+		// change alters the request after it was signed.
+		change  func(r *http.Request)
+		body    string
+		wantErr string
+	}{
+		{name: "valid"},
+		{name: "within skew", at: -4 * time.Minute},
+		{name: "too old", at: -6 * time.Minute, wantErr: "outside the allowed 5m0s"},
+		{name: "too far ahead", at: 6 * time.Minute, wantErr: "outside the allowed 5m0s"},
+		{name: "body tampered", body: `{"services":["dns"],"scope":"all"}`, wantErr: "invalid request signature"},
+		{name: "query tampered", change: func(r *http.Request) { r.URL.RawQuery = "level=edit" }, wantErr: "invalid request signature"},
+		{name: "path changed", change: func(r *http.Request) { r.URL.Path = "/admin" }, wantErr: "invalid request signature"},
+		{name: "timestamp changed", change: func(r *http.Request) {
+			r.Header.Set(SignatureTimestampHeader, strconv.FormatInt(now.Unix()+1, 10))
+		}, wantErr: "invalid request signature"},
+		{name: "unknown client", change: func(r *http.Request) { r.Header.Set(SignatureClientHeader, "other") }, wantErr: `unknown client "other"`},
+		{name: "unsigned", change: func(r *http.Request) { r.Header.Del(SignatureHeader) }, wantErr: "missing request signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newSignatureVerifier(map[string][]byte{"ci": testSigningKey}, 0, nil)
+			r := httptest.NewRequest("POST", "/?level=read", nil)
+			signAt(r, "ci", now.Add(tt.at), "nonce-1", body)
+			if tt.change != nil {
+				tt.change(r)
+			}
+			sent := body
+			if tt.body != "" {
+				sent = []byte(tt.body)
+			}
+			client, err := v.verify(r, sent)
+			if tt.wantErr == "" {
+				if err != nil || client != "ci" {
+					t.Fatalf("verify() = %q, %v; want \"ci\", nil", client, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("verify() error = %v; want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifyReplay(t *testing.T) {
+	v := newSignatureVerifier(map[string][]byte{"ci": testSigningKey, "deploy": testSigningKey}, 0, nil)
+	r := httptest.NewRequest("POST", "/?level=read", strings.NewReader("{}"))
+	if err := SignRequest(r, "ci", testSigningKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.verify(r, []byte("{}")); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if _, err := v.verify(r, []byte("{}")); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("replay: error = %v; want already used", err)
+	}
+
+	// Nonces are remembered per client.
+	other := httptest.NewRequest("POST", "/?level=read", nil)
+	signAt(other, "deploy", time.Now(), r.Header.Get(SignatureNonceHeader), []byte("{}"))
+	if _, err := v.verify(other, []byte("{}")); err != nil {
+		t.Fatalf("same nonce from another client: %v", err)
+	}
+}
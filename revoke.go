@@ -0,0 +1,98 @@
+package cftoken
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RevokeResult reports what happened to one token in RevokeTokens.
+type RevokeResult struct {
+	ID       string
+	Attempts int
+	Err      error
+}
+
+// RevokeOptions controls RevokeTokens.
+type RevokeOptions struct {
+	// Concurrency is the number of tokens deleted in parallel (default 4).
+	Concurrency int
+	// Retries is how many times a failed deletion is retried (default 2;
+	// negative disables retries).
+	Retries int
+	// Progress, if set, is called after each token finishes. Calls are
+	// serialized.
+	Progress func(done, total int, r RevokeResult)
+}
+
+// RevokeTokens deletes the tokens with the given IDs with a bounded worker
+// pool. As in RunBatch, the workers share the Generator's client and its
+// built-in rate limiter, and transient failures are retried with backoff.
+// Results are returned in the order of ids; tokens not started before ctx is
+// cancelled fail with ctx.Err(), while revocations already sent finish.
+func (g *Generator) RevokeTokens(ctx context.Context, ids []string, opts RevokeOptions) []RevokeResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = 2
+	}
+
+	results := make([]RevokeResult, len(ids))
+	jobs := make(chan int)
+	var mu sync.Mutex
+	done := 0
+	finish := func(i int, r RevokeResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = r
+		done++
+		if opts.Progress != nil {
+			opts.Progress(done, len(ids), r)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				finish(i, g.revokeWithRetry(ctx, ids[i], opts.Retries))
+			}
+		}()
+	}
+
+	for i, id := range ids {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			finish(i, RevokeResult{ID: id, Err: ctx.Err()})
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+func (g *Generator) revokeWithRetry(ctx context.Context, id string, retries int) RevokeResult {
+	r := RevokeResult{ID: id}
+	backoff := time.Second
+	for {
+		r.Attempts++
+		// Let a revocation already under way finish if ctx is cancelled.
+		r.Err = g.RevokeToken(context.WithoutCancel(ctx), id)
+		if r.Err == nil || !IsRetryable(r.Err) || r.Attempts > retries {
+			return r
+		}
+		select {
+		case <-ctx.Done():
+			r.Err = ctx.Err()
+			return r
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,124 @@
+package cftoken
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sink receives a newly created token's secret.
+type Sink interface {
+	Deliver(t *Token) error
+	String() string
+}
+
+// ParseSink parses a sink specification. Supported forms:
+//
+//	file:<path>   write the token value to path with mode 0600
+//	fd:<n>        write the token value to an inherited file descriptor
+//	clipboard     copy the token value to the system clipboard
+func ParseSink(spec string) (Sink, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("sink %q: missing path", spec)
+		}
+		return fileSink{path: arg}, nil
+	case "fd":
+		fd, err := strconv.Atoi(arg)
+		if err != nil || fd < 3 {
+			return nil, fmt.Errorf("sink %q: descriptor must be a number of 3 or more", spec)
+		}
+		return fdSink{fd: fd}, nil
+	case "clipboard":
+		return clipboardSink{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q", spec)
+	}
+}
+
+type fileSink struct {
+	path string
+}
+
+func (s fileSink) Deliver(t *Token) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, []byte(t.Value+"\n"), 0600)
+}
+
+func (s fileSink) String() string { return "file:" + s.path }
+
+// Exists reports whether the file is still there.
+func (s fileSink) Exists() (bool, error) {
+	_, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type fdSink struct {
+	fd int
+}
+
+// fdFiles holds the files opened for fd sinks. They are never closed: the
+// descriptor belongs to whoever passed it in, and retries and other tokens,
+// such as batch entries sharing fd:3, write to it again. Keeping them here
+// also stops their finalizers from closing the descriptor.
+var (
+	fdFilesMu sync.Mutex
+	fdFiles   = make(map[int]*os.File)
+)
+
+func (s fdSink) Deliver(t *Token) error {
+	fdFilesMu.Lock()
+	defer fdFilesMu.Unlock()
+	f, ok := fdFiles[s.fd]
+	if !ok {
+		if f = os.NewFile(uintptr(s.fd), "fd"+strconv.Itoa(s.fd)); f == nil {
+			return fmt.Errorf("file descriptor %d is not open", s.fd)
+		}
+		fdFiles[s.fd] = f
+	}
+	_, err := f.WriteString(t.Value + "\n")
+	return err
+}
+
+func (s fdSink) String() string { return "fd:" + strconv.Itoa(s.fd) }
+
+type clipboardSink struct{}
+
+// clipboardCommands are tried in order until one is installed.
+var clipboardCommands = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip.exe"}},
+	"linux":   {{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}},
+}
+
+func (clipboardSink) Deliver(t *Token) error {
+	for _, argv := range clipboardCommands[runtime.GOOS] {
+		path, err := exec.LookPath(argv[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, argv[1:]...)
+		cmd.Stdin = strings.NewReader(t.Value)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %v: %s", argv[0], err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard command found")
+}
+
+func (clipboardSink) String() string { return "clipboard" }
@@ -0,0 +1,121 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// rolePermissionServices maps account role permission keys to the services
+// that grant equivalent API access.
+var rolePermissionServices = map[string][]string{
+	"dns":           {"dns"},
+	"dns_records":   {"dns"},
+	"zones":         {"zone"},
+	"zone_settings": {"zone"},
+	"cache_purge":   {"cache"},
+	"ssl":           {"ssl"},
+	"waf":           {"waf", "firewall"},
+	"lb":            {"loadbalancer"},
+	"page_rules":    {"pagerules"},
+	"workers":       {"workers", "kv"},
+	"stream":        {"stream"},
+	"images":        {"images"},
+	"r2":            {"r2"},
+	"pages":         {"pages"},
+	"d1":            {"d1"},
+	"queues":        {"queues"},
+	"tunnels":       {"tunnels"},
+	"ai":            {"ai"},
+	"analytics":     {"analytics", "account-analytics"},
+	"logs":          {"analytics", "account-analytics"},
+	"billing":       {"billing"},
+	"organization":  {"account", "members"},
+}
+
+// SuggestForMember reads the roles of the account member with the given email
+// and suggests token definitions granting the equivalent API access, to help
+// move people off Global API Keys. Services the member can edit and services
+// they can only read become separate presets, so neither grants more than the
+// roles do. Role permissions with no matching service are reported as
+// warnings.
+func (g *Generator) SuggestForMember(ctx context.Context, email string) ([]Preset, []string, error) {
+	if g.accountID == "" {
+		return nil, nil, fmt.Errorf("account_id required to read account members")
+	}
+	member, err := g.findMember(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var warnings []string
+	if len(member.Roles) == 0 && len(member.Policies) > 0 {
+		return nil, nil, fmt.Errorf("%s is granted access through %d member policies; only role-based members can be mapped", email, len(member.Policies))
+	}
+
+	levels := make(map[string]string)
+	unmapped := make(map[string]bool)
+	for _, role := range member.Roles {
+		for key, perm := range role.Permissions {
+			if !perm.Read && !perm.Edit {
+				continue
+			}
+			services, ok := rolePermissionServices[key]
+			if !ok {
+				unmapped[key] = true
+				continue
+			}
+			for _, svc := range services {
+				if perm.Edit {
+					levels[svc] = "edit"
+				} else if levels[svc] == "" {
+					levels[svc] = "read"
+				}
+			}
+		}
+	}
+	for key := range unmapped {
+		warnings = append(warnings, fmt.Sprintf("role permission %q has no matching service", key))
+	}
+	sort.Strings(warnings)
+
+	if len(levels) == 0 {
+		return nil, warnings, fmt.Errorf("%s's roles grant no permissions that map to known services", email)
+	}
+
+	var presets []Preset
+	for _, level := range []string{"edit", "read"} {
+		p := Preset{Scope: "all", Level: level}
+		for svc, l := range levels {
+			if l == level {
+				p.Services = append(p.Services, svc)
+			}
+		}
+		if len(p.Services) > 0 {
+			sort.Strings(p.Services)
+			presets = append(presets, p)
+		}
+	}
+	return presets, warnings, nil
+}
+
+// findMember pages through the account's members for one with email.
+func (g *Generator) findMember(ctx context.Context, email string) (*AccountMember, error) {
+	page := PageOptions{Page: 1, PerPage: 50}
+	for {
+		members, info, err := g.api.AccountMembers(ctx, g.accountID, page)
+		if err != nil {
+			return nil, fmt.Errorf("listing account members: %w", err)
+		}
+		for i, m := range members {
+			if strings.EqualFold(m.User.Email, email) {
+				return &members[i], nil
+			}
+		}
+		if page.Page >= info.TotalPages || len(members) == 0 {
+			return nil, fmt.Errorf("no account member with email %s", email)
+		}
+		page.Page++
+	}
+}
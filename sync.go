@@ -0,0 +1,85 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// SyncChange is an inventory entry whose status changed during a sync.
+type SyncChange struct {
+	ID   string
+	Name string
+	From string
+	To   string
+}
+
+// SyncReport is the result of SyncInventory.
+type SyncReport struct {
+	// Changes lists entries whose status changed.
+	Changes []SyncChange
+	// Missing lists entries whose token no longer exists in the account.
+	Missing []InventoryEntry
+	// Untracked lists live tokens with no inventory entry. Those with a
+	// managed name (Tagged) were most likely created by this tool elsewhere.
+	Untracked []TokenInfo
+}
+
+// SyncInventory cross-references the inventory with the tokens live in the
+// account, without changing anything in Cloudflare. Each entry's status,
+// name, and expiry are updated from its token, and entries whose token is
+// gone are marked InventoryRevoked rather than dropped, so the inventory
+// keeps a record of them for audits. The caller saves the inventory.
+func (g *Generator) SyncInventory(ctx context.Context, inv *Inventory) (*SyncReport, error) {
+	tokens, err := g.api.APITokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tokens: %w", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	live := make(map[string]TokenInfo, len(tokens))
+	for _, t := range tokens {
+		info := TokenInfo{APIToken: t}
+		info.Tags, info.Tagged = ParseTaggedName(t.Name)
+		live[t.ID] = info
+	}
+
+	report := &SyncReport{}
+	tracked := make(map[string]bool, len(inv.Tokens))
+	for i := range inv.Tokens {
+		e := &inv.Tokens[i]
+		tracked[e.ID] = true
+		status := InventoryRevoked
+		if t, ok := live[e.ID]; ok {
+			status = liveStatus(t, now)
+			e.Name = t.Name
+			e.ExpiresOn = t.ExpiresOn
+		} else {
+			report.Missing = append(report.Missing, *e)
+		}
+		if status != e.Status {
+			report.Changes = append(report.Changes, SyncChange{ID: e.ID, Name: e.Name, From: e.Status, To: status})
+			e.Status = status
+		}
+		e.SyncedAt = &now
+	}
+
+	for _, t := range tokens {
+		if !tracked[t.ID] {
+			report.Untracked = append(report.Untracked, live[t.ID])
+		}
+	}
+	return report, nil
+}
+
+func liveStatus(t TokenInfo, now time.Time) string {
+	switch {
+	case t.ExpiresOn != nil && !t.ExpiresOn.After(now):
+		return InventoryExpired
+	case t.Status == "disabled":
+		return InventoryDisabled
+	case t.Status == "expired":
+		return InventoryExpired
+	}
+	return InventoryActive
+}
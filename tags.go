@@ -0,0 +1,206 @@
+package cftoken
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// tagPrefix starts every token name written by the tagging convention.
+const tagPrefix = "cftg"
+
+// Tags are the team and purpose encoded in a managed token name of the form
+// "cftg:<team>:<purpose>:<hash>". Cloudflare tokens have no labels, so the
+// name carries them.
+type Tags struct {
+	Team    string
+	Purpose string
+	// Hash is a short digest of the token's policies, keeping names for
+	// different grants apart while the same request always gets the same name.
+	Hash string
+}
+
+// TaggedName returns the managed name for a token with the given team,
+// purpose, and policies. Colons in team or purpose are replaced with dashes.
+func TaggedName(team, purpose string, policies []policy.Policy) string {
+	return strings.Join([]string{tagPrefix, tagComponent(team), tagComponent(purpose), policyHash(policies)}, ":")
+}
+
+// ParseTaggedName extracts the tags from a managed token name, ignoring any
+// WithIdempotencyKey suffix. It reports false for names not written by
+// TaggedName.
+func ParseTaggedName(name string) (Tags, bool) {
+	parts := strings.Split(trimIdempotencyKey(name), ":")
+	if len(parts) != 4 || parts[0] != tagPrefix || parts[3] == "" {
+		return Tags{}, false
+	}
+	return Tags{Team: parts[1], Purpose: parts[2], Hash: parts[3]}, true
+}
+
+// WithTags names the token with TaggedName, so it can later be found by team
+// and purpose. It takes precedence over WithName.
+func WithTags(team, purpose string) Option {
+	return func(o *tokenOptions) {
+		o.team = team
+		o.purpose = purpose
+		o.tagged = true
+	}
+}
+
+func tagComponent(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(s), ":", "-")
+}
+
+// policyHash returns the first 8 hex digits of a SHA-256 over the policies'
+// effects, resources, and permission group IDs.
+func policyHash(policies []policy.Policy) string {
+	type key struct {
+		Effect    string                 `json:"e"`
+		Resources map[string]interface{} `json:"r"`
+		Groups    []string               `json:"g"`
+	}
+	keys := make([]key, 0, len(policies))
+	for _, p := range policies {
+		k := key{Effect: p.Effect, Resources: p.Resources}
+		for _, pg := range p.PermissionGroups {
+			k.Groups = append(k.Groups, pg.ID)
+		}
+		keys = append(keys, k)
+	}
+	data, _ := json.Marshal(keys)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4])
+}
+
+// TokenInfo is an existing token as listed by ListTokens.
+type TokenInfo struct {
+	APIToken
+	// Tags is set when Tagged, i.e. the name follows the managed convention.
+	Tags   Tags
+	Tagged bool
+	// LastUsedOn is filled in when TokenFilter.LastUsed or UnusedFor is set;
+	// nil means the token has never been used.
+	LastUsedOn *time.Time
+}
+
+// TokenFilter selects tokens in ListTokens. Zero fields match everything; a
+// Team or Purpose only matches tagged tokens.
+type TokenFilter struct {
+	Team    string
+	Purpose string
+	// OlderThan matches tokens issued at least this long ago.
+	OlderThan time.Duration
+	// TaggedOnly excludes tokens whose names don't follow the convention.
+	TaggedOnly bool
+	// UnusedFor matches tokens not used for at least this long. Tokens never
+	// used match if they were issued that long ago.
+	UnusedFor time.Duration
+	// LastUsed fetches each token's LastUsedOn, at the cost of one request
+	// per token.
+	LastUsed bool
+	// Match is a glob the token name must match, e.g. "ci-*"; see path.Match.
+	Match string
+	// CreatedBefore matches tokens issued before this time.
+	CreatedBefore time.Time
+}
+
+func (f TokenFilter) matches(t TokenInfo, now time.Time) bool {
+	if (f.TaggedOnly || f.Team != "" || f.Purpose != "") && !t.Tagged {
+		return false
+	}
+	if f.Team != "" && t.Tags.Team != f.Team {
+		return false
+	}
+	if f.Purpose != "" && t.Tags.Purpose != f.Purpose {
+		return false
+	}
+	if f.OlderThan > 0 && (t.IssuedOn == nil || now.Sub(*t.IssuedOn) < f.OlderThan) {
+		return false
+	}
+	if f.UnusedFor > 0 && !unusedFor(t, f.UnusedFor, now) {
+		return false
+	}
+	if f.Match != "" {
+		if ok, _ := path.Match(f.Match, t.Name); !ok {
+			return false
+		}
+	}
+	if !f.CreatedBefore.IsZero() && (t.IssuedOn == nil || !t.IssuedOn.Before(f.CreatedBefore)) {
+		return false
+	}
+	return true
+}
+
+// unusedFor reports whether t hasn't been used for at least d.
+func unusedFor(t TokenInfo, d time.Duration, now time.Time) bool {
+	last := t.LastUsedOn
+	if last == nil {
+		last = t.IssuedOn
+	}
+	return last != nil && now.Sub(*last) >= d
+}
+
+// ListTokens returns the tokens visible to the parent token that match f.
+// Every token is listed from the API and filtered locally.
+func (g *Generator) ListTokens(ctx context.Context, f TokenFilter) ([]TokenInfo, error) {
+	if _, err := path.Match(f.Match, ""); err != nil {
+		return nil, fmt.Errorf("invalid name pattern %q: %w", f.Match, err)
+	}
+	tokens, err := g.api.APITokens(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tokens: %w", err)
+	}
+	now := time.Now()
+	var result []TokenInfo
+	for _, t := range tokens {
+		info := TokenInfo{APIToken: t}
+		info.Tags, info.Tagged = ParseTaggedName(t.Name)
+		if f.LastUsed || f.UnusedFor > 0 {
+			if info.LastUsedOn, err = g.LastUsed(ctx, t.ID); err != nil {
+				return nil, err
+			}
+		}
+		if f.matches(info, now) {
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+// LastUsed returns when the token was last used, or nil if it never has
+// been. The field is only available from the token detail endpoint.
+func (g *Generator) LastUsed(ctx context.Context, id string) (*time.Time, error) {
+	resp, err := g.api.Raw(ctx, http.MethodGet, "/user/tokens/"+id, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading token %s: %w", id, err)
+	}
+	var detail struct {
+		LastUsedOn *time.Time `json:"last_used_on"`
+	}
+	if err := json.Unmarshal(resp.Result, &detail); err != nil {
+		return nil, fmt.Errorf("decoding token %s: %w", id, err)
+	}
+	return detail.LastUsedOn, nil
+}
+
+// RevokeToken deletes the token with the given ID and exports the
+// revocation to any configured SIEM.
+func (g *Generator) RevokeToken(ctx context.Context, id string) (err error) {
+	ctx, op := g.startOp(ctx, "RevokeToken")
+	defer func() { op.end(&Token{ID: id}, err) }()
+	if err := g.api.DeleteAPIToken(ctx, id); err != nil {
+		return fmt.Errorf("revoking token %s: %w", id, err)
+	}
+	if err := g.exportAudit(ctx, AuditEvent{Action: AuditTokenRevoked, TokenID: id}); err != nil {
+		return fmt.Errorf("token %s was revoked, but %w", id, err)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package cftoken
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/jackmunro/cloudflare-token-generator"
+
+// telemetry holds the Generator's OpenTelemetry instruments. It is shared
+// with the HTTP client's transport, so SetTelemetry takes effect for API
+// calls too.
+type telemetry struct {
+	tracer      trace.Tracer
+	opDuration  metric.Float64Histogram
+	ops         metric.Int64Counter
+	apiDuration metric.Float64Histogram
+}
+
+func newTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) telemetry {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+	// Instrument creation only fails on invalid names; the instruments fall
+	// back to no-ops.
+	opDuration, _ := meter.Float64Histogram("cftoken.operation.duration",
+		metric.WithDescription("Duration of token operations."), metric.WithUnit("s"))
+	ops, _ := meter.Int64Counter("cftoken.operations",
+		metric.WithDescription("Token operations by operation and outcome."))
+	apiDuration, _ := meter.Float64Histogram("http.client.request.duration",
+		metric.WithDescription("Duration of Cloudflare API requests."), metric.WithUnit("s"))
+	return telemetry{
+		tracer:      tp.Tracer(instrumentationName),
+		opDuration:  opDuration,
+		ops:         ops,
+		apiDuration: apiDuration,
+	}
+}
+
+// SetTelemetry sets the providers for the Generator's spans and metrics. Nil
+// providers use the global ones from go.opentelemetry.io/otel, which is also
+// the default. Call it before the Generator is in use.
+//
+// Token operations (GenerateToken, GodModeToken, GenerateFromPermissions, and
+// RevokeToken) get a span and are counted in cftoken.operations and timed in
+// cftoken.operation.duration, by operation and outcome. Each API request gets
+// a child span and is timed in http.client.request.duration.
+func (g *Generator) SetTelemetry(tp trace.TracerProvider, mp metric.MeterProvider) {
+	*g.telemetry = newTelemetry(tp, mp)
+}
+
+// tokenOp is a token operation in progress.
+type tokenOp struct {
+	t     *telemetry
+	name  string
+	span  trace.Span
+	start time.Time
+}
+
+// startOp starts a span for the named operation.
+func (g *Generator) startOp(ctx context.Context, name string) (context.Context, tokenOp) {
+	ctx, span := g.telemetry.tracer.Start(ctx, "cftoken."+name)
+	return ctx, tokenOp{t: g.telemetry, name: name, span: span, start: time.Now()}
+}
+
+// end records the outcome of the operation. Token IDs and names are added to
+// the span; the secret never is.
+func (op tokenOp) end(t *Token, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	if t != nil {
+		op.span.SetAttributes(attribute.String("cftoken.token.id", t.ID))
+		if t.Name != "" {
+			op.span.SetAttributes(
+				attribute.String("cftoken.token.name", t.Name),
+				attribute.StringSlice("cftoken.services", t.Services),
+				attribute.String("cftoken.scope", t.Scope),
+				attribute.String("cftoken.level", t.Level),
+				attribute.Bool("cftoken.token.existing", t.Existing),
+				attribute.Bool("cftoken.token.rolled", t.Rolled),
+			)
+		}
+	}
+	op.span.End()
+	attrs := metric.WithAttributes(attribute.String("cftoken.operation", op.name), attribute.String("cftoken.outcome", outcome))
+	op.t.ops.Add(context.Background(), 1, attrs)
+	op.t.opDuration.Record(context.Background(), time.Since(op.start).Seconds(), attrs)
+}
+
+// tracingTransport wraps API requests in client spans.
+type tracingTransport struct {
+	base http.RoundTripper
+	t    *telemetry
+}
+
+func (tr tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tr.t.tracer.Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.String("url.path", req.URL.Path),
+		))
+	defer span.End()
+	start := time.Now()
+
+	resp, err := tr.base.RoundTrip(req.WithContext(ctx))
+
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Hostname()),
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
+	} else {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		attrs = append(attrs, attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= 400 {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	tr.t.apiDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	return resp, err
+}
+
+// errorType is a low-cardinality label for a transport error.
+func errorType(err error) string {
+	if strings.Contains(err.Error(), "timeout") {
+		return "timeout"
+	}
+	return "transport"
+}
@@ -0,0 +1,272 @@
+// Package timeparse parses the durations and times accepted on the command
+// line and in config files: Go durations extended with days, weeks, months,
+// and years ("90d", "6mo", "1w2d"), and times written as dates, RFC 3339,
+// offsets from now, or phrases such as "tomorrow-9am" and "next-friday-5pm".
+package timeparse
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Calendar units as fixed durations. Duration uses these; Time adds days,
+// weeks, months, and years on the calendar instead, so "+1mo" from January
+// 31 is March 3 (or 2 in a leap year) and "+1d" across a DST change keeps
+// the clock time.
+const (
+	Day   = 24 * time.Hour
+	Week  = 7 * Day
+	Month = 30 * Day
+	Year  = 365 * Day
+)
+
+// units are the duration suffixes, longest first so "mo" wins over "m".
+var units = []struct {
+	suffix string
+	unit   time.Duration
+	// years, months, days is the unit on the calendar, for Time.
+	years, months, days int
+}{
+	{"mo", Month, 0, 1, 0},
+	{"ms", time.Millisecond, 0, 0, 0},
+	{"y", Year, 1, 0, 0},
+	{"w", Week, 0, 0, 7},
+	{"d", Day, 0, 0, 1},
+	{"h", time.Hour, 0, 0, 0},
+	{"m", time.Minute, 0, 0, 0},
+	{"s", time.Second, 0, 0, 0},
+}
+
+// Duration parses a sequence of whole numbers with units: y (365 days), mo
+// (30 days), w, d, h, m, s, and ms, e.g. "90d", "6mo", or "1d12h". Any Go
+// duration, such as "1.5h", is accepted too. Negative durations are
+// rejected, as are durations over time.Duration's range of about 292
+// years.
+func Duration(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	var total time.Duration
+	err := walk(s, func(n, u int) error {
+		var err error
+		total, err = addUnits(total, n, units[u].unit)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// errTooLong is returned for durations time.Duration can't hold.
+var errTooLong = fmt.Errorf("too long (the maximum is about %d years)", math.MaxInt64/int64(Year))
+
+// addUnits returns total plus n units, or errTooLong if that overflows.
+// total and n are never negative.
+func addUnits(total time.Duration, n int, unit time.Duration) (time.Duration, error) {
+	if time.Duration(n) > (math.MaxInt64-total)/unit {
+		return 0, errTooLong
+	}
+	return total + time.Duration(n)*unit, nil
+}
+
+// walk calls fn for each number and unit index in s, stopping at the first
+// error fn returns.
+func walk(s string, fn func(n, unit int) error) error {
+	rest := strings.TrimSpace(strings.ToLower(s))
+	if rest == "" {
+		return fmt.Errorf("invalid duration %q", s)
+	}
+	for rest != "" {
+		i := 0
+		for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+			i++
+		}
+		if i == 0 {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		n, err := strconv.Atoi(rest[:i])
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", s)
+		}
+		rest = rest[i:]
+		u := -1
+		for j, unit := range units {
+			if strings.HasPrefix(rest, unit.suffix) {
+				u = j
+				break
+			}
+		}
+		if u < 0 {
+			return fmt.Errorf("invalid duration %q: units are y, mo, w, d, h, m, s, and ms", s)
+		}
+		rest = rest[len(units[u].suffix):]
+		if err := fn(n, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Time parses s relative to now, in now's location. It accepts:
+//
+//   - RFC 3339, e.g. "2025-01-31T17:00:00Z"
+//   - a date, "2025-01-31" (midnight), or a date and clock time,
+//     "2025-01-31 17:00" or "2025-01-31T17:00"
+//   - "now", "today", or "tomorrow"
+//   - a weekday, optionally prefixed with "next-": the first such day after
+//     today, so "friday" on a Friday is a week away
+//   - any of the last two followed by a clock time: "tomorrow-9am",
+//     "next-friday-5pm", "monday-17:30", "today-noon"
+//   - a duration from now, "7d" or "+7d", or before now, "-30d"
+//
+// Days without a clock time start at midnight.
+func Time(s string, now time.Time) (time.Time, error) {
+	in := strings.TrimSpace(s)
+	if in == "" {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	if t, err := time.Parse(time.RFC3339, in); err == nil {
+		return t, nil
+	}
+	loc := now.Location()
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, in, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	lower := strings.ToLower(in)
+	if len(lower) >= 10 && lower[4] == '-' && lower[7] == '-' {
+		// Shaped like a date, but none of the layouts matched.
+		return time.Time{}, fmt.Errorf("invalid time %q: write dates as 2025-01-31 or 2025-01-31 17:00", s)
+	}
+	if lower == "now" {
+		return now, nil
+	}
+	if t, ok, err := offset(lower, now); ok {
+		return t, err
+	}
+
+	next := strings.HasPrefix(lower, "next-")
+	day, clock, _ := strings.Cut(strings.TrimPrefix(lower, "next-"), "-")
+	if next && (day == "today" || day == "tomorrow") {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	var t time.Time
+	switch day {
+	case "today":
+		t = midnight
+	case "tomorrow":
+		t = midnight.AddDate(0, 0, 1)
+	default:
+		wd, ok := weekdays[day]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid time %q: use a date, RFC 3339, a duration like 7d, or e.g. next-friday-5pm", s)
+		}
+		ahead := (int(wd) - int(now.Weekday()) + 7) % 7
+		if ahead == 0 {
+			ahead = 7
+		}
+		t = midnight.AddDate(0, 0, ahead)
+	}
+	if clock == "" {
+		return t, nil
+	}
+	h, m, err := parseClock(clock)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: %w", s, err)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), h, m, 0, 0, loc), nil
+}
+
+// offset parses a duration from now, "+7d", "7d", or "-30d", reporting
+// false if s isn't one.
+func offset(s string, now time.Time) (time.Time, bool, error) {
+	sign := 1
+	rest := s
+	switch {
+	case strings.HasPrefix(s, "+"):
+		rest = s[1:]
+	case strings.HasPrefix(s, "-"):
+		sign, rest = -1, s[1:]
+	}
+	if rest == "" || rest[0] < '0' || rest[0] > '9' {
+		return time.Time{}, false, nil
+	}
+	if d, err := time.ParseDuration(rest); err == nil {
+		return now.Add(time.Duration(sign) * d), true, nil
+	}
+	t := now
+	var clock time.Duration
+	err := walk(rest, func(n, u int) error {
+		unit := units[u]
+		if unit.years == 0 && unit.months == 0 && unit.days == 0 {
+			var err error
+			if clock, err = addUnits(clock, n, unit.unit); err != nil {
+				return fmt.Errorf("invalid time %q: %w", s, err)
+			}
+			return nil
+		}
+		// Beyond year 9999 either way, t can't be written as RFC 3339.
+		if n > 10000*366 {
+			return fmt.Errorf("invalid time %q: too far from now", s)
+		}
+		t = t.AddDate(sign*n*unit.years, sign*n*unit.months, sign*n*unit.days)
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, true, err
+	}
+	t = t.Add(time.Duration(sign) * clock)
+	if t.Year() < 1 || t.Year() > 9999 {
+		return time.Time{}, true, fmt.Errorf("invalid time %q: too far from now", s)
+	}
+	return t, true, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseClock parses "5pm", "5:30pm", "17:00", "noon", or "midnight".
+func parseClock(s string) (hour, minute int, err error) {
+	switch s {
+	case "noon":
+		return 12, 0, nil
+	case "midnight":
+		return 0, 0, nil
+	}
+	for _, layout := range []string{"3pm", "3:04pm", "15:04", "15"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Hour(), t.Minute(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid clock time %q: use e.g. 5pm, 5:30pm, or 17:30", s)
+}
+
+// Location returns the named IANA time zone, or the local zone for "" and
+// "local".
+func Location(name string) (*time.Location, error) {
+	if name == "" || strings.EqualFold(name, "local") {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,146 @@
+package timeparse
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"90d", 90 * Day},
+		{"6mo", 6 * Month},
+		{"1y", Year},
+		{"2w", 2 * Week},
+		{"1d12h", Day + 12*time.Hour},
+		{"1w2d", 9 * Day},
+		{"30m", 30 * time.Minute},
+		{"500ms", 500 * time.Millisecond},
+		{"1.5h", 90 * time.Minute},
+		{"1h30m", 90 * time.Minute},
+		{" 7D ", 7 * Day},
+		{"0s", 0},
+	}
+	for _, tt := range tests {
+		got, err := Duration(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("Duration(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestDurationErrors(t *testing.T) {
+	tests := []struct {
+		in, err string
+	}{
+		{"", "invalid duration"},
+		{"d", "invalid duration"},
+		{"-1h", "invalid duration"},
+		{"-7d", "invalid duration"},
+		{"7x", "units are"},
+		{"1.5d", "units are"},
+		{"300y", "too long"},
+		{"106751d1d", "too long"},
+	}
+	for _, tt := range tests {
+		_, err := Duration(tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Duration(%q) error = %v, want one containing %q", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// Wednesday 2025-03-05 14:30 in New York, four days before DST starts.
+	now := time.Date(2025, 3, 5, 14, 30, 0, 0, loc)
+	date := func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, loc)
+	}
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"now", now},
+		{"NOW", now},
+		{"2025-01-31T17:00:00Z", time.Date(2025, 1, 31, 17, 0, 0, 0, time.UTC)},
+		{"2025-01-31", date(2025, 1, 31, 0, 0)},
+		{"2025-01-31 17:00", date(2025, 1, 31, 17, 0)},
+		{"2025-01-31T17:00", date(2025, 1, 31, 17, 0)},
+		{"today", date(2025, 3, 5, 0, 0)},
+		{"today-noon", date(2025, 3, 5, 12, 0)},
+		{"tomorrow", date(2025, 3, 6, 0, 0)},
+		{"tomorrow-9am", date(2025, 3, 6, 9, 0)},
+		{"tomorrow-midnight", date(2025, 3, 6, 0, 0)},
+		{"friday", date(2025, 3, 7, 0, 0)},
+		{"next-friday-5pm", date(2025, 3, 7, 17, 0)},
+		{"fri-5:30pm", date(2025, 3, 7, 17, 30)},
+		{"monday-17:30", date(2025, 3, 10, 17, 30)},
+		{"wednesday", date(2025, 3, 12, 0, 0)},
+		{"7d", date(2025, 3, 12, 14, 30)},
+		{"+7d", date(2025, 3, 12, 14, 30)},
+		{"-30d", date(2025, 2, 3, 14, 30)},
+		{"+1mo", date(2025, 4, 5, 14, 30)},
+		{"+1y", date(2026, 3, 5, 14, 30)},
+		{"+2h", now.Add(2 * time.Hour)},
+		{"+1d2h", date(2025, 3, 6, 16, 30)},
+		// Calendar days keep the clock time across the DST change on
+		// March 9, where 168 hours would land at 15:30.
+		{"+1w", date(2025, 3, 12, 14, 30)},
+	}
+	for _, tt := range tests {
+		got, err := Time(tt.in, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("Time(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+
+	// A month from January 31 overflows into March.
+	jan31 := date(2025, 1, 31, 0, 0)
+	if got, err := Time("+1mo", jan31); err != nil || !got.Equal(date(2025, 3, 3, 0, 0)) {
+		t.Errorf("Time(+1mo) from January 31 = %v, %v; want March 3", got, err)
+	}
+}
+
+func TestTimeErrors(t *testing.T) {
+	now := time.Date(2025, 3, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		in, err string
+	}{
+		{"", "invalid time"},
+		{"yesterday", "use a date"},
+		{"next-tomorrow", "invalid time"},
+		{"friday-25pm", "invalid clock time"},
+		{"friday-soon", "invalid clock time"},
+		{"+7x", "units are"},
+		{"+20000y", "too far"},
+		{"2025-13-01", "write dates as"},
+		{"2025-01-31 25:00", "write dates as"},
+	}
+	for _, tt := range tests {
+		_, err := Time(tt.in, now)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Time(%q) error = %v, want one containing %q", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	for _, name := range []string{"", "local", "Local"} {
+		if loc, err := Location(name); err != nil || loc != time.Local {
+			t.Errorf("Location(%q) = %v, %v; want Local", name, loc, err)
+		}
+	}
+	if loc, err := Location("UTC"); err != nil || loc.String() != "UTC" {
+		t.Errorf("Location(UTC) = %v, %v", loc, err)
+	}
+	if _, err := Location("Mars/Olympus"); err == nil {
+		t.Error("Location(Mars/Olympus) succeeded")
+	}
+}
@@ -0,0 +1,73 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TokenLimitError is returned instead of creating a token when the parent
+// already holds Limit tokens, which Cloudflare would reject with an unhelpful
+// error.
+type TokenLimitError struct {
+	Count int
+	Limit int
+	// Candidates are tokens gc would remove to make room.
+	Candidates []Garbage
+}
+
+func (e *TokenLimitError) Error() string {
+	msg := fmt.Sprintf("parent token's user already has %d API tokens (limit %d); revoke some first", e.Count, e.Limit)
+	if len(e.Candidates) == 0 {
+		return msg
+	}
+	names := make([]string, 0, 5)
+	for _, c := range e.Candidates {
+		if len(names) == cap(names) {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, fmt.Sprintf("%s (%s)", c.Name, c.Reason))
+	}
+	return fmt.Sprintf("%s; gc would remove %d: %s", msg, len(e.Candidates), strings.Join(names, ", "))
+}
+
+// NearTokenLimit reports whether the tokens counted when t was created are
+// within 10% of the limit.
+func (t *Token) NearTokenLimit() bool {
+	return t.TokenLimit > 0 && t.TokenCount*10 >= t.TokenLimit*9
+}
+
+// checkTokenLimit counts the tokens of p's user before p creates one, and
+// returns *TokenLimitError if there's no room for another. It returns the
+// count including the new token, or 0 when the limit is disabled.
+func (g *Generator) checkTokenLimit(ctx context.Context, p *parent) (int, error) {
+	if g.tokenLimit <= 0 {
+		return 0, nil
+	}
+	list := p.api.APITokens
+	if c := batchCacheFrom(ctx); c != nil {
+		list = func(ctx context.Context) ([]APIToken, error) { return c.listTokens(ctx, p.name, p.api.APITokens) }
+	}
+	tokens, err := list(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("counting tokens: %w", err)
+	}
+	if len(tokens) < g.tokenLimit {
+		return len(tokens) + 1, nil
+	}
+	// Suggestions are best effort; the limit error matters more. gc looks at
+	// api_token's user, so a full parent on another user gets none.
+	lerr := &TokenLimitError{Count: len(tokens), Limit: g.tokenLimit}
+	if p.name != "" {
+		return 0, lerr
+	}
+	inv, _ := LoadInventory()
+	garbage, _ := g.FindGarbage(ctx, GCOptions{Inventory: inv})
+	for _, c := range garbage {
+		if !c.Gone {
+			lerr.Candidates = append(lerr.Candidates, c)
+		}
+	}
+	return 0, lerr
+}
@@ -0,0 +1,67 @@
+package cftoken
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// countingBackend is a fakeBackend whose user holds tokens API tokens.
+type countingBackend struct {
+	fakeBackend
+	tokens int
+}
+
+func (f *countingBackend) APITokens(ctx context.Context) ([]APIToken, error) {
+	f.call()
+	return make([]APIToken, f.tokens), nil
+}
+
+// TestTokenLimitParent checks that tokens are counted for the parent that
+// creates the token, not api_token.
+func TestTokenLimitParent(t *testing.T) {
+	t.Setenv("CFTG_STATE_DIR", t.TempDir())
+	root := &countingBackend{tokens: 10}
+	dns := &countingBackend{tokens: 3}
+	cfg := Config{
+		APIToken:   "root",
+		AccountID:  "01a7362d577a6c3019a474fd6f485823",
+		TokenLimit: 10,
+		Parents:    []ParentToken{{Name: "dns", APIToken: "dns", Services: []string{"dns"}}},
+	}
+	g, err := NewWithBackend(cfg, func(cfg Config, _ *http.Client) (Backend, error) {
+		if cfg.APIToken == "dns" {
+			return dns, nil
+		}
+		return root, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	token, err := g.generateToken(ctx, []string{"dns"}, "all", "read", WithZones("example.com"))
+	if err != nil {
+		t.Fatalf("dns parent has room, got %v", err)
+	}
+	if token.Parent != "dns" || token.TokenCount != 4 {
+		t.Errorf("got parent %q with %d tokens, want dns with 4", token.Parent, token.TokenCount)
+	}
+
+	_, err = g.generateToken(ctx, []string{"workers"}, "all", "read")
+	var lerr *TokenLimitError
+	if !errors.As(err, &lerr) || lerr.Count != 10 {
+		t.Errorf("api_token is full, got %v", err)
+	}
+
+	// Without a limit nothing is counted.
+	g.tokenLimit = 0
+	before := root.calls.Load()
+	if _, err := g.generateToken(ctx, []string{"workers"}, "all", "read"); err != nil {
+		t.Fatal(err)
+	}
+	if n := root.calls.Load() - before; n != 1 {
+		t.Errorf("create without a limit made %d requests, want 1", n)
+	}
+}
@@ -0,0 +1,215 @@
+package cftoken
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ImportedValue records where ImportToolCredentials found a config value.
+type ImportedValue struct {
+	// Key is the config key: "api_token", "account_id", or "zone_id".
+	Key  string
+	Path string
+}
+
+// ToolImport is what ImportToolCredentials found.
+type ToolImport struct {
+	// Config has APIToken, AccountID, and ZoneID set where found.
+	Config   Config
+	Sources  []ImportedValue
+	Warnings []string
+}
+
+// ImportToolCredentials collects credentials left by wrangler and cloudflared,
+// so users of those tools don't have to enter them again. In order of
+// precedence it reads the CLOUDFLARE_API_TOKEN and CLOUDFLARE_ACCOUNT_ID
+// environment variables, dir/.dev.vars, and wrangler's global config. Account
+// and zone IDs are also taken from cloudflared's origin certificate and tunnel
+// credentials in ~/.cloudflared. Wrangler OAuth logins are skipped with a
+// warning, since an OAuth token can't create API tokens.
+func ImportToolCredentials(dir string) (*ToolImport, error) {
+	imp := &ToolImport{}
+
+	imp.set("api_token", os.Getenv("CLOUDFLARE_API_TOKEN"), "$CLOUDFLARE_API_TOKEN")
+	imp.set("account_id", os.Getenv("CLOUDFLARE_ACCOUNT_ID"), "$CLOUDFLARE_ACCOUNT_ID")
+
+	devVars := filepath.Join(dir, ".dev.vars")
+	vars, err := readDotenv(devVars)
+	if err != nil {
+		return nil, err
+	}
+	imp.set("api_token", vars["CLOUDFLARE_API_TOKEN"], devVars)
+	imp.set("account_id", vars["CLOUDFLARE_ACCOUNT_ID"], devVars)
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range wranglerConfigPaths(home) {
+		if err := imp.readWranglerConfig(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := imp.readCloudflared(filepath.Join(home, ".cloudflared")); err != nil {
+		return nil, err
+	}
+	return imp, nil
+}
+
+// set records value for key from path unless key is already set.
+func (imp *ToolImport) set(key, value, path string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	var field *string
+	switch key {
+	case "api_token":
+		field = &imp.Config.APIToken
+	case "account_id":
+		field = &imp.Config.AccountID
+	case "zone_id":
+		field = &imp.Config.ZoneID
+	}
+	if *field != "" {
+		return
+	}
+	*field = value
+	imp.Sources = append(imp.Sources, ImportedValue{Key: key, Path: path})
+}
+
+// wranglerConfigPaths returns where wrangler versions keep their global
+// config: the legacy ~/.wrangler and the current per-OS config directory.
+func wranglerConfigPaths(home string) []string {
+	paths := []string{filepath.Join(home, ".wrangler", "config", "default.toml")}
+	switch runtime.GOOS {
+	case "darwin":
+		paths = append(paths, filepath.Join(home, "Library", "Preferences", ".wrangler", "config", "default.toml"))
+	case "windows":
+		if appData := os.Getenv("APPDATA"); appData != "" {
+			paths = append(paths, filepath.Join(appData, "xdg.config", ".wrangler", "config", "default.toml"))
+		}
+	default:
+		configHome := os.Getenv("XDG_CONFIG_HOME")
+		if configHome == "" {
+			configHome = filepath.Join(home, ".config")
+		}
+		paths = append(paths, filepath.Join(configHome, ".wrangler", "config", "default.toml"))
+	}
+	return paths
+}
+
+func (imp *ToolImport) readWranglerConfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var cfg struct {
+		APIToken   string `toml:"api_token"`
+		OAuthToken string `toml:"oauth_token"`
+	}
+	if err := toml.Unmarshal(data, &cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+	imp.set("api_token", cfg.APIToken, path)
+	if cfg.APIToken == "" && cfg.OAuthToken != "" {
+		imp.Warnings = append(imp.Warnings, fmt.Sprintf("%s holds a wrangler OAuth login, which can't create API tokens; skipped", path))
+	}
+	return nil
+}
+
+// readCloudflared takes account and zone IDs from cloudflared's origin
+// certificate, and the account ID from tunnel credentials files. The
+// certificate's own token only works for tunnels, so it isn't imported.
+func (imp *ToolImport) readCloudflared(dir string) error {
+	certPath := filepath.Join(dir, "cert.pem")
+	data, err := os.ReadFile(certPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		for rest := data; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+			if block.Type != "ARGO TUNNEL TOKEN" {
+				continue
+			}
+			var token struct {
+				ZoneID    string `json:"zoneID"`
+				AccountID string `json:"accountID"`
+			}
+			if err := json.Unmarshal(block.Bytes, &token); err != nil {
+				return fmt.Errorf("parsing %s: %w", certPath, err)
+			}
+			imp.set("account_id", token.AccountID, certPath)
+			imp.set("zone_id", token.ZoneID, certPath)
+		}
+	}
+
+	creds, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, path := range creds {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var tunnel struct {
+			AccountTag string `json:"AccountTag"`
+		}
+		// Other JSON files in the directory aren't tunnel credentials.
+		if json.Unmarshal(data, &tunnel) == nil {
+			imp.set("account_id", tunnel.AccountTag, path)
+		}
+	}
+	return nil
+}
+
+// readDotenv parses KEY=value lines, as in wrangler's .dev.vars. Blank lines
+// and # comments are skipped, and values may be quoted. A missing file yields
+// no variables.
+func readDotenv(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+	return vars, scanner.Err()
+}
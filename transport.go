@@ -0,0 +1,83 @@
+package cftoken
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Transport is an http.RoundTripper that authenticates Cloudflare API requests
+// with a short-lived token it mints on first use and replaces shortly before
+// it expires, so a program never handles a long-lived credential itself.
+// Requests to other hosts pass through untouched.
+type Transport struct {
+	gen      *Generator
+	base     http.RoundTripper
+	services []string
+	scope    string
+	level    string
+	ttl      time.Duration
+	opts     []Option
+
+	mu      sync.Mutex
+	current *Token
+}
+
+// transportHost is the only host Transport adds credentials for.
+const transportHost = "api.cloudflare.com"
+
+// NewTransport returns a Transport minting tokens for services, scope, and
+// level that live for ttl (at least a minute). A nil base uses
+// http.DefaultTransport. opts are applied to every minted token; WithTTL is
+// set by the Transport.
+func (g *Generator) NewTransport(base http.RoundTripper, services []string, scope, level string, ttl time.Duration, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if ttl < time.Minute {
+		ttl = time.Minute
+	}
+	return &Transport{
+		gen:      g,
+		base:     base,
+		services: services,
+		scope:    scope,
+		level:    level,
+		ttl:      ttl,
+		opts:     opts,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Hostname() != transportHost {
+		return t.base.RoundTrip(req)
+	}
+	token, err := t.token()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Del("X-Auth-Key")
+	req.Header.Del("X-Auth-Email")
+	return t.base.RoundTrip(req)
+}
+
+// token returns the current token value, minting a new one when there is none
+// or the current one is in the last fifth of its lifetime.
+func (t *Transport) token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.current != nil && t.current.ExpiresOn != nil && time.Until(*t.current.ExpiresOn) > t.ttl/5 {
+		return t.current.Value, nil
+	}
+	opts := append(append([]Option(nil), t.opts...), WithTTL(t.ttl))
+	token, err := t.gen.GenerateToken(t.services, t.scope, t.level, opts...)
+	if err != nil {
+		return "", fmt.Errorf("minting token for transport: %w", err)
+	}
+	t.current = token
+	return token.Value, nil
+}
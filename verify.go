@@ -0,0 +1,186 @@
+package cftoken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackmunro/cloudflare-token-generator/policy"
+)
+
+// ProbeResult is the outcome of exercising one service with a new token.
+type ProbeResult struct {
+	Service string
+	// Skipped is set when the service has no read endpoint to probe or no
+	// resource was available to probe it against.
+	Skipped bool
+	Reason  string
+	Err     error
+}
+
+// probeTarget holds the resources a probe runs against.
+type probeTarget struct {
+	zoneID    string
+	accountID string
+}
+
+var errNoTarget = fmt.Errorf("no resource to probe")
+
+// probes maps service keys to a representative read endpoint, with {zone}
+// or {account} standing for the resource it's probed against.
+var probes = map[string]string{
+	"dns":          "/zones/{zone}/dns_records",
+	"zone":         "/zones/{zone}",
+	"firewall":     "/zones/{zone}/firewall/rules",
+	"ssl":          "/zones/{zone}/ssl/certificate_packs",
+	"waf":          "/zones/{zone}/rulesets",
+	"loadbalancer": "/zones/{zone}/load_balancers",
+	"pagerules":    "/zones/{zone}/pagerules",
+	"snippets":     "/zones/{zone}/snippets",
+	"waitingroom":  "/zones/{zone}/waiting_rooms",
+	"workers":      "/accounts/{account}/workers/scripts",
+	"kv":           "/accounts/{account}/storage/kv/namespaces",
+	"r2":           "/accounts/{account}/r2/buckets",
+	"pages":        "/accounts/{account}/pages/projects",
+	"d1":           "/accounts/{account}/d1/database",
+	"queues":       "/accounts/{account}/queues",
+	"ai":           "/accounts/{account}/ai/models/search",
+	"stream":       "/accounts/{account}/stream",
+	"images":       "/accounts/{account}/images/v1",
+	"tunnels":      "/accounts/{account}/cfd_tunnel",
+	"billing":      "/accounts/{account}/billing/profile",
+	"account":      "/accounts/{account}",
+	"members":      "/accounts/{account}/members",
+	"dns-firewall": "/accounts/{account}/dns_firewall",
+}
+
+// endpoint fills in the resource of a probe endpoint, or returns
+// errNoTarget if t has none of the kind it needs.
+func (t probeTarget) endpoint(probe string) (string, error) {
+	switch {
+	case strings.Contains(probe, "{zone}"):
+		if t.zoneID == "" {
+			return "", errNoTarget
+		}
+		return strings.Replace(probe, "{zone}", url.PathEscape(t.zoneID), 1), nil
+	case strings.Contains(probe, "{account}"):
+		if t.accountID == "" {
+			return "", errNoTarget
+		}
+		return strings.Replace(probe, "{account}", url.PathEscape(t.accountID), 1), nil
+	}
+	return probe, nil
+}
+
+// probeAttempts and probeBackoff control retries while a new token propagates.
+const (
+	probeAttempts = 4
+	probeBackoff  = time.Second
+)
+
+// VerifyToken uses the new token to call a representative read endpoint for
+// each of its services, catching propagation delays and scoping mistakes right
+// after creation. Zones and accounts to probe are taken from the token's
+// policies, falling back to the configured defaults. Services without a read
+// endpoint are reported as skipped.
+func (g *Generator) VerifyToken(ctx context.Context, t *Token) []ProbeResult {
+	api, err := g.newBackend(Config{APIToken: t.Value}, g.client)
+	if err != nil {
+		return []ProbeResult{{Service: strings.Join(t.Services, ","), Err: err}}
+	}
+
+	target := g.probeTarget(ctx, api, t.Policies)
+
+	services := append([]string(nil), t.Services...)
+	sort.Strings(services)
+
+	var results []ProbeResult
+	for _, svc := range services {
+		p, ok := probes[svc]
+		if !ok {
+			results = append(results, ProbeResult{Service: svc, Skipped: true, Reason: "no read endpoint to probe"})
+			continue
+		}
+		endpoint, err := target.endpoint(p)
+		if err == errNoTarget {
+			results = append(results, ProbeResult{Service: svc, Skipped: true, Reason: "no zone or account to probe"})
+			continue
+		}
+		err = retryProbe(ctx, func() error {
+			_, err := api.Raw(ctx, http.MethodGet, endpoint, nil, nil)
+			return err
+		})
+		results = append(results, ProbeResult{Service: svc, Err: err})
+	}
+	return results
+}
+
+// probeTarget picks a zone and account to probe from the token's policies.
+// Wildcard zone policies fall back to the configured zone, or the first zone
+// the new token can list.
+func (g *Generator) probeTarget(ctx context.Context, api Backend, policies []policy.Policy) probeTarget {
+	var t probeTarget
+	wildcardZone := false
+	visit := func(key string) {
+		switch {
+		case key == "com.cloudflare.api.account.zone.*":
+			wildcardZone = true
+		case strings.HasPrefix(key, "com.cloudflare.api.account.zone."):
+			if t.zoneID == "" {
+				t.zoneID = strings.TrimPrefix(key, "com.cloudflare.api.account.zone.")
+			}
+		case strings.HasPrefix(key, "com.cloudflare.api.account."):
+			if t.accountID == "" {
+				t.accountID = strings.TrimPrefix(key, "com.cloudflare.api.account.")
+			}
+		}
+	}
+	for _, pol := range policies {
+		for key, value := range pol.Resources {
+			visit(key)
+			// Zones within an account resource's subset.
+			if subset, ok := value.(map[string]interface{}); ok {
+				for sub := range subset {
+					visit(sub)
+				}
+			}
+		}
+	}
+	if t.zoneID == "" && wildcardZone {
+		t.zoneID = g.zoneID
+		if t.zoneID == "" {
+			var zones []Zone
+			err := retryProbe(ctx, func() error {
+				var err error
+				zones, err = api.ListZones(ctx)
+				return err
+			})
+			if err == nil && len(zones) > 0 {
+				t.zoneID = zones[0].ID
+			}
+		}
+	}
+	return t
+}
+
+// retryProbe retries fn with exponential backoff, since a freshly created
+// token can take a few seconds to become usable.
+func retryProbe(ctx context.Context, fn func() error) error {
+	var err error
+	backoff := probeBackoff
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || err == errNoTarget || attempt == probeAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,5 @@
+package webhookclient
+
+// The client is generated from the same OpenAPI document the server serves
+// at /openapi.yaml. Edit api/eso-webhook.yaml, not webhookclient.gen.go.
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.4.1 -config oapi-codegen.yaml ../api/eso-webhook.yaml
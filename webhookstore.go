@@ -0,0 +1,106 @@
+package cftoken
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// Webhook request statuses recorded in a WebhookStore.
+const (
+	WebhookPending = "pending"
+	WebhookIssued  = "issued"
+	WebhookFailed  = "failed"
+	// WebhookInterrupted marks a request that was still pending when the
+	// webhook stopped; its token may or may not have been created.
+	WebhookInterrupted = "interrupted"
+)
+
+// WebhookRecord is a token request accepted by the webhook and what became
+// of it.
+type WebhookRecord struct {
+	ID        string     `json:"id"`
+	Requester string     `json:"requester"`
+	Services  []string   `json:"services"`
+	Scope     string     `json:"scope"`
+	Level     string     `json:"level"`
+	Status    string     `json:"status"`
+	TokenID   string     `json:"token_id,omitempty"`
+	TokenName string     `json:"token_name,omitempty"`
+	ExpiresOn *time.Time `json:"expires_on,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// WebhookStore keeps the webhook's state across restarts: the requests it
+// has accepted and the signature nonces it has seen. The boltstore package
+// keeps it in a local file, and the redisstore package in Redis for
+// replicas to share.
+type WebhookStore interface {
+	// PutRequest creates or replaces the record with r.ID.
+	PutRequest(ctx context.Context, r WebhookRecord) error
+	// Requests returns the records with the given status, or every record
+	// if status is empty, oldest first.
+	Requests(ctx context.Context, status string) ([]WebhookRecord, error)
+	// UseNonce marks key as used for ttl and reports whether it was unused.
+	UseNonce(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Prune deletes records whose token expired, or which ended without
+	// one, before the given time, and nonces past their ttl.
+	Prune(ctx context.Context, before time.Time) error
+	// Ping reports whether the store can be used.
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// webhookRecordRetention is how long the webhook keeps a record after its
+// token expired, or after it failed or was interrupted.
+const webhookRecordRetention = 7 * 24 * time.Hour
+
+// Prunable reports whether the record no longer matters as of before: its
+// token expired, or it ended without a token and was last updated, before
+// then. Pending records are kept until RecoverWebhookRequests marks them.
+// WebhookStore implementations use it in Prune.
+func (r WebhookRecord) Prunable(before time.Time) bool {
+	switch r.Status {
+	case WebhookPending:
+		return false
+	case WebhookIssued:
+		return r.ExpiresOn != nil && r.ExpiresOn.Before(before)
+	}
+	return r.UpdatedAt.Before(before)
+}
+
+// RecoverWebhookRequests marks requests left pending for longer than
+// olderThan as interrupted and returns them, so the operator can check
+// whether their tokens were created. Call it before serving. With a store
+// of its own, a process can pass zero, since anything pending was left by a
+// previous run; with a shared store, pass longer than any request takes, so
+// other replicas' requests in flight are left alone.
+func RecoverWebhookRequests(ctx context.Context, store WebhookStore, olderThan time.Duration) ([]WebhookRecord, error) {
+	pending, err := store.Requests(ctx, WebhookPending)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var interrupted []WebhookRecord
+	for _, r := range pending {
+		if now.Sub(r.UpdatedAt) < olderThan {
+			continue
+		}
+		r.Status = WebhookInterrupted
+		r.UpdatedAt = now
+		if err := store.PutRequest(ctx, r); err != nil {
+			return nil, err
+		}
+		interrupted = append(interrupted, r)
+	}
+	return interrupted, nil
+}
+
+func newWebhookRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package cftoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var zoneIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Errors from matchZones for entries that match nothing.
+var (
+	errNoZonesMatch = errors.New("no zones match")
+	errZoneNotFound = errors.New("not found")
+)
+
+// ZoneGroup lists the members of a zone group. Each entry is a zone ID, a
+// zone name, or a glob pattern over zone names such as "*.example.com". In
+// YAML a group is either a list of entries or a single pattern string.
+type ZoneGroup []string
+
+// UnmarshalYAML accepts a single string as a one-entry group.
+func (zg *ZoneGroup) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*zg = ZoneGroup{node.Value}
+		return nil
+	}
+	var entries []string
+	if err := node.Decode(&entries); err != nil {
+		return err
+	}
+	*zg = entries
+	return nil
+}
+
+// ResolveZoneGroup returns the zone IDs in the named zone group. Zone names
+// and patterns are resolved against the zones the parent token can list at
+// call time, so pattern groups pick up zones as they are added.
+func (g *Generator) ResolveZoneGroup(ctx context.Context, name string) ([]string, error) {
+	entries, ok := g.zoneGroups[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown zone group %q", name)
+	}
+	ids, err := g.resolveZones(ctx, entries)
+	if err != nil {
+		return nil, fmt.Errorf("zone group %q: %w", name, err)
+	}
+	return ids, nil
+}
+
+// resolveZones returns the zone IDs for entries, each a zone ID, a zone name,
+// or a glob pattern over zone names. Zones are only listed when an entry
+// isn't an ID.
+func (g *Generator) resolveZones(ctx context.Context, entries []string) ([]string, error) {
+	var zones []Zone
+	var err error
+	if slices.ContainsFunc(entries, func(e string) bool { return !zoneIDPattern.MatchString(e) }) {
+		zones, err = g.MatchZones(ctx, entries)
+	} else {
+		zones, err = matchZones(entries, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(zones))
+	for i, z := range zones {
+		ids[i] = z.ID
+	}
+	return ids, nil
+}
+
+// MatchZones returns the zones matching entries, each a zone ID, a zone
+// name, or a glob pattern over zone names, in entry order and without
+// duplicates. Zones are listed with the parent token.
+func (g *Generator) MatchZones(ctx context.Context, entries []string) ([]Zone, error) {
+	zones, err := g.DiscoverZones(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing zones: %w", err)
+	}
+	return matchZones(entries, zones)
+}
+
+// matchZones matches entries against zones. IDs the parent can't list are
+// kept, without a name.
+func matchZones(entries []string, zones []Zone) ([]Zone, error) {
+	var matched []Zone
+	seen := make(map[string]bool)
+	add := func(z Zone) {
+		if !seen[z.ID] {
+			seen[z.ID] = true
+			matched = append(matched, z)
+		}
+	}
+
+	for _, entry := range entries {
+		if zoneIDPattern.MatchString(entry) {
+			z := Zone{ID: entry}
+			for _, listed := range zones {
+				if listed.ID == entry {
+					z = listed
+					break
+				}
+			}
+			add(z)
+			continue
+		}
+
+		if isZonePattern(entry) {
+			if _, err := path.Match(entry, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q", entry)
+			}
+			for _, z := range zones {
+				if ok, _ := path.Match(entry, z.Name); ok {
+					add(z)
+				}
+			}
+			continue
+		}
+
+		found := false
+		for _, z := range zones {
+			if z.Name == entry {
+				add(z)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("zone %q %w", entry, errZoneNotFound)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, errNoZonesMatch
+	}
+	return matched, nil
+}
+
+func isZonePattern(entry string) bool {
+	return strings.ContainsAny(entry, "*?[")
+}
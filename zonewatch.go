@@ -0,0 +1,126 @@
+package cftoken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// KnownZones is the state kept by watch-zones: the zones already onboarded,
+// by ID, with their names.
+type KnownZones map[string]string
+
+// KnownZonesPath returns the default watch-zones state file, in the state
+// directory.
+func KnownZonesPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "known-zones.json"), nil
+}
+
+// LoadKnownZones reads a state file. A missing file returns nil, so a first
+// run can be told apart from an account without zones.
+func LoadKnownZones(path string) (KnownZones, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := KnownZones{}
+	if err := json.Unmarshal(data, &known); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return known, nil
+}
+
+// Save writes the state file with mode 0600.
+func (k KnownZones) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Unknown returns the zones not in k, in order.
+func (k KnownZones) Unknown(zones []Zone) []Zone {
+	var unknown []Zone
+	for _, z := range zones {
+		if _, ok := k[z.ID]; !ok {
+			unknown = append(unknown, z)
+		}
+	}
+	return unknown
+}
+
+// ZoneOnboardedEvent reports the tokens generated for a new zone.
+type ZoneOnboardedEvent struct {
+	Time   time.Time            `json:"time"`
+	Env    string               `json:"env,omitempty"`
+	Zone   string               `json:"zone"`
+	ZoneID string               `json:"zone_id"`
+	Tokens []ZoneOnboardedToken `json:"tokens"`
+	Failed int                  `json:"failed"`
+	// Text is a one-line summary, so chat incoming webhooks can post the
+	// event as is.
+	Text string `json:"text"`
+}
+
+// ZoneOnboardedToken is one token in a ZoneOnboardedEvent. The secret is
+// never included.
+type ZoneOnboardedToken struct {
+	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
+	Status string `json:"status"`
+	Sink   string `json:"sink,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// NewZoneOnboardedEvent summarizes the batch results for zone.
+func NewZoneOnboardedEvent(env string, zone Zone, results []BatchResult) ZoneOnboardedEvent {
+	e := ZoneOnboardedEvent{
+		Time:   time.Now().UTC().Truncate(time.Second),
+		Env:    env,
+		Zone:   zone.Name,
+		ZoneID: zone.ID,
+	}
+	var names []string
+	for _, r := range results {
+		t := ZoneOnboardedToken{Name: r.Entry.Name, Status: string(r.Status)}
+		if r.Token != nil {
+			t.ID = r.Token.ID
+		}
+		if r.Delivered {
+			t.Sink = r.Entry.Sink
+		}
+		if r.Err != nil {
+			t.Error = r.Err.Error()
+			e.Failed++
+		}
+		e.Tokens = append(e.Tokens, t)
+		names = append(names, r.Entry.Name)
+	}
+	e.Text = fmt.Sprintf("New zone %s: generated %s", zone.Name, strings.Join(names, ", "))
+	if e.Failed > 0 {
+		e.Text = fmt.Sprintf("New zone %s: %d of %d tokens failed (%s)", zone.Name, e.Failed, len(results), strings.Join(names, ", "))
+	}
+	return e
+}
+
+// NotifyZoneOnboarded sends e to url as a JSON POST.
+func (g *Generator) NotifyZoneOnboarded(ctx context.Context, url string, e ZoneOnboardedEvent) error {
+	return g.postWebhook(ctx, url, e)
+}